@@ -0,0 +1,311 @@
+// Package cardform serves a hosted card entry page, so raw card numbers never reach the main app.
+//
+// The main app redirects customer's browser to a signed session URL, the page validates the card, saves it with a
+// CreditCardManager (or a vault), optionally starts 3D Secure 2.0 authentication, then redirects back with only the card token.
+//
+//	handler := cardform.New(Paygent, secret)
+//	http.Handle("/cards/new", handler)
+//
+//	// main app
+//	http.Redirect(w, r, handler.SessionURL("https://pay.example.com/cards/new", cardform.Session{CustomerID: "c1", State: state, ReturnURL: "https://example.com/cards"}), http.StatusSeeOther)
+//
+//	// ReturnURL, customer id and state are the ones kept in main app's session
+//	result, err := handler.VerifyReturn(r.URL.Query(), "c1", state)
+package cardform
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"html/template"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/qor/gomerchant"
+)
+
+// Vault saves credit cards, gomerchant.CreditCardManager is a vault
+type Vault interface {
+	CreateCreditCard(creditCardParams gomerchant.CreateCreditCardParams) (gomerchant.CreditCardResponse, error)
+}
+
+// ThreeDSecure starts 3D Secure 2.0 authentication, like Paygent
+type ThreeDSecure interface {
+	Start3DS2Authentication(ctx context.Context, params gomerchant.Start3DS2AuthenticationParams) (gomerchant.Start3DS2AuthenticationResponse, error)
+}
+
+// Handler card entry page
+type Handler struct {
+	Vault        Vault
+	ThreeDSecure ThreeDSecure // optional, 3D Secure 2.0 authentication is started if session has amount
+	Secret       []byte       // key of signed sessions, CSRF tokens and return params, should be shared with main app
+
+	Template *template.Template // executed with FormData, default DefaultTemplate
+	Brands   []string           // accepted brands of gomerchant.Brands, default all of them
+	BaseURL  string             // public URL of the handler, used as term URL of 3D Secure, default scheme, host and path of request
+
+	ReturnTTL time.Duration // return params expire after it, default 10 minutes
+
+	// ThreeDSAuthIDField form field of 3D Secure authentication id posted by ACS, default "3ds_auth_id" of Paygent
+	ThreeDSAuthIDField string
+
+	Logger *log.Logger // default log.Default(), card numbers and security codes are never logged
+	Now    func() time.Time
+}
+
+// FormData data of card entry template
+type FormData struct {
+	Session   Session
+	CSRFToken string
+	Nonce     string // CSP nonce of inline styles and scripts
+	Brands    []string
+	Values    FormValues // submitted values, card number and security code are never filled back
+	Errors    map[string]string
+}
+
+// FormValues submitted values that are filled back to the form
+type FormValues struct {
+	Name     string
+	ExpMonth string
+	ExpYear  string
+}
+
+const csrfCookie = "gomerchant_cardform_csrf"
+
+// New initialize card entry handler
+func New(vault Vault, secret []byte) *Handler {
+	handler := &Handler{Vault: vault, Secret: secret}
+	if threeDSecure, ok := vault.(ThreeDSecure); ok {
+		handler.ThreeDSecure = threeDSecure
+	}
+	return handler
+}
+
+func (handler *Handler) now() time.Time {
+	if handler.Now != nil {
+		return handler.Now()
+	}
+	return time.Now()
+}
+
+func (handler *Handler) logf(format string, args ...interface{}) {
+	logger := handler.Logger
+	if logger == nil {
+		logger = log.Default()
+	}
+	logger.Printf(format, args...)
+}
+
+// ServeHTTP serve card entry page, card submission and 3D Secure returns
+func (handler *Handler) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
+	header := writer.Header()
+	header.Set("Cache-Control", "no-store")
+	header.Set("X-Content-Type-Options", "nosniff")
+	header.Set("X-Frame-Options", "DENY")
+	header.Set("Referrer-Policy", "no-referrer")
+
+	if len(handler.Secret) == 0 {
+		handler.logf("cardform: secret is required")
+		http.Error(writer, "card entry is not configured", http.StatusInternalServerError)
+		return
+	}
+
+	request.Body = http.MaxBytesReader(writer, request.Body, 64<<10)
+
+	switch {
+	case request.Method == http.MethodPost && request.URL.Query().Get("three_ds") != "":
+		handler.completeThreeDSecure(writer, request)
+	case request.Method == http.MethodGet, request.Method == http.MethodHead:
+		handler.form(writer, request)
+	case request.Method == http.MethodPost:
+		handler.submit(writer, request)
+	default:
+		header.Set("Allow", "GET, HEAD, POST")
+		http.Error(writer, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+	}
+}
+
+func randomString(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// render render card entry form with a new CSRF token
+func (handler *Handler) render(writer http.ResponseWriter, request *http.Request, status int, data FormData) {
+	nonce := randomString(16)
+	csrf := randomString(24)
+	http.SetCookie(writer, &http.Cookie{
+		Name:     csrfCookie,
+		Value:    csrf,
+		Path:     request.URL.Path,
+		HttpOnly: true,
+		Secure:   request.TLS != nil || request.Header.Get("X-Forwarded-Proto") == "https",
+		SameSite: http.SameSiteStrictMode,
+	})
+
+	data.Nonce = nonce
+	data.CSRFToken = handler.mac("csrf", csrf+"\x00"+request.URL.Query().Get("session"))
+	data.Brands = handler.Brands
+	if data.Errors == nil {
+		data.Errors = map[string]string{}
+	}
+
+	writer.Header().Set("Content-Security-Policy", "default-src 'none'; style-src 'nonce-"+nonce+"'; script-src 'nonce-"+nonce+"'; img-src 'self' data:; form-action 'self'; frame-ancestors 'none'; base-uri 'none'")
+	writer.Header().Set("Content-Type", "text/html; charset=utf-8")
+	writer.WriteHeader(status)
+
+	tmpl := handler.Template
+	if tmpl == nil {
+		tmpl = DefaultTemplate
+	}
+	if err := tmpl.Execute(writer, data); err != nil {
+		handler.logf("cardform: failed to render template: %v", err)
+	}
+}
+
+func (handler *Handler) form(writer http.ResponseWriter, request *http.Request) {
+	session, err := handler.session(request.URL.Query().Get("session"))
+	if err != nil {
+		http.Error(writer, err.Error(), http.StatusBadRequest)
+		return
+	}
+	handler.render(writer, request, http.StatusOK, FormData{Session: session})
+}
+
+func (handler *Handler) submit(writer http.ResponseWriter, request *http.Request) {
+	session, err := handler.session(request.URL.Query().Get("session"))
+	if err != nil {
+		http.Error(writer, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := request.ParseForm(); err != nil {
+		http.Error(writer, "invalid form", http.StatusBadRequest)
+		return
+	}
+
+	cookie, err := request.Cookie(csrfCookie)
+	if err != nil || !validCSRFToken(request.PostForm.Get("csrf_token"), handler.mac("csrf", cookie.Value+"\x00"+request.URL.Query().Get("session"))) {
+		http.Error(writer, "invalid CSRF token, reload the page and try again", http.StatusForbidden)
+		return
+	}
+
+	values := FormValues{
+		Name:     strings.TrimSpace(request.PostForm.Get("name")),
+		ExpMonth: strings.TrimSpace(request.PostForm.Get("exp_month")),
+		ExpYear:  strings.TrimSpace(request.PostForm.Get("exp_year")),
+	}
+	creditCard, errs := handler.validate(values, request.PostForm.Get("number"), request.PostForm.Get("cvc"))
+	if len(errs) > 0 {
+		handler.render(writer, request, http.StatusUnprocessableEntity, FormData{Session: session, Values: values, Errors: errs})
+		return
+	}
+
+	response, err := handler.Vault.CreateCreditCard(gomerchant.CreateCreditCardParams{CustomerID: session.CustomerID, CreditCard: creditCard})
+	if err != nil {
+		// errors of gateways describe fields, not values, never log the request
+		handler.logf("cardform: failed to save card of customer %v: %v", session.CustomerID, err)
+		handler.render(writer, request, http.StatusUnprocessableEntity, FormData{Session: session, Values: values, Errors: map[string]string{"card": errorMessage(err)}})
+		return
+	}
+
+	result := Result{CreditCardID: response.CreditCardID}
+	if session.Amount > 0 && handler.ThreeDSecure != nil {
+		if handler.startThreeDSecure(writer, request, session, result) {
+			return
+		}
+		result.Error = "three_ds_failed"
+	}
+	handler.redirect(writer, request, session, result)
+}
+
+func validCSRFToken(token, expected string) bool {
+	return token != "" && hmac.Equal([]byte(token), []byte(expected))
+}
+
+func (handler *Handler) redirect(writer http.ResponseWriter, request *http.Request, session Session, result Result) {
+	returnURL, err := handler.returnURL(session, result)
+	if err != nil {
+		http.Error(writer, "invalid return URL", http.StatusBadRequest)
+		return
+	}
+	http.Redirect(writer, request, returnURL, http.StatusSeeOther)
+}
+
+// validate validate submitted card, returns errors of fields
+func (handler *Handler) validate(values FormValues, number, cvc string) (*gomerchant.CreditCard, map[string]string) {
+	var (
+		errs       = map[string]string{}
+		creditCard = &gomerchant.CreditCard{Name: values.Name, Number: digits(number), CVC: strings.TrimSpace(cvc)}
+	)
+
+	if !creditCard.ValidNumber() {
+		errs["number"] = "Card number is invalid"
+	} else if brand := creditCard.Brand(); brand == "" || !handler.acceptBrand(brand) {
+		errs["number"] = "Card brand is not supported"
+	}
+
+	month, err := strconv.ParseUint(values.ExpMonth, 10, 8)
+	if err != nil || month < 1 || month > 12 {
+		errs["exp_month"] = "Expiration month is invalid"
+	}
+	year, err := strconv.ParseUint(values.ExpYear, 10, 16)
+	if err == nil && len(values.ExpYear) == 2 {
+		year += 2000
+	}
+	if err != nil || (len(values.ExpYear) != 2 && len(values.ExpYear) != 4) {
+		errs["exp_year"] = "Expiration year is invalid"
+	} else if now := handler.now(); errs["exp_month"] == "" && (int(year) < now.Year() || (int(year) == now.Year() && int(month) < int(now.Month()))) {
+		errs["exp_year"] = "Card has expired"
+	}
+	creditCard.ExpMonth, creditCard.ExpYear = uint(month), uint(year)
+
+	if len(creditCard.CVC) < 3 || len(creditCard.CVC) > 4 || digits(creditCard.CVC) != creditCard.CVC {
+		errs["cvc"] = "Security code is invalid"
+	}
+	return creditCard, errs
+}
+
+func (handler *Handler) acceptBrand(brand string) bool {
+	if len(handler.Brands) == 0 {
+		return true
+	}
+	for _, b := range handler.Brands {
+		if b == brand {
+			return true
+		}
+	}
+	return false
+}
+
+// digits remove spaces and dashes that customers might type, other characters are kept so the number is invalid
+func digits(number string) string {
+	return strings.NewReplacer(" ", "", "-", "").Replace(strings.TrimSpace(number))
+}
+
+var cardErrorMessages = map[error]string{
+	gomerchant.ErrInvalidNumber:      "Card number is invalid",
+	gomerchant.ErrIncorrectNumber:    "Card number is incorrect",
+	gomerchant.ErrInvalidExpiryMonth: "Expiration month is invalid",
+	gomerchant.ErrInvalidExpiryYear:  "Expiration year is invalid",
+	gomerchant.ErrExpiredCard:        "Card has expired",
+	gomerchant.ErrInvalidCVC:         "Security code is invalid",
+	gomerchant.ErrIncorrectCVC:       "Security code is incorrect",
+	gomerchant.ErrCardDeclined:       "Card was declined",
+}
+
+// errorMessage message of vault error that is shown to customers, details of gateways are not shown
+func errorMessage(err error) string {
+	for e, message := range cardErrorMessages {
+		if errors.Is(err, e) {
+			return message
+		}
+	}
+	return "Card couldn't be saved, please check it and try again"
+}
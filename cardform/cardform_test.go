@@ -0,0 +1,223 @@
+package cardform_test
+
+import (
+	"bytes"
+	"html"
+	"io"
+	"log"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/qor/gomerchant"
+	"github.com/qor/gomerchant/cardform"
+	"github.com/qor/gomerchant/gateways/paygent/paygenttest"
+)
+
+const returnURL = "https://example.com/cards/return"
+
+type testForm struct {
+	*httptest.Server
+	handler *cardform.Handler
+	paygent *paygenttest.Server
+	client  *http.Client
+	logs    *bytes.Buffer
+}
+
+func newTestForm(t *testing.T) *testForm {
+	simulator := paygenttest.NewServer()
+	t.Cleanup(simulator.Close)
+
+	var logs bytes.Buffer
+	handler := cardform.New(simulator.Paygent(), []byte("secret"))
+	handler.Logger = log.New(&logs, "", 0)
+
+	mux := http.NewServeMux()
+	mux.Handle("/cards/new", handler)
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	jar, _ := cookiejar.New(nil)
+	return &testForm{
+		Server:  server,
+		handler: handler,
+		paygent: simulator,
+		logs:    &logs,
+		client: &http.Client{Jar: jar, CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		}},
+	}
+}
+
+func (form *testForm) sessionURL(session cardform.Session) string {
+	session.ReturnURL = returnURL
+	return form.handler.SessionURL(form.URL+"/cards/new", session)
+}
+
+var csrfToken = regexp.MustCompile(`name="csrf_token" value="([^"]+)"`)
+
+// open open form, returns CSRF token
+func (form *testForm) open(t *testing.T, sessionURL string) string {
+	t.Helper()
+	response, err := form.client.Get(sessionURL)
+	if err != nil {
+		t.Fatalf("failed to open form, got %v", err)
+	}
+	defer response.Body.Close()
+	body, _ := io.ReadAll(response.Body)
+
+	if response.StatusCode != http.StatusOK {
+		t.Fatalf("failed to open form, got %v %s", response.StatusCode, body)
+	}
+	if csp := response.Header.Get("Content-Security-Policy"); !strings.Contains(csp, "frame-ancestors 'none'") || !strings.Contains(csp, "form-action 'self'") {
+		t.Errorf("form should be protected by CSP, got %v", csp)
+	}
+	matches := csrfToken.FindSubmatch(body)
+	if matches == nil {
+		t.Fatalf("form should have CSRF token, got %s", body)
+	}
+	return html.UnescapeString(string(matches[1]))
+}
+
+func (form *testForm) submit(t *testing.T, sessionURL string, values url.Values) (*http.Response, string) {
+	t.Helper()
+	response, err := form.client.PostForm(sessionURL, values)
+	if err != nil {
+		t.Fatalf("failed to submit form, got %v", err)
+	}
+	defer response.Body.Close()
+	body, _ := io.ReadAll(response.Body)
+	return response, string(body)
+}
+
+func cardValues(csrf, number string) url.Values {
+	return url.Values{"csrf_token": {csrf}, "name": {"Jinzhu"}, "number": {number}, "exp_month": {"12"}, "exp_year": {time.Now().AddDate(1, 0, 0).Format("06")}, "cvc": {"123"}}
+}
+
+func TestSaveCard(t *testing.T) {
+	form := newTestForm(t)
+	sessionURL := form.sessionURL(cardform.Session{CustomerID: "c1", State: "s1"})
+	csrf := form.open(t, sessionURL)
+
+	response, body := form.submit(t, sessionURL, cardValues(csrf, "4242 4242 4242 4241"))
+	if response.StatusCode != http.StatusUnprocessableEntity || !strings.Contains(body, "Card number is invalid") {
+		t.Errorf("invalid number should be rejected, got %v %v", response.StatusCode, body)
+	}
+	if strings.Contains(body, "4241") || !strings.Contains(body, "Jinzhu") {
+		t.Errorf("name should be filled back, but card number shouldn't, got %v", body)
+	}
+
+	// token is renewed after submission
+	csrf = csrfToken.FindStringSubmatch(body)[1]
+	response, _ = form.submit(t, sessionURL, cardValues(csrf, "4242 4242 4242 4242"))
+	location, _ := url.Parse(response.Header.Get("Location"))
+	if response.StatusCode != http.StatusSeeOther || !strings.HasPrefix(location.String(), returnURL) {
+		t.Fatalf("should redirect to return URL, got %v %v", response.StatusCode, location)
+	}
+
+	result, err := form.handler.VerifyReturn(location.Query(), "c1", "s1")
+	if err != nil || result.CreditCardID == "" || result.CustomerID != "c1" || result.State != "s1" {
+		t.Fatalf("return params should be verified, got %#v %v", result, err)
+	}
+	for key := range location.Query() {
+		if key != "card_id" && key != "customer_id" && key != "state" && key != "exp" && key != "signature" {
+			t.Errorf("only card token should be returned, got %v", location.Query())
+		}
+	}
+
+	cards, err := form.paygent.Paygent().ListCreditCards(gomerchant.ListCreditCardsParams{CustomerID: "c1"})
+	if err != nil || len(cards.CreditCards) != 1 || cards.CreditCards[0].CreditCardID != result.CreditCardID {
+		t.Errorf("card should be saved, got %v %v", cards.CreditCards, err)
+	}
+
+	query := location.Query()
+	query.Set("card_id", "another")
+	if _, err := form.handler.VerifyReturn(query, "c1", "s1"); err != cardform.ErrInvalidSignature {
+		t.Errorf("tampered return params should be rejected, got %v", err)
+	}
+
+	// return params can't be replayed for another customer or session
+	if _, err := form.handler.VerifyReturn(location.Query(), "c2", "s1"); err != cardform.ErrReturnMismatch {
+		t.Errorf("return params of another customer should be rejected, got %v", err)
+	}
+	if _, err := form.handler.VerifyReturn(location.Query(), "c1", "s2"); err != cardform.ErrReturnMismatch {
+		t.Errorf("return params of another session should be rejected, got %v", err)
+	}
+	if _, err := form.handler.VerifyReturn(location.Query(), "c1", ""); err != cardform.ErrStateRequired {
+		t.Errorf("state should be required, got %v", err)
+	}
+
+	form.handler.Now = func() time.Time { return time.Now().Add(11 * time.Minute) }
+	if _, err := form.handler.VerifyReturn(location.Query(), "c1", "s1"); err != cardform.ErrExpiredReturn {
+		t.Errorf("expired return params should be rejected, got %v", err)
+	}
+}
+
+func TestSecurity(t *testing.T) {
+	form := newTestForm(t)
+	sessionURL := form.sessionURL(cardform.Session{CustomerID: "c1", State: "s1"})
+	csrf := form.open(t, sessionURL)
+
+	if response, _ := form.submit(t, sessionURL, cardValues("", "4242424242424242")); response.StatusCode != http.StatusForbidden {
+		t.Errorf("request without CSRF token should be forbidden, got %v", response.StatusCode)
+	}
+
+	tampered := strings.Replace(sessionURL, "session=", "session=x", 1)
+	if response, _ := form.submit(t, tampered, cardValues(csrf, "4242424242424242")); response.StatusCode != http.StatusBadRequest {
+		t.Errorf("tampered session should be rejected, got %v", response.StatusCode)
+	}
+
+	expired := form.handler.SessionURL(form.URL+"/cards/new", cardform.Session{CustomerID: "c1", State: "s1", ReturnURL: returnURL, ExpiresAt: time.Now().Add(-time.Minute)})
+	if response, _ := form.client.Get(expired); response.StatusCode != http.StatusBadRequest {
+		t.Errorf("expired session should be rejected, got %v", response.StatusCode)
+	}
+
+	if response, _ := form.client.Get(form.sessionURL(cardform.Session{CustomerID: "c1"})); response.StatusCode != http.StatusBadRequest {
+		t.Errorf("session without state should be rejected, got %v", response.StatusCode)
+	}
+
+	// card number is never logged, even if the gateway failed
+	form.paygent.InjectFailure("025", paygenttest.Failure{ResponseCode: "P003", Times: 1})
+	response, body := form.submit(t, sessionURL, cardValues(csrf, "4242424242424242"))
+	if response.StatusCode != http.StatusUnprocessableEntity || !strings.Contains(body, "please check it") {
+		t.Errorf("gateway failure should be shown, got %v %v", response.StatusCode, body)
+	}
+	if form.logs.Len() == 0 || strings.Contains(form.logs.String(), "4242424242424242") || strings.Contains(body, "4242424242424242") {
+		t.Errorf("card number should never be logged or responded, got %v", form.logs.String())
+	}
+}
+
+var formAction = regexp.MustCompile(`action="([^"]+)"`)
+
+func TestThreeDSecure(t *testing.T) {
+	form := newTestForm(t)
+	sessionURL := form.sessionURL(cardform.Session{CustomerID: "c1", State: "s1", Amount: 1000, OrderID: "order-1"})
+	csrf := form.open(t, sessionURL)
+
+	response, body := form.submit(t, sessionURL, cardValues(csrf, "4242424242424242"))
+	matches := formAction.FindStringSubmatch(body)
+	if response.StatusCode != http.StatusOK || matches == nil {
+		t.Fatalf("should respond ACS page, got %v %v", response.StatusCode, body)
+	}
+
+	// simulated ACS posts authentication id to term URL
+	values := url.Values{}
+	for _, input := range regexp.MustCompile(`name="([^"]+)" value="([^"]+)"`).FindAllStringSubmatch(body, -1) {
+		values.Set(html.UnescapeString(input[1]), html.UnescapeString(input[2]))
+	}
+	response, _ = form.submit(t, html.UnescapeString(matches[1]), values)
+	location, _ := url.Parse(response.Header.Get("Location"))
+	if response.StatusCode != http.StatusSeeOther {
+		t.Fatalf("should redirect to return URL after 3D Secure, got %v", response.StatusCode)
+	}
+
+	result, err := form.handler.VerifyReturn(location.Query(), "c1", "s1")
+	if err != nil || result.CreditCardID == "" || result.ThreeDSAuthID == "" || result.Error != "" {
+		t.Errorf("should return 3D Secure authentication id, got %#v %v", result, err)
+	}
+}
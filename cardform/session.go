@@ -0,0 +1,178 @@
+package cardform
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrInvalidSession session token is malformed, tampered or signed with another secret
+	ErrInvalidSession = errors.New("cardform: invalid session")
+	// ErrExpiredSession session token has expired
+	ErrExpiredSession = errors.New("cardform: session has expired")
+	// ErrStateRequired session has no state, so its return params can't be bound to main app's session
+	ErrStateRequired = errors.New("cardform: session state is required")
+	// ErrInvalidSignature signature of return params is invalid
+	ErrInvalidSignature = errors.New("cardform: invalid signature")
+	// ErrExpiredReturn return params have expired
+	ErrExpiredReturn = errors.New("cardform: return params have expired")
+	// ErrReturnMismatch return params are signed for another customer or session
+	ErrReturnMismatch = errors.New("cardform: return params are for another customer or session")
+)
+
+// Session card entry session created by main app, it is signed so customers can't change it
+type Session struct {
+	CustomerID string    `json:"customer_id"`
+	ReturnURL  string    `json:"return_url"` // customer's browser is redirected to it with the card token
+	State      string    `json:"state"`      // required, passed back to ReturnURL as is, like a random value kept in main app's session
+	ExpiresAt  time.Time `json:"expires_at"`
+
+	// 3D Secure 2.0 authentication is started for the saved card if amount is given and handler has ThreeDSecure
+	Amount  uint64 `json:"amount,omitempty"`
+	OrderID string `json:"order_id,omitempty"`
+}
+
+// Result result of card entry, params of ReturnURL
+type Result struct {
+	CreditCardID  string
+	CustomerID    string
+	State         string
+	ThreeDSAuthID string    // id of 3D Secure 2.0 authentication, use it as ThreeDSAuthID of SavedCreditCard when authorizing
+	Error         string    // error code if 3D Secure failed, the card is saved anyway
+	ExpiresAt     time.Time // return params can't be verified after it
+}
+
+func (result Result) values() url.Values {
+	values := url.Values{}
+	for key, value := range map[string]string{"card_id": result.CreditCardID, "customer_id": result.CustomerID, "state": result.State, "three_ds_auth_id": result.ThreeDSAuthID, "error": result.Error} {
+		if value != "" {
+			values.Set(key, value)
+		}
+	}
+	if !result.ExpiresAt.IsZero() {
+		values.Set("exp", strconv.FormatInt(result.ExpiresAt.Unix(), 10))
+	}
+	return values
+}
+
+// SessionURL URL of card entry page for session, baseURL is where the handler is mounted
+func (handler *Handler) SessionURL(baseURL string, session Session) string {
+	if session.ExpiresAt.IsZero() {
+		session.ExpiresAt = handler.now().Add(30 * time.Minute)
+	}
+
+	separator := "?"
+	if strings.Contains(baseURL, "?") {
+		separator = "&"
+	}
+	return baseURL + separator + url.Values{"session": {handler.sign("session", session)}}.Encode()
+}
+
+// VerifyReturn verify query of ReturnURL, so main app could trust the card token that is passed through customer's browser,
+// customerID and state should be the ones of the session, kept in main app's session, so return params can't be replayed for another customer
+func (handler *Handler) VerifyReturn(query url.Values, customerID, state string) (Result, error) {
+	if state == "" {
+		return Result{}, ErrStateRequired
+	}
+
+	exp, err := strconv.ParseInt(query.Get("exp"), 10, 64)
+	if err != nil {
+		return Result{}, ErrInvalidSignature
+	}
+
+	result := Result{
+		CreditCardID:  query.Get("card_id"),
+		CustomerID:    query.Get("customer_id"),
+		State:         query.Get("state"),
+		ThreeDSAuthID: query.Get("three_ds_auth_id"),
+		Error:         query.Get("error"),
+		ExpiresAt:     time.Unix(exp, 0),
+	}
+
+	values := result.values()
+	if !hmac.Equal([]byte(query.Get("signature")), []byte(handler.mac("return", values.Encode()))) {
+		return Result{}, ErrInvalidSignature
+	}
+	if handler.now().After(result.ExpiresAt) {
+		return Result{}, ErrExpiredReturn
+	}
+	if !hmac.Equal([]byte(result.CustomerID), []byte(customerID)) || !hmac.Equal([]byte(result.State), []byte(state)) {
+		return Result{}, ErrReturnMismatch
+	}
+	return result, nil
+}
+
+func (handler *Handler) returnURL(session Session, result Result) (string, error) {
+	returnURL, err := url.Parse(session.ReturnURL)
+	if err != nil {
+		return "", err
+	}
+
+	result.CustomerID, result.State = session.CustomerID, session.State
+	result.ExpiresAt = handler.now().Add(handler.returnTTL())
+	values := result.values()
+	query := returnURL.Query()
+	for key := range values {
+		query.Set(key, values.Get(key))
+	}
+	query.Set("signature", handler.mac("return", values.Encode()))
+	returnURL.RawQuery = query.Encode()
+	return returnURL.String(), nil
+}
+
+func (handler *Handler) returnTTL() time.Duration {
+	if handler.ReturnTTL > 0 {
+		return handler.ReturnTTL
+	}
+	return 10 * time.Minute
+}
+
+// mac HMAC of value, scoped by purpose so a signature of one purpose can't be used for another
+func (handler *Handler) mac(purpose, value string) string {
+	h := hmac.New(sha256.New, handler.Secret)
+	h.Write([]byte(purpose + "\x00" + value))
+	return base64.RawURLEncoding.EncodeToString(h.Sum(nil))
+}
+
+func (handler *Handler) sign(purpose string, value interface{}) string {
+	data, _ := json.Marshal(value)
+	payload := base64.RawURLEncoding.EncodeToString(data)
+	return payload + "." + handler.mac(purpose, payload)
+}
+
+func (handler *Handler) verify(purpose, token string, value interface{}) error {
+	payload, signature, ok := strings.Cut(token, ".")
+	if !ok || !hmac.Equal([]byte(signature), []byte(handler.mac(purpose, payload))) {
+		return ErrInvalidSession
+	}
+
+	data, err := base64.RawURLEncoding.DecodeString(payload)
+	if err == nil {
+		err = json.Unmarshal(data, value)
+	}
+	if err != nil {
+		return ErrInvalidSession
+	}
+	return nil
+}
+
+func (handler *Handler) session(token string) (Session, error) {
+	var session Session
+	if err := handler.verify("session", token, &session); err != nil {
+		return session, err
+	}
+	if handler.now().After(session.ExpiresAt) {
+		return session, ErrExpiredSession
+	}
+	if session.State == "" {
+		return session, ErrStateRequired
+	}
+	return session, nil
+}
@@ -0,0 +1,51 @@
+package cardform
+
+import "html/template"
+
+// DefaultTemplate default card entry form, fields are name, number, exp_month, exp_year, cvc and csrf_token,
+// inline styles and scripts should have nonce of FormData, as they are blocked by Content-Security-Policy otherwise
+var DefaultTemplate = template.Must(template.New("cardform").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>Card</title>
+<style nonce="{{.Nonce}}">
+body { font-family: system-ui, sans-serif; max-width: 24rem; margin: 2rem auto; padding: 0 1rem; }
+label { display: block; margin-top: 1rem; }
+input { box-sizing: border-box; width: 100%; padding: .5rem; font-size: 1rem; }
+.row { display: flex; gap: .5rem; }
+.error { color: #b00020; font-size: .875rem; }
+button { margin-top: 1.5rem; width: 100%; padding: .75rem; font-size: 1rem; }
+</style>
+</head>
+<body>
+<form method="POST" autocomplete="on" novalidate>
+<input type="hidden" name="csrf_token" value="{{.CSRFToken}}">
+{{with .Errors.card}}<p class="error">{{.}}</p>{{end}}
+<label>Name on card
+<input name="name" autocomplete="cc-name" value="{{.Values.Name}}">
+</label>
+<label>Card number
+<input name="number" inputmode="numeric" autocomplete="cc-number" required>
+</label>
+{{with .Errors.number}}<p class="error">{{.}}</p>{{end}}
+<div class="row">
+<label>Month
+<input name="exp_month" inputmode="numeric" autocomplete="cc-exp-month" placeholder="MM" maxlength="2" value="{{.Values.ExpMonth}}" required>
+</label>
+<label>Year
+<input name="exp_year" inputmode="numeric" autocomplete="cc-exp-year" placeholder="YY" maxlength="4" value="{{.Values.ExpYear}}" required>
+</label>
+<label>Security code
+<input name="cvc" inputmode="numeric" autocomplete="cc-csc" maxlength="4" required>
+</label>
+</div>
+{{with .Errors.exp_month}}<p class="error">{{.}}</p>{{end}}
+{{with .Errors.exp_year}}<p class="error">{{.}}</p>{{end}}
+{{with .Errors.cvc}}<p class="error">{{.}}</p>{{end}}
+<button type="submit">Save card</button>
+</form>
+</body>
+</html>
+`))
@@ -0,0 +1,78 @@
+package cardform
+
+import (
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/qor/gomerchant"
+)
+
+// threeDSecureState state of 3D Secure authentication, signed in term URL as ACS posts back without cookies
+type threeDSecureState struct {
+	Session      Session   `json:"session"`
+	CreditCardID string    `json:"credit_card_id"`
+	ExpiresAt    time.Time `json:"expires_at"`
+}
+
+func (handler *Handler) baseURL(request *http.Request) string {
+	if handler.BaseURL != "" {
+		return handler.BaseURL
+	}
+
+	scheme := "http"
+	if request.TLS != nil || request.Header.Get("X-Forwarded-Proto") == "https" {
+		scheme = "https"
+	}
+	return scheme + "://" + request.Host + request.URL.Path
+}
+
+// startThreeDSecure start 3D Secure 2.0 authentication of saved card, and serve ACS page of gateway, returns false if it failed
+func (handler *Handler) startThreeDSecure(writer http.ResponseWriter, request *http.Request, session Session, result Result) bool {
+	state := handler.sign("three_ds", threeDSecureState{Session: session, CreditCardID: result.CreditCardID, ExpiresAt: handler.now().Add(30 * time.Minute)})
+	termURL := handler.baseURL(request) + "?" + url.Values{"three_ds": {state}}.Encode()
+
+	response, err := handler.ThreeDSecure.Start3DS2Authentication(request.Context(), gomerchant.Start3DS2AuthenticationParams{
+		TermURL:       termURL,
+		OrderID:       session.OrderID,
+		Amount:        session.Amount,
+		PaymentMethod: &gomerchant.PaymentMethod{SavedCreditCard: &gomerchant.SavedCreditCard{CustomerID: session.CustomerID, CreditCardID: result.CreditCardID}},
+	})
+	if err != nil || response.OutAcsHTML == "" {
+		handler.logf("cardform: failed to start 3D Secure of card %v of customer %v: %v", result.CreditCardID, session.CustomerID, err)
+		return false
+	}
+
+	// page of gateway submits a form to ACS on load
+	writer.Header().Set("Content-Security-Policy", "default-src 'none'; script-src 'unsafe-inline'; style-src 'unsafe-inline'; form-action https: 'self'; frame-ancestors 'none'; base-uri 'none'")
+	writer.Header().Set("Content-Type", "text/html; charset=utf-8")
+	io.WriteString(writer, response.OutAcsHTML)
+	return true
+}
+
+// completeThreeDSecure redirect back with 3D Secure authentication id posted by ACS
+func (handler *Handler) completeThreeDSecure(writer http.ResponseWriter, request *http.Request) {
+	var state threeDSecureState
+	if err := handler.verify("three_ds", request.URL.Query().Get("three_ds"), &state); err != nil {
+		http.Error(writer, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if handler.now().After(state.ExpiresAt) {
+		http.Error(writer, ErrExpiredSession.Error(), http.StatusBadRequest)
+		return
+	}
+
+	field := handler.ThreeDSAuthIDField
+	if field == "" {
+		field = "3ds_auth_id"
+	}
+
+	result := Result{CreditCardID: state.CreditCardID}
+	if err := request.ParseForm(); err == nil && request.PostForm.Get(field) != "" {
+		result.ThreeDSAuthID = request.PostForm.Get(field)
+	} else {
+		result.Error = "three_ds_failed"
+	}
+	handler.redirect(writer, request, state.Session, result)
+}
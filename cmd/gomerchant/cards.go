@@ -0,0 +1,101 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/qor/gomerchant"
+)
+
+func (app *App) cards(args []string) error {
+	if len(args) == 0 {
+		fmt.Fprintln(app.Stderr, "usage: gomerchant cards list|get|create|delete [flags]")
+		return errUsage
+	}
+
+	var (
+		flags = app.flagSet("cards " + args[0])
+		card  cardFlags
+	)
+	card.bind(flags)
+	if _, err := parse(flags, args[1:], 0); err != nil {
+		return err
+	}
+	if err := requireFlag("customer", card.customer); err != nil {
+		return err
+	}
+
+	var run func(manager gomerchant.CreditCardManager) error
+	switch args[0] {
+	case "list":
+		run = func(manager gomerchant.CreditCardManager) error {
+			response, err := manager.ListCreditCards(gomerchant.ListCreditCardsParams{CustomerID: card.customer})
+			if err != nil {
+				return err
+			}
+
+			cards := []map[string]interface{}{}
+			for _, creditCard := range response.CreditCards {
+				cards = append(cards, cardOutput(creditCard))
+			}
+			return app.print(cards)
+		}
+	case "get":
+		if err := requireFlag("card", card.card); err != nil {
+			return err
+		}
+		run = func(manager gomerchant.CreditCardManager) error {
+			response, err := manager.GetCreditCard(gomerchant.GetCreditCardParams{CustomerID: card.customer, CreditCardID: card.card})
+			if err != nil {
+				return err
+			}
+			return app.print(cardOutput(response.CreditCard))
+		}
+	case "create":
+		creditCard, err := app.readCard(&card)
+		if err != nil {
+			return err
+		}
+		run = func(manager gomerchant.CreditCardManager) error {
+			response, err := manager.CreateCreditCard(gomerchant.CreateCreditCardParams{CustomerID: card.customer, CreditCard: creditCard})
+			if err != nil {
+				return err
+			}
+			return app.print(map[string]interface{}{"customer_id": response.CustomerID, "credit_card_id": response.CreditCardID})
+		}
+	case "delete":
+		if err := requireFlag("card", card.card); err != nil {
+			return err
+		}
+		run = func(manager gomerchant.CreditCardManager) error {
+			if err := app.confirm("Delete card %v of customer %v?", card.card, card.customer); err != nil {
+				return err
+			}
+			if _, err := manager.DeleteCreditCard(gomerchant.DeleteCreditCardParams{CustomerID: card.customer, CreditCardID: card.card}); err != nil {
+				return err
+			}
+			return app.print(map[string]interface{}{"customer_id": card.customer, "credit_card_id": card.card, "deleted": true})
+		}
+	default:
+		fmt.Fprintf(app.Stderr, "unknown cards command %q, should be list, get, create or delete\n", args[0])
+		return errUsage
+	}
+
+	gateways, err := app.open()
+	if err != nil {
+		return err
+	}
+	return run(gateways.CreditCardManager)
+}
+
+func cardOutput(card *gomerchant.CustomerCreditCard) map[string]interface{} {
+	if card == nil {
+		return map[string]interface{}{}
+	}
+	return map[string]interface{}{
+		"customer_id":    card.CustomerID,
+		"credit_card_id": card.CreditCardID,
+		"masked_number":  card.MaskedNumber,
+		"brand":          card.Brand,
+		"exp":            fmt.Sprintf("%02d/%d", card.ExpMonth, card.ExpYear),
+	}
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/jinzhu/configor"
+	"github.com/qor/gomerchant"
+	"github.com/qor/gomerchant/gateways/paygent"
+	"github.com/qor/gomerchant/gateways/stripe"
+)
+
+// Config config of gateways, loaded from config file and environment variables with prefix GOMERCHANT
+//
+//	gateway: paygent
+//	paygent:
+//	  merchantid: "12345"
+//	  connectid: test
+//	  connectpassword: secret
+//	  clientfilepath: paygent.pem
+//	  certpassword: changeit
+//	  cafilepath: curl-ca-bundle.crt
+//	stripe:
+//	  key: sk_test_xxx
+//	server:
+//	  addr: ":8080"
+//	  apikeys: [sk_live_xxx]
+type Config struct {
+	Gateway string `default:"paygent"` // stripe or paygent
+
+	Stripe struct {
+		Key string
+		URL string
+	}
+
+	Paygent struct {
+		MerchantID           string
+		ConnectID            string
+		ConnectPassword      string
+		MerchantName         string
+		TelegramVersion      string
+		ThreeDSAcceptanceKey string
+		CertPassword         string
+		ClientFilePath       string
+		CAFilePath           string
+		ProductionMode       bool
+		SecurityCodeUse      bool
+		ServiceDomain        string
+	}
+
+	Server struct {
+		Addr    string `default:":8080"`
+		BaseURL string
+		APIKeys []string
+	}
+}
+
+// LoadConfig load config from files and environment variables
+func LoadConfig(files ...string) (*Config, error) {
+	config := &Config{}
+	err := configor.New(&configor.Config{ENVPrefix: "GOMERCHANT"}).Load(config, files...)
+	return config, err
+}
+
+// Gateways opened gateways
+type Gateways struct {
+	Name              string
+	PaymentGateway    gomerchant.PaymentGateway
+	CreditCardManager gomerchant.CreditCardManager
+	Paygent           *paygent.Paygent // nil if gateway isn't paygent
+	Config            *Config
+}
+
+// OpenGateways open gateway of config
+func OpenGateways(config *Config) (*Gateways, error) {
+	switch config.Gateway {
+	case "stripe":
+		if config.Stripe.Key == "" {
+			return nil, errors.New("stripe key is required, set GOMERCHANT_STRIPE_KEY or stripe.key in config file")
+		}
+		gateway := stripe.New(&stripe.Config{Key: config.Stripe.Key, URL: config.Stripe.URL})
+		return &Gateways{Name: "stripe", PaymentGateway: gateway, CreditCardManager: gateway}, nil
+	case "paygent":
+		c := config.Paygent
+		if c.MerchantID == "" || c.ConnectID == "" || c.ConnectPassword == "" {
+			return nil, errors.New("paygent merchant id, connect id and connect password are required, set GOMERCHANT_PAYGENT_* or paygent in config file")
+		}
+		gateway := paygent.New(&paygent.Config{
+			MerchantID:           c.MerchantID,
+			ConnectID:            c.ConnectID,
+			ConnectPassword:      c.ConnectPassword,
+			MerchantName:         c.MerchantName,
+			TelegramVersion:      c.TelegramVersion,
+			ThreeDSAcceptanceKey: c.ThreeDSAcceptanceKey,
+			CertPassword:         c.CertPassword,
+			ClientFilePath:       c.ClientFilePath,
+			CAFilePath:           c.CAFilePath,
+			ProductionMode:       c.ProductionMode,
+			SecurityCodeUse:      c.SecurityCodeUse,
+			ServiceDomain:        c.ServiceDomain,
+		})
+		return &Gateways{Name: "paygent", PaymentGateway: gateway, CreditCardManager: gateway, Paygent: gateway}, nil
+	}
+	return nil, fmt.Errorf("unknown gateway %q, should be stripe or paygent", config.Gateway)
+}
+
+// open load config and open gateways once
+func (app *App) open() (*Gateways, error) {
+	if app.gateways != nil {
+		return app.gateways, nil
+	}
+
+	var files []string
+	if app.configFile != "" {
+		files = append(files, app.configFile)
+	}
+
+	config, err := LoadConfig(files...)
+	if err != nil {
+		return nil, err
+	}
+	if app.gateway != "" {
+		config.Gateway = app.gateway
+	}
+
+	open := app.Open
+	if open == nil {
+		open = OpenGateways
+	}
+	if app.gateways, err = open(config); err == nil && app.gateways.Config == nil {
+		app.gateways.Config = config
+	}
+	return app.gateways, err
+}
@@ -0,0 +1,200 @@
+// Command gomerchant operates payments with configured gateway, like refunding or voiding a payment without writing a program.
+//
+//	gomerchant [-config gomerchant.yml] [-gateway paygent] [-output table] [-yes] <command> [flags] [args]
+//
+// Commands:
+//
+//	authorize -amount 1000 -currency JPY -order order-1 (-exp 12/30 | -customer c1 -card card1)
+//	capture <transaction_id>
+//	refund -amount 100 [-captured] <transaction_id>
+//	void [-captured] <transaction_id>
+//	query <transaction_id>
+//	cards list -customer c1
+//	cards get -customer c1 -card card1
+//	cards create -customer c1 -exp 12/30
+//	cards delete -customer c1 -card card1
+//	paygent request <telegram_kind> key=value ... (card_number=- card_conf_number=- ...)
+//	paygent notices [-from notice_id] [-checkpoint file] [-limit 100]
+//	paygent 3ds -amount 1000 -order order-1 -term-url https://example.com/3ds (-exp 12/30 | -customer c1 -card card1) [-html acs.html]
+//	serve [-addr :8080] [-base-url https://pay.example.com]
+//
+// Card number and security code of a new card are never given as flags, they are prompted without echo, or read from the first two lines of stdin
+// when it isn't a terminal, like `gomerchant authorize -amount 1000 -exp 12/30 < card.txt`. Params of paygent request with card data or secrets
+// are given as `key=-`, they are read from stdin in the same way, in order of arguments.
+//
+// Config is loaded from config file and environment variables with prefix GOMERCHANT, like GOMERCHANT_STRIPE_KEY,
+// card data in output is redacted, capture, refund, void, delete and paygent requests that change payments ask for confirmation unless -yes is given.
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+func main() {
+	app := &App{Stdin: os.Stdin, Stdout: os.Stdout, Stderr: os.Stderr}
+	os.Exit(app.Run(os.Args[1:]))
+}
+
+// App command-line application
+type App struct {
+	Stdin          io.Reader
+	Stdout, Stderr io.Writer
+
+	// Open open gateways with config, default OpenGateways
+	Open func(config *Config) (*Gateways, error)
+
+	configFile string
+	gateway    string
+	output     string
+	yes        bool
+
+	stdin    *bufio.Reader
+	gateways *Gateways
+}
+
+var errUsage = errors.New("usage")
+
+// ErrAborted operation is not confirmed
+var ErrAborted = errors.New("aborted")
+
+type command func(app *App, args []string) error
+
+var commands = map[string]command{
+	"authorize": (*App).authorize,
+	"capture":   (*App).capture,
+	"refund":    (*App).refund,
+	"void":      (*App).void,
+	"query":     (*App).query,
+	"cards":     (*App).cards,
+	"paygent":   (*App).paygent,
+	"serve":     (*App).serve,
+}
+
+// Run run command with args, returns exit code
+func (app *App) Run(args []string) int {
+	flags := app.flagSet("gomerchant")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	args = flags.Args()
+	if len(args) == 0 {
+		app.usage()
+		return 2
+	}
+
+	cmd, ok := commands[args[0]]
+	if !ok {
+		fmt.Fprintf(app.Stderr, "unknown command %q\n", args[0])
+		app.usage()
+		return 2
+	}
+
+	if err := cmd(app, args[1:]); err != nil {
+		if err == errUsage || err == flag.ErrHelp {
+			return 2
+		}
+		fmt.Fprintf(app.Stderr, "error: %v\n", redactString(err.Error()))
+		return 1
+	}
+	return 0
+}
+
+func (app *App) usage() {
+	fmt.Fprintln(app.Stderr, "usage: gomerchant [-config file] [-gateway stripe|paygent] [-output json|table] [-yes] <command> [flags] [args]")
+	fmt.Fprintln(app.Stderr, "commands: authorize, capture, refund, void, query, cards list|get|create|delete, paygent request|notices|3ds, serve")
+}
+
+// flagSet flag set with global flags, so they could be given before or after command
+func (app *App) flagSet(name string) *flag.FlagSet {
+	flags := flag.NewFlagSet(name, flag.ContinueOnError)
+	flags.SetOutput(app.Stderr)
+	flags.StringVar(&app.configFile, "config", app.configFile, "config file, YAML, JSON or TOML")
+	flags.StringVar(&app.gateway, "gateway", app.gateway, "gateway, stripe or paygent, default gateway of config")
+	flags.StringVar(&app.output, "output", app.output, "output format, json or table")
+	flags.BoolVar(&app.yes, "yes", app.yes, "don't ask for confirmation")
+	return flags
+}
+
+// parse parse flags and positional args in any order, returns positional args
+func parse(flags *flag.FlagSet, args []string, positional int) ([]string, error) {
+	var values []string
+	for {
+		if err := flags.Parse(args); err != nil {
+			return nil, err
+		}
+		if args = flags.Args(); len(args) == 0 {
+			break
+		}
+		values, args = append(values, args[0]), args[1:]
+	}
+
+	if positional >= 0 && len(values) != positional {
+		fmt.Fprintf(flags.Output(), "%v requires %v argument(s), got %v\n", flags.Name(), positional, len(values))
+		flags.Usage()
+		return nil, errUsage
+	}
+	return values, nil
+}
+
+// confirm ask for confirmation unless -yes is given
+func (app *App) confirm(format string, args ...interface{}) error {
+	if app.yes {
+		return nil
+	}
+
+	fmt.Fprintf(app.Stderr, format+" [y/N] ", args...)
+	answer, _ := app.readLine()
+	if answer = strings.ToLower(answer); answer == "y" || answer == "yes" {
+		return nil
+	}
+	return ErrAborted
+}
+
+// readLine read a line from stdin, without line break
+func (app *App) readLine() (string, error) {
+	if app.stdin == nil {
+		app.stdin = bufio.NewReader(app.Stdin)
+	}
+	line, err := app.stdin.ReadString('\n')
+	if err == io.EOF && line != "" {
+		err = nil
+	}
+	return strings.TrimSpace(line), err
+}
+
+// readSecret read a line from stdin, prompt for it without echo if stdin is a terminal
+func (app *App) readSecret(prompt string) (string, error) {
+	if file, ok := app.Stdin.(*os.File); ok {
+		if info, err := file.Stat(); err == nil && info.Mode()&os.ModeCharDevice != 0 {
+			fmt.Fprint(app.Stderr, prompt)
+			if err := stty(file, "-echo"); err != nil {
+				return "", fmt.Errorf("failed to disable echo, write card data to stdin instead: %w", err)
+			}
+			defer func() {
+				stty(file, "echo")
+				fmt.Fprintln(app.Stderr)
+			}()
+		}
+	}
+
+	line, err := app.readLine()
+	if err == io.EOF {
+		err = nil
+	}
+	return line, err
+}
+
+// stty change settings of terminal, like disabling echo
+func stty(terminal *os.File, args ...string) error {
+	cmd := exec.Command("stty", args...)
+	cmd.Stdin = terminal
+	return cmd.Run()
+}
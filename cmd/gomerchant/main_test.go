@@ -0,0 +1,198 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/qor/gomerchant/gateways/paygent/paygenttest"
+)
+
+type run struct {
+	stdout, stderr string
+	code           int
+}
+
+func newApp(server *paygenttest.Server, stdin string) (*App, *bytes.Buffer, *bytes.Buffer) {
+	var stdout, stderr bytes.Buffer
+	return &App{
+		Stdin:  strings.NewReader(stdin),
+		Stdout: &stdout,
+		Stderr: &stderr,
+		Open: func(config *Config) (*Gateways, error) {
+			client := server.Paygent()
+			return &Gateways{Name: "paygent", PaymentGateway: client, CreditCardManager: client, Paygent: client}, nil
+		},
+	}, &stdout, &stderr
+}
+
+func execute(server *paygenttest.Server, stdin string, args ...string) run {
+	app, stdout, stderr := newApp(server, stdin)
+	code := app.Run(args)
+	return run{stdout: stdout.String(), stderr: stderr.String(), code: code}
+}
+
+func decode(t *testing.T, r run) map[string]interface{} {
+	t.Helper()
+	var value map[string]interface{}
+	if r.code != 0 {
+		t.Fatalf("command failed with %v, stderr %v", r.code, r.stderr)
+	}
+	if err := json.Unmarshal([]byte(r.stdout), &value); err != nil {
+		t.Fatalf("output should be JSON, got %v", r.stdout)
+	}
+	return value
+}
+
+func exp() string {
+	return "12/" + time.Now().AddDate(1, 0, 0).Format("06")
+}
+
+func TestPaymentCommands(t *testing.T) {
+	server := paygenttest.NewServer()
+	defer server.Close()
+
+	authorized := decode(t, execute(server, "4242424242424242\n123\n", "authorize", "-amount", "1000", "-currency", "JPY", "-order", "order-1", "-exp", exp()))
+	transactionID, _ := authorized["transaction_id"].(string)
+	if transactionID == "" {
+		t.Fatalf("should print transaction id, got %v", authorized)
+	}
+
+	r := execute(server, "", "-output", "table", "query", transactionID)
+	if r.code != 0 || !strings.Contains(r.stdout, "status") || !strings.Contains(r.stdout, transactionID) {
+		t.Errorf("query should print table, got %v %v", r.stdout, r.stderr)
+	}
+
+	if r := execute(server, "n\n", "refund", transactionID, "-amount", "100"); r.code != 1 || !strings.Contains(r.stderr, ErrAborted.Error()) {
+		t.Errorf("refund should be aborted if not confirmed, got %v %v", r.code, r.stderr)
+	}
+	if payment, _ := server.Payment(transactionID); payment.Amount != 1000 {
+		t.Errorf("aborted refund should not be sent, got %+v", payment)
+	}
+
+	refunded := decode(t, execute(server, "y\n", "refund", "-amount", "100", transactionID))
+	refundedID, _ := refunded["transaction_id"].(string)
+	if payment, _ := server.Payment(refundedID); payment.Amount != 900 {
+		t.Errorf("refund should be sent after confirmed, got %+v", payment)
+	}
+
+	decode(t, execute(server, "", "void", "-yes", refundedID))
+	if payment, _ := server.Payment(refundedID); payment.Status == "20" {
+		t.Errorf("payment should be voided, got %+v", payment)
+	}
+
+	if r := execute(server, "", "capture"); r.code != 2 {
+		t.Errorf("capture without transaction id should print usage, got %v", r.code)
+	}
+}
+
+func TestCardCommands(t *testing.T) {
+	server := paygenttest.NewServer()
+	defer server.Close()
+
+	created := decode(t, execute(server, "4242424242424242\n", "cards", "create", "-customer", "c1", "-exp", exp()))
+	cardID, _ := created["credit_card_id"].(string)
+	if cardID == "" {
+		t.Fatalf("should print card id, got %v", created)
+	}
+
+	r := execute(server, "", "cards", "list", "-customer", "c1", "-output", "table")
+	if r.code != 0 || !strings.Contains(r.stdout, "CREDIT_CARD_ID") || !strings.Contains(r.stdout, cardID) {
+		t.Errorf("should list cards as table, got %v %v", r.stdout, r.stderr)
+	}
+	if strings.Contains(r.stdout, "4242424242424242") {
+		t.Errorf("card number should not be printed, got %v", r.stdout)
+	}
+
+	decode(t, execute(server, "", "cards", "delete", "-customer", "c1", "-card", cardID, "-yes"))
+	if r := execute(server, "", "cards", "list", "-customer", "c1", "-output", "table"); strings.Contains(r.stdout, cardID) {
+		t.Errorf("card should be deleted, got %v", r.stdout)
+	}
+}
+
+func TestCardDataFromStdin(t *testing.T) {
+	server := paygenttest.NewServer()
+	defer server.Close()
+
+	if r := execute(server, "", "authorize", "-amount", "1000", "-number", "4242424242424242", "-exp", exp()); r.code == 0 || !strings.Contains(r.stderr, "flag provided but not defined: -number") {
+		t.Errorf("card number should not be accepted as flag, got %v %v", r.code, r.stderr)
+	}
+
+	if r := execute(server, "", "authorize", "-amount", "1000", "-exp", exp()); r.code != 1 || !strings.Contains(r.stderr, "card number is required") {
+		t.Errorf("card number should be required, got %v %v", r.code, r.stderr)
+	}
+
+	authorized := decode(t, execute(server, "4242 4242 4242 4242\n123\n", "authorize", "-amount", "1000", "-exp", exp()))
+	if payment, _ := server.Payment(authorized["transaction_id"].(string)); payment.Status != "20" {
+		t.Errorf("card read from stdin should be authorized, got %+v", payment)
+	}
+}
+
+func TestPaygentCommands(t *testing.T) {
+	server := paygenttest.NewServer()
+	defer server.Close()
+
+	authorized := decode(t, execute(server, "4242424242424242", "authorize", "-amount", "1000", "-order", "order-1", "-exp", exp()))
+	transactionID := authorized["transaction_id"].(string)
+
+	// read-only telegrams are sent without confirmation
+	ref := decode(t, execute(server, "", "paygent", "request", "094", "payment_id="+transactionID))
+	if ref["payment_id"] != transactionID || ref["payment_status"] != "20" {
+		t.Errorf("should print response params, got %v", ref)
+	}
+
+	if r := execute(server, "", "paygent", "request", "022", "payment_id="+transactionID); r.code != 1 {
+		t.Errorf("telegram that changes payment should be confirmed, got %v", r.code)
+	}
+
+	if r := execute(server, "", "paygent", "request", "094", "payment_id="+transactionID, "card_conf_number=123"); r.code != 1 || strings.Contains(r.stderr, "123") {
+		t.Errorf("card data should not be accepted as argument, got %v %v", r.code, r.stderr)
+	}
+
+	ref = decode(t, execute(server, "123\n", "paygent", "request", "094", "payment_id="+transactionID, "card_conf_number=-"))
+	if ref["payment_id"] != transactionID {
+		t.Errorf("should read card data from stdin, got %v", ref)
+	}
+
+	var notices []map[string]interface{}
+	r := execute(server, "", "paygent", "notices", "-limit", "10")
+	if err := json.Unmarshal([]byte(r.stdout), &notices); err != nil || len(notices) == 0 || notices[0]["transaction_id"] != transactionID {
+		t.Errorf("should print notices, got %v %v", r.stdout, r.stderr)
+	}
+
+	threeDS := decode(t, execute(server, "4242424242424242\n\n", "paygent", "3ds", "-amount", "1000", "-order", "order-2", "-term-url", "https://example.com/3ds", "-exp", exp()))
+	if threeDS["out_acs_html"] == "" {
+		t.Errorf("should print ACS HTML, got %v", threeDS)
+	}
+}
+
+func TestRedact(t *testing.T) {
+	value := redact(map[string]interface{}{
+		"card_number":      "4242424242424242",
+		"card_conf_number": "123",
+		"RawBody":          "result=0",
+		"message":          "card 4242424242424242 declined, order 1234567890123",
+		"params":           map[string]interface{}{"CVC": "123"},
+	}).(map[string]interface{})
+
+	if value["card_number"] != redacted || value["card_conf_number"] != redacted || value["params"].(map[string]interface{})["CVC"] != redacted {
+		t.Errorf("sensitive keys should be redacted, got %v", value)
+	}
+	if _, ok := value["RawBody"]; ok {
+		t.Errorf("raw body should be removed, got %v", value)
+	}
+	if value["message"] != "card ************4242 declined, order 1234567890123" {
+		t.Errorf("card numbers in values should be masked, got %v", value["message"])
+	}
+}
+
+func TestServe(t *testing.T) {
+	server := paygenttest.NewServer()
+	defer server.Close()
+
+	if r := execute(server, "", "serve", "-addr", "127.0.0.1:0"); r.code != 1 || !strings.Contains(r.stderr, "API keys are required") {
+		t.Errorf("serve should require API keys, got %v %v", r.code, r.stderr)
+	}
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/qor/gomerchant"
+)
+
+var (
+	// sensitiveKey keys of card data and secrets in params, their values are redacted
+	sensitiveKey = regexp.MustCompile(`(?i)(card_?number|card_conf_number|card_valid_term|cvc|cvv|security_code|password|secret)`)
+	// cardNumber card numbers in values, like error messages or raw bodies
+	cardNumber = regexp.MustCompile(`\b\d{12,19}\b`)
+)
+
+const redacted = "[REDACTED]"
+
+// redactString mask card numbers in s, keeps the last 4 digits
+func redactString(s string) string {
+	return cardNumber.ReplaceAllStringFunc(s, func(number string) string {
+		card := gomerchant.CreditCard{Number: number}
+		if !card.ValidNumber() || card.Brand() == "" {
+			return number
+		}
+		return strings.Repeat("*", len(number)-4) + number[len(number)-4:]
+	})
+}
+
+// redact redact card data of decoded JSON value
+func redact(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, item := range v {
+			switch {
+			case strings.EqualFold(key, "RawBody"): // duplicated with params
+				delete(v, key)
+			case sensitiveKey.MatchString(key):
+				v[key] = redacted
+			default:
+				v[key] = redact(item)
+			}
+		}
+	case []interface{}:
+		for idx, item := range v {
+			v[idx] = redact(item)
+		}
+	case string:
+		return redactString(v)
+	}
+	return value
+}
+
+// print print value as JSON or table, card data is redacted
+func (app *App) print(value interface{}) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+
+	var decoded interface{}
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		return err
+	}
+	decoded = redact(decoded)
+
+	switch app.output {
+	case "", "json":
+		encoder := json.NewEncoder(app.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(decoded)
+	case "table":
+		return printTable(app, decoded)
+	}
+	return fmt.Errorf("unknown output %q, should be json or table", app.output)
+}
+
+func printTable(app *App, value interface{}) error {
+	writer := tabwriter.NewWriter(app.Stdout, 0, 4, 2, ' ', 0)
+
+	switch v := value.(type) {
+	case []interface{}:
+		if len(v) == 0 {
+			fmt.Fprintln(writer, "no results")
+			break
+		}
+
+		var (
+			rows    []map[string]string
+			columns []string
+			seen    = map[string]bool{}
+		)
+		for _, item := range v {
+			row := map[string]string{}
+			flatten("", item, row)
+			for key := range row {
+				if !seen[key] {
+					seen[key] = true
+					columns = append(columns, key)
+				}
+			}
+			rows = append(rows, row)
+		}
+		sort.Strings(columns)
+
+		fmt.Fprintln(writer, strings.ToUpper(strings.Join(columns, "\t")))
+		for _, row := range rows {
+			var values []string
+			for _, column := range columns {
+				values = append(values, row[column])
+			}
+			fmt.Fprintln(writer, strings.Join(values, "\t"))
+		}
+	default:
+		row := map[string]string{}
+		flatten("", v, row)
+
+		var keys []string
+		for key := range row {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		for _, key := range keys {
+			fmt.Fprintf(writer, "%v\t%v\n", key, row[key])
+		}
+	}
+	return writer.Flush()
+}
+
+// flatten flatten nested objects to row with dotted keys
+func flatten(prefix string, value interface{}, row map[string]string) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, item := range v {
+			if prefix != "" {
+				key = prefix + "." + key
+			}
+			flatten(key, item, row)
+		}
+	case nil:
+		row[prefix] = ""
+	default:
+		if prefix == "" {
+			prefix = "value"
+		}
+		row[prefix] = strings.NewReplacer("\t", " ", "\n", " ").Replace(fmt.Sprint(v))
+	}
+}
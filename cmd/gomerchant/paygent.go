@@ -0,0 +1,229 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/qor/gomerchant"
+	"github.com/qor/gomerchant/gateways/paygent"
+)
+
+// readOnlyTelegrams telegrams that don't change payments or cards, they are sent without confirmation
+var readOnlyTelegrams = map[string]bool{
+	"027": true, // list cards
+	"091": true, // payment notice
+	"093": true,
+	"094": true, // payment reference
+}
+
+func (app *App) paygent(args []string) error {
+	if len(args) == 0 {
+		fmt.Fprintln(app.Stderr, "usage: gomerchant paygent request|notices|3ds [flags]")
+		return errUsage
+	}
+
+	switch args[0] {
+	case "request":
+		return app.paygentRequest(args[1:])
+	case "notices":
+		return app.paygentNotices(args[1:])
+	case "3ds":
+		return app.paygent3DS(args[1:])
+	}
+	fmt.Fprintf(app.Stderr, "unknown paygent command %q, should be request, notices or 3ds\n", args[0])
+	return errUsage
+}
+
+func (app *App) openPaygent() (*paygent.Paygent, error) {
+	gateways, err := app.open()
+	if err != nil {
+		return nil, err
+	}
+	if gateways.Paygent == nil {
+		return nil, fmt.Errorf("paygent commands require paygent gateway, got %v", gateways.Name)
+	}
+	return gateways.Paygent, nil
+}
+
+func (app *App) paygentRequest(args []string) error {
+	flags := app.flagSet("paygent request")
+	values, err := parse(flags, args, -1)
+	if err != nil {
+		return err
+	}
+	if len(values) == 0 {
+		fmt.Fprintln(app.Stderr, "usage: gomerchant paygent request <telegram_kind> key=value ...")
+		return errUsage
+	}
+
+	var (
+		telegramKind = values[0]
+		params       = gomerchant.Params{}
+		secretKeys   []string
+	)
+	for _, value := range values[1:] {
+		kv := strings.SplitN(value, "=", 2)
+		if len(kv) != 2 || kv[0] == "" {
+			return fmt.Errorf("param %q should be key=value", redactString(value))
+		}
+		if sensitiveKey.MatchString(kv[0]) {
+			// card data and secrets in arguments are kept in shell history and visible in process list
+			if kv[1] != "-" {
+				return fmt.Errorf("param %v should not be given as argument, give %v=- to read it from stdin", kv[0], kv[0])
+			}
+			secretKeys = append(secretKeys, kv[0])
+			continue
+		}
+		params.Set(kv[0], kv[1])
+	}
+
+	for _, key := range secretKeys {
+		secret, err := app.readSecret(key + ": ")
+		if err != nil {
+			return err
+		}
+		params.Set(key, secret)
+	}
+
+	client, err := app.openPaygent()
+	if err != nil {
+		return err
+	}
+	if !readOnlyTelegrams[telegramKind] {
+		if err := app.confirm("Send telegram %v to paygent?", telegramKind); err != nil {
+			return err
+		}
+	}
+
+	response, err := client.Request(telegramKind, params)
+	if err != nil {
+		if response.ResponseCode != "" {
+			return fmt.Errorf("%v (response code %v)", err, response.ResponseCode)
+		}
+		return err
+	}
+	return app.print(response.Params)
+}
+
+func (app *App) paygentNotices(args []string) error {
+	var (
+		flags      = app.flagSet("paygent notices")
+		from       = flags.String("from", "", "start after this payment notice id")
+		checkpoint = flags.String("checkpoint", "", "file of last handled notice id, it is read and updated")
+		limit      = flags.Int("limit", 100, "maximum number of notices")
+	)
+	if _, err := parse(flags, args, 0); err != nil {
+		return err
+	}
+
+	client, err := app.openPaygent()
+	if err != nil {
+		return err
+	}
+
+	var (
+		notices = []map[string]interface{}{}
+		source  = &limitedSource{NotificationSource: client, limit: *limit}
+		poller  = &paygent.NotificationPoller{
+			Source:     source,
+			Checkpoint: &paygent.MemoryCheckpoint{},
+			Handler: func(ctx context.Context, event paygent.NotificationEvent) error {
+				notice := map[string]interface{}{
+					"notice_id":       event.NoticeID,
+					"order_id":        event.OrderID,
+					"transaction_id":  event.Transaction.ID,
+					"base_payment_id": event.BasePaymentID,
+					"status":          event.Transaction.Status,
+					"amount":          event.Transaction.Amount,
+				}
+				if event.ChangedAt != nil {
+					notice["changed_at"] = event.ChangedAt
+				}
+				notices = append(notices, notice)
+				return nil
+			},
+		}
+	)
+
+	if *checkpoint != "" {
+		poller.Checkpoint = paygent.FileCheckpoint{Path: *checkpoint}
+	} else if *from != "" {
+		poller.Checkpoint.Save(*from)
+	}
+
+	if _, err := poller.Drain(context.Background()); err != nil && !errors.Is(err, errLimitReached) {
+		return err
+	}
+	return app.print(notices)
+}
+
+var errLimitReached = errors.New("limit reached")
+
+// limitedSource stop draining notices after limit
+type limitedSource struct {
+	paygent.NotificationSource
+	limit, count int
+}
+
+func (source *limitedSource) InquiryNotification(noticeID string) (gomerchant.InquiryResponse, error) {
+	if source.count >= source.limit {
+		return gomerchant.InquiryResponse{}, errLimitReached
+	}
+	source.count++
+	return source.NotificationSource.InquiryNotification(noticeID)
+}
+
+func (app *App) paygent3DS(args []string) error {
+	var (
+		flags   = app.flagSet("paygent 3ds")
+		card    cardFlags
+		amount  = flags.Uint64("amount", 0, "amount")
+		orderID = flags.String("order", "", "order id")
+		termURL = flags.String("term-url", "", "URL that ACS redirects to after authentication")
+		html    = flags.String("html", "", "write ACS HTML to this file, instead of output")
+	)
+	card.bind(flags)
+	if _, err := parse(flags, args, 0); err != nil {
+		return err
+	}
+	if *amount == 0 {
+		return errors.New("amount (-amount) is required")
+	}
+	if err := requireFlag("term-url", *termURL); err != nil {
+		return err
+	}
+
+	paymentMethod, err := app.paymentMethod(&card)
+	if err != nil {
+		return err
+	}
+
+	client, err := app.openPaygent()
+	if err != nil {
+		return err
+	}
+
+	response, err := client.Start3DS2Authentication(context.Background(), gomerchant.Start3DS2AuthenticationParams{
+		TermURL:       *termURL,
+		OrderID:       *orderID,
+		Amount:        *amount,
+		PaymentMethod: paymentMethod,
+	})
+	if err != nil {
+		return err
+	}
+
+	output := map[string]interface{}{"result": response.Result}
+	if *html != "" {
+		if err := os.WriteFile(*html, []byte(response.OutAcsHTML), 0600); err != nil {
+			return err
+		}
+		output["html"] = *html
+	} else {
+		output["out_acs_html"] = response.OutAcsHTML
+	}
+	return app.print(output)
+}
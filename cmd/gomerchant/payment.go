@@ -0,0 +1,252 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/qor/gomerchant"
+)
+
+// cardFlags flags of a credit card or a saved credit card
+type cardFlags struct {
+	number, exp, cvc, name string
+	customer, card         string
+}
+
+// bind bind flags of card, card number and security code are not flags, they are read with readCard, so they never appear in argv or shell history
+func (card *cardFlags) bind(flags *flag.FlagSet) {
+	flags.StringVar(&card.exp, "exp", "", "card expiry, MM/YY or MM/YYYY")
+	flags.StringVar(&card.name, "name", "", "card holder name")
+	flags.StringVar(&card.customer, "customer", "", "customer id")
+	flags.StringVar(&card.card, "card", "", "saved credit card id")
+}
+
+func (card *cardFlags) creditCard() (*gomerchant.CreditCard, error) {
+	creditCard := &gomerchant.CreditCard{Name: card.name, Number: strings.ReplaceAll(card.number, " ", ""), CVC: card.cvc}
+	if !creditCard.ValidNumber() {
+		return nil, gomerchant.ErrInvalidNumber
+	}
+
+	parts := strings.Split(card.exp, "/")
+	if len(parts) != 2 {
+		return nil, errors.New("card expiry should be MM/YY or MM/YYYY")
+	}
+
+	month, err := strconv.ParseUint(parts[0], 10, 32)
+	if err != nil || month < 1 || month > 12 {
+		return nil, gomerchant.ErrInvalidExpiryMonth
+	}
+	year, err := strconv.ParseUint(parts[1], 10, 32)
+	if err != nil {
+		return nil, gomerchant.ErrInvalidExpiryYear
+	}
+	if year < 100 {
+		year += 2000
+	}
+
+	creditCard.ExpMonth, creditCard.ExpYear = uint(month), uint(year)
+	return creditCard, nil
+}
+
+// paymentMethod saved card if -card is given, otherwise card read with readCard
+func (app *App) paymentMethod(card *cardFlags) (*gomerchant.PaymentMethod, error) {
+	if card.card != "" {
+		return &gomerchant.PaymentMethod{SavedCreditCard: &gomerchant.SavedCreditCard{CustomerID: card.customer, CreditCardID: card.card}}, nil
+	}
+
+	creditCard, err := app.readCard(card)
+	return &gomerchant.PaymentMethod{CreditCard: creditCard}, err
+}
+
+// readCard read card number and security code from stdin. If stdin is a terminal, they are prompted without echo,
+// otherwise they are the first two lines of stdin, the security code line could be blank
+func (app *App) readCard(card *cardFlags) (*gomerchant.CreditCard, error) {
+	var err error
+	if card.number, err = app.readSecret("Card number: "); err != nil {
+		return nil, err
+	}
+	if card.number == "" {
+		return nil, errors.New("card number is required, enter it when prompted or write it to stdin, or use saved card (-customer and -card)")
+	}
+	if card.cvc, err = app.readSecret("Security code (blank to skip): "); err != nil {
+		return nil, err
+	}
+	return card.creditCard()
+}
+
+func (app *App) authorize(args []string) error {
+	var (
+		flags       = app.flagSet("authorize")
+		card        cardFlags
+		amount      = flags.Uint64("amount", 0, "amount in the smallest currency unit")
+		currency    = flags.String("currency", "", "currency, like JPY")
+		orderID     = flags.String("order", "", "order id")
+		description = flags.String("description", "", "description")
+	)
+	card.bind(flags)
+
+	if _, err := parse(flags, args, 0); err != nil {
+		return err
+	}
+	if *amount == 0 {
+		return errors.New("amount (-amount) is required")
+	}
+
+	paymentMethod, err := app.paymentMethod(&card)
+	if err != nil {
+		return err
+	}
+
+	gateways, err := app.open()
+	if err != nil {
+		return err
+	}
+
+	response, err := gateways.PaymentGateway.Authorize(*amount, gomerchant.AuthorizeParams{
+		Amount:        *amount,
+		Currency:      *currency,
+		Customer:      card.customer,
+		Description:   *description,
+		OrderID:       *orderID,
+		PaymentMethod: paymentMethod,
+	})
+	if err != nil {
+		return err
+	}
+
+	return app.print(map[string]interface{}{
+		"transaction_id":     response.TransactionID,
+		"authorization_code": response.AuthorizationCode,
+		"avs_address":        response.AVSResult.Address,
+		"avs_postal_code":    response.AVSResult.PostalCode,
+		"cvc":                response.CVCResult,
+		"params":             response.Params,
+	})
+}
+
+func (app *App) capture(args []string) error {
+	flags := app.flagSet("capture")
+	values, err := parse(flags, args, 1)
+	if err != nil {
+		return err
+	}
+
+	gateways, err := app.open()
+	if err != nil {
+		return err
+	}
+	if err := app.confirm("Capture %v with %v?", values[0], gateways.Name); err != nil {
+		return err
+	}
+
+	response, err := gateways.PaymentGateway.Capture(values[0], gomerchant.CaptureParams{})
+	if err != nil {
+		return err
+	}
+	return app.print(map[string]interface{}{"transaction_id": response.TransactionID, "params": response.Params})
+}
+
+func (app *App) refund(args []string) error {
+	var (
+		flags    = app.flagSet("refund")
+		amount   = flags.Uint("amount", 0, "refund amount in the smallest currency unit")
+		captured = flags.Bool("captured", false, "transaction is captured")
+	)
+	values, err := parse(flags, args, 1)
+	if err != nil {
+		return err
+	}
+	if *amount == 0 {
+		return errors.New("amount (-amount) is required")
+	}
+
+	gateways, err := app.open()
+	if err != nil {
+		return err
+	}
+	if err := app.confirm("Refund %v of %v with %v?", *amount, values[0], gateways.Name); err != nil {
+		return err
+	}
+
+	response, err := gateways.PaymentGateway.Refund(values[0], *amount, gomerchant.RefundParams{Captured: *captured})
+	if err != nil {
+		return err
+	}
+	return app.print(map[string]interface{}{"transaction_id": response.TransactionID, "params": response.Params})
+}
+
+func (app *App) void(args []string) error {
+	var (
+		flags    = app.flagSet("void")
+		captured = flags.Bool("captured", false, "transaction is captured")
+	)
+	values, err := parse(flags, args, 1)
+	if err != nil {
+		return err
+	}
+
+	gateways, err := app.open()
+	if err != nil {
+		return err
+	}
+	if err := app.confirm("Void %v with %v?", values[0], gateways.Name); err != nil {
+		return err
+	}
+
+	response, err := gateways.PaymentGateway.Void(values[0], gomerchant.VoidParams{Captured: *captured})
+	if err != nil {
+		return err
+	}
+	return app.print(map[string]interface{}{"transaction_id": response.TransactionID, "params": response.Params})
+}
+
+func (app *App) query(args []string) error {
+	flags := app.flagSet("query")
+	values, err := parse(flags, args, 1)
+	if err != nil {
+		return err
+	}
+
+	gateways, err := app.open()
+	if err != nil {
+		return err
+	}
+
+	transaction, err := gateways.PaymentGateway.Query(values[0])
+	if err != nil {
+		return err
+	}
+	return app.print(transactionOutput(transaction))
+}
+
+func transactionOutput(transaction gomerchant.Transaction) map[string]interface{} {
+	output := map[string]interface{}{
+		"id":        transaction.ID,
+		"amount":    transaction.Amount,
+		"currency":  transaction.Currency,
+		"captured":  transaction.Captured,
+		"paid":      transaction.Paid,
+		"cancelled": transaction.Cancelled,
+		"disputed":  transaction.Disputed,
+		"status":    transaction.Status,
+		"params":    transaction.Params,
+	}
+	if transaction.CreatedAt != nil {
+		output["created_at"] = transaction.CreatedAt
+	}
+	if transaction.AuthorizationCode != "" {
+		output["authorization_code"] = transaction.AuthorizationCode
+	}
+	return output
+}
+
+// requireFlag error if flag is blank
+func requireFlag(name, value string) error {
+	if value == "" {
+		return fmt.Errorf("%v (-%v) is required", name, name)
+	}
+	return nil
+}
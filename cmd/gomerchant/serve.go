@@ -0,0 +1,46 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/qor/gomerchant/server"
+)
+
+// serve run REST API of gateway, API keys are loaded from config, like GOMERCHANT_SERVER_APIKEYS
+func (app *App) serve(args []string) error {
+	flags := app.flagSet("serve")
+	addr := flags.String("addr", "", "listen address, default server.addr of config")
+	baseURL := flags.String("base-url", "", "base URL of 3D Secure redirects, default server.baseurl of config")
+	if _, err := parse(flags, args, 0); err != nil {
+		return err
+	}
+
+	gateways, err := app.open()
+	if err != nil {
+		return err
+	}
+
+	config := gateways.Config
+	if config == nil {
+		config = &Config{}
+	}
+	if *addr == "" {
+		*addr = config.Server.Addr
+	}
+	if *baseURL == "" {
+		*baseURL = config.Server.BaseURL
+	}
+	if len(config.Server.APIKeys) == 0 {
+		return errors.New("API keys are required, set GOMERCHANT_SERVER_APIKEYS or server.apikeys in config file")
+	}
+
+	handler := server.New(gateways.PaymentGateway, gateways.CreditCardManager, config.Server.APIKeys...)
+	handler.BaseURL = *baseURL
+
+	fmt.Fprintf(app.Stderr, "serving %v gateway on %v\n", gateways.Name, *addr)
+	httpServer := &http.Server{Addr: *addr, Handler: handler, ReadHeaderTimeout: 10 * time.Second}
+	return httpServer.ListenAndServe()
+}
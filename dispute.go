@@ -0,0 +1,76 @@
+package gomerchant
+
+import (
+	"io"
+	"time"
+)
+
+// DisputeManager interface, manage disputes (chargebacks) of transactions
+type DisputeManager interface {
+	ListDisputes(params ListDisputesParams) (ListDisputesResponse, error)
+	GetDispute(disputeID string) (Dispute, error)
+	SubmitDisputeEvidence(disputeID string, params DisputeEvidenceParams) (Dispute, error)
+	AcceptDispute(disputeID string) (Dispute, error)
+}
+
+// DisputeStatus normalized dispute status
+type DisputeStatus string
+
+const (
+	DisputeInquiry       DisputeStatus = "inquiry"        // cardholder's bank asked for information, it is not a chargeback yet
+	DisputeNeedsResponse DisputeStatus = "needs_response" // evidence should be submitted before EvidenceDueBy
+	DisputeUnderReview   DisputeStatus = "under_review"   // evidence submitted, waiting for decision
+	DisputeWon           DisputeStatus = "won"
+	DisputeLost          DisputeStatus = "lost" // lost or accepted
+	DisputeClosed        DisputeStatus = "closed"
+)
+
+// Dispute dispute of a transaction
+type Dispute struct {
+	ID            string
+	TransactionID string
+	Amount        int
+	Currency      string
+	Reason        string
+	Status        DisputeStatus
+	GatewayStatus string // status returned by gateway
+	EvidenceDueBy *time.Time
+	CreatedAt     *time.Time
+	Params
+}
+
+// Open dispute is waiting for merchant or bank
+func (dispute Dispute) Open() bool {
+	return dispute.Status == DisputeInquiry || dispute.Status == DisputeNeedsResponse || dispute.Status == DisputeUnderReview
+}
+
+// ListDisputesParams list disputes params, disputes are listed page by page
+type ListDisputesParams struct {
+	TransactionID string
+	CreatedAfter  *time.Time
+	CreatedBefore *time.Time
+	PageSize      int    // disputes fetched per request, default value of gateway if it is zero
+	Cursor        string // fetch the page after cursor, it is Cursor of previous response
+	Params
+}
+
+// ListDisputesResponse list disputes response, a page of disputes
+type ListDisputesResponse struct {
+	Disputes []*Dispute
+	Cursor   string // cursor of next page, empty if there are no more disputes
+	Params
+}
+
+// DisputeEvidenceParams evidence of dispute, keys of Text and Files are evidence fields of gateway, like `product_description`, `receipt` for Stripe
+type DisputeEvidenceParams struct {
+	Text   map[string]string
+	Files  map[string]DisputeEvidenceFile
+	Submit bool // submit evidence to bank, evidence could be updated until it is submitted
+	Params
+}
+
+// DisputeEvidenceFile evidence file
+type DisputeEvidenceFile struct {
+	Filename string
+	Reader   io.Reader
+}
@@ -0,0 +1,258 @@
+package paygent
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"mime/multipart"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/qor/gomerchant"
+	"golang.org/x/text/encoding/japanese"
+	"golang.org/x/text/transform"
+)
+
+// File payment telegram kinds
+const (
+	BatchRequestTelegram = "201" // upload request file
+	BatchResultTelegram  = "202" // download result file
+)
+
+// BatchRecord a record in file payment request, each record will be processed as a telegram of `TelegramKind`
+type BatchRecord interface {
+	TelegramKind() string
+	// Fields payment_id, trading_id, payment_amount, customer_id, customer_card_id
+	Fields() []string
+}
+
+// BatchCapture capture authorized payment
+type BatchCapture struct {
+	PaymentID string
+}
+
+func (BatchCapture) TelegramKind() string { return "022" }
+
+func (record BatchCapture) Fields() []string {
+	return []string{record.PaymentID, "", "", "", ""}
+}
+
+// BatchVoid void authorized payment, or captured payment if Captured is true
+type BatchVoid struct {
+	PaymentID string
+	Captured  bool
+}
+
+func (record BatchVoid) TelegramKind() string {
+	if record.Captured {
+		return "023"
+	}
+	return "021"
+}
+
+func (record BatchVoid) Fields() []string {
+	return []string{record.PaymentID, "", "", "", ""}
+}
+
+// BatchStoredCardCharge authorize with stored credit card
+type BatchStoredCardCharge struct {
+	OrderID      string
+	Amount       uint64
+	CustomerID   string
+	CreditCardID string
+}
+
+func (BatchStoredCardCharge) TelegramKind() string { return "020" }
+
+func (record BatchStoredCardCharge) Fields() []string {
+	return []string{"", record.OrderID, fmt.Sprint(record.Amount), record.CustomerID, record.CreditCardID}
+}
+
+// Batch file payment request
+type Batch struct {
+	CreatedAt time.Time
+	Records   []BatchRecord
+}
+
+// BatchResponse response of uploaded request file
+type BatchResponse struct {
+	FileID string
+	Params gomerchant.Params
+}
+
+// BatchResult parsed result file
+type BatchResult struct {
+	Result         string
+	ResponseCode   string
+	ResponseDetail string
+	Successes      []BatchRecordResult
+	Failures       []BatchRecordResult
+}
+
+// BatchRecordResult result of a record, Line is the sequence number of the record in request file, starting from 1
+type BatchRecordResult struct {
+	Line           int
+	TelegramKind   string
+	Result         string
+	ResponseCode   string
+	ResponseDetail string
+	PaymentID      string
+	TradingID      string
+}
+
+// EncodeBatch encode batch to Shift_JIS CSV request file
+//
+//	1,merchant_id,merchant_name,created_at
+//	2,line,telegram_kind,payment_id,trading_id,payment_amount,customer_id,customer_card_id
+//	3,record count
+func (paygent *Paygent) EncodeBatch(batch Batch) ([]byte, error) {
+	var (
+		buf          bytes.Buffer
+		shiftJISFile = transform.NewWriter(&buf, japanese.ShiftJIS.NewEncoder())
+		writer       = csv.NewWriter(shiftJISFile)
+	)
+	writer.UseCRLF = true
+
+	createdAt := batch.CreatedAt
+	if createdAt.IsZero() {
+		createdAt = time.Now()
+	}
+
+	writer.Write([]string{"1", paygent.Config.MerchantID, paygent.Config.MerchantName, createdAt.In(PaygentServerTimeZone).Format("20060102150405")})
+	for idx, record := range batch.Records {
+		writer.Write(append([]string{"2", strconv.Itoa(idx + 1), record.TelegramKind()}, record.Fields()...))
+	}
+	writer.Write([]string{"3", strconv.Itoa(len(batch.Records))})
+	writer.Flush()
+
+	err := writer.Error()
+	if err == nil {
+		err = shiftJISFile.Close()
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode batch: %v", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// SubmitBatch upload request file of batch, use returned FileID to get result with `BatchResult`
+func (paygent *Paygent) SubmitBatch(batch Batch) (BatchResponse, error) {
+	var (
+		response BatchResponse
+		body     bytes.Buffer
+		writer   = multipart.NewWriter(&body)
+	)
+
+	data, err := paygent.EncodeBatch(batch)
+	if err != nil {
+		return response, err
+	}
+
+	for key, values := range paygent.telegramValues(BatchRequestTelegram) {
+		for _, value := range values {
+			writer.WriteField(key, value)
+		}
+	}
+
+	if part, err := writer.CreateFormFile("data", "request.csv"); err == nil {
+		part.Write(data)
+	} else {
+		return response, err
+	}
+	writer.Close()
+
+	results, err := paygent.send(BatchRequestTelegram, writer.FormDataContentType(), &body)
+	if fileID, ok := results.Get("file_id"); ok {
+		response.FileID = fmt.Sprint(fileID)
+	}
+	response.Params = results.Params
+	return response, err
+}
+
+// BatchResult get result file of submitted batch
+func (paygent *Paygent) BatchResult(fileID string) (BatchResult, error) {
+	results, err := paygent.Request(BatchResultTelegram, gomerchant.Params{"file_id": fileID})
+	if err != nil {
+		return BatchResult{}, err
+	}
+	return ParseBatchResult(results.RawBody)
+}
+
+// ParseBatchResult parse decoded result file
+//
+//	1,result,response_code,response_detail
+//	2,line,telegram_kind,result,response_code,response_detail,payment_id,trading_id
+//	3,record count,success count,failure count
+func ParseBatchResult(body string) (result BatchResult, err error) {
+	var hasTrailer bool
+
+	for _, str := range strings.Split(body, "\r\n") {
+		if str == "" {
+			continue
+		}
+
+		record, err := csv.NewReader(strings.NewReader(str)).Read()
+		if err != nil {
+			return result, err
+		}
+
+		switch record[0] {
+		case "1":
+			if len(record) != 4 {
+				return result, errors.New("wrong format")
+			}
+			result.Result, result.ResponseCode, result.ResponseDetail = record[1], record[2], record[3]
+		case "2":
+			if len(record) != 8 {
+				return result, errors.New("wrong format")
+			}
+
+			line, err := strconv.Atoi(record[1])
+			if err != nil {
+				return result, fmt.Errorf("wrong line number %v", record[1])
+			}
+
+			recordResult := BatchRecordResult{
+				Line:           line,
+				TelegramKind:   record[2],
+				Result:         record[3],
+				ResponseCode:   record[4],
+				ResponseDetail: record[5],
+				PaymentID:      record[6],
+				TradingID:      record[7],
+			}
+
+			if recordResult.Result == "0" {
+				result.Successes = append(result.Successes, recordResult)
+			} else {
+				result.Failures = append(result.Failures, recordResult)
+			}
+		case "3":
+			if len(record) != 4 {
+				return result, errors.New("wrong format")
+			}
+			hasTrailer = true
+
+			if record[2] != strconv.Itoa(len(result.Successes)) || record[3] != strconv.Itoa(len(result.Failures)) {
+				return result, fmt.Errorf("result file is incomplete, expect %v successes and %v failures, but got %v and %v", record[2], record[3], len(result.Successes), len(result.Failures))
+			}
+		default:
+			return result, errors.New("wrong format")
+		}
+	}
+
+	if result.Result == "1" {
+		if result.ResponseDetail != "" {
+			return result, errors.New(result.ResponseDetail)
+		}
+		return result, errors.New("failed to process this request")
+	}
+
+	if !hasTrailer {
+		return result, errors.New("result file is incomplete")
+	}
+
+	return result, nil
+}
@@ -0,0 +1,97 @@
+package paygent_test
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/qor/gomerchant/gateways/paygent"
+)
+
+var update = flag.Bool("update", false, "update golden files")
+
+func goldenFile(t *testing.T, name string, got []byte) []byte {
+	path := filepath.Join("testdata", name)
+	if *update {
+		if err := os.WriteFile(path, got, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return want
+}
+
+func TestEncodeBatch(t *testing.T) {
+	client := paygent.New(&paygent.Config{MerchantID: "12345", MerchantName: "テスト商店"})
+
+	data, err := client.EncodeBatch(paygent.Batch{
+		CreatedAt: time.Date(2026, 10, 1, 1, 2, 3, 0, paygent.PaygentServerTimeZone),
+		Records: []paygent.BatchRecord{
+			paygent.BatchCapture{PaymentID: "1001"},
+			paygent.BatchVoid{PaymentID: "1002"},
+			paygent.BatchVoid{PaymentID: "1003", Captured: true},
+			paygent.BatchStoredCardCharge{OrderID: "order-1", Amount: 1500, CustomerID: "customer-1", CreditCardID: "9"},
+		},
+	})
+	if err != nil {
+		t.Fatalf("no error should happen when encode batch, but got %v", err)
+	}
+
+	if want := goldenFile(t, "batch_request.golden", data); !bytes.Equal(data, want) {
+		t.Errorf("encoded batch should be\n%q\nbut got\n%q", want, data)
+	}
+}
+
+func TestEncodeBatchWithUnsupportedCharacters(t *testing.T) {
+	client := paygent.New(&paygent.Config{MerchantID: "12345", MerchantName: "Shop 🛒"})
+
+	if _, err := client.EncodeBatch(paygent.Batch{Records: []paygent.BatchRecord{paygent.BatchCapture{PaymentID: "1001"}}}); err == nil {
+		t.Errorf("should get error when merchant name can't be encoded to Shift_JIS")
+	}
+}
+
+func TestParseBatchResult(t *testing.T) {
+	body, err := os.ReadFile(filepath.Join("testdata", "batch_result.golden"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := paygent.ParseBatchResult(string(body))
+	if err != nil {
+		t.Fatalf("no error should happen when parse batch result, but got %v", err)
+	}
+
+	if len(result.Successes) != 3 || len(result.Failures) != 1 {
+		t.Fatalf("should get 3 successes and 1 failure, but got %+v", result)
+	}
+
+	if success := result.Successes[2]; success.Line != 4 || success.TelegramKind != "020" || success.PaymentID != "2004" || success.TradingID != "order-1" {
+		t.Errorf("success record is not correct, but got %+v", success)
+	}
+
+	if failure := result.Failures[0]; failure.Line != 2 || failure.ResponseCode != "P008" || failure.ResponseDetail != "取消済みです" || failure.PaymentID != "1002" {
+		t.Errorf("failure record is not correct, but got %+v", failure)
+	}
+}
+
+func TestParseIncompleteBatchResult(t *testing.T) {
+	body, err := os.ReadFile(filepath.Join("testdata", "batch_result.golden"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := paygent.ParseBatchResult(string(bytes.SplitAfter(body, []byte("\r\n"))[0])); err == nil {
+		t.Errorf("should get error when result file has no trailer")
+	}
+
+	if _, err := paygent.ParseBatchResult("1,1,P001,ファイル形式が不正です\r\n"); err == nil || err.Error() != "ファイル形式が不正です" {
+		t.Errorf("should get response detail as error, but got %v", err)
+	}
+}
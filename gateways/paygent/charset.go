@@ -0,0 +1,103 @@
+package paygent
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+
+	"golang.org/x/text/encoding/japanese"
+	"golang.org/x/text/unicode/norm"
+	"golang.org/x/text/width"
+)
+
+// CharsetError value can't be encoded in the charset of telegram
+type CharsetError struct {
+	Field   string
+	Char    rune
+	Charset string
+}
+
+func (err CharsetError) Error() string {
+	return fmt.Sprintf("paygent: field %v contains character %q (%U) that can't be encoded in %v", err.Field, err.Char, err.Char, err.Charset)
+}
+
+// encodeTelegramForm encode form values in charset, paygent expects Shift_JIS unless charset is UTF-8
+func encodeTelegramForm(values url.Values, charset string) (string, error) {
+	var (
+		buf  strings.Builder
+		keys = make([]string, 0, len(values))
+	)
+
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		for _, value := range values[key] {
+			encoded, err := encodeTelegramValue(key, value, charset)
+			if err != nil {
+				return "", err
+			}
+
+			if buf.Len() > 0 {
+				buf.WriteByte('&')
+			}
+			buf.WriteString(url.QueryEscape(key))
+			buf.WriteByte('=')
+			buf.WriteString(url.QueryEscape(encoded))
+		}
+	}
+	return buf.String(), nil
+}
+
+func encodeTelegramValue(field, value, charset string) (string, error) {
+	if strings.EqualFold(charset, "UTF-8") || isASCII(value) {
+		return value, nil
+	}
+
+	encoder := japanese.ShiftJIS.NewEncoder()
+	for _, r := range value {
+		if _, err := encoder.String(string(r)); err != nil {
+			return "", CharsetError{Field: field, Char: r, Charset: "Shift_JIS"}
+		}
+	}
+	return encoder.String(value)
+}
+
+// ToFullWidthKana convert half-width katakana to full-width, voiced sound marks are combined, like ｶﾞ to ガ
+func ToFullWidthKana(value string) string {
+	var buf strings.Builder
+	for _, r := range value {
+		if r >= 0xff61 && r <= 0xff9f {
+			buf.WriteString(width.Widen.String(string(r)))
+		} else {
+			buf.WriteRune(r)
+		}
+	}
+
+	return strings.NewReplacer("゙", "゛", "゚", "゜").Replace(norm.NFC.String(buf.String()))
+}
+
+// ToHalfWidthKana convert hiragana and katakana to half-width katakana, like が to ｶﾞ, full-width alphabets and numbers are converted as well
+func ToHalfWidthKana(value string) string {
+	var buf strings.Builder
+	for _, r := range value {
+		switch {
+		case r >= 0x3041 && r <= 0x3096: // hiragana
+			r += 0x60
+		case r == '゛':
+			r = '゙'
+		case r == '゜':
+			r = '゚'
+		}
+
+		if r >= 0x30a1 && r <= 0x30fa {
+			buf.WriteString(width.Narrow.String(norm.NFD.String(string(r))))
+		} else {
+			buf.WriteString(width.Narrow.String(string(r)))
+		}
+	}
+	return buf.String()
+}
@@ -0,0 +1,98 @@
+package paygent_test
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/qor/gomerchant"
+	"github.com/qor/gomerchant/gateways/paygent"
+	"golang.org/x/text/encoding/japanese"
+)
+
+func TestKanaConversion(t *testing.T) {
+	if got := paygent.ToFullWidthKana("ｶﾞｷﾞｸﾞﾊﾟﾝ ｱﾞ ABC"); got != "ガギグパン ア゛ ABC" {
+		t.Errorf("half-width kana should be converted to full-width, but got %v", got)
+	}
+
+	if got := paygent.ToHalfWidthKana("がっこう　パン゛ＡＢＣ"); got != "ｶﾞｯｺｳ ﾊﾟﾝﾞABC" {
+		t.Errorf("kana should be converted to half-width, but got %v", got)
+	}
+}
+
+func newRecordingPaygent(body chan string) *paygent.Paygent {
+	return paygent.New(&paygent.Config{
+		MerchantID: "12345",
+		Transport: roundTripFunc(func(request *http.Request) (*http.Response, error) {
+			data, _ := io.ReadAll(request.Body)
+			body <- string(data)
+			return &http.Response{
+				StatusCode: 200,
+				Header:     http.Header{"Content-Type": {"text/plain; charset=UTF-8"}},
+				Body:       io.NopCloser(strings.NewReader("result=0\r\npayment_id=2001")),
+			}, nil
+		}),
+	})
+}
+
+func TestRequestEncodesShiftJIS(t *testing.T) {
+	var (
+		body   = make(chan string, 1)
+		client = newRecordingPaygent(body)
+	)
+
+	if _, err := client.RequestTelegram(paygent.RakutenPayApplicationRequest{
+		PaymentAmount: 1000,
+		Goods:         []paygent.RakutenPayGood{{Name: "ﾃｽﾄ商品", ID: "test", Price: 1000, Amount: 1}},
+	}, nil); err != nil {
+		t.Fatalf("no error should happen when request, but got %v", err)
+	}
+
+	values, err := url.ParseQuery(<-body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := values.Get("goods[0]"); got != "\x83e\x83X\x83g\x8f\xa4\x95i" {
+		t.Errorf("goods name should be sent as full-width Shift_JIS, but got %q", got)
+	} else if decoded, _ := japanese.ShiftJIS.NewDecoder().String(got); decoded != "テスト商品" {
+		t.Errorf("goods name should be decoded to テスト商品, but got %v", decoded)
+	}
+}
+
+func TestRequestWithUnsupportedCharacters(t *testing.T) {
+	var (
+		body   = make(chan string, 1)
+		client = newRecordingPaygent(body)
+	)
+
+	_, err := client.Request("270", gomerchant.Params{"goods[0]": "Tシャツ😀"})
+
+	var charsetError paygent.CharsetError
+	if !errors.As(err, &charsetError) || charsetError.Field != "goods[0]" || charsetError.Char != '😀' {
+		t.Errorf("should get charset error, but got %v", err)
+	}
+
+	_, err = client.RequestTelegram(paygent.ThreeDS2AuthenticationRequest{
+		PaymentAmount:      100,
+		TermURL:            "https://example.com",
+		AuthenticationType: "01",
+		CardSetMethod:      "direct",
+		MerchantName:       "ショップ😀",
+	}, nil)
+	if !errors.As(err, &charsetError) || charsetError.Field != "merchant_name" {
+		t.Errorf("should get charset error, but got %v", err)
+	}
+
+	if len(body) != 0 {
+		t.Errorf("request should not be sent if values can't be encoded")
+	}
+
+	client.Config.RequestCharset = "UTF-8"
+	if _, err := client.Request("270", gomerchant.Params{"goods[0]": "Tシャツ😀"}); err != nil {
+		t.Errorf("values should be sent as it is in UTF-8, but got %v", err)
+	}
+}
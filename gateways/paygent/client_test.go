@@ -0,0 +1,210 @@
+package paygent_test
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/qor/gomerchant"
+	"github.com/qor/gomerchant/gateways/paygent"
+)
+
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (fn roundTripFunc) RoundTrip(request *http.Request) (*http.Response, error) {
+	return fn(request)
+}
+
+func writeCertificateFile(t *testing.T, path string, commonName string) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	data = append(data, pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})...)
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestClientIsReused(t *testing.T) {
+	var (
+		mutex    sync.Mutex
+		requests []string
+		client   = paygent.New(&paygent.Config{
+			MerchantID: "12345",
+			Transport: roundTripFunc(func(request *http.Request) (*http.Response, error) {
+				request.ParseForm()
+				mutex.Lock()
+				requests = append(requests, request.Form.Get("payment_id"))
+				mutex.Unlock()
+
+				return &http.Response{
+					StatusCode: 200,
+					Header:     http.Header{"Content-Type": {"text/plain; charset=UTF-8"}},
+					Body:       io.NopCloser(strings.NewReader("result=0\r\npayment_id=" + request.Form.Get("payment_id") + "\r\npayment_status=20")),
+				}, nil
+			}),
+		})
+		wg sync.WaitGroup
+	)
+
+	first, err := client.Client()
+	if err != nil {
+		t.Fatalf("no error should happen when build client, but got %v", err)
+	}
+
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if c, err := client.Client(); err != nil || c != first {
+				t.Errorf("client should be reused, but got %v, %v", c, err)
+			}
+
+			if transaction, err := client.Query("1001"); err != nil || !transaction.Paid {
+				t.Errorf("no error should happen when query, but got %v, %+v", err, transaction)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if len(requests) != 10 {
+		t.Errorf("all requests should be sent with transport, but got %v", requests)
+	}
+}
+
+type closeRecorder struct {
+	io.Reader
+	closed *bool
+}
+
+func (body closeRecorder) Close() error {
+	*body.closed = true
+	return nil
+}
+
+func TestResponseBodyClosed(t *testing.T) {
+	var (
+		closed bool
+		client = paygent.New(&paygent.Config{
+			MerchantID: "12345",
+			Transport: roundTripFunc(func(request *http.Request) (*http.Response, error) {
+				return &http.Response{StatusCode: http.StatusServiceUnavailable, Body: closeRecorder{Reader: strings.NewReader("maintenance"), closed: &closed}}, nil
+			}),
+		})
+	)
+
+	if _, err := client.Query("1001"); err == nil {
+		t.Errorf("should fail with HTTP status")
+	}
+	if !closed {
+		t.Errorf("body of failed response should be closed")
+	}
+}
+
+func TestCookiesNotShared(t *testing.T) {
+	var (
+		cookies []string
+		client  = paygent.New(&paygent.Config{
+			MerchantID: "12345",
+			Transport: roundTripFunc(func(request *http.Request) (*http.Response, error) {
+				cookies = append(cookies, request.Header.Get("Cookie"))
+				return &http.Response{
+					StatusCode: 200,
+					Header:     http.Header{"Content-Type": {"text/plain; charset=UTF-8"}, "Set-Cookie": {"JSESSIONID=session-1; Path=/"}},
+					Body:       io.NopCloser(strings.NewReader("result=0\r\npayment_id=1001\r\npayment_status=20")),
+				}, nil
+			}),
+		})
+	)
+
+	client.Query("1001")
+	client.Query("1001")
+	if len(cookies) != 2 || cookies[1] != "" {
+		t.Errorf("cookies should not be shared between requests, got %q", cookies)
+	}
+}
+
+func TestClientReloadCertificates(t *testing.T) {
+	var (
+		dir       = t.TempDir()
+		certFile  = filepath.Join(dir, "client.pem")
+		reloadErr error
+		config    = &paygent.Config{ClientFilePath: certFile, CAFilePath: certFile, CertCheckInterval: time.Nanosecond, OnCertReloadError: func(err error) { reloadErr = err }}
+		client    = paygent.New(config)
+	)
+	writeCertificateFile(t, certFile, "first")
+
+	first, err := client.Client()
+	if err != nil {
+		t.Fatalf("no error should happen when build client, but got %v", err)
+	}
+
+	if first.Jar != nil {
+		t.Errorf("shared client should not keep cookies")
+	}
+
+	if config.ClientFileContent != "" || config.CAFileContent != "" {
+		t.Errorf("loaded certificates should not be written back to config")
+	}
+
+	if second, _ := client.Client(); second != first {
+		t.Errorf("client should be reused if certificates not changed")
+	}
+
+	writeCertificateFile(t, certFile, "second")
+	later := time.Now().Add(time.Minute)
+	os.Chtimes(certFile, later, later)
+
+	reloaded, err := client.Client()
+	if err != nil || reloaded == first {
+		t.Fatalf("client should be rebuilt after certificates changed, but got %v", err)
+	}
+
+	certificates := reloaded.Transport.(*http.Transport).TLSClientConfig.Certificates
+	if leaf, err := x509.ParseCertificate(certificates[0].Certificate[0]); err != nil || leaf.Subject.CommonName != "second" {
+		t.Errorf("should use reloaded certificate, but got %v", err)
+	}
+
+	os.WriteFile(certFile, []byte("broken"), 0600)
+	os.Chtimes(certFile, later.Add(time.Minute), later.Add(time.Minute))
+	if kept, err := client.Client(); err != nil || kept != reloaded {
+		t.Errorf("previous client should be kept if failed to reload certificates, but got %v", err)
+	}
+	if reloadErr == nil {
+		t.Errorf("failed reload should be reported")
+	}
+}
+
+func TestClientWithInvalidCertificates(t *testing.T) {
+	client := paygent.New(&paygent.Config{ClientFilePath: filepath.Join(t.TempDir(), "missing.pem")})
+
+	if _, err := client.Request("094", gomerchant.Params{"payment_id": "1001"}); err == nil {
+		t.Errorf("should get error when certificate file is missing")
+	}
+}
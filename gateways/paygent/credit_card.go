@@ -26,27 +26,26 @@ var brandsMap = map[string]string{"visa": "V", "master": "M", "american_express"
 func (paygent *Paygent) CreateCreditCard(creditCardParams gomerchant.CreateCreditCardParams) (gomerchant.CreditCardResponse, error) {
 	var (
 		response   = gomerchant.CreditCardResponse{CustomerID: creditCardParams.CustomerID}
+		result     CreateCardResponse
 		creditCard = creditCardParams.CreditCard
 		brand, _   = brandsMap[creditCard.Brand()]
 	)
 
-	params := gomerchant.Params{
-		"customer_id":     creditCardParams.CustomerID,
-		"card_number":     creditCard.Number,
-		"card_valid_term": getValidTerm(creditCard),
-		"cardholder_name": creditCard.Name,
-		"card_brand":      brand,
-	}.IgnoreBlankFields()
+	request := CreateCardRequest{
+		CustomerID:     creditCardParams.CustomerID,
+		CardNumber:     creditCard.Number,
+		CardValidTerm:  getValidTerm(creditCard),
+		CardholderName: creditCard.Name,
+		CardBrand:      brand,
+	}
 	if paygent.Config.SecurityCodeUse {
-		params.Set("security_code_use",1)
-		params.Set("card_conf_number",creditCard.CVC)
+		request.SecurityCodeUse = true
+		request.CardConfNumber = creditCard.CVC
 	}
-	results, err := paygent.Request("025", params)
+	results, err := paygent.RequestTelegram(request, &result)
 
 	if err == nil {
-		if customerCardID, ok := results.Get("customer_card_id"); ok {
-			response.CreditCardID = fmt.Sprint(customerCardID)
-		}
+		response.CreditCardID = result.CustomerCardID
 	}
 	response.Params = results.Params
 
@@ -55,7 +54,7 @@ func (paygent *Paygent) CreateCreditCard(creditCardParams gomerchant.CreateCredi
 
 func (paygent *Paygent) GetCreditCard(getCreditCardParams gomerchant.GetCreditCardParams) (gomerchant.GetCreditCardResponse, error) {
 	var response gomerchant.GetCreditCardResponse
-	results, err := paygent.Request("027", gomerchant.Params{"customer_id": getCreditCardParams.CustomerID, "credit_card_id": getCreditCardParams.CreditCardID})
+	results, err := paygent.RequestTelegram(ListCardsRequest{CustomerID: getCreditCardParams.CustomerID, CustomerCardID: getCreditCardParams.CreditCardID}, nil)
 
 	if err == nil {
 		cards, err := parseListCreditCardsResponse(&results)
@@ -73,7 +72,7 @@ func (paygent *Paygent) GetCreditCard(getCreditCardParams gomerchant.GetCreditCa
 func (paygent *Paygent) DeleteCreditCard(deleteCreditCardParams gomerchant.DeleteCreditCardParams) (gomerchant.DeleteCreditCardResponse, error) {
 	var response = gomerchant.DeleteCreditCardResponse{}
 
-	results, err := paygent.Request("026", gomerchant.Params{"customer_id": deleteCreditCardParams.CustomerID, "customer_card_id": deleteCreditCardParams.CreditCardID}.IgnoreBlankFields())
+	results, err := paygent.RequestTelegram(DeleteCardRequest{CustomerID: deleteCreditCardParams.CustomerID, CustomerCardID: deleteCreditCardParams.CreditCardID}, nil)
 	response.Params = results.Params
 	return response, err
 }
@@ -81,7 +80,7 @@ func (paygent *Paygent) DeleteCreditCard(deleteCreditCardParams gomerchant.Delet
 func (paygent *Paygent) ListCreditCards(listCreditCardsParams gomerchant.ListCreditCardsParams) (gomerchant.ListCreditCardsResponse, error) {
 	var response = gomerchant.ListCreditCardsResponse{}
 
-	results, err := paygent.Request("027", gomerchant.Params{"customer_id": listCreditCardsParams.CustomerID})
+	results, err := paygent.RequestTelegram(ListCardsRequest{CustomerID: listCreditCardsParams.CustomerID}, nil)
 
 	if err == nil {
 		response.CreditCards, err = parseListCreditCardsResponse(&results)
@@ -0,0 +1,50 @@
+package paygent
+
+import (
+	"github.com/qor/gomerchant"
+)
+
+// Electronic money telegram kinds
+const (
+	EMoneyApplicationTelegram  = "150"
+	EMoneyCompletionTelegram   = "151"
+	EMoneySalesTelegram        = "152"
+	EMoneyCancellationTelegram = "153"
+	EMoneyRefundTelegram       = "154"
+)
+
+// EMoneyApplicationMessage apply an electronic money payment, redirect user to the e-money service with `RedirectHTML` of the response
+// e-money service type like `emoney_type` should be set in params.Params
+func (paygent *Paygent) EMoneyApplicationMessage(amount uint64, params gomerchant.ApplicationParams) (gomerchant.ApplicationResponse, error) {
+	return paygent.redirectApplicationMessage(EMoneyApplicationTelegram, amount, params)
+}
+
+// EMoneyCompletionMessage complete electronic money payment after user returned from the e-money service
+func (paygent *Paygent) EMoneyCompletionMessage(transactionID string, params gomerchant.CompleteAuthorizeParams) (gomerchant.Transaction, error) {
+	return paygent.redirectCompletionMessage(EMoneyCompletionTelegram, transactionID, params)
+}
+
+// EMoneySalesMessage capture electronic money payment
+func (paygent *Paygent) EMoneySalesMessage(transactionID string) (gomerchant.CaptureResponse, error) {
+	results, err := paygent.Request(EMoneySalesTelegram, gomerchant.Params{"payment_id": transactionID})
+	response := gomerchant.CaptureResponse{Params: results.Params}
+	if paymentID, ok := getPaymentID(results); ok && err == nil {
+		response.TransactionID = paymentID
+	}
+	return response, err
+}
+
+// EMoneyCancellationMessage void electronic money payment before it is captured
+func (paygent *Paygent) EMoneyCancellationMessage(transactionID string) (gomerchant.VoidResponse, error) {
+	results, err := paygent.Request(EMoneyCancellationTelegram, gomerchant.Params{"payment_id": transactionID})
+	response := gomerchant.VoidResponse{Params: results.Params}
+	if paymentID, ok := getPaymentID(results); ok && err == nil {
+		response.TransactionID = paymentID
+	}
+	return response, err
+}
+
+// EMoneyRefundMessage refund captured electronic money payment, refund whole payment if amount is 0
+func (paygent *Paygent) EMoneyRefundMessage(transactionID string, amount uint) (gomerchant.RefundResponse, error) {
+	return paygent.redirectRefundMessage(EMoneyRefundTelegram, transactionID, amount)
+}
@@ -0,0 +1,227 @@
+package paygent
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/qor/gomerchant"
+)
+
+// NotificationSource source of payment notices, implemented by Paygent
+type NotificationSource interface {
+	InquiryNotification(noticeID string) (gomerchant.InquiryResponse, error)
+}
+
+var _ NotificationSource = &Paygent{}
+
+// Checkpoint persists ID of the last handled payment notice
+type Checkpoint interface {
+	Load() (string, error)
+	Save(noticeID string) error
+}
+
+// MemoryCheckpoint keeps notice ID in memory, poller will start from beginning after restarted
+type MemoryCheckpoint struct {
+	mutex    sync.Mutex
+	noticeID string
+}
+
+func (checkpoint *MemoryCheckpoint) Load() (string, error) {
+	checkpoint.mutex.Lock()
+	defer checkpoint.mutex.Unlock()
+	return checkpoint.noticeID, nil
+}
+
+func (checkpoint *MemoryCheckpoint) Save(noticeID string) error {
+	checkpoint.mutex.Lock()
+	defer checkpoint.mutex.Unlock()
+	checkpoint.noticeID = noticeID
+	return nil
+}
+
+// FileCheckpoint keeps notice ID in file, missing file means no notice has been handled
+type FileCheckpoint struct {
+	Path string
+}
+
+func (checkpoint FileCheckpoint) Load() (string, error) {
+	data, err := os.ReadFile(checkpoint.Path)
+	if os.IsNotExist(err) {
+		return "", nil
+	}
+	return strings.TrimSpace(string(data)), err
+}
+
+// Save write notice ID to a temporary file then rename it, so the checkpoint won't be truncated if process crashed
+func (checkpoint FileCheckpoint) Save(noticeID string) error {
+	file, err := os.CreateTemp(filepath.Dir(checkpoint.Path), filepath.Base(checkpoint.Path)+".*")
+	if err != nil {
+		return err
+	}
+
+	if _, err = file.WriteString(noticeID); err == nil {
+		err = file.Sync()
+	}
+	if e := file.Close(); err == nil {
+		err = e
+	}
+	if err == nil {
+		err = os.Rename(file.Name(), checkpoint.Path)
+	}
+
+	if err != nil {
+		os.Remove(file.Name())
+	}
+	return err
+}
+
+// NotificationEvent normalized payment notice
+type NotificationEvent struct {
+	NoticeID      string
+	OrderID       string
+	BasePaymentID string
+	ChangedAt     *time.Time
+	Transaction   gomerchant.Transaction
+	Inquiry       gomerchant.InquiryResponse
+}
+
+// NewNotificationEvent convert inquiry response of telegram 091 to notification event
+func NewNotificationEvent(inquiry gomerchant.InquiryResponse) NotificationEvent {
+	event := NotificationEvent{
+		NoticeID:      inquiry.PaymentNoticeID,
+		OrderID:       inquiry.TradingID,
+		BasePaymentID: inquiry.BasePaymentID,
+		Inquiry:       inquiry,
+		Transaction: gomerchant.Transaction{
+			ID:       inquiry.TransactionID,
+			Currency: "JPY",
+			Params:   inquiry.Params,
+		},
+	}
+
+	if i, err := strconv.Atoi(inquiry.PaymentAmount); err == nil {
+		event.Transaction.Amount = i
+	}
+
+	if t, err := time.ParseInLocation("20060102150405", inquiry.PaymentInitDate, PaygentServerTimeZone); err == nil {
+		event.Transaction.CreatedAt = &t
+	}
+
+	if t, err := time.ParseInLocation("20060102150405", inquiry.PaymentChangeDate, PaygentServerTimeZone); err == nil {
+		event.ChangedAt = &t
+	}
+
+	setTransactionStatus(&event.Transaction, inquiry.PaymentStatus)
+	return event
+}
+
+// NotificationPoller drains payment notices with telegram 091
+//
+// An event is delivered to Handler until it returns nil, then the checkpoint is moved to the event,
+// so events might be delivered more than once if the process stopped before checkpoint saved.
+type NotificationPoller struct {
+	Source     NotificationSource
+	Checkpoint Checkpoint
+	Handler    func(context.Context, NotificationEvent) error
+	OnError    func(error) // called when failed to inquiry notice, handle event or save checkpoint
+
+	MinInterval time.Duration // wait time when queue is empty or got error, default 1 second
+	MaxInterval time.Duration // wait time will be doubled until MaxInterval, default 1 minute
+}
+
+// Drain handle notices until the queue is empty, returns count of handled events
+func (poller *NotificationPoller) Drain(ctx context.Context) (count int, err error) {
+	if poller.Source == nil || poller.Handler == nil {
+		return 0, errors.New("notification poller requires source and handler")
+	}
+
+	checkpoint := poller.Checkpoint
+	if checkpoint == nil {
+		checkpoint = &MemoryCheckpoint{}
+		poller.Checkpoint = checkpoint
+	}
+
+	noticeID, err := checkpoint.Load()
+	if err != nil {
+		return 0, err
+	}
+
+	for ctx.Err() == nil {
+		inquiry, err := poller.Source.InquiryNotification(noticeID)
+		if err != nil {
+			return count, err
+		}
+
+		if inquiry.PaymentNoticeID == "" {
+			return count, nil
+		}
+
+		if err := poller.Handler(ctx, NewNotificationEvent(inquiry)); err != nil {
+			return count, err
+		}
+		count++
+
+		if err := checkpoint.Save(inquiry.PaymentNoticeID); err != nil {
+			return count, err
+		}
+		noticeID = inquiry.PaymentNoticeID
+	}
+
+	return count, nil
+}
+
+// Run drain notices until ctx is done, back off when queue is empty or got error.
+// A running handler is never interrupted, Run returns after it finished.
+func (poller *NotificationPoller) Run(ctx context.Context) error {
+	if poller.Source == nil || poller.Handler == nil {
+		return errors.New("notification poller requires source and handler")
+	}
+
+	var (
+		minInterval = poller.MinInterval
+		maxInterval = poller.MaxInterval
+	)
+
+	if minInterval <= 0 {
+		minInterval = time.Second
+	}
+
+	if maxInterval < minInterval {
+		maxInterval = time.Minute
+		if maxInterval < minInterval {
+			maxInterval = minInterval
+		}
+	}
+
+	interval := minInterval
+	for {
+		count, err := poller.Drain(ctx)
+		if err != nil && poller.OnError != nil {
+			poller.OnError(err)
+		}
+
+		if count > 0 && err == nil {
+			interval = minInterval
+		}
+
+		timer := time.NewTimer(interval)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil
+		case <-timer.C:
+		}
+
+		if count == 0 || err != nil {
+			if interval *= 2; interval > maxInterval {
+				interval = maxInterval
+			}
+		}
+	}
+}
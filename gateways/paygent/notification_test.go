@@ -0,0 +1,151 @@
+package paygent_test
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/qor/gomerchant"
+	"github.com/qor/gomerchant/gateways/paygent"
+)
+
+type fakeNotificationSource struct {
+	mutex   sync.Mutex
+	notices []gomerchant.InquiryResponse
+	calls   int
+}
+
+func (source *fakeNotificationSource) InquiryNotification(noticeID string) (gomerchant.InquiryResponse, error) {
+	source.mutex.Lock()
+	defer source.mutex.Unlock()
+	source.calls++
+
+	for idx, notice := range source.notices {
+		if noticeID == "" || (idx > 0 && source.notices[idx-1].PaymentNoticeID == noticeID) {
+			return notice, nil
+		}
+	}
+	return gomerchant.InquiryResponse{SuccessCode: "0"}, nil
+}
+
+func newFakeNotificationSource() *fakeNotificationSource {
+	return &fakeNotificationSource{notices: []gomerchant.InquiryResponse{
+		{TransactionID: "1001", TradingID: "order-1", PaymentNoticeID: "1", PaymentStatus: "20", PaymentAmount: "1000", PaymentInitDate: "20261001100000"},
+		{TransactionID: "1001", TradingID: "order-1", PaymentNoticeID: "2", PaymentStatus: "40", PaymentAmount: "1000", PaymentChangeDate: "20261002100000"},
+		{TransactionID: "1002", TradingID: "order-2", PaymentNoticeID: "3", PaymentStatus: "32", PaymentAmount: "500"},
+	}}
+}
+
+func TestNotificationPollerDrain(t *testing.T) {
+	var (
+		events     []paygent.NotificationEvent
+		failed     bool
+		checkpoint = &paygent.MemoryCheckpoint{}
+		poller     = paygent.NotificationPoller{
+			Source:     newFakeNotificationSource(),
+			Checkpoint: checkpoint,
+			Handler: func(ctx context.Context, event paygent.NotificationEvent) error {
+				if event.NoticeID == "2" && !failed {
+					failed = true
+					return errors.New("temporary failure")
+				}
+				events = append(events, event)
+				return nil
+			},
+		}
+	)
+
+	if count, err := poller.Drain(context.Background()); err == nil || count != 1 {
+		t.Fatalf("should stop at failed event, but got %v, %v", count, err)
+	}
+
+	if noticeID, _ := checkpoint.Load(); noticeID != "1" {
+		t.Errorf("checkpoint should stay at last handled notice, but got %v", noticeID)
+	}
+
+	if count, err := poller.Drain(context.Background()); err != nil || count != 2 {
+		t.Fatalf("should redeliver failed event, but got %v, %v", count, err)
+	}
+
+	if len(events) != 3 || events[1].NoticeID != "2" {
+		t.Fatalf("should get all events, but got %+v", events)
+	}
+
+	if captured := events[1].Transaction; !captured.Captured || !captured.Paid || captured.Amount != 1000 || events[1].ChangedAt == nil {
+		t.Errorf("captured event is not correct, but got %+v", events[1])
+	}
+
+	if cancelled := events[2].Transaction; !cancelled.Cancelled || cancelled.ID != "1002" || events[2].OrderID != "order-2" {
+		t.Errorf("cancelled event is not correct, but got %+v", events[2])
+	}
+
+	if noticeID, _ := checkpoint.Load(); noticeID != "3" {
+		t.Errorf("checkpoint should be moved to last notice, but got %v", noticeID)
+	}
+}
+
+func TestNotificationPollerRun(t *testing.T) {
+	var (
+		mutex       sync.Mutex
+		events      int
+		ctx, cancel = context.WithCancel(context.Background())
+		source      = newFakeNotificationSource()
+		poller      = paygent.NotificationPoller{
+			Source:      source,
+			Checkpoint:  paygent.FileCheckpoint{Path: filepath.Join(t.TempDir(), "checkpoint")},
+			MinInterval: time.Millisecond,
+			MaxInterval: 5 * time.Millisecond,
+			Handler: func(ctx context.Context, event paygent.NotificationEvent) error {
+				mutex.Lock()
+				defer mutex.Unlock()
+				events++
+				return nil
+			},
+		}
+		done = make(chan error)
+	)
+
+	go func() { done <- poller.Run(ctx) }()
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("no error should happen when stop poller, but got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("poller should stop after context cancelled")
+	}
+
+	if events != 3 {
+		t.Errorf("each event should be handled once, but got %v", events)
+	}
+
+	if noticeID, err := poller.Checkpoint.Load(); err != nil || noticeID != "3" {
+		t.Errorf("checkpoint should be saved to file, but got %v, %v", noticeID, err)
+	}
+
+	if source.calls < 5 {
+		t.Errorf("poller should keep polling when queue is empty, but only called %v times", source.calls)
+	}
+}
+
+func TestFileCheckpoint(t *testing.T) {
+	checkpoint := paygent.FileCheckpoint{Path: filepath.Join(t.TempDir(), "checkpoint")}
+
+	if noticeID, err := checkpoint.Load(); err != nil || noticeID != "" {
+		t.Errorf("should get blank notice id from missing file, but got %v, %v", noticeID, err)
+	}
+
+	if err := checkpoint.Save("12345"); err != nil {
+		t.Fatal(err)
+	}
+
+	if noticeID, err := checkpoint.Load(); err != nil || noticeID != "12345" {
+		t.Errorf("should get saved notice id, but got %v, %v", noticeID, err)
+	}
+}
@@ -0,0 +1,35 @@
+package paygent
+
+import (
+	"fmt"
+
+	"github.com/qor/gomerchant"
+)
+
+var _ gomerchant.OrderLookup = &Paygent{}
+
+// paymentNotFoundResponseCode response code of 094 if no payment found
+const paymentNotFoundResponseCode = "P010"
+
+// QueryByOrderID query the latest payment of order (trading id) with 094 reference inquiry,
+// payments minted by amount corrections share the trading id, so the returned payment is the one to capture, refund or void
+func (paygent *Paygent) QueryByOrderID(orderID string) (gomerchant.Transaction, error) {
+	if orderID == "" {
+		return gomerchant.Transaction{}, fmt.Errorf("%w: order id is blank", gomerchant.ErrTransactionNotFound)
+	}
+
+	transaction, err := paygent.query(PaymentRefRequest{TradingID: orderID})
+	if err != nil && transaction.Params["response_code"] == paymentNotFoundResponseCode {
+		err = fmt.Errorf("%w: %v", gomerchant.ErrTransactionNotFound, err)
+	}
+	return transaction, err
+}
+
+// VoidByOrderID cancel the latest payment of order, authorized payments are cancelled with 021, captured payments with 023
+func (paygent *Paygent) VoidByOrderID(orderID string, params gomerchant.VoidParams) (gomerchant.VoidResponse, error) {
+	transaction, err := paygent.QueryByOrderID(orderID)
+	if err != nil {
+		return gomerchant.VoidResponse{Params: transaction.Params}, err
+	}
+	return gomerchant.VoidTransaction(paygent, transaction, params)
+}
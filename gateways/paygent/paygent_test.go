@@ -3,17 +3,20 @@ package paygent_test
 import (
 	"context"
 	"fmt"
-	"os"
 	"testing"
 	"time"
 
 	"github.com/jinzhu/configor"
 	"github.com/qor/gomerchant"
 	"github.com/qor/gomerchant/gateways/paygent"
+	"github.com/qor/gomerchant/gateways/paygent/paygenttest"
 	"github.com/qor/gomerchant/tests"
 )
 
-var Paygent *paygent.Paygent
+var (
+	Paygent   *paygent.Paygent
+	Simulated bool
+)
 
 type Config struct {
 	MerchantID      string `required:"true"`
@@ -33,8 +36,10 @@ type Config struct {
 func init() {
 	var config = &Config{}
 	if err := configor.New(&configor.Config{ENVPrefix: "PAYGENT_CONFIG"}).Load(config); err != nil {
-		fmt.Println(config)
-		os.Exit(1)
+		// run tests against local simulator if sandbox is not configured
+		fmt.Println(err)
+		Paygent, Simulated = paygenttest.NewServer().Paygent(), true
+		return
 	}
 
 	Paygent = paygent.New(&paygent.Config{
@@ -50,17 +55,32 @@ func init() {
 	})
 }
 
+func requireConfig(t *testing.T) {
+	if Paygent == nil {
+		t.Skip("paygent is not configured, set PAYGENT_CONFIG_* to run this test")
+	}
+}
+
+// requireSandbox skip tests depend on data of paygent sandbox, like registered customers
+func requireSandbox(t *testing.T) {
+	if Paygent == nil || Simulated {
+		t.Skip("paygent sandbox is not configured, set PAYGENT_CONFIG_* to run this test")
+	}
+}
+
 func TestTestSuite(t *testing.T) {
+	requireConfig(t)
 	tests.TestSuite{
 		CreditCardManager: Paygent,
 		Gateway:           Paygent,
 		GetRandomCustomerID: func() string {
-			return fmt.Sprint(time.Now().Unix())
+			return fmt.Sprint(time.Now().UnixNano())
 		},
 	}.TestAll(t)
 }
 
 func Test3DAuthorizeAndCapture(t *testing.T) {
+	requireConfig(t)
 	cards := map[string]bool{
 		"5123459358515820": true,
 		"5123459358515821": false,
@@ -104,6 +124,7 @@ func Test3DAuthorizeAndCapture(t *testing.T) {
 }
 
 func TestStart3DS2Authentication(t *testing.T) {
+	requireSandbox(t)
 	// for new creditcard
 	res, err := Paygent.Start3DS2Authentication(context.Background(), gomerchant.Start3DS2AuthenticationParams{
 		OrderID: fmt.Sprint(time.Now().Unix()),
@@ -171,6 +192,7 @@ func TestStart3DS2Authentication(t *testing.T) {
 }
 
 func Test3DS2Authorization(t *testing.T) {
+	requireSandbox(t)
 	resp, err := Paygent.Authorize(200000, gomerchant.AuthorizeParams{
 		Currency: "JPY",
 		OrderID:  fmt.Sprint(time.Now().Unix()),
@@ -0,0 +1,101 @@
+package paygenttest
+
+import (
+	"encoding/csv"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"golang.org/x/text/encoding/japanese"
+)
+
+// uploadBatch process records of request file at once, result file could be downloaded with returned file_id
+func (server *Server) uploadBatch(t telegram) *reply {
+	if len(t.Data) == 0 {
+		return failure("P002", "ファイルが指定されていません")
+	}
+
+	server.sequence++
+	fileID := strconv.Itoa(server.sequence)
+	server.batches[fileID] = server.processBatch(t.Data)
+
+	r := success()
+	r.Set("file_id", fileID)
+	return r
+}
+
+// processBatch process Shift_JIS CSV request file, returns records of result file
+func (server *Server) processBatch(data []byte) [][]string {
+	invalid := [][]string{{"1", "1", "P001", "ファイル形式が不正です"}}
+
+	body, err := japanese.ShiftJIS.NewDecoder().Bytes(data)
+	if err != nil {
+		return invalid
+	}
+
+	reader := csv.NewReader(strings.NewReader(string(body)))
+	reader.FieldsPerRecord = -1
+	records, err := reader.ReadAll()
+	if err != nil || len(records) < 2 {
+		return invalid
+	}
+
+	header, trailer, lines := records[0], records[len(records)-1], records[1:len(records)-1]
+	if len(header) != 4 || header[0] != "1" || header[1] != server.MerchantID || len(trailer) != 2 || trailer[0] != "3" || trailer[1] != strconv.Itoa(len(lines)) {
+		return invalid
+	}
+
+	var (
+		results   = [][]string{{"1", "0", "", ""}}
+		successes int
+	)
+	for _, line := range lines {
+		if len(line) != 8 || line[0] != "2" {
+			return invalid
+		}
+
+		t := telegram{Kind: line[2], Values: url.Values{}}
+		for idx, key := range []string{"payment_id", "trading_id", "payment_amount", "customer_id", "customer_card_id"} {
+			if value := line[idx+3]; value != "" {
+				t.Values.Set(key, value)
+			}
+		}
+		if t.Kind == "020" {
+			t.Values.Set("stock_card_mode", "1")
+		}
+
+		var r *reply
+		switch t.Kind {
+		case "020", "021", "022", "023":
+			r = server.dispatch(t)
+		default:
+			r = failure("P001", "電文種別が不正です")
+		}
+
+		result := []string{"2", line[1], t.Kind, r.Values["result"], r.Values["response_code"], r.Values["response_detail"], r.Values["payment_id"], t.Get("trading_id")}
+		if payment, ok := server.payments[r.Values["payment_id"]]; ok {
+			result[7] = payment.TradingID
+		}
+		if r.Values["result"] == "0" {
+			successes++
+		}
+		results = append(results, result)
+	}
+
+	return append(results, []string{"3", strconv.Itoa(len(lines)), strconv.Itoa(successes), strconv.Itoa(len(lines) - successes)})
+}
+
+// batchResult result file of uploaded batch
+func (server *Server) batchResult(t telegram) *reply {
+	records, ok := server.batches[t.Get("file_id")]
+	if !ok {
+		return failure("P010", "ファイルが存在しません")
+	}
+
+	// reply's CSV is quoted when written, so write a copy
+	result := make([][]string, len(records))
+	for idx, record := range records {
+		result[idx] = append([]string{}, record...)
+	}
+	return &reply{CSV: result}
+}
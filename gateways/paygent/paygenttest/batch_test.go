@@ -0,0 +1,62 @@
+package paygenttest_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/qor/gomerchant"
+	"github.com/qor/gomerchant/gateways/paygent"
+	"github.com/qor/gomerchant/gateways/paygent/paygenttest"
+)
+
+func TestBatch(t *testing.T) {
+	server := paygenttest.NewServer()
+	defer server.Close()
+	client := server.Paygent()
+
+	authorized := authorize(t, client, "4242424242424242")
+	voided := authorize(t, client, "4242424242424242")
+	card, err := client.CreateCreditCard(gomerchant.CreateCreditCardParams{
+		CustomerID: "customer-1",
+		CreditCard: &gomerchant.CreditCard{Name: "VISA", Number: "4242424242424242", ExpMonth: 1, ExpYear: uint(time.Now().Year() + 1)},
+	})
+	if err != nil {
+		t.Fatalf("failed to create credit card, got %v", err)
+	}
+
+	response, err := client.SubmitBatch(paygent.Batch{
+		Records: []paygent.BatchRecord{
+			paygent.BatchCapture{PaymentID: authorized.TransactionID},
+			paygent.BatchVoid{PaymentID: voided.TransactionID},
+			paygent.BatchStoredCardCharge{OrderID: "order-2", Amount: 500, CustomerID: "customer-1", CreditCardID: card.CreditCardID},
+			paygent.BatchCapture{PaymentID: "99999999"},
+		},
+	})
+	if err != nil || response.FileID == "" {
+		t.Fatalf("failed to submit batch, got %v, %+v", err, response)
+	}
+
+	result, err := client.BatchResult(response.FileID)
+	if err != nil {
+		t.Fatalf("failed to get batch result, got %v", err)
+	}
+
+	if len(result.Successes) != 3 || len(result.Failures) != 1 || result.Failures[0].Line != 4 || result.Failures[0].ResponseCode != "P010" {
+		t.Errorf("batch result is not correct, got %+v", result)
+	}
+	if payment, _ := server.Payment(authorized.TransactionID); payment.Status != "40" {
+		t.Errorf("payment should be captured, got %+v", payment)
+	}
+	if payment, _ := server.Payment(voided.TransactionID); payment.Status != "32" {
+		t.Errorf("payment should be voided, got %+v", payment)
+	}
+	if charge := result.Successes[2]; charge.TradingID != "order-2" {
+		t.Errorf("stored card should be charged, got %+v", charge)
+	} else if payment, _ := server.Payment(charge.PaymentID); payment.Amount != 500 || payment.CardID != card.CreditCardID {
+		t.Errorf("stored card should be charged, got %+v", payment)
+	}
+
+	if _, err := client.BatchResult("unknown"); err == nil {
+		t.Errorf("should fail to get result of unknown file")
+	}
+}
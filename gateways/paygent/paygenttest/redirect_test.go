@@ -0,0 +1,134 @@
+package paygenttest_test
+
+import (
+	"html"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/qor/gomerchant"
+	"github.com/qor/gomerchant/gateways/paygent"
+	"github.com/qor/gomerchant/gateways/paygent/paygenttest"
+)
+
+var hiddenInput = regexp.MustCompile(`name="([^"]*)" value="([^"]*)"`)
+
+// returnRequest request that user's browser posts to return url with redirect html, extra values are merged to it
+func returnRequest(redirectHTML string, extra url.Values) *http.Request {
+	values := url.Values{}
+	for _, match := range hiddenInput.FindAllStringSubmatch(redirectHTML, -1) {
+		values.Set(html.UnescapeString(match[1]), html.UnescapeString(match[2]))
+	}
+	for key, vs := range extra {
+		values[key] = vs
+	}
+
+	request := httptest.NewRequest("POST", "https://example.com/return", strings.NewReader(values.Encode()))
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return request
+}
+
+type redirectPayment struct {
+	name         string
+	paymentType  string
+	application  func(uint64, gomerchant.ApplicationParams) (gomerchant.ApplicationResponse, error)
+	completion   func(string, gomerchant.CompleteAuthorizeParams) (gomerchant.Transaction, error)
+	sales        func(string) (gomerchant.CaptureResponse, error)
+	cancellation func(string) (gomerchant.VoidResponse, error)
+	refund       func(string, uint) (gomerchant.RefundResponse, error)
+}
+
+func redirectPayments(client *paygent.Paygent) []redirectPayment {
+	return []redirectPayment{
+		{"PayPal", "paypal", client.PayPalApplicationMessage, client.PayPalCompletionMessage, client.PayPalSalesMessage, client.PayPalCancellationMessage, client.PayPalRefundMessage},
+		{"e-money", "emoney", client.EMoneyApplicationMessage, client.EMoneyCompletionMessage, client.EMoneySalesMessage, client.EMoneyCancellationMessage, client.EMoneyRefundMessage},
+	}
+}
+
+func TestPayPalAndEMoney(t *testing.T) {
+	server := paygenttest.NewServer()
+	defer server.Close()
+
+	for _, p := range redirectPayments(server.Paygent()) {
+		apply := func() gomerchant.ApplicationResponse {
+			response, err := p.application(1000, gomerchant.ApplicationParams{ReturnUrl: "https://example.com/return", CancelUrl: "https://example.com/cancel"})
+			if err != nil || response.TransactionID == "" || response.RedirectHTML == "" {
+				t.Fatalf("%v: failed to apply, got %v, %+v", p.name, err, response)
+			}
+			return response
+		}
+		complete := func(response gomerchant.ApplicationResponse) {
+			params := gomerchant.CompleteAuthorizeParams{Params: gomerchant.Params{"request": returnRequest(response.RedirectHTML, nil)}}
+			if transaction, err := p.completion(response.TransactionID, params); err != nil || transaction.ID != response.TransactionID {
+				t.Fatalf("%v: failed to complete, got %v, %+v", p.name, err, transaction)
+			}
+		}
+
+		response := apply()
+		if payment, _ := server.Payment(response.TransactionID); payment.Type != p.paymentType || payment.Status != "10" {
+			t.Errorf("%v: payment should be applied, got %+v", p.name, payment)
+		}
+		if _, err := p.sales(response.TransactionID); err == nil {
+			t.Errorf("%v: should not capture uncompleted payment", p.name)
+		}
+
+		complete(response)
+		if _, err := p.sales(response.TransactionID); err != nil {
+			t.Fatalf("%v: failed to capture, got %v", p.name, err)
+		}
+		if _, err := p.refund(response.TransactionID, 100); err != nil {
+			t.Errorf("%v: failed to refund partially, got %v", p.name, err)
+		}
+		if payment, _ := server.Payment(response.TransactionID); payment.Amount != 900 || payment.Status != "40" {
+			t.Errorf("%v: payment should be refunded partially, got %+v", p.name, payment)
+		}
+		if _, err := p.refund(response.TransactionID, 0); err != nil {
+			t.Errorf("%v: failed to refund, got %v", p.name, err)
+		}
+		if payment, _ := server.Payment(response.TransactionID); payment.Status != "60" {
+			t.Errorf("%v: payment should be refunded, got %+v", p.name, payment)
+		}
+
+		response = apply()
+		complete(response)
+		if _, err := p.cancellation(response.TransactionID); err != nil {
+			t.Errorf("%v: failed to cancel, got %v", p.name, err)
+		}
+		if payment, _ := server.Payment(response.TransactionID); payment.Status != "32" {
+			t.Errorf("%v: payment should be cancelled, got %+v", p.name, payment)
+		}
+	}
+}
+
+func TestRedirectCompletionIgnoresPostedFields(t *testing.T) {
+	server := paygenttest.NewServer()
+	defer server.Close()
+
+	for _, p := range redirectPayments(server.Paygent()) {
+		other, err := p.application(500, gomerchant.ApplicationParams{ReturnUrl: "https://example.com/return"})
+		if err != nil {
+			t.Fatalf("%v: failed to apply, got %v", p.name, err)
+		}
+		response, err := p.application(1000, gomerchant.ApplicationParams{ReturnUrl: "https://example.com/return"})
+		if err != nil {
+			t.Fatalf("%v: failed to apply, got %v", p.name, err)
+		}
+
+		// values posted to return url are controlled by user
+		forged := url.Values{"payment_id": {other.TransactionID}, "telegram_kind": {"134"}, "merchant_id": {"forged"}}
+		params := gomerchant.CompleteAuthorizeParams{Params: gomerchant.Params{"request": returnRequest(response.RedirectHTML, forged)}}
+		if transaction, err := p.completion(response.TransactionID, params); err != nil || transaction.ID != response.TransactionID {
+			t.Errorf("%v: posted fields should be ignored, got %v, %+v", p.name, err, transaction)
+		}
+
+		if payment, _ := server.Payment(response.TransactionID); payment.Status != "20" {
+			t.Errorf("%v: payment should be completed, got %+v", p.name, payment)
+		}
+		if payment, _ := server.Payment(other.TransactionID); payment.Status != "10" {
+			t.Errorf("%v: other payment should not be completed, got %+v", p.name, payment)
+		}
+	}
+}
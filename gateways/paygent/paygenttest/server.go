@@ -0,0 +1,252 @@
+// Package paygenttest provides a local Paygent simulator for offline testing.
+//
+// The simulator is an httptest.Server with mutual TLS, it speaks Paygent telegram protocol
+// with Shift_JIS bodies, and keeps payments, stored cards and payment notices in memory.
+package paygenttest
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"time"
+
+	"github.com/qor/gomerchant/gateways/paygent"
+)
+
+// Server Paygent simulator
+type Server struct {
+	*httptest.Server
+
+	MerchantID      string
+	ConnectID       string
+	ConnectPassword string
+
+	// ClientPEM client certificate and its private key, CAPEM CA that signed server and client certificates
+	ClientPEM string
+	CAPEM     string
+
+	// ThreeDSecureCards cards that require 3D Secure when authorized without `3dsecure_ryaku`
+	ThreeDSecureCards map[string]bool
+	// DeclinedCards cards that will be declined, value is the response code
+	DeclinedCards map[string]string
+
+	mutex    sync.Mutex
+	sequence int
+	payments map[string]*Payment
+	cards    map[string][]*Card
+	notices  []Notice
+	failures map[string]*Failure
+	batches  map[string][][]string // result files of uploaded batches
+}
+
+// Payment payment kept in simulator
+type Payment struct {
+	ID            string
+	TradingID     string
+	BasePaymentID string
+	Type          string // card, rakuten_pay, paypay, paypal, emoney
+	Status        string
+	Amount        uint64
+	CustomerID    string
+	CardID        string
+	CreatedAt     time.Time
+	ChangedAt     time.Time
+}
+
+// Card stored card kept in simulator
+type Card struct {
+	CustomerID string
+	ID         string
+	Number     string
+	ValidTerm  string
+	HolderName string
+	Brand      string
+}
+
+// Notice payment notice, a notice is created every time a payment's status changed
+type Notice struct {
+	ID      string
+	Payment Payment
+}
+
+// Failure injected failure of a telegram kind
+type Failure struct {
+	ResponseCode   string
+	ResponseDetail string
+	StatusCode     int           // respond with this HTTP status code instead of a failed telegram
+	Delay          time.Duration // wait before respond, for timeout tests
+	Times          int           // fail next n requests, fail all requests if it is 0
+	// a failure without ResponseCode, StatusCode and Delay responds with response code E9999
+}
+
+// NewServer start a simulator, close it with Close after used
+func NewServer() *Server {
+	server := &Server{
+		MerchantID:        "12345",
+		ConnectID:         "test_connect_id",
+		ConnectPassword:   "test_connect_password",
+		ThreeDSecureCards: map[string]bool{"5123459358515820": true},
+		DeclinedCards:     map[string]string{"4000000000000002": "P012"},
+		sequence:          10000000,
+		payments:          map[string]*Payment{},
+		cards:             map[string][]*Card{},
+		failures:          map[string]*Failure{},
+		batches:           map[string][][]string{},
+	}
+
+	caCert, caKey := newCA()
+	serverCert, _ := newCertificate(caCert, caKey, "paygenttest server")
+	_, server.ClientPEM = newCertificate(caCert, caKey, "paygenttest client")
+	server.CAPEM = string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: caCert.Raw}))
+
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(caCert)
+
+	server.Server = httptest.NewUnstartedServer(http.HandlerFunc(server.serveTelegram))
+	server.Server.TLS = &tls.Config{
+		Certificates: []tls.Certificate{serverCert},
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		ClientCAs:    clientCAs,
+	}
+	server.StartTLS()
+
+	return server
+}
+
+// Config paygent config that connects to the simulator
+func (server *Server) Config() *paygent.Config {
+	return &paygent.Config{
+		MerchantID:        server.MerchantID,
+		ConnectID:         server.ConnectID,
+		ConnectPassword:   server.ConnectPassword,
+		MerchantName:      "テストショップ",
+		TelegramVersion:   "1.0",
+		ClientFileContent: server.ClientPEM,
+		CAFileContent:     server.CAPEM,
+		ServiceDomain:     server.URL,
+	}
+}
+
+// Paygent paygent client that connects to the simulator
+func (server *Server) Paygent() *paygent.Paygent {
+	return paygent.New(server.Config())
+}
+
+// InjectFailure fail requests of telegram kind
+func (server *Server) InjectFailure(telegramKind string, failure Failure) {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+
+	if failure.ResponseCode == "" && failure.StatusCode == 0 && failure.Delay == 0 {
+		failure.ResponseCode = "E9999"
+	}
+	server.failures[telegramKind] = &failure
+}
+
+// ClearFailures remove all injected failures
+func (server *Server) ClearFailures() {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+	server.failures = map[string]*Failure{}
+}
+
+// Payment get payment by id
+func (server *Server) Payment(paymentID string) (Payment, bool) {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+
+	if payment, ok := server.payments[paymentID]; ok {
+		return *payment, true
+	}
+	return Payment{}, false
+}
+
+// Confirm simulate user confirmed a redirect payment (rakuten pay, paypay) on the payment service page
+func (server *Server) Confirm(paymentID string) bool {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+
+	if payment, ok := server.payments[paymentID]; ok && payment.Status == "10" {
+		server.changeStatus(payment, "20")
+		return true
+	}
+	return false
+}
+
+// Notices all payment notices
+func (server *Server) Notices() []Notice {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+	return append([]Notice{}, server.notices...)
+}
+
+func newCA() (*x509.Certificate, *ecdsa.PrivateKey) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		panic(err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "paygenttest CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(24 * time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+		BasicConstraintsValid: true,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		panic(err)
+	}
+
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		panic(err)
+	}
+	return cert, key
+}
+
+// newCertificate create certificate signed by CA, returns certificate and its RSA private key in the format of paygent client file as well
+func newCertificate(caCert *x509.Certificate, caKey *ecdsa.PrivateKey, commonName string) (tls.Certificate, string) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		panic(err)
+	}
+
+	serial, _ := rand.Int(rand.Reader, big.NewInt(1<<62))
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(24 * time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1"), net.IPv6loopback},
+		DNSNames:     []string{"localhost"},
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, caCert, &key.PublicKey, caKey)
+	if err != nil {
+		panic(err)
+	}
+
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		panic(err)
+	}
+	return cert, string(certPEM) + string(keyPEM)
+}
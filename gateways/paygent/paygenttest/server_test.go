@@ -0,0 +1,355 @@
+package paygenttest_test
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/qor/gomerchant"
+	"github.com/qor/gomerchant/gateways/paygent"
+	"github.com/qor/gomerchant/gateways/paygent/paygenttest"
+)
+
+func authorize(t *testing.T, client *paygent.Paygent, number string) gomerchant.AuthorizeResponse {
+	t.Helper()
+	response, err := client.Authorize(1000, gomerchant.AuthorizeParams{
+		Currency: "JPY",
+		OrderID:  "order-1",
+		PaymentMethod: &gomerchant.PaymentMethod{
+			CreditCard: &gomerchant.CreditCard{Name: "VISA", Number: number, ExpMonth: 1, ExpYear: uint(time.Now().Year() + 1), CVC: "123"},
+		},
+	})
+	if err != nil {
+		t.Fatalf("failed to authorize, got %v", err)
+	}
+	return response
+}
+
+func TestPaymentStatus(t *testing.T) {
+	server := paygenttest.NewServer()
+	defer server.Close()
+	client := server.Paygent()
+
+	authorizeResponse := authorize(t, client, "4242424242424242")
+	if payment, _ := server.Payment(authorizeResponse.TransactionID); payment.Status != "20" || payment.TradingID != "order-1" {
+		t.Errorf("payment should be authorized, but got %+v", payment)
+	}
+
+	captureResponse, err := client.Capture(authorizeResponse.TransactionID, gomerchant.CaptureParams{})
+	if err != nil {
+		t.Fatalf("failed to capture, got %v", err)
+	}
+
+	refundResponse, err := client.Refund(captureResponse.TransactionID, 100, gomerchant.RefundParams{Captured: true})
+	if err != nil {
+		t.Fatalf("failed to refund, got %v", err)
+	}
+
+	if refundResponse.TransactionID == authorizeResponse.TransactionID {
+		t.Errorf("refund should mint a new payment id")
+	}
+
+	transaction, err := client.Query(refundResponse.TransactionID)
+	if err != nil || transaction.Amount != 900 || !transaction.Captured {
+		t.Errorf("refunded transaction is not correct, got %v, %+v", err, transaction)
+	}
+
+	if payment, _ := server.Payment(authorizeResponse.TransactionID); payment.Status != "60" {
+		t.Errorf("base payment should be cancelled, but got %v", payment.Status)
+	}
+
+	// captured payment can't be captured again
+	if _, err := client.Capture(refundResponse.TransactionID, gomerchant.CaptureParams{}); err == nil {
+		t.Errorf("should not capture a captured payment")
+	}
+}
+
+func TestSecurityCodeResult(t *testing.T) {
+	server := paygenttest.NewServer()
+	defer server.Close()
+	client := server.Paygent()
+
+	if response := authorize(t, client, "4242424242424242"); response.CVCResult != gomerchant.CheckUnchecked {
+		t.Errorf("security code should not be checked, but got %v", response.CVCResult)
+	}
+
+	// a matched security code is not reported by paygent, it shouldn't be inferred
+	client.Config.SecurityCodeUse = true
+	if response := authorize(t, client, "4242424242424242"); response.CVCResult != gomerchant.CheckUnchecked || response.AVSResult.Failed() {
+		t.Errorf("security code result should be unchecked, but got %+v", response)
+	}
+}
+
+func TestWalletTokensNotSupported(t *testing.T) {
+	server := paygenttest.NewServer()
+	defer server.Close()
+	client := server.Paygent()
+
+	paymentMethod := &gomerchant.PaymentMethod{NetworkToken: &gomerchant.NetworkToken{Number: "4242424242424242", ExpMonth: 1, ExpYear: uint(time.Now().Year() + 1), Cryptogram: "AgAAAAAABk4DWZ4C28yUQAAAAAA=", Wallet: "google_pay"}}
+	if _, err := client.Authorize(1000, gomerchant.AuthorizeParams{PaymentMethod: paymentMethod}); err != gomerchant.ErrNotSupportedPaymentMethod {
+		t.Errorf("network token should not be supported, got %v", err)
+	}
+
+	paymentMethod = &gomerchant.PaymentMethod{DeviceToken: &gomerchant.DeviceToken{Number: "4242424242424242", ExpMonth: 1, ExpYear: uint(time.Now().Year() + 1), Cryptogram: "AgAAAAAABk4DWZ4C28yUQAAAAAA=", Wallet: "apple_pay"}}
+	if _, err := client.Authorize(1000, gomerchant.AuthorizeParams{PaymentMethod: paymentMethod}); err != gomerchant.ErrNotSupportedPaymentMethod {
+		t.Errorf("device token should not be supported, got %v", err)
+	}
+}
+
+func TestDeclinedCard(t *testing.T) {
+	server := paygenttest.NewServer()
+	defer server.Close()
+
+	_, err := server.Paygent().Authorize(1000, gomerchant.AuthorizeParams{
+		Currency: "JPY",
+		PaymentMethod: &gomerchant.PaymentMethod{
+			CreditCard: &gomerchant.CreditCard{Number: "4000000000000002", ExpMonth: 1, ExpYear: uint(time.Now().Year() + 1)},
+		},
+	})
+	if err == nil {
+		t.Errorf("declined card should fail")
+	}
+}
+
+func TestInjectFailure(t *testing.T) {
+	server := paygenttest.NewServer()
+	defer server.Close()
+	client := server.Paygent()
+
+	server.InjectFailure("022", paygenttest.Failure{ResponseCode: "E1001", ResponseDetail: "メンテナンス中", Times: 1})
+	authorizeResponse := authorize(t, client, "4242424242424242")
+
+	if response, err := client.Capture(authorizeResponse.TransactionID, gomerchant.CaptureParams{}); err == nil || response.Params["response_code"] != "E1001" {
+		t.Errorf("injected failure should be returned, got %v, %+v", err, response)
+	}
+
+	if _, err := client.Capture(authorizeResponse.TransactionID, gomerchant.CaptureParams{}); err != nil {
+		t.Errorf("failure should only be injected once, but got %v", err)
+	}
+
+	server.InjectFailure("094", paygenttest.Failure{StatusCode: http.StatusServiceUnavailable})
+	if _, err := client.Query(authorizeResponse.TransactionID); err == nil {
+		t.Errorf("should fail with HTTP status")
+	}
+
+	server.ClearFailures()
+	server.InjectFailure("094", paygenttest.Failure{Delay: time.Second})
+	slowClient := paygent.New(server.Config())
+	slowClient.Config.Timeout = 50 * time.Millisecond
+	if _, err := slowClient.Query(authorizeResponse.TransactionID); err == nil {
+		t.Errorf("should time out")
+	}
+}
+
+func TestNotifications(t *testing.T) {
+	server := paygenttest.NewServer()
+	defer server.Close()
+	client := server.Paygent()
+
+	authorizeResponse := authorize(t, client, "4242424242424242")
+	client.Void(authorizeResponse.TransactionID, gomerchant.VoidParams{})
+
+	var statuses []string
+	poller := paygent.NotificationPoller{
+		Source:     client,
+		Checkpoint: &paygent.MemoryCheckpoint{},
+		Handler: func(ctx context.Context, event paygent.NotificationEvent) error {
+			statuses = append(statuses, event.Inquiry.PaymentStatus)
+			return nil
+		},
+	}
+
+	if count, err := poller.Drain(context.Background()); err != nil || count != 2 {
+		t.Errorf("should get 2 notices, but got %v, %v", count, err)
+	}
+
+	if len(statuses) != 2 || statuses[0] != "20" || statuses[1] != "32" {
+		t.Errorf("notices are not correct, got %v", statuses)
+	}
+}
+
+func TestRedirectPayment(t *testing.T) {
+	server := paygenttest.NewServer()
+	defer server.Close()
+	client := server.Paygent()
+
+	response, err := client.PayPayApplicationMessage(1000, gomerchant.ApplicationParams{ReturnUrl: "https://example.com/return", CancelUrl: "https://example.com/cancel"})
+	if err != nil || response.TransactionID == "" || response.RedirectHTML == "" {
+		t.Fatalf("failed to apply paypay, got %v, %+v", err, response)
+	}
+
+	if _, err := client.PayPaySalesMessage(response.TransactionID); err == nil {
+		t.Errorf("should not capture unconfirmed payment")
+	}
+
+	if !server.Confirm(response.TransactionID) {
+		t.Fatalf("failed to confirm payment")
+	}
+
+	if _, err := client.PayPaySalesMessage(response.TransactionID); err != nil {
+		t.Errorf("failed to capture confirmed payment, got %v", err)
+	}
+}
+
+func TestClientCertificateRequired(t *testing.T) {
+	server := paygenttest.NewServer()
+	defer server.Close()
+
+	rootCAs := x509.NewCertPool()
+	rootCAs.AppendCertsFromPEM([]byte(server.CAPEM))
+
+	config := server.Config()
+	config.Transport = &http.Transport{TLSClientConfig: &tls.Config{RootCAs: rootCAs}}
+	if _, err := paygent.New(config).Query("10000001"); err == nil {
+		t.Errorf("should reject client without certificate")
+	}
+}
+
+func TestListTransactions(t *testing.T) {
+	server := paygenttest.NewServer()
+	defer server.Close()
+	client := server.Paygent()
+
+	authorizeResponse := authorize(t, client, "4242424242424242")
+	refundResponse, err := client.Refund(authorizeResponse.TransactionID, 100, gomerchant.RefundParams{})
+	if err != nil {
+		t.Fatalf("failed to refund, got %v", err)
+	}
+
+	var transactions []gomerchant.Transaction
+	iter := client.ListTransactions(gomerchant.ListTransactionsParams{OrderID: "order-1"})
+	for iter.Next() {
+		transactions = append(transactions, iter.Transaction())
+	}
+
+	if iter.Err() != nil || len(transactions) != 2 {
+		t.Fatalf("should list 2 transactions, got %v, %+v", iter.Err(), transactions)
+	}
+
+	if transactions[0].ID != refundResponse.TransactionID || transactions[0].Amount != 900 || transactions[1].ID != authorizeResponse.TransactionID || !transactions[1].Cancelled {
+		t.Errorf("should list latest payment first, then its base payment, got %+v", transactions)
+	}
+
+	iter = client.ListTransactions(gomerchant.ListTransactionsParams{OrderID: "order-1", Statuses: []gomerchant.TransactionStatus{gomerchant.TransactionCancelled}})
+	if !iter.Next() || iter.Transaction().ID != authorizeResponse.TransactionID || iter.Next() {
+		t.Errorf("should filter transactions by status")
+	}
+
+	iter = client.ListTransactions(gomerchant.ListTransactionsParams{OrderID: "order-1", Cursor: refundResponse.TransactionID})
+	if !iter.Next() || iter.Transaction().ID != authorizeResponse.TransactionID {
+		t.Errorf("should continue after cursor, got %v", iter.Transaction().ID)
+	}
+
+	if iter := client.ListTransactions(gomerchant.ListTransactionsParams{CustomerID: "customer"}); iter.Next() || !errors.Is(iter.Err(), gomerchant.ErrUnsupportedFilter) {
+		t.Errorf("should not list transactions without order id, got %v", iter.Err())
+	}
+}
+
+func TestQueryAndVoidByOrderID(t *testing.T) {
+	server := paygenttest.NewServer()
+	defer server.Close()
+	client := server.Paygent()
+
+	authorizeResponse := authorize(t, client, "4242424242424242")
+	captureResponse, err := client.Capture(authorizeResponse.TransactionID, gomerchant.CaptureParams{})
+	if err != nil {
+		t.Fatalf("failed to capture, got %v", err)
+	}
+
+	transaction, err := client.QueryByOrderID("order-1")
+	if err != nil || transaction.ID != captureResponse.TransactionID || !transaction.Captured {
+		t.Errorf("should find captured payment by order id, got %v, %+v", err, transaction)
+	}
+
+	for i := 0; i < 2; i++ {
+		voidResponse, err := client.VoidByOrderID("order-1", gomerchant.VoidParams{})
+		if err != nil || voidResponse.TransactionID != captureResponse.TransactionID {
+			t.Errorf("#%v: failed to void by order id, got %v, %+v", i, err, voidResponse)
+		}
+	}
+
+	if payment, _ := server.Payment(captureResponse.TransactionID); payment.Status != "60" {
+		t.Errorf("captured payment should be cancelled, but got %v", payment.Status)
+	}
+
+	if _, err := client.QueryByOrderID("order-unknown"); !errors.Is(err, gomerchant.ErrTransactionNotFound) {
+		t.Errorf("should get transaction not found error, but got %v", err)
+	}
+}
+
+func TestRakutenPayLineItems(t *testing.T) {
+	server := paygenttest.NewServer()
+	defer server.Close()
+	client := server.Paygent()
+
+	items := gomerchant.LineItems{
+		{ID: "shirt", Name: "シャツ", Quantity: 2, UnitPrice: 500, Tax: 100},
+		{Kind: gomerchant.LineItemShipping, Quantity: 1, UnitPrice: 500},
+	}
+
+	if _, err := client.RakutePayApplicationMessage(1500, gomerchant.ApplicationParams{LineItems: items}); !errors.Is(err, gomerchant.ErrInvalidLineItems) {
+		t.Errorf("should get invalid line items error, but got %v", err)
+	}
+
+	response, err := client.RakutePayApplicationMessage(1600, gomerchant.ApplicationParams{ReturnUrl: "https://example.com/return", LineItems: items})
+	if err != nil {
+		t.Fatalf("failed to apply rakuten pay, got %v", err)
+	}
+	server.Confirm(response.TransactionID)
+
+	remaining, _ := items.ApplyDiscount(333)
+	if _, err := client.RakutenPayCorrectionMessageWithItems(response.TransactionID, remaining); err != nil {
+		t.Fatalf("failed to correct rakuten pay with items, got %v", err)
+	}
+
+	if payment, _ := server.Payment(response.TransactionID); payment.Amount != 1267 {
+		t.Errorf("payment amount should be total of remaining items, but got %v", payment.Amount)
+	}
+
+	var fieldError paygent.FieldError
+	goods := []gomerchant.Good{{ID: "shirt", Price: 999.5, Amount: 2}}
+	if _, err := client.RakutePayApplicationMessage(1999, gomerchant.ApplicationParams{ReturnUrl: "https://example.com/return", Goods: goods}); !errors.As(err, &fieldError) || fieldError.Field != "goods_price[0]" {
+		t.Errorf("fractional price should not be truncated, but got %v", err)
+	}
+}
+
+func TestPaymentLineage(t *testing.T) {
+	server := paygenttest.NewServer()
+	defer server.Close()
+
+	payment, _, err := gomerchant.Authorize(server.Paygent(), 1000, gomerchant.AuthorizeParams{
+		Currency: "JPY",
+		OrderID:  "order-1",
+		PaymentMethod: &gomerchant.PaymentMethod{
+			CreditCard: &gomerchant.CreditCard{Number: "4242424242424242", ExpMonth: 1, ExpYear: uint(time.Now().Year() + 1), CVC: "123"},
+		},
+	})
+	if err != nil {
+		t.Fatalf("failed to authorize, got %v", err)
+	}
+
+	if _, err := payment.Refund(100, gomerchant.RefundParams{}); err != nil {
+		t.Fatalf("failed to refund, got %v", err)
+	}
+
+	if _, err := payment.Capture(gomerchant.CaptureParams{}); err != nil {
+		t.Fatalf("failed to capture the refunded payment, got %v", err)
+	}
+
+	if _, err := payment.Refund(200, gomerchant.RefundParams{Captured: true}); err != nil {
+		t.Fatalf("failed to refund captured payment, got %v", err)
+	}
+
+	transaction, err := payment.Query()
+	if err != nil || transaction.Amount != 700 || !transaction.Captured || transaction.ID != payment.TransactionID() {
+		t.Errorf("should query latest payment, got %v, %+v", err, transaction)
+	}
+
+	if ids := payment.TransactionIDs(); len(ids) != 3 {
+		t.Errorf("should track 3 payment ids, got %v", ids)
+	}
+}
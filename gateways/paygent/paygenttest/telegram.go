@@ -0,0 +1,727 @@
+package paygenttest
+
+import (
+	"fmt"
+	"html"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/qor/gomerchant/gateways/paygent"
+	"golang.org/x/text/encoding/japanese"
+)
+
+// telegram decoded telegram request
+type telegram struct {
+	Kind   string
+	Values url.Values
+	Data   []byte
+}
+
+func (t telegram) Get(key string) string {
+	return t.Values.Get(key)
+}
+
+func (t telegram) Uint(key string) (uint64, bool) {
+	u, err := strconv.ParseUint(t.Values.Get(key), 10, 64)
+	return u, err == nil
+}
+
+// reply telegram response, values are written in order, HTML is written at last with key HTMLKey
+type reply struct {
+	Keys    []string
+	Values  map[string]string
+	HTMLKey string
+	HTML    string
+	CSV     [][]string
+}
+
+func (r *reply) Set(key, value string) {
+	if r.Values == nil {
+		r.Values = map[string]string{}
+	}
+	if _, ok := r.Values[key]; !ok {
+		r.Keys = append(r.Keys, key)
+	}
+	r.Values[key] = value
+}
+
+func success() *reply {
+	r := &reply{}
+	r.Set("result", "0")
+	return r
+}
+
+func failure(code, detail string) *reply {
+	r := &reply{}
+	r.Set("result", "1")
+	r.Set("response_code", code)
+	r.Set("response_detail", detail)
+	return r
+}
+
+func (r *reply) Bytes() []byte {
+	var lines []string
+	if r.CSV != nil {
+		for _, record := range r.CSV {
+			for idx, value := range record {
+				if strings.ContainsAny(value, ",\"") {
+					record[idx] = `"` + strings.ReplaceAll(value, `"`, `""`) + `"`
+				}
+			}
+			lines = append(lines, strings.Join(record, ","))
+		}
+	} else {
+		for _, key := range r.Keys {
+			lines = append(lines, key+"="+r.Values[key])
+		}
+		if r.HTMLKey != "" {
+			lines = append(lines, r.HTMLKey+"="+r.HTML)
+		}
+	}
+
+	body, err := japanese.ShiftJIS.NewEncoder().String(strings.Join(lines, "\r\n"))
+	if err != nil {
+		panic(err)
+	}
+	return []byte(body)
+}
+
+func (server *Server) serveTelegram(writer http.ResponseWriter, request *http.Request) {
+	t, err := decodeTelegram(request)
+	if err != nil {
+		http.Error(writer, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if servicePath(t.Kind) != request.URL.Path {
+		http.NotFound(writer, request)
+		return
+	}
+
+	if failure, ok := server.takeFailure(t.Kind); ok {
+		if failure.Delay > 0 {
+			select {
+			case <-time.After(failure.Delay):
+			case <-request.Context().Done():
+				return
+			}
+		}
+
+		if failure.StatusCode != 0 {
+			http.Error(writer, http.StatusText(failure.StatusCode), failure.StatusCode)
+			return
+		}
+
+		if failure.ResponseCode != "" {
+			server.write(writer, failureReply(failure))
+			return
+		}
+	}
+
+	server.write(writer, server.handle(t))
+}
+
+func failureReply(f Failure) *reply {
+	detail := f.ResponseDetail
+	if detail == "" {
+		detail = "システムエラーが発生しました"
+	}
+	return failure(f.ResponseCode, detail)
+}
+
+func (server *Server) write(writer http.ResponseWriter, r *reply) {
+	writer.Header().Set("Content-Type", "text/plain; charset=Windows-31J")
+	writer.Write(r.Bytes())
+}
+
+func (server *Server) takeFailure(telegramKind string) (Failure, bool) {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+
+	f, ok := server.failures[telegramKind]
+	if !ok {
+		return Failure{}, false
+	}
+
+	if f.Times > 0 {
+		if f.Times--; f.Times == 0 {
+			delete(server.failures, telegramKind)
+		}
+	}
+	return *f, true
+}
+
+// servicePath service path of telegram kind, matched with the longest prefix like paygent client does
+func servicePath(telegramKind string) string {
+	for i := 0; i < len(telegramKind)-1; i++ {
+		if p, ok := paygent.TelegramServiceURLs[telegramKind[0:len(telegramKind)-i]]; ok {
+			return p
+		}
+	}
+	return ""
+}
+
+// decodeTelegram decode Shift_JIS form values, uploaded file of multipart form is kept in Data
+func decodeTelegram(request *http.Request) (telegram, error) {
+	var (
+		values url.Values
+		data   []byte
+	)
+
+	if mediaType, _, _ := mime.ParseMediaType(request.Header.Get("Content-Type")); mediaType == "multipart/form-data" {
+		if err := request.ParseMultipartForm(10 << 20); err != nil {
+			return telegram{}, err
+		}
+		values = url.Values(request.MultipartForm.Value)
+
+		if file, _, err := request.FormFile("data"); err == nil {
+			data, err = io.ReadAll(file)
+			file.Close()
+			if err != nil {
+				return telegram{}, err
+			}
+		}
+	} else {
+		body, err := io.ReadAll(request.Body)
+		if err != nil {
+			return telegram{}, err
+		}
+
+		if values, err = url.ParseQuery(string(body)); err != nil {
+			return telegram{}, err
+		}
+	}
+
+	var err error
+
+	decoder := japanese.ShiftJIS.NewDecoder()
+	for key, vs := range values {
+		for idx, v := range vs {
+			if vs[idx], err = decoder.String(v); err != nil {
+				return telegram{}, fmt.Errorf("%v is not encoded in Shift_JIS", key)
+			}
+		}
+	}
+
+	t := telegram{Kind: values.Get("telegram_kind"), Values: values, Data: data}
+	if len(t.Kind) < 3 {
+		return t, fmt.Errorf("invalid telegram kind %q", t.Kind)
+	}
+	return t, nil
+}
+
+func (server *Server) handle(t telegram) *reply {
+	if t.Get("merchant_id") != server.MerchantID || t.Get("connect_id") != server.ConnectID || t.Get("connect_password") != server.ConnectPassword {
+		return failure("E0001", "接続認証に失敗しました")
+	}
+
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+	return server.dispatch(t)
+}
+
+// dispatch process telegram by its kind, mutex should be locked
+func (server *Server) dispatch(t telegram) *reply {
+	switch t.Kind {
+	case "020":
+		return server.authorize(t)
+	case "021":
+		return server.transition(t, map[string]string{"20": "32"})
+	case "022":
+		return server.transition(t, map[string]string{"20": "40"})
+	case "023":
+		return server.transition(t, map[string]string{"30": "60", "35": "60", "40": "60", "41": "60"})
+	case "024":
+		return server.complete3DSecure(t)
+	case "025":
+		return server.createCard(t)
+	case "026":
+		return server.deleteCard(t)
+	case "027":
+		return server.listCards(t)
+	case "028":
+		return server.correct(t, map[string]string{"20": "20"})
+	case "029":
+		return server.correct(t, map[string]string{"20": "40", "40": "40"})
+	case "091":
+		return server.notice(t)
+	case "094":
+		return server.paymentRef(t)
+	case "130":
+		return server.apply(t, "paypal")
+	case "131":
+		return server.completeRedirect(t)
+	case "132":
+		return server.transition(t, map[string]string{"20": "40"})
+	case "133":
+		return server.transition(t, map[string]string{"20": "32"})
+	case "134":
+		return server.refund(t)
+	case "150":
+		return server.apply(t, "emoney")
+	case "151":
+		return server.completeRedirect(t)
+	case "152":
+		return server.transition(t, map[string]string{"20": "40"})
+	case "153":
+		return server.transition(t, map[string]string{"20": "32"})
+	case "154":
+		return server.refund(t)
+	case "201":
+		return server.uploadBatch(t)
+	case "202":
+		return server.batchResult(t)
+	case "270":
+		return server.apply(t, "rakuten_pay")
+	case "271":
+		return server.transition(t, map[string]string{"20": "40"})
+	case "272":
+		return server.transition(t, map[string]string{"20": "32", "40": "60"})
+	case "273":
+		return server.correctRakutenPay(t)
+	case "420":
+		return server.apply(t, "paypay")
+	case "421":
+		return server.refund(t)
+	case "422":
+		return server.transition(t, map[string]string{"20": "40"})
+	case "450":
+		return server.authenticate3DS2(t)
+	}
+
+	return failure("P001", "電文種別が不正です")
+}
+
+func (server *Server) newPaymentID() string {
+	server.sequence++
+	return strconv.Itoa(server.sequence)
+}
+
+func (server *Server) changeStatus(payment *Payment, status string) {
+	payment.Status = status
+	payment.ChangedAt = time.Now()
+	server.notices = append(server.notices, Notice{ID: strconv.Itoa(len(server.notices) + 1), Payment: *payment})
+}
+
+func (server *Server) newPayment(payment Payment) *Payment {
+	payment.ID = server.newPaymentID()
+	payment.CreatedAt = time.Now()
+	server.payments[payment.ID] = &payment
+	server.changeStatus(&payment, payment.Status)
+	return &payment
+}
+
+func (server *Server) findPayment(t telegram) (*Payment, *reply) {
+	if paymentID := t.Get("payment_id"); paymentID != "" {
+		if payment, ok := server.payments[paymentID]; ok {
+			return payment, nil
+		}
+	} else if tradingID := t.Get("trading_id"); tradingID != "" {
+		var found *Payment
+		for _, payment := range server.payments {
+			if payment.TradingID == tradingID && (found == nil || payment.CreatedAt.After(found.CreatedAt) || payment.CreatedAt.Equal(found.CreatedAt) && payment.ID > found.ID) {
+				found = payment
+			}
+		}
+		if found != nil {
+			return found, nil
+		}
+	}
+	return nil, failure("P010", "該当する決済が存在しません")
+}
+
+func paymentReply(payment *Payment) *reply {
+	r := success()
+	r.Set("payment_id", payment.ID)
+	return r
+}
+
+func (server *Server) transition(t telegram, transitions map[string]string) *reply {
+	payment, errReply := server.findPayment(t)
+	if errReply != nil {
+		return errReply
+	}
+
+	status, ok := transitions[payment.Status]
+	if !ok {
+		return failure("P020", fmt.Sprintf("決済ステータス%vでは処理できません", payment.Status))
+	}
+
+	server.changeStatus(payment, status)
+	return paymentReply(payment)
+}
+
+func (server *Server) authorize(t telegram) *reply {
+	amount, ok := t.Uint("payment_amount")
+	if !ok || amount == 0 {
+		return failure("P002", "決済金額が不正です")
+	}
+
+	payment := Payment{TradingID: t.Get("trading_id"), Type: "card", Amount: amount, Status: "20"}
+	cardNumber := t.Get("card_number")
+
+	if t.Get("stock_card_mode") == "1" {
+		card := server.findCard(t.Get("customer_id"), t.Get("customer_card_id"))
+		if card == nil {
+			return failure("P026", "カード情報が存在しません")
+		}
+		payment.CustomerID, payment.CardID, cardNumber = card.CustomerID, card.ID, card.Number
+	} else if cardNumber == "" || len(t.Get("card_valid_term")) != 4 {
+		return failure("P003", "カード情報が不正です")
+	}
+
+	if code, ok := server.DeclinedCards[cardNumber]; ok {
+		return failure(code, "カードが利用できません")
+	}
+
+	requires3D := t.Get("3dsecure_ryaku") != "1" && t.Get("3ds_auth_id") == "" && t.Get("term_url") != "" && server.ThreeDSecureCards[cardNumber]
+	if requires3D {
+		payment.Status = "14"
+	}
+
+	created := server.newPayment(payment)
+	r := paymentReply(created)
+	if requires3D {
+		r.HTMLKey, r.HTML = "out_acs_html", acsHTML(t.Get("term_url"), map[string]string{"MD": created.ID, "PaRes": "simulated"})
+	}
+	return r
+}
+
+func (server *Server) complete3DSecure(t telegram) *reply {
+	payment, ok := server.payments[t.Get("MD")]
+	if !ok {
+		return failure("P010", "該当する決済が存在しません")
+	}
+
+	if payment.Status != "14" {
+		return failure("P020", fmt.Sprintf("決済ステータス%vでは処理できません", payment.Status))
+	}
+
+	server.changeStatus(payment, "20")
+	return paymentReply(payment)
+}
+
+// correct create a new payment with corrected amount, base payment will be cancelled
+func (server *Server) correct(t telegram, transitions map[string]string) *reply {
+	base, errReply := server.findPayment(t)
+	if errReply != nil {
+		return errReply
+	}
+
+	status, ok := transitions[base.Status]
+	if !ok {
+		return failure("P020", fmt.Sprintf("決済ステータス%vでは処理できません", base.Status))
+	}
+
+	amount, ok := t.Uint("payment_amount")
+	if !ok {
+		return failure("P002", "決済金額が不正です")
+	}
+
+	if t.Get("reduction_flag") == "1" {
+		if amount >= base.Amount {
+			return failure("P002", "減額金額が不正です")
+		}
+		amount = base.Amount - amount
+	}
+
+	if base.Status == "40" {
+		server.changeStatus(base, "60")
+	} else {
+		server.changeStatus(base, "32")
+	}
+
+	corrected := server.newPayment(Payment{
+		TradingID:     base.TradingID,
+		BasePaymentID: base.ID,
+		Type:          base.Type,
+		Status:        status,
+		Amount:        amount,
+		CustomerID:    base.CustomerID,
+		CardID:        base.CardID,
+	})
+	return paymentReply(corrected)
+}
+
+func (server *Server) paymentRef(t telegram) *reply {
+	payment, errReply := server.findPayment(t)
+	if errReply != nil {
+		return errReply
+	}
+
+	r := paymentReply(payment)
+	setPaymentValues(r, payment)
+	return r
+}
+
+func setPaymentValues(r *reply, payment *Payment) {
+	r.Set("trading_id", payment.TradingID)
+	r.Set("payment_status", payment.Status)
+	r.Set("payment_amount", strconv.FormatUint(payment.Amount, 10))
+	r.Set("payment_init_date", payment.CreatedAt.In(paygent.PaygentServerTimeZone).Format("20060102150405"))
+	r.Set("change_date", payment.ChangedAt.In(paygent.PaygentServerTimeZone).Format("20060102150405"))
+	r.Set("base_payment_id", payment.BasePaymentID)
+}
+
+// notice returns the notice after payment_notice_id
+func (server *Server) notice(t telegram) *reply {
+	var index int
+	if noticeID := t.Get("payment_notice_id"); noticeID != "" {
+		i, err := strconv.Atoi(noticeID)
+		if err != nil {
+			return failure("P001", "決済通知IDが不正です")
+		}
+		index = i
+	}
+
+	r := success()
+	if index < len(server.notices) {
+		notice := server.notices[index]
+		r.Set("payment_notice_id", notice.ID)
+		r.Set("payment_id", notice.Payment.ID)
+		setPaymentValues(r, &notice.Payment)
+	}
+	return r
+}
+
+func (server *Server) apply(t telegram, paymentType string) *reply {
+	amount, ok := t.Uint("payment_amount")
+	if !ok || amount == 0 {
+		return failure("P002", "決済金額が不正です")
+	}
+
+	if paymentType == "rakuten_pay" {
+		if errReply := checkGoods(t, amount); errReply != nil {
+			return errReply
+		}
+	}
+
+	payment := server.newPayment(Payment{TradingID: t.Get("trading_id"), Type: paymentType, Amount: amount, Status: "10"})
+	r := paymentReply(payment)
+	r.Set("trade_generation_date", payment.CreatedAt.In(paygent.PaygentServerTimeZone).Format("20060102150405"))
+	returnValues := map[string]string{"payment_id": payment.ID}
+	if paymentType == "paypal" {
+		returnValues["token"], returnValues["PayerID"] = paypalToken(payment), "SIMULATEDPAYER"
+	}
+	r.HTMLKey, r.HTML = "redirect_html", acsHTML(t.Get("return_url"), returnValues)
+	return r
+}
+
+func paypalToken(payment *Payment) string {
+	return "EC-" + payment.ID
+}
+
+// completeRedirect complete payment after user returned from PayPal or e-money service
+func (server *Server) completeRedirect(t telegram) *reply {
+	payment, errReply := server.findPayment(t)
+	if errReply != nil {
+		return errReply
+	}
+
+	if payment.Type == "paypal" && t.Get("token") != paypalToken(payment) {
+		return failure("P002", "PayPalトークンが不正です")
+	}
+
+	if payment.Status != "10" {
+		return failure("P020", fmt.Sprintf("決済ステータス%vでは処理できません", payment.Status))
+	}
+
+	server.changeStatus(payment, "20")
+	return paymentReply(payment)
+}
+
+// checkGoods goods of rakuten pay should add up to payment amount
+func checkGoods(t telegram, amount uint64) *reply {
+	var total uint64
+	for i := 0; t.Get(fmt.Sprintf("goods_id[%d]", i)) != ""; i++ {
+		price, _ := t.Uint(fmt.Sprintf("goods_price[%d]", i))
+		count, _ := t.Uint(fmt.Sprintf("goods_amount[%d]", i))
+		total += price * count
+	}
+	if total != 0 && total != amount {
+		return failure("P030", "商品金額の合計が決済金額と一致しません")
+	}
+	return nil
+}
+
+func (server *Server) correctRakutenPay(t telegram) *reply {
+	payment, errReply := server.findPayment(t)
+	if errReply != nil {
+		return errReply
+	}
+
+	if payment.Status != "20" && payment.Status != "40" {
+		return failure("P020", fmt.Sprintf("決済ステータス%vでは処理できません", payment.Status))
+	}
+
+	amount, ok := t.Uint("payment_amount")
+	if !ok || amount == 0 || amount > payment.Amount {
+		return failure("P002", "決済金額が不正です")
+	}
+
+	if errReply := checkGoods(t, amount); errReply != nil {
+		return errReply
+	}
+
+	payment.Amount = amount
+	server.changeStatus(payment, payment.Status)
+	return paymentReply(payment)
+}
+
+// refund cancel authorized payment, or refund captured payment with repayment_amount
+func (server *Server) refund(t telegram) *reply {
+	payment, errReply := server.findPayment(t)
+	if errReply != nil {
+		return errReply
+	}
+
+	if repayment, ok := t.Uint("repayment_amount"); ok && repayment < payment.Amount {
+		if payment.Status != "40" {
+			return failure("P020", fmt.Sprintf("決済ステータス%vでは処理できません", payment.Status))
+		}
+		payment.Amount -= repayment
+		server.changeStatus(payment, payment.Status)
+		return paymentReply(payment)
+	}
+
+	switch payment.Status {
+	case "20":
+		server.changeStatus(payment, "32")
+	case "40":
+		server.changeStatus(payment, "60")
+	default:
+		return failure("P020", fmt.Sprintf("決済ステータス%vでは処理できません", payment.Status))
+	}
+	return paymentReply(payment)
+}
+
+func (server *Server) authenticate3DS2(t telegram) *reply {
+	if _, ok := t.Uint("payment_amount"); !ok || t.Get("term_url") == "" {
+		return failure("P002", "必須項目が不足しています")
+	}
+
+	switch t.Get("card_set_method") {
+	case "customer":
+		if server.findCard(t.Get("customer_id"), t.Get("customer_card_id")) == nil {
+			return failure("P026", "カード情報が存在しません")
+		}
+	case "direct":
+		if t.Get("card_number") == "" {
+			return failure("P003", "カード情報が不正です")
+		}
+	default:
+		return failure("P003", "カード設定方法が不正です")
+	}
+
+	server.sequence++
+	r := success()
+	r.HTMLKey, r.HTML = "out_acs_html", acsHTML(t.Get("term_url"), map[string]string{"3ds_auth_id": fmt.Sprintf("simulated-%d", server.sequence)})
+	return r
+}
+
+// acsHTML auto submit form that posts values to url, like ACS or payment service pages
+func acsHTML(action string, values map[string]string) string {
+	var inputs []string
+	for key, value := range values {
+		inputs = append(inputs, fmt.Sprintf(`<input type="hidden" name="%v" value="%v">`, html.EscapeString(key), html.EscapeString(value)))
+	}
+
+	return fmt.Sprintf("<!DOCTYPE HTML>\r\n<HTML><BODY onload=\"document.forms[0].submit()\">\r\n<FORM method=\"POST\" action=\"%v\">%v</FORM>\r\n</BODY></HTML>", html.EscapeString(action), strings.Join(inputs, ""))
+}
+
+func (server *Server) findCard(customerID, cardID string) *Card {
+	for _, card := range server.cards[customerID] {
+		if card.ID == cardID {
+			return card
+		}
+	}
+	return nil
+}
+
+var cardBrands = map[string]string{"4": "V", "5": "M", "34": "X", "37": "X", "36": "C", "35": "J"}
+
+func (server *Server) createCard(t telegram) *reply {
+	customerID, number, validTerm := t.Get("customer_id"), t.Get("card_number"), t.Get("card_valid_term")
+	if customerID == "" || len(number) < 14 || len(validTerm) != 4 {
+		return failure("P003", "カード情報が不正です")
+	}
+
+	brand := t.Get("card_brand")
+	for prefix, b := range cardBrands {
+		if brand == "" && strings.HasPrefix(number, prefix) {
+			brand = b
+		}
+	}
+
+	server.sequence++
+	card := &Card{
+		CustomerID: customerID,
+		ID:         strconv.Itoa(server.sequence),
+		Number:     number,
+		ValidTerm:  validTerm,
+		HolderName: t.Get("cardholder_name"),
+		Brand:      brand,
+	}
+	server.cards[customerID] = append(server.cards[customerID], card)
+
+	r := success()
+	r.Set("customer_card_id", card.ID)
+	return r
+}
+
+// deleteCard delete a card, or all cards of the customer if customer_card_id is blank
+func (server *Server) deleteCard(t telegram) *reply {
+	customerID, cardID := t.Get("customer_id"), t.Get("customer_card_id")
+	cards := server.cards[customerID]
+
+	if cardID == "" {
+		if len(cards) == 0 {
+			return failure("P026", "該当データなし")
+		}
+		delete(server.cards, customerID)
+		return success()
+	}
+
+	for idx, card := range cards {
+		if card.ID == cardID {
+			server.cards[customerID] = append(cards[:idx:idx], cards[idx+1:]...)
+			return success()
+		}
+	}
+	return failure("P026", "該当データなし")
+}
+
+// listCards cards are returned in CSV
+func (server *Server) listCards(t telegram) *reply {
+	var cards []*Card
+	for _, card := range server.cards[t.Get("customer_id")] {
+		if cardID := t.Get("customer_card_id"); cardID == "" || card.ID == cardID {
+			cards = append(cards, card)
+		}
+	}
+
+	if len(cards) == 0 {
+		return &reply{CSV: [][]string{{"1", "1", "P026", "該当データなし"}}}
+	}
+
+	records := [][]string{
+		{"1", "0", "", ""},
+		{"2", "customer_id", "customer_card_id", "card_brand", "card_number", "card_valid_term", "cardholder_name"},
+	}
+	for _, card := range cards {
+		records = append(records, []string{"3", card.CustomerID, card.ID, card.Brand, maskCardNumber(card.Number), card.ValidTerm, card.HolderName})
+	}
+	return &reply{CSV: append(records, []string{"4", strconv.Itoa(len(cards))})}
+}
+
+func maskCardNumber(number string) string {
+	if len(number) <= 10 {
+		return number
+	}
+	return number[:6] + strings.Repeat("*", len(number)-10) + number[len(number)-4:]
+}
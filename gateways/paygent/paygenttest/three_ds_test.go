@@ -0,0 +1,46 @@
+package paygenttest_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/qor/gomerchant"
+	"github.com/qor/gomerchant/gateways/paygent/paygenttest"
+)
+
+func TestStart3DS2Authentication(t *testing.T) {
+	server := paygenttest.NewServer()
+	defer server.Close()
+
+	response, err := server.Paygent().Start3DS2Authentication(context.Background(), gomerchant.Start3DS2AuthenticationParams{
+		TermURL: "https://example.com/3ds",
+		OrderID: "order-1",
+		Amount:  1000,
+		PaymentMethod: &gomerchant.PaymentMethod{
+			CreditCard: &gomerchant.CreditCard{Number: "4242424242424242", ExpMonth: 1, ExpYear: uint(time.Now().Year() + 1), CVC: "123"},
+		},
+	})
+	if err != nil || !strings.Contains(response.OutAcsHTML, "3ds_auth_id") {
+		t.Errorf("failed to start 3D Secure 2.0 authentication, got %v, %+v", err, response)
+	}
+}
+
+func TestStart3DS2AuthenticationCanceled(t *testing.T) {
+	server := paygenttest.NewServer()
+	defer server.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := server.Paygent().Start3DS2Authentication(ctx, gomerchant.Start3DS2AuthenticationParams{
+		TermURL: "https://example.com/3ds",
+		Amount:  1000,
+		PaymentMethod: &gomerchant.PaymentMethod{
+			CreditCard: &gomerchant.CreditCard{Number: "4242424242424242", ExpMonth: 1, ExpYear: uint(time.Now().Year() + 1), CVC: "123"},
+		},
+	}); !errors.Is(err, context.Canceled) {
+		t.Errorf("request should be canceled with context, got %v", err)
+	}
+}
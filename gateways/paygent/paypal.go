@@ -0,0 +1,51 @@
+package paygent
+
+import (
+	"github.com/qor/gomerchant"
+)
+
+// PayPal telegram kinds
+const (
+	PayPalApplicationTelegram  = "130"
+	PayPalCompletionTelegram   = "131"
+	PayPalSalesTelegram        = "132"
+	PayPalCancellationTelegram = "133"
+	PayPalRefundTelegram       = "134"
+)
+
+// PayPalApplicationMessage apply a PayPal payment, redirect user to PayPal with `RedirectHTML` of the response
+// Before user confirmed on PayPal page status is 10:already applied
+func (paygent *Paygent) PayPalApplicationMessage(amount uint64, params gomerchant.ApplicationParams) (gomerchant.ApplicationResponse, error) {
+	return paygent.redirectApplicationMessage(PayPalApplicationTelegram, amount, params)
+}
+
+// PayPalCompletionMessage complete PayPal payment after user returned from PayPal page, values posted back to return url could be passed with params
+// After completed status change to 20: Authorization OK
+func (paygent *Paygent) PayPalCompletionMessage(transactionID string, params gomerchant.CompleteAuthorizeParams) (gomerchant.Transaction, error) {
+	return paygent.redirectCompletionMessage(PayPalCompletionTelegram, transactionID, params)
+}
+
+// PayPalSalesMessage capture PayPal payment
+func (paygent *Paygent) PayPalSalesMessage(transactionID string) (gomerchant.CaptureResponse, error) {
+	results, err := paygent.Request(PayPalSalesTelegram, gomerchant.Params{"payment_id": transactionID})
+	response := gomerchant.CaptureResponse{Params: results.Params}
+	if paymentID, ok := getPaymentID(results); ok && err == nil {
+		response.TransactionID = paymentID
+	}
+	return response, err
+}
+
+// PayPalCancellationMessage void PayPal payment before it is captured
+func (paygent *Paygent) PayPalCancellationMessage(transactionID string) (gomerchant.VoidResponse, error) {
+	results, err := paygent.Request(PayPalCancellationTelegram, gomerchant.Params{"payment_id": transactionID})
+	response := gomerchant.VoidResponse{Params: results.Params}
+	if paymentID, ok := getPaymentID(results); ok && err == nil {
+		response.TransactionID = paymentID
+	}
+	return response, err
+}
+
+// PayPalRefundMessage refund captured PayPal payment, refund whole payment if amount is 0
+func (paygent *Paygent) PayPalRefundMessage(transactionID string, amount uint) (gomerchant.RefundResponse, error) {
+	return paygent.redirectRefundMessage(PayPalRefundTelegram, transactionID, amount)
+}
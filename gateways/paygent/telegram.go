@@ -0,0 +1,324 @@
+package paygent
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/qor/gomerchant"
+)
+
+// Telegram typed telegram request, fields are encoded with `paygent` struct tag:
+//
+//	paygent:"name,required,max=20,len=4,class=numeric"
+//
+//	required  zero value is not allowed, other zero values are not sent
+//	zero      zero value is sent as well
+//	max, len  max or exact length in Shift_JIS bytes, a full-width character takes 2 bytes
+//	class     numeric, alphanumeric, halfwidth (printable ASCII), fullwidth (double-byte characters only)
+//	kana      full or half, convert kana to full-width or half-width before validation
+//	indexed   slice of structs, encoded as name[0], name[1]...
+//	extra     gomerchant.Params merged into the request as it is
+//	tail      (response only) everything after `name=` in response body, for HTML values
+type Telegram interface {
+	TelegramKind() string
+}
+
+// FieldError telegram field failed validation, never contains the field value as it might be card data
+type FieldError struct {
+	TelegramKind string
+	Field        string
+	Reason       string
+	Err          error
+}
+
+func (err FieldError) Error() string {
+	return fmt.Sprintf("paygent: telegram %v field %v %v", err.TelegramKind, err.Field, err.Reason)
+}
+
+func (err FieldError) Unwrap() error {
+	return err.Err
+}
+
+type telegramTag struct {
+	Name     string
+	Required bool
+	Zero     bool
+	Max      int
+	Len      int
+	Class    string
+	Kana     string
+	Indexed  bool
+	Extra    bool
+	Tail     bool
+}
+
+func parseTelegramTag(field reflect.StructField) (tag telegramTag, ok bool) {
+	value, ok := field.Tag.Lookup("paygent")
+	if !ok || value == "-" {
+		return tag, false
+	}
+
+	options := strings.Split(value, ",")
+	tag.Name = options[0]
+	for _, option := range options[1:] {
+		switch {
+		case option == "required":
+			tag.Required = true
+		case option == "zero":
+			tag.Zero = true
+		case option == "indexed":
+			tag.Indexed = true
+		case option == "extra":
+			tag.Extra = true
+		case option == "tail":
+			tag.Tail = true
+		case strings.HasPrefix(option, "max="):
+			tag.Max, _ = strconv.Atoi(strings.TrimPrefix(option, "max="))
+		case strings.HasPrefix(option, "len="):
+			tag.Len, _ = strconv.Atoi(strings.TrimPrefix(option, "len="))
+		case strings.HasPrefix(option, "kana="):
+			tag.Kana = strings.TrimPrefix(option, "kana=")
+		case strings.HasPrefix(option, "class="):
+			tag.Class = strings.TrimPrefix(option, "class=")
+		}
+	}
+	return tag, true
+}
+
+// EncodeTelegram validate telegram and encode it to request params
+func EncodeTelegram(telegram Telegram) (gomerchant.Params, error) {
+	var (
+		params = gomerchant.Params{}
+		value  = reflect.Indirect(reflect.ValueOf(telegram))
+	)
+
+	if value.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("paygent: telegram %v should be a struct", telegram.TelegramKind())
+	}
+
+	if err := encodeTelegramFields(telegram.TelegramKind(), value, "", params); err != nil {
+		return nil, err
+	}
+	return params, nil
+}
+
+func encodeTelegramFields(telegramKind string, value reflect.Value, suffix string, params gomerchant.Params) error {
+	for i := 0; i < value.NumField(); i++ {
+		field := value.Type().Field(i)
+		tag, ok := parseTelegramTag(field)
+		if !ok {
+			continue
+		}
+
+		fieldValue := value.Field(i)
+		switch {
+		case tag.Extra:
+			if extra, ok := fieldValue.Interface().(gomerchant.Params); ok {
+				for key, v := range extra {
+					params[key] = v
+				}
+			}
+			continue
+		case tag.Indexed:
+			if fieldValue.Kind() != reflect.Slice {
+				return FieldError{TelegramKind: telegramKind, Field: field.Name, Reason: "should be a slice"}
+			}
+			for idx := 0; idx < fieldValue.Len(); idx++ {
+				if err := encodeTelegramFields(telegramKind, reflect.Indirect(fieldValue.Index(idx)), fmt.Sprintf("[%d]", idx), params); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+
+		name := tag.Name + suffix
+		if fieldValue.IsZero() && !tag.Zero {
+			if tag.Required {
+				return FieldError{TelegramKind: telegramKind, Field: name, Reason: "is required"}
+			}
+			continue
+		}
+
+		str, err := formatTelegramValue(fieldValue)
+		if err != nil {
+			return FieldError{TelegramKind: telegramKind, Field: name, Reason: err.Error()}
+		}
+
+		switch tag.Kana {
+		case "full":
+			str = ToFullWidthKana(str)
+		case "half":
+			str = ToHalfWidthKana(str)
+		}
+
+		if err := validateTelegramValue(name, str, tag); err != nil {
+			fieldError := FieldError{TelegramKind: telegramKind, Field: name, Reason: err.Error()}
+			if charsetError, ok := err.(CharsetError); ok {
+				fieldError.Reason = fmt.Sprintf("contains character %q (%U) that can't be encoded in %v", charsetError.Char, charsetError.Char, charsetError.Charset)
+				fieldError.Err = charsetError
+			}
+			return fieldError
+		}
+
+		params[name] = str
+	}
+	return nil
+}
+
+func formatTelegramValue(value reflect.Value) (string, error) {
+	switch value.Kind() {
+	case reflect.String:
+		return value.String(), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(value.Int(), 10), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.FormatUint(value.Uint(), 10), nil
+	case reflect.Bool:
+		if value.Bool() {
+			return "1", nil
+		}
+		return "0", nil
+	}
+	return "", fmt.Errorf("has unsupported type %v", value.Type())
+}
+
+func validateTelegramValue(name string, value string, tag telegramTag) error {
+	for _, r := range value {
+		switch tag.Class {
+		case "numeric":
+			if r < '0' || r > '9' {
+				return errors.New("should only contain numbers")
+			}
+		case "alphanumeric":
+			if !(r >= '0' && r <= '9' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z') {
+				return errors.New("should only contain alphabets and numbers")
+			}
+		case "halfwidth":
+			if r < 0x20 || r > 0x7e {
+				return errors.New("should only contain half-width characters")
+			}
+		case "fullwidth":
+			if r < 0x80 || r >= 0xff61 && r <= 0xff9f {
+				return errors.New("should only contain full-width characters")
+			}
+		}
+	}
+
+	length := len(value)
+	if !isASCII(value) {
+		encoded, err := encodeTelegramValue(name, value, "Shift_JIS")
+		if err != nil {
+			return err
+		}
+		length = len(encoded)
+	}
+
+	if tag.Max > 0 && length > tag.Max {
+		return fmt.Errorf("should be at most %v bytes, but got %v", tag.Max, length)
+	}
+
+	if tag.Len > 0 && length != tag.Len {
+		return fmt.Errorf("should be %v bytes, but got %v", tag.Len, length)
+	}
+	return nil
+}
+
+func isASCII(value string) bool {
+	for i := 0; i < len(value); i++ {
+		if value[i] >= utf8.RuneSelf {
+			return false
+		}
+	}
+	return true
+}
+
+// Decode decode response into typed telegram response
+func (response Response) Decode(result interface{}) error {
+	value := reflect.ValueOf(result)
+	if value.Kind() != reflect.Ptr || value.Elem().Kind() != reflect.Struct {
+		return errors.New("paygent: response should be decoded into a struct pointer")
+	}
+	return decodeTelegramFields(response, value.Elem())
+}
+
+func decodeTelegramFields(response Response, value reflect.Value) error {
+	for i := 0; i < value.NumField(); i++ {
+		var (
+			field      = value.Type().Field(i)
+			fieldValue = value.Field(i)
+		)
+
+		if field.Anonymous && fieldValue.Kind() == reflect.Struct {
+			if err := decodeTelegramFields(response, fieldValue); err != nil {
+				return err
+			}
+			continue
+		}
+
+		tag, ok := parseTelegramTag(field)
+		if !ok {
+			continue
+		}
+
+		var str string
+		if tag.Tail {
+			if parts := strings.SplitN(response.RawBody, tag.Name+"=", 2); len(parts) == 2 {
+				str = strings.TrimSpace(parts[1])
+			} else {
+				continue
+			}
+		} else if v, ok := response.Get(tag.Name); ok {
+			str = fmt.Sprint(v)
+		} else {
+			continue
+		}
+
+		switch fieldValue.Kind() {
+		case reflect.String:
+			fieldValue.SetString(str)
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			if str == "" {
+				continue
+			}
+			i, err := strconv.ParseInt(str, 10, 64)
+			if err != nil {
+				return fmt.Errorf("paygent: failed to decode %v: %v", tag.Name, err)
+			}
+			fieldValue.SetInt(i)
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			if str == "" {
+				continue
+			}
+			u, err := strconv.ParseUint(str, 10, 64)
+			if err != nil {
+				return fmt.Errorf("paygent: failed to decode %v: %v", tag.Name, err)
+			}
+			fieldValue.SetUint(u)
+		case reflect.Bool:
+			fieldValue.SetBool(str == "1")
+		default:
+			return fmt.Errorf("paygent: can't decode %v into %v", tag.Name, fieldValue.Type())
+		}
+	}
+	return nil
+}
+
+// RequestTelegram validate and send typed telegram, decode response into result if it is not nil
+func (paygent *Paygent) RequestTelegram(telegram Telegram, result interface{}) (Response, error) {
+	params, err := EncodeTelegram(telegram)
+	if err != nil {
+		return Response{Params: gomerchant.Params{}}, err
+	}
+
+	response, err := paygent.Request(telegram.TelegramKind(), params)
+	if result != nil && response.RawBody != "" {
+		if e := response.Decode(result); err == nil {
+			err = e
+		}
+	}
+	return response, err
+}
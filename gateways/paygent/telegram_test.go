@@ -0,0 +1,135 @@
+package paygent_test
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/qor/gomerchant"
+	"github.com/qor/gomerchant/gateways/paygent"
+)
+
+func TestEncodeTelegram(t *testing.T) {
+	params, err := paygent.EncodeTelegram(paygent.AuthorizeRequest{
+		TradingID:         "order-1",
+		PaymentAmount:     1000,
+		PaymentClass:      10,
+		CardNumber:        "4242424242424242",
+		CardValidTerm:     "0130",
+		ThreeDSecureRyaku: true,
+	})
+	if err != nil {
+		t.Fatalf("no error should happen when encode telegram, but got %v", err)
+	}
+
+	expected := gomerchant.Params{
+		"trading_id":      "order-1",
+		"payment_amount":  "1000",
+		"payment_class":   "10",
+		"card_number":     "4242424242424242",
+		"card_valid_term": "0130",
+		"3dsecure_ryaku":  "1",
+	}
+	if !reflect.DeepEqual(params, expected) {
+		t.Errorf("encoded params should be %v, but got %v", expected, params)
+	}
+
+	params, err = paygent.EncodeTelegram(paygent.RakutenPayApplicationRequest{
+		PaymentAmount: 1500,
+		Goods:         []paygent.RakutenPayGood{{Name: "シャツ", ID: "shirt", Price: 1000, Amount: 1}, {ID: "socks", Price: 500, Amount: 1}},
+	})
+	if err != nil {
+		t.Fatalf("no error should happen when encode telegram, but got %v", err)
+	}
+
+	if params["goods[0]"] != "シャツ" || params["goods_id[1]"] != "socks" || params["goods_price[1]"] != "500" || params["merchandise_type"] != "0" {
+		t.Errorf("indexed fields are not correct, got %v", params)
+	}
+
+	if _, ok := params["goods[1]"]; ok {
+		t.Errorf("blank fields should not be sent, got %v", params)
+	}
+}
+
+func TestEncodeTelegramValidation(t *testing.T) {
+	cases := []struct {
+		Telegram paygent.Telegram
+		Field    string
+	}{
+		{paygent.CaptureRequest{}, "payment_id"},
+		{paygent.CaptureRequest{PaymentID: "12a"}, "payment_id"},
+		{paygent.AuthorizeRequest{PaymentAmount: 100, CardNumber: "4242 4242 4242 4242"}, "card_number"},
+		{paygent.AuthorizeRequest{PaymentAmount: 100, CardNumber: "42424242424242424242"}, "card_number"},
+		{paygent.AuthorizeRequest{PaymentAmount: 100, CardValidTerm: "130"}, "card_valid_term"},
+		{paygent.AuthorizeRequest{PaymentAmount: 100, TradingID: "注文1"}, "trading_id"},
+		{paygent.AuthorizeRequest{PaymentAmount: 100000000}, "payment_amount"},
+		{paygent.CreateCardRequest{CustomerID: "1", CardNumber: "4242424242424242", CardValidTerm: "0130", CardholderName: strings.Repeat("山", 23)}, "cardholder_name"},
+		{paygent.CreateCardRequest{CustomerID: "1", CardNumber: "4242424242424242", CardValidTerm: "0130", CardholderName: "😀"}, "cardholder_name"},
+		{paygent.RakutenPayCorrectionRequest{PaymentID: "1", PaymentAmount: 100, Goods: []paygent.RakutenPayGood{{ID: "a", Amount: 1}, {Amount: 1}}}, "goods_id[1]"},
+	}
+
+	for _, c := range cases {
+		_, err := paygent.EncodeTelegram(c.Telegram)
+
+		var fieldError paygent.FieldError
+		if !errors.As(err, &fieldError) || fieldError.Field != c.Field || fieldError.TelegramKind != c.Telegram.TelegramKind() {
+			t.Errorf("should get error of field %v for %#v, but got %v", c.Field, c.Telegram, err)
+		}
+	}
+
+	_, err := paygent.EncodeTelegram(paygent.AuthorizeRequest{PaymentAmount: 100, CardNumber: "4242-4242-4242-4242"})
+	if err == nil || strings.Contains(err.Error(), "4242") {
+		t.Errorf("error should not contain card number, but got %v", err)
+	}
+
+	if _, err := paygent.EncodeTelegram(paygent.AuthorizeRequest{PaymentAmount: 100, CardNumber: "6250941006528599123"}); err != nil {
+		t.Errorf("19 digits card number should be allowed, but got %v", err)
+	}
+
+	if _, err := paygent.EncodeTelegram(paygent.CreateCardRequest{CustomerID: "1", CardNumber: "4242424242424242", CardValidTerm: "0130", CardholderName: strings.Repeat("山", 22)}); err != nil {
+		t.Errorf("full-width characters should be counted as 2 bytes, but got %v", err)
+	}
+}
+
+func TestRequestTelegram(t *testing.T) {
+	var (
+		form   = make(chan url.Values, 1)
+		client = paygent.New(&paygent.Config{
+			MerchantID: "12345",
+			Transport: roundTripFunc(func(request *http.Request) (*http.Response, error) {
+				request.ParseForm()
+				form <- request.Form
+				return &http.Response{
+					StatusCode: 200,
+					Header:     http.Header{"Content-Type": {"text/plain; charset=UTF-8"}},
+					Body:       io.NopCloser(strings.NewReader("result=0\r\npayment_id=2001\r\nout_acs_html=<html>\r\n<body>3D</body>\r\n</html>")),
+				}, nil
+			}),
+		})
+		result paygent.AuthorizeResponse
+	)
+
+	if _, err := client.RequestTelegram(paygent.AuthorizeRequest{TradingID: "order-1", PaymentAmount: 100}, &result); err != nil {
+		t.Fatalf("no error should happen when request telegram, but got %v", err)
+	}
+
+	sent := <-form
+	if sent.Get("telegram_kind") != "020" || sent.Get("trading_id") != "order-1" || sent.Get("payment_amount") != "100" {
+		t.Errorf("telegram is not sent correctly, got %v", sent)
+	}
+
+	if result.Result != "0" || result.PaymentID != "2001" || result.OutAcsHTML != "<html>\r\n<body>3D</body>\r\n</html>" {
+		t.Errorf("response is not decoded correctly, got %#v", result)
+	}
+
+	if _, err := client.RequestTelegram(paygent.CaptureRequest{}, nil); err == nil {
+		t.Errorf("invalid telegram should not be sent")
+	}
+	if len(form) != 0 {
+		t.Errorf("invalid telegram should not be sent")
+	}
+}
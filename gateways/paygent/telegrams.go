@@ -0,0 +1,257 @@
+package paygent
+
+import "github.com/qor/gomerchant"
+
+// TelegramResponse common fields of telegram responses
+type TelegramResponse struct {
+	Result         string `paygent:"result"`
+	ResponseCode   string `paygent:"response_code"`
+	ResponseDetail string `paygent:"response_detail"`
+}
+
+// PaymentResponse response of telegrams that return payment id
+type PaymentResponse struct {
+	TelegramResponse
+	PaymentID string `paygent:"payment_id"`
+}
+
+// AuthorizeRequest 020 card payment authorization
+type AuthorizeRequest struct {
+	TradingID           string `paygent:"trading_id,max=70,class=halfwidth"`
+	PaymentAmount       uint64 `paygent:"payment_amount,required,max=7,class=numeric"`
+	PaymentClass        uint   `paygent:"payment_class,max=2,class=numeric"`
+	CardNumber          string `paygent:"card_number,max=19,class=numeric"`
+	CardValidTerm       string `paygent:"card_valid_term,len=4,class=numeric"`
+	CardConfNumber      string `paygent:"card_conf_number,max=4,class=numeric"`
+	SecurityCodeUse     bool   `paygent:"security_code_use"`
+	StockCardMode       bool   `paygent:"stock_card_mode"`
+	CustomerID          string `paygent:"customer_id,max=50,class=halfwidth"`
+	CustomerCardID      string `paygent:"customer_card_id,max=20,class=numeric"`
+	ThreeDSecureRyaku   bool   `paygent:"3dsecure_ryaku"`
+	ThreeDSecureUseType string `paygent:"3dsecure_use_type,max=1,class=numeric"`
+	ThreeDSAuthID       string `paygent:"3ds_auth_id,max=100,class=halfwidth"`
+	HttpUserAgent       string `paygent:"http_user_agent,max=1000"`
+	HttpAccept          string `paygent:"http_accept,max=1000,class=halfwidth"`
+	TermURL             string `paygent:"term_url,max=1000,class=halfwidth"`
+}
+
+func (AuthorizeRequest) TelegramKind() string { return "020" }
+
+// AuthorizeResponse response of 020
+type AuthorizeResponse struct {
+	PaymentResponse
+	OutAcsHTML string `paygent:"out_acs_html,tail"`
+}
+
+// VoidAuthorizationRequest 021 authorization cancellation
+type VoidAuthorizationRequest struct {
+	PaymentID string `paygent:"payment_id,required,max=20,class=numeric"`
+}
+
+func (VoidAuthorizationRequest) TelegramKind() string { return "021" }
+
+// CaptureRequest 022 sales
+type CaptureRequest struct {
+	PaymentID string `paygent:"payment_id,required,max=20,class=numeric"`
+}
+
+func (CaptureRequest) TelegramKind() string { return "022" }
+
+// VoidCaptureRequest 023 sales cancellation
+type VoidCaptureRequest struct {
+	PaymentID string `paygent:"payment_id,required,max=20,class=numeric"`
+}
+
+func (VoidCaptureRequest) TelegramKind() string { return "023" }
+
+// CreateCardRequest 025 stored card registration
+type CreateCardRequest struct {
+	CustomerID      string `paygent:"customer_id,required,max=50,class=halfwidth"`
+	CardNumber      string `paygent:"card_number,required,max=19,class=numeric"`
+	CardValidTerm   string `paygent:"card_valid_term,required,len=4,class=numeric"`
+	CardholderName  string `paygent:"cardholder_name,max=45"`
+	CardBrand       string `paygent:"card_brand,max=1,class=alphanumeric"`
+	SecurityCodeUse bool   `paygent:"security_code_use"`
+	CardConfNumber  string `paygent:"card_conf_number,max=4,class=numeric"`
+}
+
+func (CreateCardRequest) TelegramKind() string { return "025" }
+
+// CreateCardResponse response of 025
+type CreateCardResponse struct {
+	TelegramResponse
+	CustomerCardID string `paygent:"customer_card_id"`
+}
+
+// DeleteCardRequest 026 stored card deletion
+type DeleteCardRequest struct {
+	CustomerID     string `paygent:"customer_id,required,max=50,class=halfwidth"`
+	CustomerCardID string `paygent:"customer_card_id,max=20,class=numeric"`
+}
+
+func (DeleteCardRequest) TelegramKind() string { return "026" }
+
+// ListCardsRequest 027 stored card inquiry, cards in response are CSV, parse them with ListCreditCards
+type ListCardsRequest struct {
+	CustomerID     string `paygent:"customer_id,required,max=50,class=halfwidth"`
+	CustomerCardID string `paygent:"customer_card_id,max=20,class=numeric"`
+}
+
+func (ListCardsRequest) TelegramKind() string { return "027" }
+
+// RefundAuthorizationRequest 028 authorization amount correction
+type RefundAuthorizationRequest struct {
+	PaymentID     string `paygent:"payment_id,required,max=20,class=numeric"`
+	PaymentAmount uint   `paygent:"payment_amount,required,max=7,class=numeric"`
+	ReductionFlag bool   `paygent:"reduction_flag"`
+}
+
+func (RefundAuthorizationRequest) TelegramKind() string { return "028" }
+
+// RefundCaptureRequest 029 sales amount correction
+type RefundCaptureRequest struct {
+	PaymentID     string `paygent:"payment_id,required,max=20,class=numeric"`
+	PaymentAmount uint   `paygent:"payment_amount,required,max=7,class=numeric"`
+	ReductionFlag bool   `paygent:"reduction_flag"`
+}
+
+func (RefundCaptureRequest) TelegramKind() string { return "029" }
+
+// PaymentNoticeRequest 091 payment notice inquiry, returns the notice after PaymentNoticeID
+type PaymentNoticeRequest struct {
+	PaymentNoticeID string `paygent:"payment_notice_id,max=20,class=numeric"`
+}
+
+func (PaymentNoticeRequest) TelegramKind() string { return "091" }
+
+// PaymentNoticeResponse response of 091
+type PaymentNoticeResponse struct {
+	PaymentResponse
+	PaymentNoticeID string `paygent:"payment_notice_id"`
+	TradingID       string `paygent:"trading_id"`
+	PaymentStatus   string `paygent:"payment_status"`
+	PaymentAmount   string `paygent:"payment_amount"`
+	PaymentInitDate string `paygent:"payment_init_date"`
+	ChangeDate      string `paygent:"change_date"`
+	BasePaymentID   string `paygent:"base_payment_id"`
+	SuccessCode     string `paygent:"success_code"`
+	SuccessDetail   string `paygent:"success_detail"`
+}
+
+// PaymentRefRequest 094 payment reference inquiry
+type PaymentRefRequest struct {
+	PaymentID string `paygent:"payment_id,max=20,class=numeric"`
+	TradingID string `paygent:"trading_id,max=70,class=halfwidth"`
+}
+
+func (PaymentRefRequest) TelegramKind() string { return "094" }
+
+// PaymentRefResponse response of 094
+type PaymentRefResponse struct {
+	PaymentResponse
+	TradingID       string `paygent:"trading_id"`
+	PaymentStatus   string `paygent:"payment_status"`
+	PaymentAmount   string `paygent:"payment_amount"`
+	PaymentInitDate string `paygent:"payment_init_date"`
+	CurrencyCode    string `paygent:"currency_code"`
+	BasePaymentID   string `paygent:"base_payment_id"`
+}
+
+// ApplicationResponse response of redirect payment applications, like 270, 420
+type ApplicationResponse struct {
+	PaymentResponse
+	TradeGenerationDate string `paygent:"trade_generation_date"`
+	RedirectHTML        string `paygent:"redirect_html,tail"`
+}
+
+// RakutenPayGood good of rakuten pay
+type RakutenPayGood struct {
+	Name   string `paygent:"goods,max=255,kana=full"`
+	ID     string `paygent:"goods_id,required,max=100,class=halfwidth"`
+	Price  uint64 `paygent:"goods_price,max=8,class=numeric"`
+	Amount uint64 `paygent:"goods_amount,required,max=5,class=numeric"`
+}
+
+// RakutenPayApplicationRequest 270 rakuten pay application
+type RakutenPayApplicationRequest struct {
+	PaymentAmount   uint64           `paygent:"payment_amount,required,max=8,class=numeric"`
+	MerchandiseType uint64           `paygent:"merchandise_type,zero,max=1,class=numeric"`
+	PCMobileType    uint64           `paygent:"pc_mobile_type,zero,max=1,class=numeric"`
+	ButtonType      string           `paygent:"button_type,max=20,class=halfwidth"`
+	ReturnURL       string           `paygent:"return_url,max=1000,class=halfwidth"`
+	CancelURL       string           `paygent:"cancel_url,max=1000,class=halfwidth"`
+	Goods           []RakutenPayGood `paygent:",indexed"`
+}
+
+func (RakutenPayApplicationRequest) TelegramKind() string { return "270" }
+
+// RakutenPaySalesRequest 271 rakuten pay sales
+type RakutenPaySalesRequest struct {
+	PaymentID string `paygent:"payment_id,required,max=20,class=numeric"`
+}
+
+func (RakutenPaySalesRequest) TelegramKind() string { return "271" }
+
+// RakutenPayCancellationRequest 272 rakuten pay cancellation
+type RakutenPayCancellationRequest struct {
+	PaymentID string `paygent:"payment_id,required,max=20,class=numeric"`
+}
+
+func (RakutenPayCancellationRequest) TelegramKind() string { return "272" }
+
+// RakutenPayCorrectionRequest 273 rakuten pay amount correction
+type RakutenPayCorrectionRequest struct {
+	PaymentID     string           `paygent:"payment_id,required,max=20,class=numeric"`
+	PaymentAmount uint             `paygent:"payment_amount,required,max=8,class=numeric"`
+	Goods         []RakutenPayGood `paygent:",indexed"`
+}
+
+func (RakutenPayCorrectionRequest) TelegramKind() string { return "273" }
+
+// PayPayApplicationRequest 420 paypay application
+type PayPayApplicationRequest struct {
+	PaymentAmount uint64 `paygent:"payment_amount,required,max=8,class=numeric"`
+	ReturnURL     string `paygent:"return_url,max=1000,class=halfwidth"`
+	CancelURL     string `paygent:"cancel_url,max=1000,class=halfwidth"`
+}
+
+func (PayPayApplicationRequest) TelegramKind() string { return "420" }
+
+// PayPayCancelAndRefundRequest 421 paypay cancellation and refund, refund whole payment if RepaymentAmount is 0
+type PayPayCancelAndRefundRequest struct {
+	PaymentID       string `paygent:"payment_id,required,max=20,class=numeric"`
+	RepaymentAmount uint   `paygent:"repayment_amount,max=8,class=numeric"`
+}
+
+func (PayPayCancelAndRefundRequest) TelegramKind() string { return "421" }
+
+// PayPaySalesRequest 422 paypay sales
+type PayPaySalesRequest struct {
+	PaymentID string `paygent:"payment_id,required,max=20,class=numeric"`
+}
+
+func (PayPaySalesRequest) TelegramKind() string { return "422" }
+
+// ThreeDS2AuthenticationRequest 450 3D Secure 2.0 authentication
+type ThreeDS2AuthenticationRequest struct {
+	TradingID          string            `paygent:"trading_id,max=70,class=halfwidth"`
+	PaymentAmount      uint64            `paygent:"payment_amount,required,max=7,class=numeric"`
+	TermURL            string            `paygent:"term_url,required,max=1000,class=halfwidth"`
+	AuthenticationType string            `paygent:"authentication_type,required,len=2,class=numeric"`
+	MerchantName       string            `paygent:"merchant_name,max=100,kana=full"`
+	CardSetMethod      string            `paygent:"card_set_method,required,max=10,class=alphanumeric"`
+	CustomerID         string            `paygent:"customer_id,max=50,class=halfwidth"`
+	CustomerCardID     string            `paygent:"customer_card_id,max=20,class=numeric"`
+	CardNumber         string            `paygent:"card_number,max=19,class=numeric"`
+	CardValidTerm      string            `paygent:"card_valid_term,len=4,class=numeric"`
+	CardConfNumber     string            `paygent:"card_conf_number,max=4,class=numeric"`
+	Params             gomerchant.Params `paygent:",extra"`
+}
+
+func (ThreeDS2AuthenticationRequest) TelegramKind() string { return "450" }
+
+// ThreeDS2AuthenticationResponse response of 450
+type ThreeDS2AuthenticationResponse struct {
+	TelegramResponse
+	OutAcsHTML string `paygent:"out_acs_html,tail"`
+}
@@ -0,0 +1,45 @@
+package paygent
+
+import (
+	"fmt"
+
+	"github.com/qor/gomerchant"
+)
+
+var _ gomerchant.TransactionLister = &Paygent{}
+
+// ListTransactions list payments of an order, paygent can only inquire payments by trading id (order id),
+// the latest payment is returned first, then payments it is based on (base_payment_id), like authorizations before amount corrections,
+// date and status filters are applied to fetched payments, other filters are not supported
+func (paygent *Paygent) ListTransactions(params gomerchant.ListTransactionsParams) gomerchant.TransactionIterator {
+	if params.OrderID == "" || params.CustomerID != "" {
+		return gomerchant.ErrorIterator(fmt.Errorf("%w: paygent only supports listing transactions by order id", gomerchant.ErrUnsupportedFilter))
+	}
+
+	resume := params.Cursor != ""
+	fetch := func(cursor string) ([]gomerchant.Transaction, string, error) {
+		var request = PaymentRefRequest{PaymentID: cursor}
+		if cursor == "" {
+			request.TradingID = params.OrderID
+		}
+
+		transaction, err := paygent.query(request)
+		if err != nil {
+			return nil, "", err
+		}
+
+		next := fmt.Sprint(transaction.Params["base_payment_id"])
+		if _, ok := transaction.Params["base_payment_id"]; !ok || next == transaction.ID {
+			next = ""
+		}
+
+		// continue after cursor, the cursor payment itself was returned already
+		if resume {
+			resume = false
+			return nil, next, nil
+		}
+		return []gomerchant.Transaction{transaction}, next, nil
+	}
+
+	return gomerchant.NewTransactionIterator(params.Cursor, fetch, params.Match)
+}
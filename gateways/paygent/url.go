@@ -47,5 +47,5 @@ var TelegramServiceURLs = map[string]string{
 	"421": "/n/paypay/request",
 	"422": "/n/paypay/request",
 	// 3ds2.0 authencation
-	"450": "n/threeds/request",
+	"450": "/n/threeds/request",
 }
@@ -3,6 +3,7 @@ package paygent
 import (
 	"fmt"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/qor/gomerchant"
@@ -57,18 +58,41 @@ func extractTransactionFromPaygentResponse(params Response) (transaction gomerch
 	}
 
 	if v, ok := params.Get("payment_status"); ok {
-		transaction.Status = fmt.Sprint(v)
-		switch transaction.Status {
-		case "20", "30", "35":
-			transaction.Paid = true
-		case "40", "41":
-			transaction.Paid = true
-			transaction.Captured = true
-		case "32", "33", "42", "55", "60":
-			transaction.Cancelled = true
-		}
+		setTransactionStatus(&transaction, fmt.Sprint(v))
+	}
+
+	return
+}
+
+func setTransactionStatus(transaction *gomerchant.Transaction, status string) {
+	transaction.Status = status
+	switch status {
+	case "20", "30", "35":
+		transaction.Paid = true
+	case "40", "41":
+		transaction.Paid = true
+		transaction.Captured = true
+	case "32", "33", "42", "55", "60":
+		transaction.Cancelled = true
+	}
+}
+
+func extractApplicationResponse(results Response) (response gomerchant.ApplicationResponse) {
+	if paymentID, ok := results.Get("payment_id"); ok {
+		response.TransactionID = fmt.Sprint(paymentID)
+	}
+
+	if tradeGenerationDate, ok := results.Get("trade_generation_date"); ok {
+		response.TradeGenerationDate = fmt.Sprint(tradeGenerationDate)
+	}
+
+	// redirect_html contains line breaks that ResponseParser can't handle, so take everything after the key
+	redirectHTML := strings.Split(results.RawBody, "redirect_html=")
+	if len(redirectHTML) == 2 {
+		response.RedirectHTML = redirectHTML[1]
 	}
 
+	response.Params = results.Params
 	return
 }
 
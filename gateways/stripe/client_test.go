@@ -0,0 +1,143 @@
+package stripe_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/qor/gomerchant"
+	"github.com/qor/gomerchant/gateways/stripe"
+)
+
+// stubRequest request received by stub backend
+type stubRequest struct {
+	Method        string
+	Path          string
+	Authorization string
+	StripeAccount string
+	Form          map[string]string
+	Files         map[string]string // form field => uploaded file name
+}
+
+// stubBackend local stripe API, responds with JSON returned by handler
+type stubBackend struct {
+	*httptest.Server
+	mutex    sync.Mutex
+	requests []stubRequest
+}
+
+func newStubBackend(t *testing.T, handler func(request stubRequest) (int, interface{})) *stubBackend {
+	backend := &stubBackend{}
+	backend.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseMultipartForm(1 << 20)
+		request := stubRequest{
+			Method:        r.Method,
+			Path:          r.URL.Path,
+			Authorization: r.Header.Get("Authorization"),
+			StripeAccount: r.Header.Get("Stripe-Account"),
+			Form:          map[string]string{},
+			Files:         map[string]string{},
+		}
+		for key := range r.Form {
+			request.Form[key] = r.Form.Get(key)
+		}
+		if r.MultipartForm != nil {
+			for key, files := range r.MultipartForm.File {
+				request.Files[key] = files[0].Filename
+			}
+		}
+
+		backend.mutex.Lock()
+		backend.requests = append(backend.requests, request)
+		backend.mutex.Unlock()
+
+		status, body := handler(request)
+		if status == http.StatusConflict {
+			w.Header().Set("Stripe-Should-Retry", "true")
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(body)
+	}))
+	t.Cleanup(backend.Close)
+	return backend
+}
+
+func (backend *stubBackend) Requests() []stubRequest {
+	backend.mutex.Lock()
+	defer backend.mutex.Unlock()
+	return append([]stubRequest{}, backend.requests...)
+}
+
+func (backend *stubBackend) Stripe(key string) *stripe.Stripe {
+	return stripe.New(&stripe.Config{Key: key, URL: backend.URL, UploadsURL: backend.URL, HTTPClient: backend.Client()})
+}
+
+func chargeJSON(id string, amount int, captured bool) map[string]interface{} {
+	return map[string]interface{}{"id": id, "object": "charge", "amount": amount, "currency": "jpy", "captured": captured, "paid": true, "status": "succeeded", "created": 1700000000}
+}
+
+func TestClientsWithDifferentKeys(t *testing.T) {
+	backend := newStubBackend(t, func(request stubRequest) (int, interface{}) {
+		return http.StatusOK, chargeJSON("ch_1", 1000, false)
+	})
+
+	jp, us := backend.Stripe("sk_test_jp"), backend.Stripe("sk_test_us")
+	jp.Authorize(1000, gomerchant.AuthorizeParams{Currency: "jpy", OrderID: "order-1"})
+	us.Query("ch_1")
+	jp.Query("ch_1")
+
+	requests := backend.Requests()
+	if len(requests) != 3 {
+		t.Fatalf("should send 3 requests, but got %v", len(requests))
+	}
+
+	for idx, key := range []string{"sk_test_jp", "sk_test_us", "sk_test_jp"} {
+		if requests[idx].Authorization != "Bearer "+key {
+			t.Errorf("request %v should use key %v, but got %v", idx, key, requests[idx].Authorization)
+		}
+	}
+
+	if requests[0].Path != "/v1/charges" || requests[0].Form["metadata[order_id]"] != "order-1" || requests[0].Form["capture"] != "false" {
+		t.Errorf("authorize request is not correct, got %+v", requests[0])
+	}
+}
+
+func TestStripeAccount(t *testing.T) {
+	backend := newStubBackend(t, func(request stubRequest) (int, interface{}) {
+		return http.StatusOK, chargeJSON("ch_1", 1000, true)
+	})
+
+	client := backend.Stripe("sk_test")
+	client.Capture("ch_1", gomerchant.CaptureParams{Params: gomerchant.Params{stripe.StripeAccountParam: "acct_param"}})
+	client.WithAccount("acct_connected").Query("ch_1")
+	client.Query("ch_1")
+
+	requests := backend.Requests()
+	for idx, account := range []string{"acct_param", "acct_connected", ""} {
+		if requests[idx].StripeAccount != account {
+			t.Errorf("request %v should be sent with Stripe-Account %q, but got %q", idx, account, requests[idx].StripeAccount)
+		}
+	}
+}
+
+func TestMaxNetworkRetries(t *testing.T) {
+	var count int
+	backend := newStubBackend(t, func(request stubRequest) (int, interface{}) {
+		if count++; count == 1 {
+			return http.StatusConflict, map[string]interface{}{"error": map[string]string{"type": "api_error", "message": "lock timeout"}}
+		}
+		return http.StatusOK, chargeJSON("ch_1", 1000, true)
+	})
+
+	client := stripe.New(&stripe.Config{Key: "sk_test", URL: backend.URL, MaxNetworkRetries: 1})
+	if transaction, err := client.Query("ch_1"); err != nil || transaction.Amount != 1000 || !transaction.Captured {
+		t.Errorf("request should be retried, but got %v, %+v", err, transaction)
+	}
+
+	if len(backend.Requests()) != 2 {
+		t.Errorf("should send 2 requests, but got %v", len(backend.Requests()))
+	}
+}
@@ -0,0 +1,201 @@
+package stripe
+
+import (
+	"fmt"
+
+	"github.com/qor/gomerchant"
+	stripe "github.com/stripe/stripe-go"
+)
+
+// SplitTransfer transfer to connected account of a split payment
+type SplitTransfer struct {
+	ID             string
+	Account        string
+	Amount         int64
+	AmountReversed int64
+	TransferGroup  string
+}
+
+// setSplitPayment set destination, application fee, on_behalf_of and transfer group of charge
+func setSplitPayment(chargeParams *stripe.ChargeParams, amount uint64, orderID string, split gomerchant.SplitPayment) error {
+	if err := split.Validate(amount); err != nil {
+		return err
+	}
+
+	if split.OnBehalfOf != "" {
+		chargeParams.OnBehalfOf = stripe.String(split.OnBehalfOf)
+	}
+
+	switch split.Mode {
+	case gomerchant.SplitDestination:
+		recipient := split.Recipients[0]
+		chargeParams.TransferData = &stripe.ChargeTransferDataParams{Destination: stripe.String(recipient.Account)}
+		if recipient.Amount > 0 {
+			// application fee is what is not transferred if transfer amount is set
+			if split.ApplicationFee > 0 && recipient.Amount+split.ApplicationFee != amount {
+				return fmt.Errorf("%w: application fee should be payment amount - recipient amount", gomerchant.ErrInvalidSplitPayment)
+			}
+			chargeParams.TransferData.Amount = stripe.Int64(int64(recipient.Amount))
+		} else if split.ApplicationFee > 0 {
+			chargeParams.ApplicationFeeAmount = stripe.Int64(int64(split.ApplicationFee))
+		}
+	case gomerchant.SplitSeparate:
+		transferGroup := split.TransferGroup
+		if transferGroup == "" {
+			transferGroup = orderID
+		}
+		if transferGroup != "" {
+			chargeParams.TransferGroup = stripe.String(transferGroup)
+		}
+	}
+	return nil
+}
+
+// Transfer transfer funds of a captured charge to recipients of split payment, for separate charges and transfers,
+// transfers are tied to the charge with source_transaction, so they succeed even if the charge's funds are still pending
+func (s *Stripe) Transfer(transactionID string, split gomerchant.SplitPayment) ([]SplitTransfer, error) {
+	var transfers []SplitTransfer
+
+	if split.Mode != gomerchant.SplitSeparate {
+		return nil, fmt.Errorf("%w: only separate split payment could be transferred", gomerchant.ErrInvalidSplitPayment)
+	}
+
+	c, err := s.getCharge(transactionID, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := split.Validate(uint64(c.Amount - c.AmountRefunded)); err != nil {
+		return nil, err
+	}
+
+	transferGroup := split.TransferGroup
+	if transferGroup == "" {
+		transferGroup = c.TransferGroup
+	}
+
+	for _, recipient := range split.Recipients {
+		transferParams := &stripe.TransferParams{
+			Amount:            stripe.Int64(int64(recipient.Amount)),
+			Currency:          stripe.String(string(c.Currency)),
+			Destination:       stripe.String(recipient.Account),
+			SourceTransaction: stripe.String(c.ID),
+		}
+		if transferGroup != "" {
+			transferParams.TransferGroup = stripe.String(transferGroup)
+		}
+		if recipient.Description != "" {
+			transferParams.Description = stripe.String(recipient.Description)
+		}
+		s.setParams(&transferParams.Params, nil)
+
+		transfer, err := s.API.Transfers.New(transferParams)
+		if err != nil {
+			return transfers, err
+		}
+		transfers = append(transfers, toSplitTransfer(transfer))
+	}
+	return transfers, nil
+}
+
+// Transfers transfers created from the charge
+func (s *Stripe) Transfers(transactionID string) ([]SplitTransfer, error) {
+	c, err := s.getCharge(transactionID, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	transfers, err := s.chargeTransfers(c, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var results []SplitTransfer
+	for _, transfer := range transfers {
+		results = append(results, toSplitTransfer(transfer))
+	}
+	return results, nil
+}
+
+func toSplitTransfer(transfer *stripe.Transfer) SplitTransfer {
+	result := SplitTransfer{
+		ID:             transfer.ID,
+		Amount:         transfer.Amount,
+		AmountReversed: transfer.AmountReversed,
+		TransferGroup:  transfer.TransferGroup,
+	}
+	if transfer.Destination != nil {
+		result.Account = transfer.Destination.ID
+	}
+	return result
+}
+
+// chargeTransfers transfers in the transfer group of charge that use the charge as source transaction
+func (s *Stripe) chargeTransfers(c *stripe.Charge, params gomerchant.Params) ([]*stripe.Transfer, error) {
+	var transfers []*stripe.Transfer
+	if c.TransferGroup == "" {
+		return nil, nil
+	}
+
+	listParams := &stripe.TransferListParams{TransferGroup: stripe.String(c.TransferGroup)}
+	if account := s.stripeAccount(params); account != "" {
+		listParams.SetStripeAccount(account)
+	}
+
+	iter := s.API.Transfers.List(listParams)
+	for iter.Next() {
+		transfer := iter.Transfer()
+		// transfer group may be shared by other charges of the order, or manual transfers without source transaction
+		if transfer.SourceTransaction != nil && transfer.SourceTransaction.ID == c.ID {
+			transfers = append(transfers, transfer)
+		}
+	}
+	return transfers, iter.Err()
+}
+
+// refund refund charge, transfers to connected accounts are reversed in proportion if reverseTransfers is true
+//
+// destination charges are reversed by stripe with application fee refunded, transfers of separate charges are reversed after refunded
+func (s *Stripe) refund(c *stripe.Charge, refundParams *stripe.RefundParams, reverseTransfers bool, params gomerchant.Params) error {
+	isDestination := c.TransferData != nil || c.Destination != nil
+	if reverseTransfers && isDestination {
+		refundParams.ReverseTransfer = stripe.Bool(true)
+		refundParams.RefundApplicationFee = stripe.Bool(true)
+	}
+
+	refund, err := s.API.Refunds.New(refundParams)
+	if err != nil || !reverseTransfers || isDestination {
+		return err
+	}
+
+	transfers, err := s.chargeTransfers(c, params)
+	if err != nil {
+		return fmt.Errorf("stripe: charge %v refunded, but failed to list transfers to reverse: %w", c.ID, err)
+	}
+
+	split := gomerchant.SplitPayment{}
+	for _, transfer := range transfers {
+		split.Recipients = append(split.Recipients, gomerchant.SplitRecipient{Amount: uint64(transfer.Amount)})
+	}
+
+	for idx, amount := range split.Allocate(uint64(refund.Amount), uint64(c.Amount)) {
+		transfer := transfers[idx]
+		if remaining := uint64(transfer.Amount - transfer.AmountReversed); amount > remaining {
+			amount = remaining
+		}
+		if amount == 0 {
+			continue
+		}
+
+		reversalParams := &stripe.ReversalParams{
+			Transfer: stripe.String(transfer.ID),
+			Amount:   stripe.Int64(int64(amount)),
+		}
+		s.setParams(&reversalParams.Params, params)
+
+		if _, err := s.API.Reversals.New(reversalParams); err != nil {
+			return fmt.Errorf("stripe: charge %v refunded, but failed to reverse transfer %v: %w", c.ID, transfer.ID, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,157 @@
+package stripe_test
+
+import (
+	"errors"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/qor/gomerchant"
+)
+
+func TestDestinationCharge(t *testing.T) {
+	backend := newStubBackend(t, func(request stubRequest) (int, interface{}) {
+		charge := chargeJSON("ch_1", 1000, true)
+		charge["transfer_data"] = map[string]interface{}{"destination": "acct_seller"}
+		if request.Path == "/v1/refunds" {
+			return http.StatusOK, map[string]interface{}{"id": "re_1", "object": "refund", "amount": 300, "charge": "ch_1"}
+		}
+		return http.StatusOK, charge
+	})
+	client := backend.Stripe("sk_test")
+
+	_, err := client.Authorize(1000, gomerchant.AuthorizeParams{
+		Currency: "jpy",
+		OrderID:  "order-1",
+		SplitPayment: &gomerchant.SplitPayment{
+			Mode:           gomerchant.SplitDestination,
+			OnBehalfOf:     "acct_seller",
+			ApplicationFee: 100,
+			Recipients:     []gomerchant.SplitRecipient{{Account: "acct_seller"}},
+		},
+	})
+	if err != nil {
+		t.Fatalf("failed to authorize, got %v", err)
+	}
+
+	if _, err := client.Refund("ch_1", 300, gomerchant.RefundParams{Captured: true, ReverseTransfers: true}); err != nil {
+		t.Fatalf("failed to refund, got %v", err)
+	}
+
+	requests := backend.Requests()
+	authorize := requests[0].Form
+	if authorize["transfer_data[destination]"] != "acct_seller" || authorize["application_fee_amount"] != "100" || authorize["on_behalf_of"] != "acct_seller" {
+		t.Errorf("destination charge is not correct, got %v", authorize)
+	}
+
+	refund := requests[len(requests)-1]
+	if refund.Path != "/v1/refunds" || refund.Form["reverse_transfer"] != "true" || refund.Form["refund_application_fee"] != "true" || refund.Form["amount"] != "300" {
+		t.Errorf("refund of destination charge should reverse transfer, got %+v", refund)
+	}
+}
+
+func TestInvalidSplitPayment(t *testing.T) {
+	backend := newStubBackend(t, func(request stubRequest) (int, interface{}) {
+		return http.StatusOK, chargeJSON("ch_1", 1000, false)
+	})
+
+	_, err := backend.Stripe("sk_test").Authorize(1000, gomerchant.AuthorizeParams{
+		Currency: "jpy",
+		SplitPayment: &gomerchant.SplitPayment{
+			Mode:       gomerchant.SplitSeparate,
+			Recipients: []gomerchant.SplitRecipient{{Account: "acct_1", Amount: 800}, {Account: "acct_2", Amount: 800}},
+		},
+	})
+
+	if !errors.Is(err, gomerchant.ErrInvalidSplitPayment) {
+		t.Errorf("should get invalid split payment error, but got %v", err)
+	}
+
+	if len(backend.Requests()) != 0 {
+		t.Errorf("invalid split payment should not be sent")
+	}
+}
+
+func TestSeparateChargesAndTransfers(t *testing.T) {
+	transfers := []map[string]interface{}{}
+	backend := newStubBackend(t, func(request stubRequest) (int, interface{}) {
+		switch {
+		case request.Path == "/v1/charges" || request.Path == "/v1/charges/ch_1":
+			charge := chargeJSON("ch_1", 1000, true)
+			charge["transfer_group"] = "order-1"
+			return http.StatusOK, charge
+		case request.Path == "/v1/transfers" && request.Method == http.MethodPost:
+			amount, _ := strconv.Atoi(request.Form["amount"])
+			transfer := map[string]interface{}{
+				"id":                 "tr_" + request.Form["destination"],
+				"object":             "transfer",
+				"amount":             amount,
+				"destination":        request.Form["destination"],
+				"source_transaction": request.Form["source_transaction"],
+				"transfer_group":     request.Form["transfer_group"],
+			}
+			transfers = append(transfers, transfer)
+			return http.StatusOK, transfer
+		case request.Path == "/v1/transfers":
+			return http.StatusOK, map[string]interface{}{"object": "list", "data": transfers, "has_more": false}
+		case request.Path == "/v1/refunds":
+			return http.StatusOK, map[string]interface{}{"id": "re_1", "object": "refund", "amount": 300, "charge": "ch_1"}
+		case strings.HasSuffix(request.Path, "/reversals"):
+			amount, _ := strconv.Atoi(request.Form["amount"])
+			return http.StatusOK, map[string]interface{}{"id": "trr_1", "object": "transfer_reversal", "amount": amount}
+		}
+		return http.StatusNotFound, map[string]interface{}{"error": map[string]string{"type": "invalid_request_error"}}
+	})
+	client := backend.Stripe("sk_test")
+
+	split := gomerchant.SplitPayment{
+		Mode:       gomerchant.SplitSeparate,
+		Recipients: []gomerchant.SplitRecipient{{Account: "acct_a", Amount: 500}, {Account: "acct_b", Amount: 200}},
+	}
+
+	if _, err := client.Authorize(1000, gomerchant.AuthorizeParams{Currency: "jpy", OrderID: "order-1", SplitPayment: &split}); err != nil {
+		t.Fatalf("failed to authorize, got %v", err)
+	}
+
+	if form := backend.Requests()[0].Form; form["transfer_group"] != "order-1" || form["transfer_data[destination]"] != "" {
+		t.Errorf("transfer group should be order id, got %v", form)
+	}
+
+	results, err := client.Transfer("ch_1", split)
+	if err != nil || len(results) != 2 || results[0].Account != "acct_a" || results[0].Amount != 500 {
+		t.Fatalf("failed to transfer, got %v, %+v", err, results)
+	}
+
+	for _, transfer := range transfers {
+		if transfer["source_transaction"] != "ch_1" || transfer["transfer_group"] != "order-1" {
+			t.Errorf("transfer should be tied to charge, got %v", transfer)
+		}
+	}
+
+	// transfers of another charge or without source transaction in the same transfer group
+	transfers = append(transfers,
+		map[string]interface{}{"id": "tr_other_charge", "object": "transfer", "amount": 100, "destination": "acct_a", "source_transaction": "ch_2", "transfer_group": "order-1"},
+		map[string]interface{}{"id": "tr_manual", "object": "transfer", "amount": 100, "destination": "acct_b", "transfer_group": "order-1"},
+	)
+	if results, err := client.Transfers("ch_1"); err != nil || len(results) != 2 {
+		t.Errorf("only transfers from the charge should be listed, got %v, %+v", err, results)
+	}
+
+	if _, err := client.Refund("ch_1", 300, gomerchant.RefundParams{Captured: true, ReverseTransfers: true}); err != nil {
+		t.Fatalf("failed to refund, got %v", err)
+	}
+
+	reversals := map[string]string{}
+	for _, request := range backend.Requests() {
+		if strings.HasSuffix(request.Path, "/reversals") {
+			reversals[request.Path] = request.Form["amount"]
+		}
+	}
+
+	expected := map[string]string{"/v1/transfers/tr_acct_a/reversals": "150", "/v1/transfers/tr_acct_b/reversals": "60"}
+	if !reflect.DeepEqual(reversals, expected) {
+		t.Errorf("transfers should be reversed in proportion, expected %v, but got %v", expected, reversals)
+	}
+}
@@ -5,23 +5,28 @@ import (
 
 	"github.com/qor/gomerchant"
 	stripe "github.com/stripe/stripe-go"
-	"github.com/stripe/stripe-go/card"
 )
 
-func (*Stripe) CreateCreditCard(creditCardParams gomerchant.CreateCreditCardParams) (gomerchant.CreditCardResponse, error) {
+func (s *Stripe) CreateCreditCard(creditCardParams gomerchant.CreateCreditCardParams) (gomerchant.CreditCardResponse, error) {
 	var (
 		expMonth = fmt.Sprint(creditCardParams.CreditCard.ExpMonth)
 		expYear  = fmt.Sprint(creditCardParams.CreditCard.ExpYear)
 	)
 
-	c, err := card.New(&stripe.CardParams{
+	cardParams := &stripe.CardParams{
 		Customer: &creditCardParams.CustomerID,
 		Name:     &creditCardParams.CreditCard.Name,
 		Number:   &creditCardParams.CreditCard.Number,
 		ExpMonth: &expMonth,
 		ExpYear:  &expYear,
 		CVC:      &creditCardParams.CreditCard.CVC,
-	})
+	}
+	s.setParams(&cardParams.Params, nil)
+
+	c, err := s.API.Cards.New(cardParams)
+	if err != nil {
+		return gomerchant.CreditCardResponse{}, err
+	}
 
 	resp := gomerchant.CreditCardResponse{CreditCardID: c.ID}
 
@@ -32,8 +37,14 @@ func (*Stripe) CreateCreditCard(creditCardParams gomerchant.CreateCreditCardPara
 	return resp, err
 }
 
-func (*Stripe) GetCreditCard(creditCardParams gomerchant.GetCreditCardParams) (gomerchant.GetCreditCardResponse, error) {
-	c, err := card.Get(creditCardParams.CreditCardID, &stripe.CardParams{Customer: &creditCardParams.CustomerID})
+func (s *Stripe) GetCreditCard(creditCardParams gomerchant.GetCreditCardParams) (gomerchant.GetCreditCardResponse, error) {
+	cardParams := &stripe.CardParams{Customer: &creditCardParams.CustomerID}
+	s.setParams(&cardParams.Params, nil)
+
+	c, err := s.API.Cards.Get(creditCardParams.CreditCardID, cardParams)
+	if err != nil {
+		return gomerchant.GetCreditCardResponse{}, err
+	}
 
 	resp := gomerchant.GetCreditCardResponse{
 		CreditCard: &gomerchant.CustomerCreditCard{
@@ -53,8 +64,13 @@ func (*Stripe) GetCreditCard(creditCardParams gomerchant.GetCreditCardParams) (g
 	return resp, err
 }
 
-func (*Stripe) ListCreditCards(listCreditCardsParams gomerchant.ListCreditCardsParams) (gomerchant.ListCreditCardsResponse, error) {
-	iter := card.List(&stripe.CardListParams{Customer: &listCreditCardsParams.CustomerID})
+func (s *Stripe) ListCreditCards(listCreditCardsParams gomerchant.ListCreditCardsParams) (gomerchant.ListCreditCardsResponse, error) {
+	listParams := &stripe.CardListParams{Customer: &listCreditCardsParams.CustomerID}
+	if account := s.stripeAccount(nil); account != "" {
+		listParams.SetStripeAccount(account)
+	}
+
+	iter := s.API.Cards.List(listParams)
 	resp := gomerchant.ListCreditCardsResponse{}
 	for iter.Next() {
 		c := iter.Card()
@@ -76,7 +92,10 @@ func (*Stripe) ListCreditCards(listCreditCardsParams gomerchant.ListCreditCardsP
 	return resp, iter.Err()
 }
 
-func (*Stripe) DeleteCreditCard(deleteCreditCardParams gomerchant.DeleteCreditCardParams) (gomerchant.DeleteCreditCardResponse, error) {
-	_, err := card.Del(deleteCreditCardParams.CreditCardID, &stripe.CardParams{Customer: &deleteCreditCardParams.CustomerID})
+func (s *Stripe) DeleteCreditCard(deleteCreditCardParams gomerchant.DeleteCreditCardParams) (gomerchant.DeleteCreditCardResponse, error) {
+	cardParams := &stripe.CardParams{Customer: &deleteCreditCardParams.CustomerID}
+	s.setParams(&cardParams.Params, nil)
+
+	_, err := s.API.Cards.Del(deleteCreditCardParams.CreditCardID, cardParams)
 	return gomerchant.DeleteCreditCardResponse{}, err
 }
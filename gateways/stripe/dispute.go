@@ -0,0 +1,160 @@
+package stripe
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/qor/gomerchant"
+	stripe "github.com/stripe/stripe-go"
+)
+
+var _ gomerchant.DisputeManager = &Stripe{}
+
+var disputeStatuses = map[stripe.DisputeStatus]gomerchant.DisputeStatus{
+	stripe.DisputeStatusWarningNeedsResponse: gomerchant.DisputeInquiry,
+	stripe.DisputeStatusWarningUnderReview:   gomerchant.DisputeInquiry,
+	stripe.DisputeStatusWarningClosed:        gomerchant.DisputeClosed,
+	stripe.DisputeStatusNeedsResponse:        gomerchant.DisputeNeedsResponse,
+	stripe.DisputeStatusUnderReview:          gomerchant.DisputeUnderReview,
+	stripe.DisputeStatusWon:                  gomerchant.DisputeWon,
+	stripe.DisputeStatusLost:                 gomerchant.DisputeLost,
+	stripe.DisputeStatusChargeRefunded:       gomerchant.DisputeClosed,
+}
+
+func (s *Stripe) ListDisputes(params gomerchant.ListDisputesParams) (gomerchant.ListDisputesResponse, error) {
+	var (
+		response   gomerchant.ListDisputesResponse
+		listParams = &stripe.DisputeListParams{}
+	)
+	listParams.Single = true
+
+	if params.PageSize > 0 {
+		listParams.Limit = stripe.Int64(int64(params.PageSize))
+	}
+
+	if params.Cursor != "" {
+		listParams.StartingAfter = stripe.String(params.Cursor)
+	}
+
+	if params.TransactionID != "" {
+		listParams.Charge = stripe.String(params.TransactionID)
+	}
+
+	if params.CreatedAfter != nil || params.CreatedBefore != nil {
+		listParams.CreatedRange = &stripe.RangeQueryParams{}
+		if params.CreatedAfter != nil {
+			listParams.CreatedRange.GreaterThanOrEqual = params.CreatedAfter.Unix()
+		}
+		if params.CreatedBefore != nil {
+			listParams.CreatedRange.LesserThan = params.CreatedBefore.Unix()
+		}
+	}
+
+	if account := s.stripeAccount(params.Params); account != "" {
+		listParams.SetStripeAccount(account)
+	}
+
+	iter := s.API.Disputes.List(listParams)
+	for iter.Next() {
+		dispute := toDispute(iter.Dispute())
+		response.Disputes = append(response.Disputes, &dispute)
+	}
+
+	if meta := iter.Meta(); meta != nil && meta.HasMore && len(response.Disputes) > 0 {
+		response.Cursor = response.Disputes[len(response.Disputes)-1].ID
+	}
+	return response, iter.Err()
+}
+
+func (s *Stripe) GetDispute(disputeID string) (gomerchant.Dispute, error) {
+	disputeParams := &stripe.DisputeParams{}
+	s.setParams(&disputeParams.Params, nil)
+
+	dispute, err := s.API.Disputes.Get(disputeID, disputeParams)
+	if err != nil {
+		return gomerchant.Dispute{ID: disputeID}, err
+	}
+	return toDispute(dispute), nil
+}
+
+// SubmitDisputeEvidence upload files with purpose dispute_evidence, then update evidence of dispute with text and uploaded file ids
+func (s *Stripe) SubmitDisputeEvidence(disputeID string, params gomerchant.DisputeEvidenceParams) (gomerchant.Dispute, error) {
+	disputeParams := &stripe.DisputeParams{Submit: stripe.Bool(params.Submit)}
+	s.setParams(&disputeParams.Params, params.Params)
+
+	for field, value := range params.Text {
+		disputeParams.AddExtra(fmt.Sprintf("evidence[%v]", field), value)
+	}
+
+	for field, file := range params.Files {
+		fileParams := &stripe.FileParams{
+			FileReader: file.Reader,
+			Filename:   stripe.String(file.Filename),
+			Purpose:    stripe.String(string(stripe.FilePurposeDisputeEvidence)),
+		}
+		s.setParams(&fileParams.Params, params.Params)
+
+		uploaded, err := s.API.Files.New(fileParams)
+		if err != nil {
+			return gomerchant.Dispute{ID: disputeID}, fmt.Errorf("stripe: failed to upload evidence %v: %w", field, err)
+		}
+		disputeParams.AddExtra(fmt.Sprintf("evidence[%v]", field), uploaded.ID)
+	}
+
+	dispute, err := s.API.Disputes.Update(disputeID, disputeParams)
+	if err != nil {
+		return gomerchant.Dispute{ID: disputeID}, err
+	}
+	return toDispute(dispute), nil
+}
+
+// AcceptDispute accept dispute, it will be closed as lost
+func (s *Stripe) AcceptDispute(disputeID string) (gomerchant.Dispute, error) {
+	disputeParams := &stripe.DisputeParams{}
+	s.setParams(&disputeParams.Params, nil)
+
+	dispute, err := s.API.Disputes.Close(disputeID, disputeParams)
+	if err != nil {
+		return gomerchant.Dispute{ID: disputeID}, err
+	}
+	return toDispute(dispute), nil
+}
+
+// DisputeFromEvent get dispute from `charge.dispute.*` webhook events
+func DisputeFromEvent(event *stripe.Event) (gomerchant.Dispute, error) {
+	var dispute stripe.Dispute
+
+	if !strings.HasPrefix(event.Type, "charge.dispute.") || event.Data == nil {
+		return gomerchant.Dispute{}, fmt.Errorf("stripe: event %v is not a dispute event", event.Type)
+	}
+
+	if err := json.Unmarshal(event.Data.Raw, &dispute); err != nil {
+		return gomerchant.Dispute{}, err
+	}
+	return toDispute(&dispute), nil
+}
+
+func toDispute(dispute *stripe.Dispute) gomerchant.Dispute {
+	created := time.Unix(dispute.Created, 0)
+	result := gomerchant.Dispute{
+		ID:            dispute.ID,
+		Amount:        int(dispute.Amount),
+		Currency:      string(dispute.Currency),
+		Reason:        string(dispute.Reason),
+		Status:        disputeStatuses[dispute.Status],
+		GatewayStatus: string(dispute.Status),
+		CreatedAt:     &created,
+	}
+
+	if dispute.Charge != nil {
+		result.TransactionID = dispute.Charge.ID
+	}
+
+	if dispute.EvidenceDetails != nil && dispute.EvidenceDetails.DueBy > 0 {
+		dueBy := time.Unix(dispute.EvidenceDetails.DueBy, 0)
+		result.EvidenceDueBy = &dueBy
+	}
+	return result
+}
@@ -0,0 +1,102 @@
+package stripe_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/qor/gomerchant"
+	"github.com/qor/gomerchant/gateways/stripe"
+	stripego "github.com/stripe/stripe-go"
+)
+
+func disputeJSON(id string, status string) map[string]interface{} {
+	return map[string]interface{}{
+		"id":               id,
+		"object":           "dispute",
+		"amount":           1000,
+		"currency":         "jpy",
+		"charge":           "ch_1",
+		"reason":           "fraudulent",
+		"status":           status,
+		"created":          1700000000,
+		"evidence_details": map[string]interface{}{"due_by": 1700864000},
+	}
+}
+
+func TestDisputes(t *testing.T) {
+	backend := newStubBackend(t, func(request stubRequest) (int, interface{}) {
+		switch {
+		case request.Path == "/v1/disputes":
+			return http.StatusOK, map[string]interface{}{"object": "list", "data": []interface{}{disputeJSON("dp_1", "needs_response"), disputeJSON("dp_2", "warning_needs_response")}, "has_more": request.Form["starting_after"] == ""}
+		case request.Path == "/v1/files":
+			return http.StatusOK, map[string]interface{}{"id": "file_receipt", "object": "file", "purpose": request.Form["purpose"]}
+		case strings.HasSuffix(request.Path, "/close"):
+			return http.StatusOK, disputeJSON("dp_1", "lost")
+		case request.Method == http.MethodPost:
+			return http.StatusOK, disputeJSON("dp_1", "under_review")
+		}
+		return http.StatusOK, disputeJSON("dp_1", "needs_response")
+	})
+	client := backend.Stripe("sk_test")
+
+	createdAfter := time.Unix(1600000000, 0)
+	response, err := client.ListDisputes(gomerchant.ListDisputesParams{TransactionID: "ch_1", CreatedAfter: &createdAfter, PageSize: 2})
+	if err != nil || len(response.Disputes) != 2 || response.Cursor != "dp_2" {
+		t.Fatalf("failed to list disputes, got %v, %+v", err, response)
+	}
+
+	if form := backend.Requests()[0].Form; form["charge"] != "ch_1" || form["created[gte]"] != "1600000000" || form["limit"] != "2" {
+		t.Errorf("list filters are not correct, got %v", form)
+	}
+
+	if next, err := client.ListDisputes(gomerchant.ListDisputesParams{Cursor: response.Cursor}); err != nil || next.Cursor != "" || len(backend.Requests()) != 2 || backend.Requests()[1].Form["starting_after"] != "dp_2" {
+		t.Errorf("only one page should be fetched per call, got %v, %+v, %v", err, next, backend.Requests())
+	}
+
+	if dispute := response.Disputes[1]; dispute.Status != gomerchant.DisputeInquiry || !dispute.Open() {
+		t.Errorf("warning should be mapped to inquiry, got %+v", dispute)
+	}
+
+	dispute, err := client.GetDispute("dp_1")
+	if err != nil || dispute.Status != gomerchant.DisputeNeedsResponse || dispute.TransactionID != "ch_1" || dispute.Amount != 1000 || dispute.Reason != "fraudulent" || dispute.EvidenceDueBy == nil || dispute.EvidenceDueBy.Unix() != 1700864000 {
+		t.Errorf("dispute is not correct, got %v, %+v", err, dispute)
+	}
+
+	dispute, err = client.SubmitDisputeEvidence("dp_1", gomerchant.DisputeEvidenceParams{
+		Text:   map[string]string{"product_description": "T-shirt"},
+		Files:  map[string]gomerchant.DisputeEvidenceFile{"receipt": {Filename: "receipt.pdf", Reader: strings.NewReader("%PDF-1.4")}},
+		Submit: true,
+	})
+	if err != nil || dispute.Status != gomerchant.DisputeUnderReview {
+		t.Errorf("failed to submit evidence, got %v, %+v", err, dispute)
+	}
+
+	requests := backend.Requests()
+	upload, update := requests[len(requests)-2], requests[len(requests)-1]
+	if upload.Files["file"] != "receipt.pdf" || upload.Form["purpose"] != "dispute_evidence" {
+		t.Errorf("evidence file should be uploaded, got %+v", upload)
+	}
+
+	if update.Path != "/v1/disputes/dp_1" || update.Form["evidence[receipt]"] != "file_receipt" || update.Form["evidence[product_description]"] != "T-shirt" || update.Form["submit"] != "true" {
+		t.Errorf("evidence is not correct, got %+v", update)
+	}
+
+	if dispute, err := client.AcceptDispute("dp_1"); err != nil || dispute.Status != gomerchant.DisputeLost || dispute.Open() {
+		t.Errorf("accepted dispute should be lost, got %v, %+v", err, dispute)
+	}
+}
+
+func TestDisputeFromEvent(t *testing.T) {
+	raw, _ := json.Marshal(disputeJSON("dp_1", "won"))
+	dispute, err := stripe.DisputeFromEvent(&stripego.Event{Type: "charge.dispute.closed", Data: &stripego.EventData{Raw: raw}})
+	if err != nil || dispute.ID != "dp_1" || dispute.Status != gomerchant.DisputeWon || dispute.GatewayStatus != "won" {
+		t.Errorf("failed to get dispute from event, got %v, %+v", err, dispute)
+	}
+
+	if _, err := stripe.DisputeFromEvent(&stripego.Event{Type: "charge.succeeded", Data: &stripego.EventData{Raw: raw}}); err == nil {
+		t.Errorf("should not get dispute from other events")
+	}
+}
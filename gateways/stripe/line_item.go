@@ -0,0 +1,71 @@
+package stripe
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/qor/gomerchant"
+	stripe "github.com/stripe/stripe-go"
+)
+
+// MaxMetadataLineItems line items saved in metadata at most, stripe allows 50 metadata keys
+const MaxMetadataLineItems = 40
+
+const maxMetadataValueLength = 500
+
+type metadataLineItem struct {
+	ID        string                  `json:"id,omitempty"`
+	Name      string                  `json:"name,omitempty"`
+	Kind      gomerchant.LineItemKind `json:"kind,omitempty"`
+	Quantity  uint64                  `json:"quantity"`
+	UnitPrice uint64                  `json:"unit_price"`
+	Tax       uint64                  `json:"tax,omitempty"`
+	Discount  uint64                  `json:"discount,omitempty"`
+}
+
+// setLineItems validate items with amount, save them as `line_item_<index>` metadata in JSON, names are truncated to fit metadata value limit
+func setLineItems(params *stripe.Params, amount uint64, items gomerchant.LineItems) error {
+	if len(items) == 0 {
+		return nil
+	}
+
+	if err := items.Validate(amount); err != nil {
+		return err
+	}
+
+	if len(items) > MaxMetadataLineItems {
+		return fmt.Errorf("%w: stripe metadata could save %v items at most, but got %v", gomerchant.ErrInvalidLineItems, MaxMetadataLineItems, len(items))
+	}
+
+	for idx, item := range items {
+		value := metadataLineItem{ID: item.ID, Name: item.Name, Kind: item.Kind, Quantity: item.Quantity, UnitPrice: item.UnitPrice, Tax: item.Tax, Discount: item.Discount}
+		data, err := json.Marshal(value)
+		for name := []rune(item.Name); err == nil && len(data) > maxMetadataValueLength && len(name) > 0; {
+			name = name[:len(name)*2/3]
+			value.Name = string(name)
+			data, err = json.Marshal(value)
+		}
+		if err != nil {
+			return err
+		}
+		params.AddMetadata(fmt.Sprintf("line_item_%v", idx), string(data))
+	}
+	return nil
+}
+
+// LineItemsFromMetadata get line items saved in metadata of charge or refund
+func LineItemsFromMetadata(metadata map[string]string) gomerchant.LineItems {
+	var items gomerchant.LineItems
+	for idx := 0; idx < MaxMetadataLineItems; idx++ {
+		data, ok := metadata[fmt.Sprintf("line_item_%v", idx)]
+		if !ok {
+			break
+		}
+
+		var value metadataLineItem
+		if json.Unmarshal([]byte(data), &value) == nil {
+			items = append(items, gomerchant.LineItem{ID: value.ID, Name: value.Name, Kind: value.Kind, Quantity: value.Quantity, UnitPrice: value.UnitPrice, Tax: value.Tax, Discount: value.Discount})
+		}
+	}
+	return items
+}
@@ -0,0 +1,65 @@
+package stripe_test
+
+import (
+	"errors"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/qor/gomerchant"
+	"github.com/qor/gomerchant/gateways/stripe"
+)
+
+func TestLineItemsMetadata(t *testing.T) {
+	backend := newStubBackend(t, func(request stubRequest) (int, interface{}) {
+		if request.Path == "/v1/refunds" {
+			return http.StatusOK, map[string]interface{}{"id": "re_1", "object": "refund", "amount": 500, "charge": "ch_1"}
+		}
+		return http.StatusOK, chargeJSON("ch_1", 1500, true)
+	})
+	client := backend.Stripe("sk_test")
+
+	items := gomerchant.LineItems{
+		{ID: "shirt", Name: strings.Repeat("シャツ", 200), Quantity: 2, UnitPrice: 500},
+		{Kind: gomerchant.LineItemShipping, Quantity: 1, UnitPrice: 600, Discount: 100},
+	}
+
+	if _, err := client.Authorize(1500, gomerchant.AuthorizeParams{Currency: "jpy", OrderID: "order-1", LineItems: items}); err != nil {
+		t.Fatalf("failed to authorize, got %v", err)
+	}
+
+	metadata := map[string]string{}
+	for key, value := range backend.Requests()[0].Form {
+		if strings.HasPrefix(key, "metadata[") {
+			metadata[strings.TrimSuffix(strings.TrimPrefix(key, "metadata["), "]")] = value
+		}
+	}
+
+	if len([]rune(metadata["line_item_0"])) > 500 {
+		t.Errorf("metadata value should be truncated, got %v", metadata["line_item_0"])
+	}
+
+	decoded := stripe.LineItemsFromMetadata(metadata)
+	if len(decoded) != 2 || decoded[0].ID != "shirt" || !strings.HasPrefix(items[0].Name, decoded[0].Name) || !reflect.DeepEqual(decoded[1], items[1]) {
+		t.Errorf("line items should be saved in metadata, got %+v", decoded)
+	}
+
+	if _, err := client.Refund("ch_1", 500, gomerchant.RefundParams{Captured: true, LineItems: gomerchant.LineItems{{ID: "shirt", Quantity: 1, UnitPrice: 500}}}); err != nil {
+		t.Fatalf("failed to refund, got %v", err)
+	}
+
+	requests := backend.Requests()
+	if refund := requests[len(requests)-1]; refund.Path != "/v1/refunds" || !strings.Contains(refund.Form["metadata[line_item_0]"], `"shirt"`) {
+		t.Errorf("refunded items should be saved in refund metadata, got %+v", refund)
+	}
+
+	count := len(requests)
+	if _, err := client.Authorize(1000, gomerchant.AuthorizeParams{Currency: "jpy", LineItems: items}); !errors.Is(err, gomerchant.ErrInvalidLineItems) {
+		t.Errorf("should get invalid line items error, but got %v", err)
+	}
+
+	if len(backend.Requests()) != count {
+		t.Errorf("invalid line items should not be sent")
+	}
+}
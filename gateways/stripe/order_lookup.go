@@ -0,0 +1,95 @@
+package stripe
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/qor/gomerchant"
+	stripe "github.com/stripe/stripe-go"
+)
+
+var _ gomerchant.OrderLookup = &Stripe{}
+
+// orderLookupScanLimit charges listed at most when search doesn't find the order
+const orderLookupScanLimit = 1000
+
+// chargeSearchParams params of charges search API, which isn't supported by stripe-go v70
+type chargeSearchParams struct {
+	stripe.Params `form:"*"`
+	Query         *string `form:"query"`
+	Limit         *int64  `form:"limit"`
+}
+
+type chargeSearchResult struct {
+	Data []*stripe.Charge `json:"data"`
+}
+
+// QueryByOrderID query the latest charge with `order_id` metadata with the search API, search results might be delayed up to a minute,
+// so if it isn't found, charges created in Config.OrderLookupPeriod are listed and filtered, up to 1000 charges
+func (s *Stripe) QueryByOrderID(orderID string) (gomerchant.Transaction, error) {
+	if orderID == "" {
+		return gomerchant.Transaction{}, fmt.Errorf("%w: order id is blank", gomerchant.ErrTransactionNotFound)
+	}
+
+	if charge, err := s.searchCharge(orderID); err != nil || charge != nil {
+		if err != nil {
+			return gomerchant.Transaction{}, err
+		}
+		return toTransaction(charge), nil
+	}
+
+	period := s.Config.OrderLookupPeriod
+	if period <= 0 {
+		period = 10 * time.Minute
+	}
+	createdAfter := time.Now().Add(-period)
+
+	var (
+		scanned int
+		iter    = s.ListTransactions(gomerchant.ListTransactionsParams{CreatedAfter: &createdAfter, PageSize: 100})
+	)
+	for scanned < orderLookupScanLimit && iter.Next() {
+		if transaction := iter.Transaction(); transaction.Params["order_id"] == orderID {
+			return transaction, nil
+		}
+		scanned++
+	}
+
+	if err := iter.Err(); err != nil {
+		return gomerchant.Transaction{}, err
+	}
+	return gomerchant.Transaction{}, fmt.Errorf("%w: no charge of order %v", gomerchant.ErrTransactionNotFound, orderID)
+}
+
+// searchCharge search the latest charge with `order_id` metadata, returns nil if it isn't found
+func (s *Stripe) searchCharge(orderID string) (*stripe.Charge, error) {
+	var (
+		result chargeSearchResult
+		latest *stripe.Charge
+		value  = strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(orderID)
+		params = &chargeSearchParams{Query: stripe.String(fmt.Sprintf("metadata['order_id']:'%v'", value)), Limit: stripe.Int64(100)}
+	)
+	s.setParams(&params.Params, nil)
+
+	if err := s.API.Charges.B.Call(http.MethodGet, "/v1/charges/search", s.API.Charges.Key, params, &result); err != nil {
+		return nil, err
+	}
+
+	for _, charge := range result.Data {
+		if latest == nil || charge.Created > latest.Created {
+			latest = charge
+		}
+	}
+	return latest, nil
+}
+
+// VoidByOrderID refund the latest charge of order, uncaptured charges are released
+func (s *Stripe) VoidByOrderID(orderID string, params gomerchant.VoidParams) (gomerchant.VoidResponse, error) {
+	transaction, err := s.QueryByOrderID(orderID)
+	if err != nil {
+		return gomerchant.VoidResponse{}, err
+	}
+	return gomerchant.VoidTransaction(s, transaction, params)
+}
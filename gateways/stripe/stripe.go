@@ -3,17 +3,23 @@ package stripe
 
 import (
 	"fmt"
+	"net/http"
 	"time"
 
 	"github.com/qor/gomerchant"
 	stripe "github.com/stripe/stripe-go"
-	"github.com/stripe/stripe-go/charge"
-	"github.com/stripe/stripe-go/refund"
+	"github.com/stripe/stripe-go/client"
 )
 
+// StripeAccountParam key of params to make the request on behalf of a connected account, sent as Stripe-Account header
+const StripeAccountParam = "stripe_account"
+
 // Stripe implements gomerchant.PaymetGateway interface.
 type Stripe struct {
 	Config *Config
+	API    *client.API
+
+	account string
 }
 
 var _ gomerchant.PaymentGateway = &Stripe{}
@@ -21,20 +27,67 @@ var _ gomerchant.PaymentGateway = &Stripe{}
 // Config stripe config
 type Config struct {
 	Key string
+
+	URL               string       // API URL, default https://api.stripe.com, could be a local stub for tests
+	UploadsURL        string       // files API URL, default https://files.stripe.com
+	HTTPClient        *http.Client // default client of stripe-go if it is nil
+	MaxNetworkRetries int          // retry requests failed due to network problems or conflicts
+
+	// OrderLookupPeriod charges created in the period are listed by QueryByOrderID if search API doesn't find the order yet, default 10 minutes
+	OrderLookupPeriod time.Duration
+
+	// Backends use these backends instead of building them from above options
+	Backends *stripe.Backends
 }
 
-// New creates Stripe struct.
+// New creates Stripe struct, every Stripe has its own client, so different keys could be used in one process.
 func New(config *Config) *Stripe {
-	stripe.Key = config.Key
+	backends := config.Backends
+	if backends == nil {
+		backends = &stripe.Backends{
+			API:     stripe.GetBackendWithConfig(stripe.APIBackend, config.backendConfig(config.URL)),
+			Connect: stripe.GetBackendWithConfig(stripe.ConnectBackend, config.backendConfig("")),
+			Uploads: stripe.GetBackendWithConfig(stripe.UploadsBackend, config.backendConfig(config.UploadsURL)),
+		}
+	}
 
 	return &Stripe{
 		Config: config,
+		API:    client.New(config.Key, backends),
+	}
+}
+
+func (config *Config) backendConfig(url string) *stripe.BackendConfig {
+	return &stripe.BackendConfig{
+		URL:               url,
+		HTTPClient:        config.HTTPClient,
+		MaxNetworkRetries: config.MaxNetworkRetries,
+		LeveledLogger:     stripe.DefaultLeveledLogger,
 	}
 }
 
+// WithAccount returns a Stripe that makes requests on behalf of connected account with Stripe-Account header
+func (s *Stripe) WithAccount(account string) *Stripe {
+	return &Stripe{Config: s.Config, API: s.API, account: account}
+}
+
+// setParams set Stripe-Account header from params or the Stripe
+func (s *Stripe) setParams(stripeParams *stripe.Params, params gomerchant.Params) {
+	if account := s.stripeAccount(params); account != "" {
+		stripeParams.SetStripeAccount(account)
+	}
+}
+
+func (s *Stripe) stripeAccount(params gomerchant.Params) string {
+	if v, ok := params.Get(StripeAccountParam); ok {
+		return fmt.Sprint(v)
+	}
+	return s.account
+}
+
 var capture bool = false
 
-func (*Stripe) Authorize(amount uint64, params gomerchant.AuthorizeParams) (gomerchant.AuthorizeResponse, error) {
+func (s *Stripe) Authorize(amount uint64, params gomerchant.AuthorizeParams) (gomerchant.AuthorizeResponse, error) {
 	int64Amount := int64(amount)
 	chargeParams := &stripe.ChargeParams{
 		Amount:      &int64Amount,
@@ -43,8 +96,23 @@ func (*Stripe) Authorize(amount uint64, params gomerchant.AuthorizeParams) (gome
 		Capture:     &capture,
 	}
 	chargeParams.AddMetadata("order_id", params.OrderID)
+	s.setParams(&chargeParams.Params, params.Params)
+
+	if err := setLineItems(&chargeParams.Params, amount, params.LineItems); err != nil {
+		return gomerchant.AuthorizeResponse{}, err
+	}
+
+	if params.SplitPayment != nil {
+		if err := setSplitPayment(chargeParams, amount, params.OrderID, *params.SplitPayment); err != nil {
+			return gomerchant.AuthorizeResponse{}, err
+		}
+	}
 
 	if params.PaymentMethod != nil {
+		if params.PaymentMethod.NetworkToken != nil || params.PaymentMethod.DeviceToken != nil {
+			// charges don't accept cryptograms of network tokens
+			return gomerchant.AuthorizeResponse{}, gomerchant.ErrNotSupportedPaymentMethod
+		}
 		if params.PaymentMethod.CreditCard != nil {
 			chargeParams.SetSource(toStripeCC(params.Customer, params.PaymentMethod.CreditCard, params.BillingAddress))
 		}
@@ -56,9 +124,11 @@ func (*Stripe) Authorize(amount uint64, params gomerchant.AuthorizeParams) (gome
 		}
 	}
 
-	charge, err := charge.New(chargeParams)
+	charge, err := s.API.Charges.New(chargeParams)
 	if charge != nil {
-		return gomerchant.AuthorizeResponse{TransactionID: charge.ID}, err
+		response := gomerchant.AuthorizeResponse{TransactionID: charge.ID, AuthorizationCode: charge.AuthorizationCode}
+		response.AVSResult, response.CVCResult = chargeChecks(charge)
+		return response, err
 	}
 	return gomerchant.AuthorizeResponse{}, err
 }
@@ -67,42 +137,79 @@ func (*Stripe) CompleteAuthorize(paymentID string, params gomerchant.CompleteAut
 	return gomerchant.CompleteAuthorizeResponse{}, nil
 }
 
-func (*Stripe) Capture(transactionID string, params gomerchant.CaptureParams) (gomerchant.CaptureResponse, error) {
-	_, err := charge.Capture(transactionID, nil)
+func (s *Stripe) Capture(transactionID string, params gomerchant.CaptureParams) (gomerchant.CaptureResponse, error) {
+	captureParams := &stripe.CaptureParams{}
+	s.setParams(&captureParams.Params, params.Params)
+	_, err := s.API.Charges.Capture(transactionID, captureParams)
 	return gomerchant.CaptureResponse{TransactionID: transactionID}, err
 }
 
 func (s *Stripe) Refund(transactionID string, amount uint, params gomerchant.RefundParams) (gomerchant.RefundResponse, error) {
-	transaction, err := s.Query(transactionID)
+	if len(params.LineItems) > 0 {
+		if err := params.LineItems.Validate(uint64(amount)); err != nil {
+			return gomerchant.RefundResponse{TransactionID: transactionID}, err
+		}
+	}
+
+	c, err := s.getCharge(transactionID, params.Params)
 
 	if err == nil {
-		if transaction.Captured {
+		if c.Captured {
 			int64Amount := int64(amount)
-			_, err = refund.New(&stripe.RefundParams{
+			refundParams := &stripe.RefundParams{
 				Charge: &transactionID,
 				Amount: &int64Amount,
-			})
+			}
+			s.setParams(&refundParams.Params, params.Params)
+			if err = setLineItems(&refundParams.Params, uint64(amount), params.LineItems); err != nil {
+				return gomerchant.RefundResponse{TransactionID: transactionID}, err
+			}
+			err = s.refund(c, refundParams, params.ReverseTransfers, params.Params)
 		} else {
-			int64Amount := int64(transaction.Amount - int(amount))
-			_, err = charge.Capture(transactionID, &stripe.CaptureParams{
+			int64Amount := c.Amount - int64(amount)
+			captureParams := &stripe.CaptureParams{
 				Amount: &int64Amount,
-			})
+			}
+			s.setParams(&captureParams.Params, params.Params)
+			_, err = s.API.Charges.Capture(transactionID, captureParams)
 		}
 	}
 
 	return gomerchant.RefundResponse{TransactionID: transactionID}, err
 }
 
-func (*Stripe) Void(transactionID string, params gomerchant.VoidParams) (gomerchant.VoidResponse, error) {
+func (s *Stripe) Void(transactionID string, params gomerchant.VoidParams) (gomerchant.VoidResponse, error) {
 	refundParams := &stripe.RefundParams{
 		Charge: &transactionID,
 	}
-	_, err := refund.New(refundParams)
+	s.setParams(&refundParams.Params, params.Params)
+
+	var err error
+	if params.ReverseTransfers {
+		var c *stripe.Charge
+		if c, err = s.getCharge(transactionID, params.Params); err == nil {
+			err = s.refund(c, refundParams, true, params.Params)
+		}
+	} else {
+		_, err = s.API.Refunds.New(refundParams)
+	}
 	return gomerchant.VoidResponse{TransactionID: transactionID}, err
 }
 
-func (*Stripe) Query(transactionID string) (gomerchant.Transaction, error) {
-	c, err := charge.Get(transactionID, nil)
+func (s *Stripe) Query(transactionID string) (gomerchant.Transaction, error) {
+	return s.query(transactionID, nil)
+}
+
+func (s *Stripe) query(transactionID string, params gomerchant.Params) (gomerchant.Transaction, error) {
+	c, err := s.getCharge(transactionID, params)
+	if err != nil {
+		return gomerchant.Transaction{ID: transactionID}, err
+	}
+
+	return toTransaction(c), nil
+}
+
+func toTransaction(c *stripe.Charge) gomerchant.Transaction {
 	created := time.Unix(c.Created, 0)
 	transaction := gomerchant.Transaction{
 		ID:        c.ID,
@@ -111,8 +218,21 @@ func (*Stripe) Query(transactionID string) (gomerchant.Transaction, error) {
 		Captured:  c.Captured,
 		Paid:      c.Paid,
 		Cancelled: c.Refunded,
+		Disputed:  c.Disputed,
 		Status:    c.Status,
 		CreatedAt: &created,
+		Params:    gomerchant.Params{},
+
+		AuthorizationCode: c.AuthorizationCode,
+	}
+	transaction.AVSResult, transaction.CVCResult = chargeChecks(c)
+
+	if orderID, ok := c.Metadata["order_id"]; ok {
+		transaction.Params["order_id"] = orderID
+	}
+
+	if c.Customer != nil {
+		transaction.Params["customer_id"] = c.Customer.ID
 	}
 
 	if transaction.Cancelled {
@@ -120,7 +240,13 @@ func (*Stripe) Query(transactionID string) (gomerchant.Transaction, error) {
 		transaction.Captured = false
 	}
 
-	return transaction, err
+	return transaction
+}
+
+func (s *Stripe) getCharge(transactionID string, params gomerchant.Params) (*stripe.Charge, error) {
+	chargeParams := &stripe.ChargeParams{}
+	s.setParams(&chargeParams.Params, params)
+	return s.API.Charges.Get(transactionID, chargeParams)
 }
 
 func toStripeCC(customer string, cc *gomerchant.CreditCard, billingAddress *gomerchant.Address) *stripe.CardParams {
@@ -139,7 +265,7 @@ func toStripeCC(customer string, cc *gomerchant.CreditCard, billingAddress *gome
 
 	if billingAddress != nil {
 		cm.AddressLine1 = &billingAddress.Address1
-		cm.AddressLine1 = &billingAddress.Address2
+		cm.AddressLine2 = &billingAddress.Address2
 		cm.AddressCity = &billingAddress.City
 		cm.AddressState = &billingAddress.State
 		cm.AddressZip = &billingAddress.ZIP
@@ -8,7 +8,6 @@ import (
 	"github.com/jinzhu/configor"
 	"github.com/qor/gomerchant/gateways/stripe"
 	"github.com/qor/gomerchant/tests"
-	"github.com/stripe/stripe-go/customer"
 )
 
 var Stripe *stripe.Stripe
@@ -22,7 +21,7 @@ func init() {
 	os.Setenv("CONFIGOR_ENV_PREFIX", "-")
 	if err := configor.Load(config); err != nil {
 		fmt.Println(err)
-		os.Exit(1)
+		return
 	}
 
 	Stripe = stripe.New(&stripe.Config{
@@ -30,12 +29,19 @@ func init() {
 	})
 }
 
+func requireConfig(t *testing.T) {
+	if Stripe == nil {
+		t.Skip("stripe is not configured, set Key to run this test")
+	}
+}
+
 func TestTestSuite(t *testing.T) {
+	requireConfig(t)
 	tests.TestSuite{
 		CreditCardManager: Stripe,
 		Gateway:           Stripe,
 		GetRandomCustomerID: func() string {
-			Customer, err := customer.New(nil)
+			Customer, err := Stripe.API.Customers.New(nil)
 			if err != nil {
 				fmt.Printf("Get error when create customer: %v", err)
 			}
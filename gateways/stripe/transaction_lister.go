@@ -0,0 +1,61 @@
+package stripe
+
+import (
+	"github.com/qor/gomerchant"
+	stripe "github.com/stripe/stripe-go"
+)
+
+var _ gomerchant.TransactionLister = &Stripe{}
+
+// ListTransactions list charges, newest first, customer and date filters are applied by Stripe,
+// order id (`order_id` metadata) and status filters are applied to fetched charges
+func (s *Stripe) ListTransactions(params gomerchant.ListTransactionsParams) gomerchant.TransactionIterator {
+	listParams := stripe.ChargeListParams{}
+	listParams.Single = true
+
+	if params.PageSize > 0 {
+		listParams.Limit = stripe.Int64(int64(params.PageSize))
+	}
+
+	if params.CustomerID != "" {
+		listParams.Customer = stripe.String(params.CustomerID)
+	}
+
+	if params.CreatedAfter != nil || params.CreatedBefore != nil {
+		listParams.CreatedRange = &stripe.RangeQueryParams{}
+		if params.CreatedAfter != nil {
+			listParams.CreatedRange.GreaterThanOrEqual = params.CreatedAfter.Unix()
+		}
+		if params.CreatedBefore != nil {
+			listParams.CreatedRange.LesserThan = params.CreatedBefore.Unix()
+		}
+	}
+
+	if account := s.stripeAccount(params.Params); account != "" {
+		listParams.SetStripeAccount(account)
+	}
+
+	fetch := func(cursor string) (transactions []gomerchant.Transaction, next string, err error) {
+		pageParams := listParams
+		if cursor != "" {
+			pageParams.StartingAfter = stripe.String(cursor)
+		}
+
+		iter := s.API.Charges.List(&pageParams)
+		for iter.Next() {
+			transactions = append(transactions, toTransaction(iter.Charge()))
+		}
+
+		if meta := iter.Meta(); meta != nil && meta.HasMore && len(transactions) > 0 {
+			next = transactions[len(transactions)-1].ID
+		}
+		return transactions, next, iter.Err()
+	}
+
+	return gomerchant.NewTransactionIterator(params.Cursor, fetch, func(transaction gomerchant.Transaction) bool {
+		if params.OrderID != "" && transaction.Params["order_id"] != params.OrderID {
+			return false
+		}
+		return params.Match(transaction)
+	})
+}
@@ -0,0 +1,125 @@
+package stripe_test
+
+import (
+	"errors"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/qor/gomerchant"
+)
+
+func TestListTransactions(t *testing.T) {
+	backend := newStubBackend(t, func(request stubRequest) (int, interface{}) {
+		var (
+			charges []map[string]interface{}
+			hasMore bool
+		)
+
+		switch request.Form["starting_after"] {
+		case "":
+			charges = []map[string]interface{}{chargeJSON("ch_3", 1000, true), chargeJSON("ch_2", 1000, false)}
+			hasMore = true
+		case "ch_2":
+			charges = []map[string]interface{}{chargeJSON("ch_1", 1000, true)}
+		}
+
+		for _, charge := range charges {
+			charge["metadata"] = map[string]string{"order_id": "order-" + charge["id"].(string)}
+		}
+		charges[0]["metadata"] = map[string]string{"order_id": "order-1"}
+		return http.StatusOK, map[string]interface{}{"object": "list", "data": charges, "has_more": hasMore}
+	})
+	client := backend.Stripe("sk_test")
+
+	after := time.Unix(1600000000, 0)
+	var ids []string
+	iter := client.ListTransactions(gomerchant.ListTransactionsParams{
+		CustomerID:   "cus_1",
+		CreatedAfter: &after,
+		PageSize:     2,
+		Statuses:     []gomerchant.TransactionStatus{gomerchant.TransactionCaptured},
+	})
+	for iter.Next() {
+		ids = append(ids, iter.Transaction().ID)
+	}
+
+	if iter.Err() != nil || !reflect.DeepEqual(ids, []string{"ch_3", "ch_1"}) {
+		t.Errorf("should list captured charges of all pages, got %v, %v", ids, iter.Err())
+	}
+
+	requests := backend.Requests()
+	if len(requests) != 2 {
+		t.Fatalf("should fetch 2 pages, but got %v", len(requests))
+	}
+
+	if form := requests[0].Form; form["customer"] != "cus_1" || form["created[gte]"] != "1600000000" || form["limit"] != "2" {
+		t.Errorf("filters should be sent to stripe, got %v", form)
+	}
+
+	ids = nil
+	iter = client.ListTransactions(gomerchant.ListTransactionsParams{OrderID: "order-1"})
+	for iter.Next() {
+		ids = append(ids, iter.Transaction().ID)
+	}
+
+	if !reflect.DeepEqual(ids, []string{"ch_3", "ch_1"}) {
+		t.Errorf("should filter charges by order id, got %v", ids)
+	}
+}
+
+func TestQueryAndVoidByOrderID(t *testing.T) {
+	backend := newStubBackend(t, func(request stubRequest) (int, interface{}) {
+		charges := []map[string]interface{}{chargeJSON("ch_2", 1000, false), chargeJSON("ch_1", 1000, true), chargeJSON("ch_0", 1000, true)}
+		charges[0]["metadata"] = map[string]string{"order_id": "order-2"}
+		charges[1]["metadata"] = map[string]string{"order_id": "order-1"}
+		charges[2]["metadata"] = map[string]string{"order_id": "order-1"}
+		charges[0]["created"], charges[1]["created"], charges[2]["created"] = time.Now().Unix(), time.Now().Unix(), time.Now().Add(-time.Hour).Unix()
+
+		switch {
+		case request.Path == "/v1/charges/search":
+			// order-2 is not indexed yet
+			if request.Form["query"] == "metadata['order_id']:'order-1'" {
+				return http.StatusOK, map[string]interface{}{"object": "search_result", "data": []interface{}{charges[2], charges[1]}}
+			}
+			return http.StatusOK, map[string]interface{}{"object": "search_result", "data": []interface{}{}}
+		case request.Path == "/v1/charges" && request.Method == http.MethodGet:
+			return http.StatusOK, map[string]interface{}{"object": "list", "data": charges[:1], "has_more": false}
+		case request.Path == "/v1/refunds":
+			return http.StatusOK, map[string]interface{}{"id": "re_1", "object": "refund", "amount": 1000, "charge": request.Form["charge"]}
+		}
+		return http.StatusOK, chargeJSON("ch_1", 1000, true)
+	})
+	client := backend.Stripe("sk_test")
+
+	transaction, err := client.QueryByOrderID("order-1")
+	if err != nil || transaction.ID != "ch_1" {
+		t.Errorf("should find the latest charge by order id, got %v, %+v", err, transaction)
+	}
+
+	if requests := backend.Requests(); len(requests) != 1 || requests[0].Path != "/v1/charges/search" {
+		t.Errorf("should search charges by order id, got %+v", requests)
+	}
+
+	if transaction, err := client.QueryByOrderID("order-2"); err != nil || transaction.ID != "ch_2" {
+		t.Errorf("should find charge that is not indexed yet by listing, got %v, %+v", err, transaction)
+	}
+
+	if form := backend.Requests()[2].Form; form["created[gte]"] == "" {
+		t.Errorf("should only list charges created in lookup period, got %v", form)
+	}
+
+	if _, err := client.QueryByOrderID("order-'3"); !errors.Is(err, gomerchant.ErrTransactionNotFound) || backend.Requests()[3].Form["query"] != `metadata['order_id']:'order-\'3'` {
+		t.Errorf("should escape order id in query, got %v, %+v", err, backend.Requests()[3])
+	}
+
+	if response, err := client.VoidByOrderID("order-1", gomerchant.VoidParams{}); err != nil || response.TransactionID != "ch_1" {
+		t.Errorf("failed to void by order id, got %v, %+v", err, response)
+	}
+
+	requests := backend.Requests()
+	if refund := requests[len(requests)-1]; refund.Path != "/v1/refunds" || refund.Form["charge"] != "ch_1" {
+		t.Errorf("should refund charge of order, got %+v", refund)
+	}
+}
@@ -0,0 +1,27 @@
+package stripe
+
+import (
+	"github.com/qor/gomerchant"
+	stripe "github.com/stripe/stripe-go"
+)
+
+var checkResults = map[stripe.CardVerification]gomerchant.CheckResult{
+	stripe.CardVerificationPass:        gomerchant.CheckPass,
+	stripe.CardVerificationFail:        gomerchant.CheckFail,
+	stripe.CardVerificationUnavailable: gomerchant.CheckUnavailable,
+}
+
+// chargeChecks AVS and CVC results of charge, from payment method details, or card of source for legacy charges.
+// network transaction id (`payment_method_details.card.network_transaction_id`) is not decoded by stripe-go v70, so it is left blank
+func chargeChecks(c *stripe.Charge) (avs gomerchant.AVSResult, cvc gomerchant.CheckResult) {
+	if details := c.PaymentMethodDetails; details != nil && details.Card != nil && details.Card.Checks != nil {
+		checks := details.Card.Checks
+		return gomerchant.AVSResult{Address: checkResults[checks.AddressLine1Check], PostalCode: checkResults[checks.AddressPostalCodeCheck]}, checkResults[checks.CVCCheck]
+	}
+
+	if c.Source != nil && c.Source.Card != nil {
+		card := c.Source.Card
+		return gomerchant.AVSResult{Address: checkResults[card.AddressLine1Check], PostalCode: checkResults[card.AddressZipCheck]}, checkResults[card.CVCCheck]
+	}
+	return avs, cvc
+}
@@ -0,0 +1,65 @@
+package stripe_test
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/qor/gomerchant"
+)
+
+func TestChargeChecks(t *testing.T) {
+	backend := newStubBackend(t, func(request stubRequest) (int, interface{}) {
+		charge := chargeJSON("ch_1", 1000, false)
+		charge["authorization_code"] = "123456"
+		if request.Method == http.MethodPost {
+			charge["payment_method_details"] = map[string]interface{}{
+				"type": "card",
+				"card": map[string]interface{}{
+					"checks": map[string]interface{}{"address_line1_check": "pass", "address_postal_code_check": "fail", "cvc_check": "unavailable"},
+				},
+			}
+		} else {
+			charge["source"] = map[string]interface{}{"id": "card_1", "object": "card", "address_line1_check": "unchecked", "address_zip_check": "pass", "cvc_check": "fail"}
+		}
+		return http.StatusOK, charge
+	})
+	client := backend.Stripe("sk_test")
+
+	response, err := client.Authorize(1000, gomerchant.AuthorizeParams{Currency: "jpy"})
+	if err != nil {
+		t.Fatalf("failed to authorize, got %v", err)
+	}
+
+	if response.AVSResult != (gomerchant.AVSResult{Address: gomerchant.CheckPass, PostalCode: gomerchant.CheckFail}) || response.CVCResult != gomerchant.CheckUnavailable || response.AuthorizationCode != "123456" {
+		t.Errorf("checks of payment method details are not correct, got %+v", response)
+	}
+
+	transaction, err := client.Query("ch_1")
+	if err != nil {
+		t.Fatalf("failed to query, got %v", err)
+	}
+
+	if transaction.AVSResult != (gomerchant.AVSResult{Address: gomerchant.CheckUnchecked, PostalCode: gomerchant.CheckPass}) || transaction.CVCResult != gomerchant.CheckFail || transaction.AuthorizationCode != "123456" {
+		t.Errorf("checks of source card are not correct, got %+v", transaction)
+	}
+}
+
+func TestBillingAddress(t *testing.T) {
+	backend := newStubBackend(t, func(request stubRequest) (int, interface{}) {
+		return http.StatusOK, chargeJSON("ch_1", 1000, false)
+	})
+	client := backend.Stripe("sk_test")
+
+	_, err := client.Authorize(1000, gomerchant.AuthorizeParams{
+		Currency:       "jpy",
+		PaymentMethod:  &gomerchant.PaymentMethod{CreditCard: &gomerchant.CreditCard{Number: "4242424242424242", ExpMonth: 1, ExpYear: 2099}},
+		BillingAddress: &gomerchant.Address{Address1: "1-2-3 Shibuya", Address2: "Room 101", City: "Shibuya", ZIP: "150-0002", Country: "JP"},
+	})
+	if err != nil {
+		t.Fatalf("failed to authorize, got %v", err)
+	}
+
+	if form := backend.Requests()[0].Form; form["source[address_line1]"] != "1-2-3 Shibuya" || form["source[address_line2]"] != "Room 101" || form["source[address_zip]"] != "150-0002" {
+		t.Errorf("both address lines should be sent, got %v", form)
+	}
+}
@@ -0,0 +1,133 @@
+package ledger
+
+import (
+	"fmt"
+
+	"github.com/qor/gomerchant"
+)
+
+// Gateway records operations of wrapped gateway to ledger, refunds and releases above balances are refused before the gateway is called.
+// payments authorized before the ledger was used are not found, ErrNotFound is returned for them
+type Gateway struct {
+	gomerchant.PaymentGateway
+	Ledger *Ledger
+
+	// RefundCapturesRemainder wrapped gateway captures the remaining authorized amount when refunding an uncaptured payment, like Stripe,
+	// otherwise the refunded amount is only released from the authorization, like Paygent
+	RefundCapturesRemainder bool
+}
+
+var _ gomerchant.PaymentGateway = &Gateway{}
+
+// NewGateway wrap gateway with ledger
+func NewGateway(gateway gomerchant.PaymentGateway, ledger *Ledger) *Gateway {
+	return &Gateway{PaymentGateway: gateway, Ledger: ledger}
+}
+
+// Authorize authorize and record authorized amount
+func (gateway *Gateway) Authorize(amount uint64, params gomerchant.AuthorizeParams) (gomerchant.AuthorizeResponse, error) {
+	response, err := gateway.PaymentGateway.Authorize(amount, params)
+	if err == nil && response.TransactionID != "" {
+		err = gateway.Ledger.Authorize(response.TransactionID, params.Currency, int64(amount))
+	}
+	return response, err
+}
+
+// Capture capture authorized balance
+func (gateway *Gateway) Capture(transactionID string, params gomerchant.CaptureParams) (gomerchant.CaptureResponse, error) {
+	paymentID, balance, unlock, err := gateway.lock(transactionID)
+	if err != nil {
+		return gomerchant.CaptureResponse{}, err
+	}
+	defer unlock()
+
+	if err := gateway.Ledger.CheckRelease(paymentID, balance.Authorized); err != nil {
+		return gomerchant.CaptureResponse{}, err
+	}
+
+	response, err := gateway.PaymentGateway.Capture(transactionID, params)
+	if err == nil {
+		err = gateway.Ledger.Capture(paymentID, transactionIDOf(response.TransactionID, transactionID), balance.Authorized)
+	}
+	return response, err
+}
+
+// Refund refund captured balance if params.Captured, otherwise reduce authorized balance,
+// and capture the remaining authorized balance if RefundCapturesRemainder
+func (gateway *Gateway) Refund(transactionID string, amount uint, params gomerchant.RefundParams) (gomerchant.RefundResponse, error) {
+	paymentID, balance, unlock, err := gateway.lock(transactionID)
+	if err != nil {
+		return gomerchant.RefundResponse{}, err
+	}
+	defer unlock()
+
+	record, check := gateway.Ledger.Release, gateway.Ledger.CheckRelease
+	if params.Captured {
+		record, check = gateway.Ledger.Refund, gateway.Ledger.CheckRefund
+	} else if gateway.RefundCapturesRemainder {
+		record = func(paymentID, transactionID string, amount int64) error {
+			if remainder := balance.Authorized - amount; remainder > 0 {
+				if err := gateway.Ledger.Capture(paymentID, transactionID, remainder); err != nil {
+					return err
+				}
+			}
+			return gateway.Ledger.Release(paymentID, transactionID, amount)
+		}
+	}
+
+	if err := check(paymentID, int64(amount)); err != nil {
+		return gomerchant.RefundResponse{}, err
+	}
+
+	response, err := gateway.PaymentGateway.Refund(transactionID, amount, params)
+	if err == nil {
+		err = record(paymentID, transactionIDOf(response.TransactionID, transactionID), int64(amount))
+	}
+	return response, err
+}
+
+// Void refund captured balance if params.Captured, and release authorized balance
+func (gateway *Gateway) Void(transactionID string, params gomerchant.VoidParams) (gomerchant.VoidResponse, error) {
+	paymentID, balance, unlock, err := gateway.lock(transactionID)
+	if err != nil {
+		return gomerchant.VoidResponse{}, err
+	}
+	defer unlock()
+
+	if params.Captured && balance.Captured <= 0 {
+		return gomerchant.VoidResponse{}, fmt.Errorf("%w: nothing captured to void of payment %v", ErrInsufficientBalance, paymentID)
+	}
+
+	response, err := gateway.PaymentGateway.Void(transactionID, params)
+	if err != nil {
+		return response, err
+	}
+
+	id := transactionIDOf(response.TransactionID, transactionID)
+	if params.Captured {
+		err = gateway.Ledger.Refund(paymentID, id, balance.Captured)
+	}
+	if err == nil && balance.Authorized > 0 {
+		err = gateway.Ledger.Release(paymentID, id, balance.Authorized)
+	}
+	return response, err
+}
+
+func (gateway *Gateway) lock(transactionID string) (paymentID string, balance Balance, unlock func(), err error) {
+	if paymentID, err = gateway.Ledger.PaymentID(transactionID); err != nil {
+		return
+	}
+
+	unlock = gateway.Ledger.Lock(paymentID)
+	if balance, err = gateway.Ledger.Balance(paymentID); err != nil {
+		unlock()
+	}
+	return
+}
+
+func transactionIDOf(responseID, requestID string) string {
+	if responseID != "" {
+		return responseID
+	}
+	return requestID
+}
@@ -0,0 +1,259 @@
+// Package ledger records gateway operations of payments as balanced double-entry postings,
+// and keeps balances of payments, so refunds above the captured balance are refused before a gateway is called.
+package ledger
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Account ledger account
+type Account string
+
+const (
+	AccountCustomer   Account = "customer"   // funds of customer, credited when authorized, debited when released or refunded
+	AccountAuthorized Account = "authorized" // authorized, but not captured
+	AccountCaptured   Account = "captured"   // captured and not refunded, the refundable balance
+	AccountRefunded   Account = "refunded"
+	AccountFees       Account = "fees"     // fees charged by gateway
+	AccountMerchant   Account = "merchant" // credited when merchant pays fees
+)
+
+// Operation gateway operation of posting
+type Operation string
+
+const (
+	OperationAuthorize Operation = "authorize"
+	OperationCapture   Operation = "capture"
+	OperationRefund    Operation = "refund"
+	OperationRelease   Operation = "release" // release authorized amount, like void or reduce authorization
+	OperationFee       Operation = "fee"
+)
+
+// Entry entry of posting, debit is positive and credit is negative
+type Entry struct {
+	Account Account
+	Amount  int64
+}
+
+// Posting balanced entries of an operation
+type Posting struct {
+	ID            string
+	PaymentID     string // transaction id returned when authorized
+	TransactionID string // transaction id of operation, it is different from payment id if gateway mints new ids, like Paygent
+	Operation     Operation
+	Currency      string
+	Entries       []Entry
+	CreatedAt     time.Time
+}
+
+// ErrUnbalanced sum of entries is not zero
+var ErrUnbalanced = errors.New("ledger: posting is not balanced")
+
+// Validate entries should sum to zero
+func (posting Posting) Validate() error {
+	var sum int64
+	for _, entry := range posting.Entries {
+		sum += entry.Amount
+	}
+	if sum != 0 || len(posting.Entries) == 0 {
+		return fmt.Errorf("%w: entries of %v sum to %v", ErrUnbalanced, posting.Operation, sum)
+	}
+	return nil
+}
+
+// Balance balances of a payment
+type Balance struct {
+	Currency   string
+	Authorized int64 // authorized, not captured or released
+	Captured   int64 // captured, not refunded
+	Refunded   int64
+	Fees       int64
+}
+
+// BalanceOf sum postings of a payment
+func BalanceOf(postings []Posting) Balance {
+	var balance Balance
+	for _, posting := range postings {
+		if balance.Currency == "" {
+			balance.Currency = posting.Currency
+		}
+		for _, entry := range posting.Entries {
+			switch entry.Account {
+			case AccountAuthorized:
+				balance.Authorized += entry.Amount
+			case AccountCaptured:
+				balance.Captured += entry.Amount
+			case AccountRefunded:
+				balance.Refunded += entry.Amount
+			case AccountFees:
+				balance.Fees += entry.Amount
+			}
+		}
+	}
+	return balance
+}
+
+var (
+	// ErrNotFound payment or transaction is not recorded
+	ErrNotFound = errors.New("ledger: not found")
+	// ErrInsufficientBalance operation is greater than the balance, like refunds above the captured balance
+	ErrInsufficientBalance = errors.New("ledger: insufficient balance")
+)
+
+// Ledger record postings to storage
+type Ledger struct {
+	Storage Storage
+	Now     func() time.Time // default time.Now
+
+	mutex sync.Mutex
+	locks map[string]*paymentLock
+}
+
+// paymentLock lock of a payment, it is removed when no one holds or waits for it
+type paymentLock struct {
+	sync.Mutex
+	refs int
+}
+
+// New initialize ledger
+func New(storage Storage) *Ledger {
+	return &Ledger{Storage: storage}
+}
+
+// Lock lock payment, so balance is checked and updated atomically in this process, returns unlock function
+func (ledger *Ledger) Lock(paymentID string) func() {
+	ledger.mutex.Lock()
+	if ledger.locks == nil {
+		ledger.locks = map[string]*paymentLock{}
+	}
+	lock, ok := ledger.locks[paymentID]
+	if !ok {
+		lock = &paymentLock{}
+		ledger.locks[paymentID] = lock
+	}
+	lock.refs++
+	ledger.mutex.Unlock()
+
+	lock.Lock()
+	return func() {
+		lock.Unlock()
+
+		ledger.mutex.Lock()
+		if lock.refs--; lock.refs == 0 {
+			delete(ledger.locks, paymentID)
+		}
+		ledger.mutex.Unlock()
+	}
+}
+
+// Balance balance of payment
+func (ledger *Ledger) Balance(paymentID string) (Balance, error) {
+	postings, err := ledger.Storage.Postings(paymentID)
+	if err == nil && len(postings) == 0 {
+		err = fmt.Errorf("%w: payment %v", ErrNotFound, paymentID)
+	}
+	return BalanceOf(postings), err
+}
+
+// PaymentID payment of a recorded transaction id
+func (ledger *Ledger) PaymentID(transactionID string) (string, error) {
+	return ledger.Storage.PaymentID(transactionID)
+}
+
+// Authorize record authorized amount, payment id is the authorized transaction id
+func (ledger *Ledger) Authorize(paymentID string, currency string, amount int64) error {
+	return ledger.record(paymentID, paymentID, OperationAuthorize, currency, Entry{AccountAuthorized, amount}, Entry{AccountCustomer, -amount})
+}
+
+// Capture record captured amount, it should not be greater than authorized balance
+func (ledger *Ledger) Capture(paymentID, transactionID string, amount int64) error {
+	return ledger.transfer(paymentID, transactionID, OperationCapture, amount, AccountAuthorized, AccountCaptured)
+}
+
+// Refund record refunded amount, it should not be greater than captured balance
+func (ledger *Ledger) Refund(paymentID, transactionID string, amount int64) error {
+	return ledger.transfer(paymentID, transactionID, OperationRefund, amount, AccountCaptured, AccountRefunded)
+}
+
+// Release record released authorized amount, it should not be greater than authorized balance
+func (ledger *Ledger) Release(paymentID, transactionID string, amount int64) error {
+	return ledger.transfer(paymentID, transactionID, OperationRelease, amount, AccountAuthorized, AccountCustomer)
+}
+
+// Fee record fee charged by gateway
+func (ledger *Ledger) Fee(paymentID, transactionID string, amount int64) error {
+	balance, err := ledger.Balance(paymentID)
+	if err != nil {
+		return err
+	}
+	return ledger.record(paymentID, transactionID, OperationFee, balance.Currency, Entry{AccountFees, amount}, Entry{AccountMerchant, -amount})
+}
+
+// CheckRefund check refund amount with captured balance
+func (ledger *Ledger) CheckRefund(paymentID string, amount int64) error {
+	return ledger.check(paymentID, amount, AccountCaptured)
+}
+
+// CheckRelease check released amount with authorized balance
+func (ledger *Ledger) CheckRelease(paymentID string, amount int64) error {
+	return ledger.check(paymentID, amount, AccountAuthorized)
+}
+
+func (ledger *Ledger) check(paymentID string, amount int64, account Account) error {
+	balance, err := ledger.Balance(paymentID)
+	if err != nil {
+		return err
+	}
+
+	available := balance.Authorized
+	if account == AccountCaptured {
+		available = balance.Captured
+	}
+
+	if amount <= 0 || amount > available {
+		return fmt.Errorf("%w: %v %v of payment %v, %v balance is %v", ErrInsufficientBalance, account, amount, paymentID, account, available)
+	}
+	return nil
+}
+
+// transfer move amount from account to account
+func (ledger *Ledger) transfer(paymentID, transactionID string, operation Operation, amount int64, from, to Account) error {
+	if err := ledger.check(paymentID, amount, from); err != nil {
+		return err
+	}
+
+	balance, _ := ledger.Balance(paymentID)
+	return ledger.record(paymentID, transactionID, operation, balance.Currency, Entry{to, amount}, Entry{from, -amount})
+}
+
+func (ledger *Ledger) record(paymentID, transactionID string, operation Operation, currency string, entries ...Entry) error {
+	posting := Posting{
+		ID:            newID(),
+		PaymentID:     paymentID,
+		TransactionID: transactionID,
+		Operation:     operation,
+		Currency:      currency,
+		Entries:       entries,
+		CreatedAt:     time.Now(),
+	}
+
+	if ledger.Now != nil {
+		posting.CreatedAt = ledger.Now()
+	}
+
+	if err := posting.Validate(); err != nil {
+		return err
+	}
+	return ledger.Storage.Append(posting)
+}
+
+func newID() string {
+	id := make([]byte, 16)
+	rand.Read(id)
+	return hex.EncodeToString(id)
+}
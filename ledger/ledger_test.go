@@ -0,0 +1,182 @@
+package ledger_test
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/qor/gomerchant"
+	"github.com/qor/gomerchant/ledger"
+)
+
+// fakeGateway mints a new transaction id for refunds like Paygent
+type fakeGateway struct {
+	gomerchant.PaymentGateway
+	calls []string
+	next  int
+}
+
+func (gateway *fakeGateway) newID() string {
+	gateway.next++
+	return fmt.Sprint(gateway.next)
+}
+
+func (gateway *fakeGateway) Authorize(amount uint64, params gomerchant.AuthorizeParams) (gomerchant.AuthorizeResponse, error) {
+	gateway.calls = append(gateway.calls, "authorize")
+	return gomerchant.AuthorizeResponse{TransactionID: gateway.newID()}, nil
+}
+
+func (gateway *fakeGateway) Capture(transactionID string, params gomerchant.CaptureParams) (gomerchant.CaptureResponse, error) {
+	gateway.calls = append(gateway.calls, "capture")
+	return gomerchant.CaptureResponse{TransactionID: transactionID}, nil
+}
+
+func (gateway *fakeGateway) Refund(transactionID string, amount uint, params gomerchant.RefundParams) (gomerchant.RefundResponse, error) {
+	gateway.calls = append(gateway.calls, "refund")
+	return gomerchant.RefundResponse{TransactionID: gateway.newID()}, nil
+}
+
+func (gateway *fakeGateway) Void(transactionID string, params gomerchant.VoidParams) (gomerchant.VoidResponse, error) {
+	gateway.calls = append(gateway.calls, "void")
+	return gomerchant.VoidResponse{TransactionID: transactionID}, nil
+}
+
+func TestGateway(t *testing.T) {
+	var (
+		wrapped = &fakeGateway{}
+		book    = ledger.New(ledger.NewMemoryStorage())
+		gateway = ledger.NewGateway(wrapped, book)
+	)
+
+	response, err := gateway.Authorize(1000, gomerchant.AuthorizeParams{Currency: "JPY"})
+	if err != nil {
+		t.Fatalf("failed to authorize, got %v", err)
+	}
+	paymentID := response.TransactionID
+
+	if _, err := gateway.Refund(paymentID, 100, gomerchant.RefundParams{Captured: true}); !errors.Is(err, ledger.ErrInsufficientBalance) {
+		t.Errorf("should not refund before captured, got %v", err)
+	}
+
+	if _, err := gateway.Capture(paymentID, gomerchant.CaptureParams{}); err != nil {
+		t.Fatalf("failed to capture, got %v", err)
+	}
+
+	refundResponse, err := gateway.Refund(paymentID, 300, gomerchant.RefundParams{Captured: true})
+	if err != nil {
+		t.Fatalf("failed to refund, got %v", err)
+	}
+
+	// refund with the new transaction id
+	if _, err := gateway.Refund(refundResponse.TransactionID, 800, gomerchant.RefundParams{Captured: true}); !errors.Is(err, ledger.ErrInsufficientBalance) {
+		t.Errorf("should refuse refund above captured balance, got %v", err)
+	}
+
+	if err := book.Fee(paymentID, paymentID, 36); err != nil {
+		t.Errorf("failed to record fee, got %v", err)
+	}
+
+	balance, err := book.Balance(paymentID)
+	if err != nil || balance != (ledger.Balance{Currency: "JPY", Captured: 700, Refunded: 300, Fees: 36}) {
+		t.Errorf("balance is not correct, got %v, %+v", err, balance)
+	}
+
+	if _, err := gateway.Void(refundResponse.TransactionID, gomerchant.VoidParams{Captured: true}); err != nil {
+		t.Fatalf("failed to void, got %v", err)
+	}
+
+	if balance, _ := book.Balance(paymentID); balance.Captured != 0 || balance.Refunded != 1000 {
+		t.Errorf("captured balance should be refunded when voided, got %+v", balance)
+	}
+
+	expected := "[authorize capture refund void]"
+	if calls := fmt.Sprint(wrapped.calls); calls != expected {
+		t.Errorf("refused operations should not call gateway, expected %v, but got %v", expected, calls)
+	}
+
+	postings, _ := book.Storage.Postings(paymentID)
+	for _, posting := range postings {
+		if err := posting.Validate(); err != nil {
+			t.Errorf("posting should be balanced, got %v", err)
+		}
+	}
+
+	if _, err := gateway.Capture("unknown", gomerchant.CaptureParams{}); !errors.Is(err, ledger.ErrNotFound) {
+		t.Errorf("should get not found error, but got %v", err)
+	}
+}
+
+func TestReleaseAuthorization(t *testing.T) {
+	var (
+		book    = ledger.New(ledger.NewMemoryStorage())
+		gateway = ledger.NewGateway(&fakeGateway{}, book)
+	)
+
+	response, _ := gateway.Authorize(1000, gomerchant.AuthorizeParams{Currency: "JPY"})
+	if _, err := gateway.Refund(response.TransactionID, 400, gomerchant.RefundParams{}); err != nil {
+		t.Fatalf("failed to reduce authorization, got %v", err)
+	}
+
+	if balance, _ := book.Balance(response.TransactionID); balance.Authorized != 600 || balance.Refunded != 0 {
+		t.Errorf("authorized balance should be reduced, got %+v", balance)
+	}
+
+	if _, err := gateway.Void(response.TransactionID, gomerchant.VoidParams{}); err != nil {
+		t.Fatalf("failed to void, got %v", err)
+	}
+
+	if balance, _ := book.Balance(response.TransactionID); balance.Authorized != 0 {
+		t.Errorf("authorized balance should be released, got %+v", balance)
+	}
+
+	if _, err := gateway.Capture(response.TransactionID, gomerchant.CaptureParams{}); !errors.Is(err, ledger.ErrInsufficientBalance) {
+		t.Errorf("should not capture released payment, got %v", err)
+	}
+}
+
+func TestRefundCapturesRemainder(t *testing.T) {
+	var (
+		book    = ledger.New(ledger.NewMemoryStorage())
+		gateway = ledger.NewGateway(&fakeGateway{}, book)
+	)
+	gateway.RefundCapturesRemainder = true
+
+	response, _ := gateway.Authorize(1000, gomerchant.AuthorizeParams{Currency: "JPY"})
+	if _, err := gateway.Refund(response.TransactionID, 400, gomerchant.RefundParams{}); err != nil {
+		t.Fatalf("failed to refund uncaptured payment, got %v", err)
+	}
+
+	if balance, _ := book.Balance(response.TransactionID); balance != (ledger.Balance{Currency: "JPY", Captured: 600}) {
+		t.Errorf("remaining authorized balance should be captured, got %+v", balance)
+	}
+
+	if _, err := gateway.Refund(response.TransactionID, 600, gomerchant.RefundParams{Captured: true}); err != nil {
+		t.Errorf("captured remainder should be refundable, got %v", err)
+	}
+}
+
+func TestLock(t *testing.T) {
+	var (
+		book    = ledger.New(ledger.NewMemoryStorage())
+		counter int
+		wg      sync.WaitGroup
+	)
+
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			unlock := book.Lock("payment-1")
+			defer unlock()
+
+			value := counter
+			counter = value + 1
+		}()
+	}
+	wg.Wait()
+
+	if counter != 100 {
+		t.Errorf("payment should be locked exclusively, got %v", counter)
+	}
+}
@@ -0,0 +1,185 @@
+package ledger
+
+import (
+	"database/sql"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Storage storage of postings
+type Storage interface {
+	Append(posting Posting) error
+	Postings(paymentID string) ([]Posting, error) // postings of payment in recorded order
+	PaymentID(transactionID string) (string, error)
+}
+
+// MemoryStorage in-memory storage
+type MemoryStorage struct {
+	mutex        sync.RWMutex
+	postings     map[string][]Posting
+	transactions map[string]string
+}
+
+// NewMemoryStorage initialize in-memory storage
+func NewMemoryStorage() *MemoryStorage {
+	return &MemoryStorage{postings: map[string][]Posting{}, transactions: map[string]string{}}
+}
+
+// Append append posting
+func (storage *MemoryStorage) Append(posting Posting) error {
+	storage.mutex.Lock()
+	defer storage.mutex.Unlock()
+
+	storage.postings[posting.PaymentID] = append(storage.postings[posting.PaymentID], posting)
+	storage.transactions[posting.TransactionID] = posting.PaymentID
+	return nil
+}
+
+// Postings postings of payment
+func (storage *MemoryStorage) Postings(paymentID string) ([]Posting, error) {
+	storage.mutex.RLock()
+	defer storage.mutex.RUnlock()
+	return append([]Posting{}, storage.postings[paymentID]...), nil
+}
+
+// PaymentID payment of transaction id
+func (storage *MemoryStorage) PaymentID(transactionID string) (string, error) {
+	storage.mutex.RLock()
+	defer storage.mutex.RUnlock()
+
+	if paymentID, ok := storage.transactions[transactionID]; ok {
+		return paymentID, nil
+	}
+	return "", fmt.Errorf("%w: transaction %v", ErrNotFound, transactionID)
+}
+
+// SQLStorage database/sql storage, every entry is saved as a row:
+//
+//	CREATE TABLE ledger_entries (
+//		posting_id     VARCHAR(32) NOT NULL,
+//		payment_id     VARCHAR(255) NOT NULL,
+//		transaction_id VARCHAR(255) NOT NULL,
+//		operation      VARCHAR(32) NOT NULL,
+//		currency       VARCHAR(3) NOT NULL,
+//		account        VARCHAR(32) NOT NULL,
+//		amount         BIGINT NOT NULL,
+//		created_at     TIMESTAMP NOT NULL,
+//		position       INTEGER NOT NULL
+//	)
+type SQLStorage struct {
+	DB          *sql.DB
+	Table       string             // default ledger_entries
+	Placeholder func(n int) string // placeholder of nth (from 1) argument, default `?`, use `$n` for PostgreSQL
+}
+
+// NewSQLStorage initialize database/sql storage
+func NewSQLStorage(db *sql.DB) *SQLStorage {
+	return &SQLStorage{DB: db}
+}
+
+// DollarPlaceholder PostgreSQL placeholder
+func DollarPlaceholder(n int) string {
+	return fmt.Sprintf("$%d", n)
+}
+
+func (storage *SQLStorage) table() string {
+	if storage.Table != "" {
+		return storage.Table
+	}
+	return "ledger_entries"
+}
+
+func (storage *SQLStorage) placeholder(n int) string {
+	if storage.Placeholder != nil {
+		return storage.Placeholder(n)
+	}
+	return "?"
+}
+
+// CreateTable create table if it doesn't exist
+func (storage *SQLStorage) CreateTable() error {
+	_, err := storage.DB.Exec(fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %v (
+	posting_id VARCHAR(32) NOT NULL,
+	payment_id VARCHAR(255) NOT NULL,
+	transaction_id VARCHAR(255) NOT NULL,
+	operation VARCHAR(32) NOT NULL,
+	currency VARCHAR(3) NOT NULL,
+	account VARCHAR(32) NOT NULL,
+	amount BIGINT NOT NULL,
+	created_at TIMESTAMP NOT NULL,
+	position INTEGER NOT NULL
+)`, storage.table()))
+	return err
+}
+
+// Append insert entries of posting in a database transaction
+func (storage *SQLStorage) Append(posting Posting) error {
+	tx, err := storage.DB.Begin()
+	if err != nil {
+		return err
+	}
+
+	var placeholders string
+	for i := 1; i <= 9; i++ {
+		if i > 1 {
+			placeholders += ", "
+		}
+		placeholders += storage.placeholder(i)
+	}
+	query := fmt.Sprintf("INSERT INTO %v (posting_id, payment_id, transaction_id, operation, currency, account, amount, created_at, position) VALUES (%v)", storage.table(), placeholders)
+
+	for idx, entry := range posting.Entries {
+		if _, err := tx.Exec(query, posting.ID, posting.PaymentID, posting.TransactionID, string(posting.Operation), posting.Currency, string(entry.Account), entry.Amount, posting.CreatedAt.UTC(), idx); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// Postings postings of payment, ordered by created time
+func (storage *SQLStorage) Postings(paymentID string) ([]Posting, error) {
+	rows, err := storage.DB.Query(fmt.Sprintf("SELECT posting_id, transaction_id, operation, currency, account, amount, created_at FROM %v WHERE payment_id = %v ORDER BY created_at, posting_id, position", storage.table(), storage.placeholder(1)), paymentID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var postings []Posting
+	for rows.Next() {
+		var (
+			posting            = Posting{PaymentID: paymentID}
+			operation, account string
+			entry              Entry
+			createdAt          time.Time
+		)
+
+		if err := rows.Scan(&posting.ID, &posting.TransactionID, &operation, &posting.Currency, &account, &entry.Amount, &createdAt); err != nil {
+			return nil, err
+		}
+		entry.Account = Account(account)
+
+		if len(postings) > 0 && postings[len(postings)-1].ID == posting.ID {
+			last := &postings[len(postings)-1]
+			last.Entries = append(last.Entries, entry)
+			continue
+		}
+
+		posting.Operation = Operation(operation)
+		posting.CreatedAt = createdAt
+		posting.Entries = []Entry{entry}
+		postings = append(postings, posting)
+	}
+	return postings, rows.Err()
+}
+
+// PaymentID payment of transaction id
+func (storage *SQLStorage) PaymentID(transactionID string) (string, error) {
+	var paymentID string
+	err := storage.DB.QueryRow(fmt.Sprintf("SELECT payment_id FROM %v WHERE transaction_id = %v LIMIT 1", storage.table(), storage.placeholder(1)), transactionID).Scan(&paymentID)
+	if err == sql.ErrNoRows {
+		return "", fmt.Errorf("%w: transaction %v", ErrNotFound, transactionID)
+	}
+	return paymentID, err
+}
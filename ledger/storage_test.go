@@ -0,0 +1,166 @@
+package ledger_test
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/qor/gomerchant/ledger"
+)
+
+// fakeDriver database/sql driver that understands statements of SQLStorage, rows are kept in memory
+type fakeDriver struct {
+	mutex sync.Mutex
+	rows  [][]driver.Value
+}
+
+func (d *fakeDriver) Open(name string) (driver.Conn, error) { return &fakeConn{driver: d}, nil }
+
+type fakeConn struct{ driver *fakeDriver }
+
+func (c *fakeConn) Prepare(query string) (driver.Stmt, error) {
+	return &fakeStmt{conn: c, query: query}, nil
+}
+func (c *fakeConn) Close() error              { return nil }
+func (c *fakeConn) Begin() (driver.Tx, error) { return c, nil }
+func (c *fakeConn) Commit() error             { return nil }
+func (c *fakeConn) Rollback() error           { return nil }
+
+type fakeStmt struct {
+	conn  *fakeConn
+	query string
+}
+
+func (s *fakeStmt) Close() error  { return nil }
+func (s *fakeStmt) NumInput() int { return -1 }
+
+func (s *fakeStmt) Exec(args []driver.Value) (driver.Result, error) {
+	d := s.conn.driver
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	switch {
+	case strings.HasPrefix(s.query, "CREATE TABLE"):
+	case strings.HasPrefix(s.query, "INSERT INTO"):
+		if len(args) != 9 {
+			return nil, errors.New("wrong number of arguments")
+		}
+		d.rows = append(d.rows, args)
+	default:
+		return nil, errors.New("unknown statement " + s.query)
+	}
+	return driver.RowsAffected(1), nil
+}
+
+// columns posting_id, payment_id, transaction_id, operation, currency, account, amount, created_at, position
+func (s *fakeStmt) Query(args []driver.Value) (driver.Rows, error) {
+	d := s.conn.driver
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	result := &fakeRows{}
+	switch {
+	case strings.Contains(s.query, "WHERE payment_id"):
+		result.columns = []string{"posting_id", "transaction_id", "operation", "currency", "account", "amount", "created_at"}
+		var matched [][]driver.Value
+		for _, row := range d.rows {
+			if row[1] == args[0] {
+				matched = append(matched, row)
+			}
+		}
+		sort.SliceStable(matched, func(i, j int) bool {
+			if ti, tj := matched[i][7].(time.Time), matched[j][7].(time.Time); !ti.Equal(tj) {
+				return ti.Before(tj)
+			}
+			if matched[i][0] != matched[j][0] {
+				return matched[i][0].(string) < matched[j][0].(string)
+			}
+			return matched[i][8].(int64) < matched[j][8].(int64)
+		})
+		for _, row := range matched {
+			result.rows = append(result.rows, []driver.Value{row[0], row[2], row[3], row[4], row[5], row[6], row[7]})
+		}
+	case strings.Contains(s.query, "WHERE transaction_id"):
+		result.columns = []string{"payment_id"}
+		for _, row := range d.rows {
+			if row[2] == args[0] {
+				result.rows = append(result.rows, []driver.Value{row[1]})
+				break
+			}
+		}
+	default:
+		return nil, errors.New("unknown query " + s.query)
+	}
+	return result, nil
+}
+
+type fakeRows struct {
+	columns []string
+	rows    [][]driver.Value
+}
+
+func (r *fakeRows) Columns() []string { return r.columns }
+func (r *fakeRows) Close() error      { return nil }
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if len(r.rows) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.rows[0])
+	r.rows = r.rows[1:]
+	return nil
+}
+
+func init() {
+	sql.Register("ledger_fake", &fakeDriver{})
+}
+
+func TestStorages(t *testing.T) {
+	db, err := sql.Open("ledger_fake", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	sqlStorage := ledger.NewSQLStorage(db)
+	if err := sqlStorage.CreateTable(); err != nil {
+		t.Fatalf("failed to create table, got %v", err)
+	}
+
+	for name, storage := range map[string]ledger.Storage{"memory": ledger.NewMemoryStorage(), "sql": sqlStorage} {
+		var (
+			now    = time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+			record = ledger.New(storage)
+		)
+		record.Now = func() time.Time { now = now.Add(time.Second); return now }
+
+		record.Authorize("pay_1", "jpy", 1000)
+		record.Capture("pay_1", "pay_1", 1000)
+		record.Refund("pay_1", "pay_2", 300)
+
+		postings, err := storage.Postings("pay_1")
+		if err != nil || len(postings) != 3 {
+			t.Fatalf("%v: should get 3 postings, but got %v, %v", name, err, len(postings))
+		}
+
+		refund := postings[2]
+		expected := []ledger.Entry{{Account: ledger.AccountRefunded, Amount: 300}, {Account: ledger.AccountCaptured, Amount: -300}}
+		if refund.Operation != ledger.OperationRefund || refund.TransactionID != "pay_2" || refund.Currency != "jpy" || !reflect.DeepEqual(refund.Entries, expected) || !refund.CreatedAt.Equal(now) {
+			t.Errorf("%v: refund posting is not correct, got %+v", name, refund)
+		}
+
+		if paymentID, err := storage.PaymentID("pay_2"); err != nil || paymentID != "pay_1" {
+			t.Errorf("%v: should find payment of transaction, got %v, %v", name, paymentID, err)
+		}
+
+		if _, err := storage.PaymentID("unknown"); !errors.Is(err, ledger.ErrNotFound) {
+			t.Errorf("%v: should get not found error, but got %v", name, err)
+		}
+	}
+}
@@ -0,0 +1,115 @@
+package gomerchant
+
+import (
+	"errors"
+	"fmt"
+)
+
+// LineItemKind kind of line item
+type LineItemKind string
+
+const (
+	LineItemProduct  LineItemKind = "product" // default kind if it is blank
+	LineItemShipping LineItemKind = "shipping"
+)
+
+// LineItem item of an order, total of item is Quantity * UnitPrice + Tax - Discount
+type LineItem struct {
+	ID        string
+	Name      string
+	Kind      LineItemKind
+	Quantity  uint64
+	UnitPrice uint64
+	Tax       uint64 // tax of the whole line, 0 if UnitPrice includes tax
+	Discount  uint64 // discount of the whole line
+}
+
+// Subtotal unit price * quantity
+func (item LineItem) Subtotal() uint64 {
+	return item.UnitPrice * item.Quantity
+}
+
+// Total subtotal + tax - discount, 0 if discount is greater than subtotal + tax
+func (item LineItem) Total() uint64 {
+	if gross := item.Subtotal() + item.Tax; gross > item.Discount {
+		return gross - item.Discount
+	}
+	return 0
+}
+
+// ErrInvalidLineItems line items don't add up to the amount
+var ErrInvalidLineItems = errors.New("gomerchant: invalid line items")
+
+// LineItems line items of an order
+type LineItems []LineItem
+
+// Total sum of item totals
+func (items LineItems) Total() (total uint64) {
+	for _, item := range items {
+		total += item.Total()
+	}
+	return total
+}
+
+// Validate validate items, totals of items should add up to amount
+func (items LineItems) Validate(amount uint64) error {
+	for idx, item := range items {
+		if item.Quantity == 0 {
+			return fmt.Errorf("%w: quantity of item #%v %v is zero", ErrInvalidLineItems, idx, item.ID)
+		}
+		if item.Discount > item.Subtotal()+item.Tax {
+			return fmt.Errorf("%w: discount of item #%v %v is greater than its price", ErrInvalidLineItems, idx, item.ID)
+		}
+	}
+
+	if total := items.Total(); total != amount {
+		return fmt.Errorf("%w: items add up to %v, but amount is %v", ErrInvalidLineItems, total, amount)
+	}
+	return nil
+}
+
+// Allocate allocate amount (like an order discount or partial refund) to items in proportion to their totals,
+// rounding remainder goes to the first items, allocated amount of an item won't be greater than its total
+func (items LineItems) Allocate(amount uint64) []uint64 {
+	var (
+		allocated = make([]uint64, len(items))
+		total     = items.Total()
+		sum       uint64
+	)
+
+	if total == 0 {
+		return allocated
+	}
+
+	if amount > total {
+		amount = total
+	}
+
+	for idx, item := range items {
+		allocated[idx] = item.Total() * amount / total
+		sum += allocated[idx]
+	}
+
+	for idx := 0; sum < amount; idx = (idx + 1) % len(allocated) {
+		if allocated[idx] < items[idx].Total() {
+			allocated[idx]++
+			sum++
+		}
+	}
+	return allocated
+}
+
+// ApplyDiscount allocate discount to items with Allocate, returns items with increased Discount,
+// could be used to get remaining items after a partial refund
+func (items LineItems) ApplyDiscount(discount uint64) (LineItems, error) {
+	if total := items.Total(); discount > total {
+		return nil, fmt.Errorf("%w: discount %v is greater than total %v", ErrInvalidLineItems, discount, total)
+	}
+
+	results := make(LineItems, len(items))
+	for idx, amount := range items.Allocate(discount) {
+		results[idx] = items[idx]
+		results[idx].Discount += amount
+	}
+	return results, nil
+}
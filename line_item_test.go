@@ -0,0 +1,70 @@
+package gomerchant
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+var lineItems = LineItems{
+	{ID: "shirt", Quantity: 2, UnitPrice: 500, Tax: 100},
+	{ID: "socks", Quantity: 1, UnitPrice: 300, Discount: 100},
+	{Kind: LineItemShipping, Quantity: 1, UnitPrice: 500},
+}
+
+func TestLineItemsValidate(t *testing.T) {
+	cases := []struct {
+		items  LineItems
+		amount uint64
+		valid  bool
+	}{
+		{lineItems, 1800, true},
+		{lineItems, 1700, false},
+		{LineItems{{ID: "shirt", UnitPrice: 500}}, 0, false},
+		{LineItems{{ID: "shirt", Quantity: 1, UnitPrice: 500, Discount: 600}}, 0, false},
+		{nil, 0, true},
+	}
+
+	for idx, c := range cases {
+		err := c.items.Validate(c.amount)
+		if c.valid != (err == nil) {
+			t.Errorf("#%v: valid should be %v, but got %v", idx, c.valid, err)
+		}
+		if err != nil && !errors.Is(err, ErrInvalidLineItems) {
+			t.Errorf("#%v: error should be ErrInvalidLineItems, but got %v", idx, err)
+		}
+	}
+}
+
+func TestLineItemsAllocate(t *testing.T) {
+	cases := []struct {
+		amount   uint64
+		expected []uint64
+	}{
+		{180, []uint64{110, 20, 50}},
+		{100, []uint64{62, 11, 27}},
+		{5000, []uint64{1100, 200, 500}},
+		{0, []uint64{0, 0, 0}},
+	}
+
+	for _, c := range cases {
+		if allocated := lineItems.Allocate(c.amount); !reflect.DeepEqual(allocated, c.expected) {
+			t.Errorf("allocate %v should be %v, but got %v", c.amount, c.expected, allocated)
+		}
+	}
+}
+
+func TestLineItemsApplyDiscount(t *testing.T) {
+	items, err := lineItems.ApplyDiscount(180)
+	if err != nil || items.Total() != 1620 {
+		t.Fatalf("failed to apply discount, got %v, %v", err, items.Total())
+	}
+
+	if items[0].Discount != 110 || items[1].Discount != 120 || items[2].Discount != 50 || lineItems[1].Discount != 100 {
+		t.Errorf("discount should be allocated to new items, got %+v", items)
+	}
+
+	if _, err := lineItems.ApplyDiscount(1801); !errors.Is(err, ErrInvalidLineItems) {
+		t.Errorf("should not apply discount greater than total, got %v", err)
+	}
+}
@@ -0,0 +1,24 @@
+package gomerchant
+
+import "errors"
+
+// OrderLookup interface, find and cancel transactions by the order id passed to Authorize,
+// used to recover payments whose transaction id was lost, like the process crashed after authorized but before the transaction id was saved
+type OrderLookup interface {
+	QueryByOrderID(orderID string) (Transaction, error)
+	VoidByOrderID(orderID string, params VoidParams) (VoidResponse, error)
+}
+
+// ErrTransactionNotFound transaction not found
+var ErrTransactionNotFound = errors.New("gomerchant: transaction not found")
+
+// VoidTransaction void transaction found by order id, captured transactions are voided as captured,
+// cancelled transactions are not voided again, so retrying a cancel-by-order flow is safe
+func VoidTransaction(gateway PaymentGateway, transaction Transaction, params VoidParams) (VoidResponse, error) {
+	if transaction.Cancelled {
+		return VoidResponse{TransactionID: transaction.ID, Params: transaction.Params}, nil
+	}
+
+	params.Captured = transaction.Captured
+	return gateway.Void(transaction.ID, params)
+}
@@ -0,0 +1,135 @@
+package gomerchant
+
+import "sync"
+
+// Payment payment of an order, gateways like Paygent mint a new transaction id when a payment is refunded or corrected,
+// Payment follows the chain of transaction ids, so operations always target the latest transaction id
+//
+//	payment, _, err := gomerchant.Authorize(Paygent, 1000, params)
+//	payment.Refund(100, gomerchant.RefundParams{})
+//	payment.Capture(gomerchant.CaptureParams{}) // captures the transaction id returned by refund
+//	payment.TransactionIDs()                    // save the chain to resume with NewPayment
+type Payment struct {
+	Gateway PaymentGateway
+	OrderID string
+
+	mutex          sync.Mutex
+	transactionIDs []string
+}
+
+// NewPayment payment with known transaction ids, from the authorized one to the latest
+func NewPayment(gateway PaymentGateway, orderID string, transactionIDs ...string) *Payment {
+	payment := &Payment{Gateway: gateway, OrderID: orderID}
+	for _, transactionID := range transactionIDs {
+		payment.Track(transactionID)
+	}
+	return payment
+}
+
+// Authorize authorize a payment with gateway
+func Authorize(gateway PaymentGateway, amount uint64, params AuthorizeParams) (*Payment, AuthorizeResponse, error) {
+	response, err := gateway.Authorize(amount, params)
+	return NewPayment(gateway, params.OrderID, response.TransactionID), response, err
+}
+
+// TransactionID latest transaction id
+func (payment *Payment) TransactionID() string {
+	payment.mutex.Lock()
+	defer payment.mutex.Unlock()
+	return payment.latest()
+}
+
+// TransactionIDs all transaction ids, from the authorized one to the latest
+func (payment *Payment) TransactionIDs() []string {
+	payment.mutex.Lock()
+	defer payment.mutex.Unlock()
+	return append([]string{}, payment.transactionIDs...)
+}
+
+// Track track a new transaction id returned by an operation that is not called through the payment, like Rakuten Pay corrections,
+// it is ignored if it is blank or tracked already
+func (payment *Payment) Track(transactionID string) {
+	payment.mutex.Lock()
+	defer payment.mutex.Unlock()
+	payment.track(transactionID)
+}
+
+func (payment *Payment) track(transactionID string) {
+	if transactionID == "" {
+		return
+	}
+	for _, id := range payment.transactionIDs {
+		if id == transactionID {
+			return
+		}
+	}
+	payment.transactionIDs = append(payment.transactionIDs, transactionID)
+}
+
+// Follow track transaction id if its base transaction id belongs to the payment, like payment notifications with `base_payment_id` of Paygent,
+// returns if it belongs to the payment
+func (payment *Payment) Follow(transactionID, baseTransactionID string) bool {
+	payment.mutex.Lock()
+	defer payment.mutex.Unlock()
+
+	for _, id := range payment.transactionIDs {
+		if id == transactionID {
+			return true
+		}
+		if id == baseTransactionID && baseTransactionID != "" {
+			payment.track(transactionID)
+			return true
+		}
+	}
+	return false
+}
+
+// Capture capture latest transaction
+func (payment *Payment) Capture(params CaptureParams) (CaptureResponse, error) {
+	payment.mutex.Lock()
+	defer payment.mutex.Unlock()
+
+	response, err := payment.Gateway.Capture(payment.latest(), params)
+	if err == nil {
+		payment.track(response.TransactionID)
+	}
+	return response, err
+}
+
+// Refund refund latest transaction
+func (payment *Payment) Refund(amount uint, params RefundParams) (RefundResponse, error) {
+	payment.mutex.Lock()
+	defer payment.mutex.Unlock()
+
+	response, err := payment.Gateway.Refund(payment.latest(), amount, params)
+	if err == nil {
+		payment.track(response.TransactionID)
+	}
+	return response, err
+}
+
+// Void void latest transaction
+func (payment *Payment) Void(params VoidParams) (VoidResponse, error) {
+	payment.mutex.Lock()
+	defer payment.mutex.Unlock()
+
+	response, err := payment.Gateway.Void(payment.latest(), params)
+	if err == nil {
+		payment.track(response.TransactionID)
+	}
+	return response, err
+}
+
+// Query query latest transaction
+func (payment *Payment) Query() (Transaction, error) {
+	payment.mutex.Lock()
+	defer payment.mutex.Unlock()
+	return payment.Gateway.Query(payment.latest())
+}
+
+func (payment *Payment) latest() string {
+	if len(payment.transactionIDs) == 0 {
+		return ""
+	}
+	return payment.transactionIDs[len(payment.transactionIDs)-1]
+}
@@ -23,14 +23,20 @@ type AuthorizeParams struct {
 	BillingAddress  *Address
 	ShippingAddress *Address
 	PaymentMethod   *PaymentMethod
+	SplitPayment    *SplitPayment // split payment between platform and connected accounts, for marketplaces
+	LineItems       LineItems     // items of order, totals of items should add up to amount
 	Params
 }
 
 // AuthorizeResponse authorize response
 type AuthorizeResponse struct {
-	TransactionID  string
-	HandleRequest  bool                                                   // need process request after authorize or not
-	RequestHandler func(http.ResponseWriter, *http.Request, Params) error // process request
+	TransactionID        string
+	HandleRequest        bool                                                   // need process request after authorize or not
+	RequestHandler       func(http.ResponseWriter, *http.Request, Params) error // process request
+	AVSResult            AVSResult
+	CVCResult            CheckResult
+	NetworkTransactionID string // transaction id of card network, used for merchant initiated transactions, not filled by Paygent and Stripe yet
+	AuthorizationCode    string // approval code of issuer
 	Params
 }
 
@@ -57,7 +63,9 @@ type CaptureResponse struct {
 
 // RefundParams refund params
 type RefundParams struct {
-	Captured bool
+	Captured         bool
+	ReverseTransfers bool      // reverse transfers to connected accounts of split payment in proportion
+	LineItems        LineItems // refunded items, totals of items should add up to refund amount
 	Params
 }
 
@@ -69,7 +77,8 @@ type RefundResponse struct {
 
 // VoidParams void params
 type VoidParams struct {
-	Captured bool
+	Captured         bool
+	ReverseTransfers bool // reverse transfers to connected accounts of split payment
 	Params
 }
 
@@ -100,6 +109,7 @@ type ApplicationParams struct {
 	ReturnUrl       string
 	CancelUrl       string
 	Goods           []Good
+	LineItems       LineItems // items of order, used if Goods is blank
 	Params
 }
 
@@ -7,4 +7,29 @@ var ErrNotSupportedPaymentMethod = errors.New("not supported payment method")
 type PaymentMethod struct {
 	SavedCreditCard *SavedCreditCard
 	CreditCard      *CreditCard
+	NetworkToken    *NetworkToken
+	DeviceToken     *DeviceToken
+}
+
+// NetworkToken network token of a card, like Google Pay's CRYPTOGRAM_3DS cards, it is authorized with the cryptogram instead of security code,
+// built-in gateways don't support it yet and return ErrNotSupportedPaymentMethod
+type NetworkToken struct {
+	Number     string // token number, issued by card network in place of the card number
+	ExpMonth   uint
+	ExpYear    uint
+	Cryptogram string // one-time cryptogram of the payment, like TAVV
+	ECI        string // electronic commerce indicator, blank if it isn't provided
+	Wallet     string // wallet that provided the token, like google_pay
+}
+
+// DeviceToken device account number of a card provisioned to a device, like Apple Pay's cards, it is authorized with the cryptogram instead of security code,
+// built-in gateways don't support it yet and return ErrNotSupportedPaymentMethod
+type DeviceToken struct {
+	Number         string // device primary account number
+	ExpMonth       uint
+	ExpYear        uint
+	Cryptogram     string // online payment cryptogram
+	ECI            string // electronic commerce indicator, blank if it isn't provided
+	CardholderName string
+	Wallet         string // wallet of the device, like apple_pay
 }
@@ -0,0 +1,66 @@
+package gomerchant
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+// mintingGateway mints a new transaction id for refunds
+type mintingGateway struct {
+	PaymentGateway
+	targets []string
+	next    int
+}
+
+func (gateway *mintingGateway) Authorize(amount uint64, params AuthorizeParams) (AuthorizeResponse, error) {
+	gateway.next++
+	return AuthorizeResponse{TransactionID: fmt.Sprint(gateway.next)}, nil
+}
+
+func (gateway *mintingGateway) Capture(transactionID string, params CaptureParams) (CaptureResponse, error) {
+	gateway.targets = append(gateway.targets, "capture "+transactionID)
+	return CaptureResponse{TransactionID: transactionID}, nil
+}
+
+func (gateway *mintingGateway) Refund(transactionID string, amount uint, params RefundParams) (RefundResponse, error) {
+	gateway.targets = append(gateway.targets, "refund "+transactionID)
+	gateway.next++
+	return RefundResponse{TransactionID: fmt.Sprint(gateway.next)}, nil
+}
+
+func (gateway *mintingGateway) Query(transactionID string) (Transaction, error) {
+	gateway.targets = append(gateway.targets, "query "+transactionID)
+	return Transaction{ID: transactionID}, nil
+}
+
+func TestPayment(t *testing.T) {
+	gateway := &mintingGateway{}
+	payment, response, err := Authorize(gateway, 1000, AuthorizeParams{OrderID: "order-1"})
+	if err != nil || response.TransactionID != "1" || payment.TransactionID() != "1" || payment.OrderID != "order-1" {
+		t.Fatalf("failed to authorize, got %v, %+v", err, response)
+	}
+
+	payment.Refund(100, RefundParams{})
+	payment.Capture(CaptureParams{})
+	payment.Refund(100, RefundParams{Captured: true})
+	payment.Query()
+
+	expected := []string{"refund 1", "capture 2", "refund 2", "query 3"}
+	if !reflect.DeepEqual(gateway.targets, expected) {
+		t.Errorf("operations should target latest transaction id, expected %v, but got %v", expected, gateway.targets)
+	}
+
+	if ids := payment.TransactionIDs(); !reflect.DeepEqual(ids, []string{"1", "2", "3"}) {
+		t.Errorf("transaction ids are not correct, got %v", ids)
+	}
+
+	if !payment.Follow("4", "3") || payment.Follow("5", "99") || payment.TransactionID() != "4" {
+		t.Errorf("should follow transaction id with base transaction id of payment, got %v", payment.TransactionIDs())
+	}
+
+	resumed := NewPayment(gateway, "order-1", payment.TransactionIDs()...)
+	if resumed.TransactionID() != "4" {
+		t.Errorf("resumed payment should target latest transaction id, got %v", resumed.TransactionID())
+	}
+}
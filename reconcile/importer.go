@@ -0,0 +1,111 @@
+package reconcile
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Importer import settlement report of gateway into records
+type Importer interface {
+	Import(r io.Reader) ([]Record, error)
+}
+
+// ImporterFunc func that implements Importer
+type ImporterFunc func(r io.Reader) ([]Record, error)
+
+// Import import records
+func (fc ImporterFunc) Import(r io.Reader) ([]Record, error) {
+	return fc(r)
+}
+
+var (
+	importersMutex sync.RWMutex
+	importers      = map[string]Importer{}
+)
+
+// Register register importer with name, registered importer could be used with Import
+func Register(name string, importer Importer) {
+	importersMutex.Lock()
+	defer importersMutex.Unlock()
+	importers[name] = importer
+}
+
+// Importers names of registered importers
+func Importers() []string {
+	importersMutex.RLock()
+	defer importersMutex.RUnlock()
+
+	var names []string
+	for name := range importers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Import import records with registered importer
+func Import(name string, r io.Reader) ([]Record, error) {
+	importersMutex.RLock()
+	importer, ok := importers[name]
+	importersMutex.RUnlock()
+
+	if !ok {
+		return nil, fmt.Errorf("reconcile: importer %q is not registered", name)
+	}
+	return importer.Import(r)
+}
+
+func init() {
+	Register("stripe", StripeImporter{})
+	Register("paygent", PaygentImporter{})
+}
+
+// zeroDecimalCurrencies currencies without minor unit
+var zeroDecimalCurrencies = map[string]bool{
+	"bif": true, "clp": true, "djf": true, "gnf": true, "jpy": true, "kmf": true, "krw": true, "mga": true,
+	"pyg": true, "rwf": true, "ugx": true, "vnd": true, "vuv": true, "xaf": true, "xof": true, "xpf": true,
+}
+
+// parseAmount parse decimal amount in major unit, like 10.50, into the smallest currency unit
+func parseAmount(value string, currency string) (int, error) {
+	value = strings.NewReplacer(",", "", " ", "").Replace(strings.TrimSpace(value))
+	if value == "" {
+		return 0, nil
+	}
+
+	f, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return 0, fmt.Errorf("reconcile: invalid amount %q", value)
+	}
+
+	if !zeroDecimalCurrencies[strings.ToLower(currency)] {
+		f *= 100
+	}
+	return int(math.Round(f)), nil
+}
+
+// csvHeader index of columns
+type csvHeader map[string]int
+
+func newCSVHeader(record []string) csvHeader {
+	header := csvHeader{}
+	for idx, name := range record {
+		header[strings.TrimSpace(strings.TrimPrefix(name, "\ufeff"))] = idx
+	}
+	return header
+}
+
+// Get get value of first existing column
+func (header csvHeader) Get(record []string, names ...string) string {
+	for _, name := range names {
+		if idx, ok := header[name]; ok && idx < len(record) {
+			return strings.TrimSpace(record[idx])
+		}
+	}
+	return ""
+}
@@ -0,0 +1,148 @@
+package reconcile
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/qor/gomerchant/gateways/paygent"
+	"golang.org/x/text/encoding/japanese"
+	"golang.org/x/text/transform"
+)
+
+// PaygentColumns column names of Paygent sales/settlement CSV, every field could have several names, the first existing column is used
+type PaygentColumns struct {
+	PaymentID   []string
+	TradingID   []string
+	Kind        []string
+	Amount      []string
+	Fee         []string
+	Date        []string
+	Description []string
+}
+
+// DefaultPaygentColumns columns of Paygent settlement CSV downloaded from merchant console
+var DefaultPaygentColumns = PaygentColumns{
+	PaymentID:   []string{"決済ID", "payment_id"},
+	TradingID:   []string{"マーチャント取引ID", "trading_id"},
+	Kind:        []string{"処理区分", "売上区分", "kind"},
+	Amount:      []string{"売上金額", "金額", "payment_amount"},
+	Fee:         []string{"手数料", "fee"},
+	Date:        []string{"売上日", "処理日", "date"},
+	Description: []string{"決済種別", "payment_type"},
+}
+
+// DefaultPaygentKinds record types of Paygent processing kinds
+var DefaultPaygentKinds = map[string]RecordType{
+	"売上":      Charge,
+	"売上確定":    Charge,
+	"取消":      Refund,
+	"売上取消":    Refund,
+	"返品":      Refund,
+	"減額":      Refund,
+	"チャージバック": Chargeback,
+	"手数料":     Fee,
+	"入金":      Payout,
+	"振込":      Payout,
+}
+
+// PaygentImporter import Paygent sales/settlement CSV encoded in Shift_JIS, amounts are in yen
+type PaygentImporter struct {
+	Columns PaygentColumns        // default DefaultPaygentColumns
+	Kinds   map[string]RecordType // default DefaultPaygentKinds
+	UTF8    bool                  // CSV is encoded in UTF-8
+}
+
+// Import import records
+func (importer PaygentImporter) Import(r io.Reader) ([]Record, error) {
+	var (
+		records []Record
+		header  csvHeader
+		columns = importer.Columns
+		kinds   = importer.Kinds
+	)
+
+	if columns.PaymentID == nil {
+		columns = DefaultPaygentColumns
+	}
+
+	if kinds == nil {
+		kinds = DefaultPaygentKinds
+	}
+
+	if !importer.UTF8 {
+		r = transform.NewReader(r, japanese.ShiftJIS.NewDecoder())
+	}
+
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+
+	for line := 1; ; line++ {
+		row, err := reader.Read()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+
+		if header == nil {
+			header = newCSVHeader(row)
+			continue
+		}
+
+		kind := header.Get(row, columns.Kind...)
+		record := Record{
+			Gateway:       "paygent",
+			Reference:     fmt.Sprint(line),
+			Type:          Adjustment,
+			TransactionID: header.Get(row, columns.PaymentID...),
+			OrderID:       header.Get(row, columns.TradingID...),
+			Currency:      "jpy",
+			Description:   strings.TrimSpace(header.Get(row, columns.Description...) + " " + kind),
+		}
+
+		if recordType, ok := kinds[kind]; ok {
+			record.Type = recordType
+		}
+
+		if record.Amount, err = parseAmount(header.Get(row, columns.Amount...), "jpy"); err == nil {
+			record.Fee, err = parseAmount(header.Get(row, columns.Fee...), "jpy")
+		}
+		if err != nil {
+			return nil, fmt.Errorf("reconcile: line %v: %w", line, err)
+		}
+
+		// cancellations and refunds are listed with positive amounts
+		if (record.Type == Refund || record.Type == Chargeback) && record.Amount > 0 {
+			record.Amount = -record.Amount
+		}
+
+		if record.Type == Fee && record.Fee == 0 {
+			record.Fee, record.Amount = record.Amount, 0
+			if record.Fee < 0 {
+				record.Fee = -record.Fee
+			}
+		}
+		record.Net = record.Amount - record.Fee
+
+		if date := header.Get(row, columns.Date...); date != "" {
+			if record.SettledAt, err = parsePaygentDate(date); err != nil {
+				return nil, fmt.Errorf("reconcile: line %v: %w", line, err)
+			}
+		}
+
+		records = append(records, record)
+	}
+	return records, nil
+}
+
+func parsePaygentDate(value string) (time.Time, error) {
+	for _, layout := range []string{"20060102", "2006/01/02", "2006-01-02", "20060102150405", "2006/01/02 15:04:05"} {
+		if t, err := time.ParseInLocation(layout, value, paygent.PaygentServerTimeZone); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("reconcile: invalid date %q", value)
+}
@@ -0,0 +1,283 @@
+// Package reconcile reconciles settlement reports of payment gateways with recorded transactions.
+//
+// Settlement reports are imported into Records with Importers, then Reconcile matches them against
+// transactions recorded when Authorize, Capture and Refund, and reports matched, missing, amount or currency mismatched,
+// duplicated, unexpected and fee lines.
+package reconcile
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// RecordType type of settlement record
+type RecordType string
+
+const (
+	Charge     RecordType = "charge"
+	Refund     RecordType = "refund"
+	Chargeback RecordType = "chargeback"
+	Fee        RecordType = "fee"
+	Adjustment RecordType = "adjustment"
+	Payout     RecordType = "payout"
+)
+
+// Record settlement line imported from gateway report, amounts are in the smallest currency unit, refunds are negative,
+// Fee is positive if it is charged by gateway, fee lines have zero Amount and their fee in Fee
+type Record struct {
+	Gateway       string
+	Reference     string // id of the line in report, like balance transaction id
+	Type          RecordType
+	TransactionID string
+	OrderID       string
+	Currency      string
+	Amount        int // gross amount
+	Fee           int
+	Net           int
+	SettledAt     time.Time
+	Description   string
+}
+
+// Transaction transaction recorded by application, Amount of refund is negative
+type Transaction struct {
+	TransactionID string
+	OrderID       string
+	Type          RecordType // Charge or Refund
+	Currency      string
+	Amount        int
+}
+
+// Match recorded transaction and its settlement records
+type Match struct {
+	Transaction Transaction
+	Records     []Record
+	Amount      int // settled amount of records
+	Fee         int
+}
+
+// Difference settled amount - recorded amount
+func (match Match) Difference() int {
+	return match.Amount - match.Transaction.Amount
+}
+
+// CurrencyMatched all records are settled in currency of the transaction
+func (match Match) CurrencyMatched() bool {
+	for _, record := range match.Records {
+		if record.Currency != "" && match.Transaction.Currency != "" && !strings.EqualFold(record.Currency, match.Transaction.Currency) {
+			return false
+		}
+	}
+	return true
+}
+
+// Report reconciliation report
+type Report struct {
+	Matched    []Match       // settled amount and currency equal recorded ones
+	Mismatched []Match       // settled amount or currency is different from recorded one
+	Missing    []Transaction // recorded, but not settled
+	Duplicates []Transaction // recorded again with the same transaction id and type, records are matched with the first one
+	Unexpected []Record      // settled, but not recorded
+	Fees       []Record      // fee lines, like gateway fees, not related to a transaction
+	Ignored    []Record      // payouts
+}
+
+// Reconcile match records against transactions, records are matched by transaction id and type first, then order id and type,
+// a record matched by order id goes to the first transaction of the order that isn't settled yet
+func Reconcile(transactions []Transaction, records []Record) Report {
+	var (
+		report     Report
+		matches    []Match
+		duplicated = map[int]bool{}
+		byID       = map[string]int{}
+		byOrder    = map[string][]int{}
+	)
+
+	for _, transaction := range transactions {
+		if transaction.TransactionID != "" {
+			key := matchKey(transaction.TransactionID, transaction.Type)
+			if idx, ok := byID[key]; ok {
+				duplicated[idx] = true
+				report.Duplicates = append(report.Duplicates, transaction)
+				continue
+			}
+			byID[key] = len(matches)
+		}
+		if transaction.OrderID != "" {
+			key := matchKey(transaction.OrderID, transaction.Type)
+			byOrder[key] = append(byOrder[key], len(matches))
+		}
+		matches = append(matches, Match{Transaction: transaction})
+	}
+
+	// byOrderID first transaction of the order that isn't settled yet, or the first one if all are settled
+	byOrderID := func(record Record) (int, bool) {
+		indexes := byOrder[matchKey(record.OrderID, record.Type)]
+		if record.OrderID == "" || len(indexes) == 0 {
+			return 0, false
+		}
+		for _, idx := range indexes {
+			if len(matches[idx].Records) == 0 {
+				return idx, true
+			}
+		}
+		return indexes[0], true
+	}
+
+	for _, record := range records {
+		switch record.Type {
+		case Payout:
+			report.Ignored = append(report.Ignored, record)
+			continue
+		case Fee:
+			report.Fees = append(report.Fees, record)
+			continue
+		}
+
+		idx, ok := byID[matchKey(record.TransactionID, record.Type)]
+		if !ok || record.TransactionID == "" {
+			idx, ok = byOrderID(record)
+		}
+
+		if !ok {
+			report.Unexpected = append(report.Unexpected, record)
+			continue
+		}
+
+		matches[idx].Records = append(matches[idx].Records, record)
+		matches[idx].Amount += record.Amount
+		matches[idx].Fee += record.Fee
+	}
+
+	for _, match := range matches {
+		switch {
+		case len(match.Records) == 0:
+			report.Missing = append(report.Missing, match.Transaction)
+		case match.Difference() == 0 && match.CurrencyMatched():
+			report.Matched = append(report.Matched, match)
+		default:
+			report.Mismatched = append(report.Mismatched, match)
+		}
+	}
+	return report
+}
+
+// matchKey transaction id or order id with type, as a charge and its refunds might share the same id
+func matchKey(id string, recordType RecordType) string {
+	return string(recordType) + ":" + id
+}
+
+// Balanced all records are matched
+func (report Report) Balanced() bool {
+	return len(report.Mismatched) == 0 && len(report.Missing) == 0 && len(report.Duplicates) == 0 && len(report.Unexpected) == 0
+}
+
+// TotalFees fees of matched transactions and fee lines by currency
+func (report Report) TotalFees() map[string]int {
+	fees := map[string]int{}
+	for _, matches := range [][]Match{report.Matched, report.Mismatched} {
+		for _, match := range matches {
+			fees[match.Transaction.Currency] += match.Fee
+		}
+	}
+	for _, record := range report.Fees {
+		fees[record.Currency] += record.Fee
+	}
+	return fees
+}
+
+// WriteTo write report as text tables
+func (report Report) WriteTo(w io.Writer) (int64, error) {
+	var (
+		counter = &countWriter{w: w}
+		writer  = tabwriter.NewWriter(counter, 0, 4, 2, ' ', 0)
+	)
+
+	section := func(title string, count int) {
+		fmt.Fprintf(writer, "\n%v (%v)\n", title, count)
+	}
+
+	var (
+		fees       = report.TotalFees()
+		currencies []string
+	)
+	for currency := range fees {
+		currencies = append(currencies, fmt.Sprintf("%v %v", currency, fees[currency]))
+	}
+	sort.Strings(currencies)
+
+	fmt.Fprintf(writer, "matched: %v, mismatched: %v, missing: %v, duplicates: %v, unexpected: %v, fee lines: %v, total fee: %v\n",
+		len(report.Matched), len(report.Mismatched), len(report.Missing), len(report.Duplicates), len(report.Unexpected), len(report.Fees), strings.Join(currencies, ", "))
+
+	section("MATCHED", len(report.Matched))
+	writeMatches(writer, report.Matched)
+
+	section("MISMATCHED", len(report.Mismatched))
+	writeMatches(writer, report.Mismatched)
+
+	section("MISSING", len(report.Missing))
+	writeTransactions(writer, report.Missing)
+
+	section("DUPLICATES", len(report.Duplicates))
+	writeTransactions(writer, report.Duplicates)
+
+	section("UNEXPECTED", len(report.Unexpected))
+	writeRecords(writer, report.Unexpected)
+
+	section("FEES", len(report.Fees))
+	writeRecords(writer, report.Fees)
+
+	err := writer.Flush()
+	return counter.n, err
+}
+
+func writeMatches(writer io.Writer, matches []Match) {
+	sorted := append([]Match{}, matches...)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].Transaction.TransactionID < sorted[j].Transaction.TransactionID })
+
+	fmt.Fprintln(writer, "TRANSACTION\tORDER\tTYPE\tCURRENCY\tRECORDED\tSETTLED\tDIFFERENCE\tFEE\tREFERENCES")
+	for _, match := range sorted {
+		var references []string
+		for _, record := range match.Records {
+			references = append(references, record.Reference)
+		}
+		transaction, currency := match.Transaction, match.Transaction.Currency
+		if !match.CurrencyMatched() {
+			// settled currencies, like `jpy (usd)`
+			var settled []string
+			for _, record := range match.Records {
+				settled = append(settled, record.Currency)
+			}
+			currency = fmt.Sprintf("%v (%v)", currency, strings.Join(settled, " "))
+		}
+		fmt.Fprintf(writer, "%v\t%v\t%v\t%v\t%v\t%v\t%v\t%v\t%v\n", transaction.TransactionID, transaction.OrderID, transaction.Type, currency, transaction.Amount, match.Amount, match.Difference(), match.Fee, strings.Join(references, " "))
+	}
+}
+
+func writeTransactions(writer io.Writer, transactions []Transaction) {
+	fmt.Fprintln(writer, "TRANSACTION\tORDER\tTYPE\tCURRENCY\tAMOUNT")
+	for _, transaction := range transactions {
+		fmt.Fprintf(writer, "%v\t%v\t%v\t%v\t%v\n", transaction.TransactionID, transaction.OrderID, transaction.Type, transaction.Currency, transaction.Amount)
+	}
+}
+
+func writeRecords(writer io.Writer, records []Record) {
+	fmt.Fprintln(writer, "GATEWAY\tREFERENCE\tTYPE\tTRANSACTION\tORDER\tCURRENCY\tAMOUNT\tFEE\tSETTLED AT\tDESCRIPTION")
+	for _, record := range records {
+		fmt.Fprintf(writer, "%v\t%v\t%v\t%v\t%v\t%v\t%v\t%v\t%v\t%v\n", record.Gateway, record.Reference, record.Type, record.TransactionID, record.OrderID, record.Currency, record.Amount, record.Fee, record.SettledAt.Format("2006-01-02"), record.Description)
+	}
+}
+
+type countWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (writer *countWriter) Write(p []byte) (int, error) {
+	n, err := writer.w.Write(p)
+	writer.n += int64(n)
+	return n, err
+}
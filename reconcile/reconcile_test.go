@@ -0,0 +1,172 @@
+package reconcile_test
+
+import (
+	"bytes"
+	"flag"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/qor/gomerchant/reconcile"
+	stripe "github.com/stripe/stripe-go"
+)
+
+var update = flag.Bool("update", false, "update golden files")
+
+func goldenFile(t *testing.T, name string, got []byte) []byte {
+	path := filepath.Join("testdata", name)
+	if *update {
+		if err := os.WriteFile(path, got, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return want
+}
+
+func importFile(t *testing.T, importer string, name string) []reconcile.Record {
+	file, err := os.Open(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	records, err := reconcile.Import(importer, file)
+	if err != nil {
+		t.Fatalf("failed to import %v, got %v", name, err)
+	}
+	return records
+}
+
+func TestReconcileStripe(t *testing.T) {
+	records := importFile(t, "stripe", "stripe_balance.csv")
+
+	report := reconcile.Reconcile([]reconcile.Transaction{
+		{TransactionID: "ch_1", OrderID: "order-1", Type: reconcile.Charge, Currency: "jpy", Amount: 1000},
+		{TransactionID: "ch_1", OrderID: "order-1", Type: reconcile.Refund, Currency: "jpy", Amount: -300},
+		{TransactionID: "ch_2", OrderID: "order-2", Type: reconcile.Charge, Currency: "jpy", Amount: 2500},
+		{TransactionID: "ch_3", OrderID: "order-3", Type: reconcile.Charge, Currency: "usd", Amount: 1050},
+		{TransactionID: "ch_4", OrderID: "order-4", Type: reconcile.Charge, Currency: "jpy", Amount: 800},
+	}, records)
+
+	if len(report.Matched) != 3 || len(report.Mismatched) != 1 || len(report.Missing) != 1 || len(report.Unexpected) != 1 || len(report.Fees) != 1 || len(report.Ignored) != 1 {
+		t.Errorf("report is not correct, got %+v", report)
+	}
+
+	if report.Balanced() {
+		t.Errorf("report should not be balanced")
+	}
+
+	var buf bytes.Buffer
+	report.WriteTo(&buf)
+	if want := goldenFile(t, "stripe_report.golden", buf.Bytes()); !bytes.Equal(buf.Bytes(), want) {
+		t.Errorf("report should be\n%s\nbut got\n%s", want, buf.Bytes())
+	}
+}
+
+func TestReconcilePaygent(t *testing.T) {
+	records := importFile(t, "paygent", "paygent_settlement.csv")
+
+	report := reconcile.Reconcile([]reconcile.Transaction{
+		{TransactionID: "10000001", OrderID: "order-1", Type: reconcile.Charge, Currency: "jpy", Amount: 1000},
+		{TransactionID: "10000002", OrderID: "order-2", Type: reconcile.Charge, Currency: "jpy", Amount: 1800},
+		{TransactionID: "10000003", OrderID: "order-1", Type: reconcile.Refund, Currency: "jpy", Amount: -300},
+		{TransactionID: "10000004", OrderID: "order-4", Type: reconcile.Charge, Currency: "jpy", Amount: 700},
+	}, records)
+
+	if fees := report.TotalFees(); fees["jpy"] != 1100+32+64 {
+		t.Errorf("total fee should be %v, but got %v", 1100+32+64, fees)
+	}
+
+	var buf bytes.Buffer
+	report.WriteTo(&buf)
+	if want := goldenFile(t, "paygent_report.golden", buf.Bytes()); !bytes.Equal(buf.Bytes(), want) {
+		t.Errorf("report should be\n%s\nbut got\n%s", want, buf.Bytes())
+	}
+}
+
+func TestMatchByOrderID(t *testing.T) {
+	report := reconcile.Reconcile(
+		[]reconcile.Transaction{{OrderID: "order-1", Type: reconcile.Charge, Amount: 1000}},
+		[]reconcile.Record{{TransactionID: "unknown", OrderID: "order-1", Type: reconcile.Charge, Amount: 600}, {OrderID: "order-1", Type: reconcile.Charge, Amount: 400}},
+	)
+
+	if !report.Balanced() || len(report.Matched) != 1 || len(report.Matched[0].Records) != 2 {
+		t.Errorf("records should be matched by order id, got %+v", report)
+	}
+}
+
+func TestDuplicateTransactions(t *testing.T) {
+	report := reconcile.Reconcile(
+		[]reconcile.Transaction{
+			{TransactionID: "ch_1", Type: reconcile.Charge, Currency: "jpy", Amount: 1000},
+			{TransactionID: "ch_1", Type: reconcile.Charge, Currency: "jpy", Amount: 1000},
+			{OrderID: "order-2", Type: reconcile.Charge, Currency: "jpy", Amount: 500},
+			{OrderID: "order-2", Type: reconcile.Charge, Currency: "jpy", Amount: 500},
+		},
+		[]reconcile.Record{
+			{TransactionID: "ch_1", Type: reconcile.Charge, Currency: "jpy", Amount: 1000},
+			{OrderID: "order-2", Type: reconcile.Charge, Currency: "jpy", Amount: 500},
+			{OrderID: "order-2", Type: reconcile.Charge, Currency: "jpy", Amount: 500},
+		},
+	)
+
+	if len(report.Matched) != 3 || len(report.Missing) != 0 || len(report.Duplicates) != 1 || report.Duplicates[0].TransactionID != "ch_1" || report.Balanced() {
+		t.Errorf("settled transaction should be matched and duplicate should be reported, got %+v", report)
+	}
+}
+
+func TestCurrencyMismatch(t *testing.T) {
+	report := reconcile.Reconcile(
+		[]reconcile.Transaction{{TransactionID: "ch_1", Type: reconcile.Charge, Currency: "jpy", Amount: 1000}},
+		[]reconcile.Record{{TransactionID: "ch_1", Type: reconcile.Charge, Currency: "usd", Amount: 1000}},
+	)
+
+	if len(report.Matched) != 0 || len(report.Mismatched) != 1 || report.Mismatched[0].CurrencyMatched() {
+		t.Errorf("record settled in another currency should be mismatched, got %+v", report)
+	}
+
+	if report := reconcile.Reconcile(
+		[]reconcile.Transaction{{TransactionID: "ch_1", Type: reconcile.Charge, Currency: "jpy", Amount: 1000}},
+		[]reconcile.Record{{TransactionID: "ch_1", Type: reconcile.Charge, Currency: "JPY", Amount: 1000}},
+	); len(report.Matched) != 1 {
+		t.Errorf("currency should be compared case-insensitively, got %+v", report)
+	}
+}
+
+func TestRegisterImporter(t *testing.T) {
+	reconcile.Register("custom", reconcile.ImporterFunc(func(r io.Reader) ([]reconcile.Record, error) {
+		return []reconcile.Record{{Gateway: "custom"}}, nil
+	}))
+
+	if records, err := reconcile.Import("custom", bytes.NewReader(nil)); err != nil || len(records) != 1 {
+		t.Errorf("should import with registered importer, got %v, %v", records, err)
+	}
+
+	if _, err := reconcile.Import("unknown", bytes.NewReader(nil)); err == nil {
+		t.Errorf("should fail with unknown importer")
+	}
+}
+
+func TestFromStripeBalanceTransaction(t *testing.T) {
+	record := reconcile.FromStripeBalanceTransaction(&stripe.BalanceTransaction{
+		ID:                "txn_1",
+		Amount:            -300,
+		Currency:          "jpy",
+		Net:               -300,
+		ReportingCategory: "refund",
+		Source: &stripe.BalanceTransactionSource{
+			ID:     "re_1",
+			Refund: &stripe.Refund{ID: "re_1", Charge: &stripe.Charge{ID: "ch_1", Metadata: map[string]string{"order_id": "order-1"}}},
+		},
+	})
+
+	if record.Type != reconcile.Refund || record.TransactionID != "ch_1" || record.OrderID != "order-1" || record.Amount != -300 {
+		t.Errorf("record is not correct, got %+v", record)
+	}
+}
@@ -0,0 +1,131 @@
+package reconcile
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	stripe "github.com/stripe/stripe-go"
+)
+
+var stripeCategories = map[string]RecordType{
+	"charge":                   Charge,
+	"refund":                   Refund,
+	"refund_failure":           Refund,
+	"partial_capture_reversal": Refund,
+	"dispute":                  Chargeback,
+	"dispute_reversal":         Chargeback,
+	"fee":                      Fee,
+	"network_cost":             Fee,
+	"payout":                   Payout,
+	"payout_reversal":          Payout,
+	"transfer":                 Payout,
+	"transfer_reversal":        Payout,
+}
+
+// StripeImporter import Stripe "Balance change from activity" itemized report (CSV),
+// order id is read from `payment_metadata[order_id]` column that comes from charge metadata
+type StripeImporter struct{}
+
+// Import import records
+func (StripeImporter) Import(r io.Reader) ([]Record, error) {
+	var (
+		records []Record
+		header  csvHeader
+		reader  = csv.NewReader(r)
+	)
+	reader.FieldsPerRecord = -1
+
+	for line := 1; ; line++ {
+		row, err := reader.Read()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+
+		if header == nil {
+			header = newCSVHeader(row)
+			continue
+		}
+
+		var (
+			currency = header.Get(row, "currency")
+			record   = Record{
+				Gateway:       "stripe",
+				Reference:     header.Get(row, "balance_transaction_id", "id"),
+				Type:          stripeRecordType(header.Get(row, "reporting_category", "type")),
+				TransactionID: header.Get(row, "charge_id", "source_id", "source"),
+				OrderID:       header.Get(row, "payment_metadata[order_id]", "order_id"),
+				Currency:      strings.ToLower(currency),
+				Description:   header.Get(row, "description"),
+			}
+		)
+
+		if record.Amount, err = parseAmount(header.Get(row, "gross", "amount"), currency); err == nil {
+			if record.Fee, err = parseAmount(header.Get(row, "fee"), currency); err == nil {
+				record.Net, err = parseAmount(header.Get(row, "net"), currency)
+			}
+		}
+		if err != nil {
+			return nil, fmt.Errorf("reconcile: line %v: %w", line, err)
+		}
+
+		if created := header.Get(row, "created_utc", "created"); created != "" {
+			if record.SettledAt, err = time.Parse("2006-01-02 15:04:05", created); err != nil {
+				return nil, fmt.Errorf("reconcile: line %v: invalid created time %q", line, created)
+			}
+		}
+
+		records = append(records, normalizeFeeRecord(record))
+	}
+	return records, nil
+}
+
+// FromStripeBalanceTransaction convert balance transaction from Stripe API, expand `source` to get charge id of refunds
+func FromStripeBalanceTransaction(transaction *stripe.BalanceTransaction) Record {
+	record := Record{
+		Gateway:     "stripe",
+		Reference:   transaction.ID,
+		Type:        stripeRecordType(string(transaction.ReportingCategory)),
+		Currency:    string(transaction.Currency),
+		Amount:      int(transaction.Amount),
+		Fee:         int(transaction.Fee),
+		Net:         int(transaction.Net),
+		SettledAt:   time.Unix(transaction.Created, 0).UTC(),
+		Description: transaction.Description,
+	}
+
+	if record.Type == "" {
+		record.Type = stripeRecordType(string(transaction.Type))
+	}
+
+	if source := transaction.Source; source != nil {
+		record.TransactionID = source.ID
+		switch {
+		case source.Charge != nil:
+			record.OrderID = source.Charge.Metadata["order_id"]
+		case source.Refund != nil && source.Refund.Charge != nil:
+			record.TransactionID = source.Refund.Charge.ID
+			record.OrderID = source.Refund.Charge.Metadata["order_id"]
+		}
+	}
+	return normalizeFeeRecord(record)
+}
+
+func stripeRecordType(category string) RecordType {
+	if recordType, ok := stripeCategories[category]; ok {
+		return recordType
+	}
+	return Adjustment
+}
+
+// normalizeFeeRecord fee lines keep their fee in Fee
+func normalizeFeeRecord(record Record) Record {
+	if record.Type == Fee {
+		record.Fee, record.Amount = record.Fee-record.Amount, 0
+	}
+	return record
+}
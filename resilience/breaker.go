@@ -0,0 +1,282 @@
+// Package resilience protects gateways with a circuit breaker and a token-bucket rate limiter,
+// they fail fast instead of waiting on a gateway that is down, like Paygent during a maintenance window.
+package resilience
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/qor/gomerchant/gateways/paygent"
+	stripe "github.com/stripe/stripe-go"
+)
+
+// State circuit breaker state
+type State int
+
+const (
+	Closed   State = iota // requests are sent, transient errors are counted
+	Open                  // requests fail fast with ErrOpen
+	HalfOpen              // a few probe requests are sent to check if the gateway is back
+)
+
+func (state State) String() string {
+	switch state {
+	case Open:
+		return "open"
+	case HalfOpen:
+		return "half-open"
+	}
+	return "closed"
+}
+
+// ErrOpen circuit breaker is open, use errors.As with *OpenError to know when it will be half-open
+var ErrOpen = errors.New("resilience: circuit breaker is open")
+
+// OpenError error of requests rejected by an open circuit breaker
+type OpenError struct {
+	State      State
+	RetryAfter time.Duration // duration until half-open, zero if it is half-open and probes are running
+}
+
+func (err *OpenError) Error() string {
+	return fmt.Sprintf("%v, state %v, retry after %v", ErrOpen, err.State, err.RetryAfter)
+}
+
+// Is open error is ErrOpen
+func (err *OpenError) Is(target error) bool {
+	return target == ErrOpen
+}
+
+// IsTransient default transient errors, like timeouts, network errors, Stripe's API errors, Paygent's HTTP 5xx and system errors,
+// declines or invalid requests are not transient, they don't open circuit breaker
+func IsTransient(err error) bool {
+	var (
+		netErr         net.Error
+		stripeErr      *stripe.Error
+		paygentStatus  paygent.StatusError
+		paygentFailure paygent.ResponseError
+	)
+
+	switch {
+	case err == nil:
+		return false
+	case errors.Is(err, context.DeadlineExceeded), errors.As(err, &netErr):
+		return true
+	case errors.As(err, &stripeErr):
+		return stripeErr.Type == stripe.ErrorTypeAPI || stripeErr.Type == stripe.ErrorTypeAPIConnection || stripeErr.Type == stripe.ErrorTypeRateLimit
+	case errors.As(err, &paygentStatus):
+		return paygentStatus.StatusCode >= http.StatusInternalServerError || paygentStatus.StatusCode == http.StatusTooManyRequests
+	case errors.As(err, &paygentFailure):
+		return paygentFailure.SystemError()
+	}
+	return false
+}
+
+// Breaker circuit breaker, it opens when rate of transient errors in window reaches FailureRate,
+// after OpenTimeout, it is half-open and sends HalfOpenRequests probes, closes if all of them succeed, otherwise opens again
+type Breaker struct {
+	Window           time.Duration // default 1 minute
+	MinRequests      int           // minimum requests in window to open, default 10
+	FailureRate      float64       // default 0.5
+	OpenTimeout      time.Duration // default 30 seconds
+	HalfOpenRequests int           // default 1
+
+	IsTransient   func(err error) bool // default IsTransient
+	OnStateChange func(from, to State)
+	Now           func() time.Time // default time.Now
+
+	mutex     sync.Mutex
+	state     State
+	openedAt  time.Time
+	outcomes  []outcome
+	probes    int // probes running when half-open
+	succeeded int // succeeded probes when half-open
+	changes   [][2]State
+	epoch     int // incremented when state changes, results of requests started in previous states are ignored
+}
+
+type outcome struct {
+	at     time.Time
+	failed bool
+}
+
+// NewBreaker initialize circuit breaker with default settings
+func NewBreaker() *Breaker {
+	return &Breaker{}
+}
+
+// State current state
+func (breaker *Breaker) State() State {
+	breaker.mutex.Lock()
+	defer breaker.unlock()
+	breaker.refresh(breaker.now())
+	return breaker.state
+}
+
+// Do call fn if breaker allows, ErrOpen is returned without calling fn if it is open
+func (breaker *Breaker) Do(fn func() error) error {
+	done, err := breaker.Allow()
+	if err != nil {
+		return err
+	}
+	err = fn()
+	done(err)
+	return err
+}
+
+// Allow check if a request is allowed, call done with result of the request
+func (breaker *Breaker) Allow() (done func(err error), err error) {
+	breaker.mutex.Lock()
+	defer breaker.unlock()
+
+	now := breaker.now()
+	breaker.refresh(now)
+
+	switch breaker.state {
+	case Open:
+		return nil, &OpenError{State: Open, RetryAfter: breaker.openedAt.Add(breaker.openTimeout()).Sub(now)}
+	case HalfOpen:
+		if breaker.probes >= breaker.halfOpenRequests() {
+			return nil, &OpenError{State: HalfOpen}
+		}
+		breaker.probes++
+	}
+
+	epoch := breaker.epoch
+	return func(err error) { breaker.record(epoch, err) }, nil
+}
+
+func (breaker *Breaker) record(epoch int, err error) {
+	breaker.mutex.Lock()
+	defer breaker.unlock()
+
+	var (
+		now    = breaker.now()
+		failed = breaker.isTransient(err)
+	)
+
+	// state changed while request was running, its result is stale
+	if epoch != breaker.epoch {
+		return
+	}
+
+	if breaker.state == HalfOpen {
+		breaker.probes--
+		if failed {
+			breaker.setState(Open, now)
+			return
+		}
+		if breaker.succeeded++; breaker.succeeded >= breaker.halfOpenRequests() {
+			breaker.setState(Closed, now)
+		}
+		return
+	}
+
+	breaker.outcomes = append(breaker.outcomes, outcome{at: now, failed: failed})
+	breaker.prune(now)
+
+	var failures int
+	for _, o := range breaker.outcomes {
+		if o.failed {
+			failures++
+		}
+	}
+
+	if total := len(breaker.outcomes); failed && total >= breaker.minRequests() && float64(failures)/float64(total) >= breaker.failureRate() {
+		breaker.setState(Open, now)
+	}
+}
+
+// refresh switch open breaker to half-open after timeout
+func (breaker *Breaker) refresh(now time.Time) {
+	if breaker.state == Open && !now.Before(breaker.openedAt.Add(breaker.openTimeout())) {
+		breaker.setState(HalfOpen, now)
+	}
+}
+
+func (breaker *Breaker) setState(state State, now time.Time) {
+	from := breaker.state
+	breaker.state, breaker.outcomes, breaker.probes, breaker.succeeded = state, nil, 0, 0
+	if state == Open {
+		breaker.openedAt = now
+	}
+
+	if from != state {
+		breaker.epoch++
+		breaker.changes = append(breaker.changes, [2]State{from, state})
+	}
+}
+
+// unlock unlock breaker, then call OnStateChange with state changes, so callbacks could use the breaker
+func (breaker *Breaker) unlock() {
+	changes := breaker.changes
+	breaker.changes = nil
+	breaker.mutex.Unlock()
+
+	if breaker.OnStateChange != nil {
+		for _, change := range changes {
+			breaker.OnStateChange(change[0], change[1])
+		}
+	}
+}
+
+// prune remove outcomes out of window
+func (breaker *Breaker) prune(now time.Time) {
+	window := breaker.Window
+	if window <= 0 {
+		window = time.Minute
+	}
+
+	idx := 0
+	for idx < len(breaker.outcomes) && now.Sub(breaker.outcomes[idx].at) > window {
+		idx++
+	}
+	breaker.outcomes = breaker.outcomes[idx:]
+}
+
+func (breaker *Breaker) now() time.Time {
+	if breaker.Now != nil {
+		return breaker.Now()
+	}
+	return time.Now()
+}
+
+func (breaker *Breaker) isTransient(err error) bool {
+	if breaker.IsTransient != nil {
+		return err != nil && breaker.IsTransient(err)
+	}
+	return IsTransient(err)
+}
+
+func (breaker *Breaker) minRequests() int {
+	if breaker.MinRequests > 0 {
+		return breaker.MinRequests
+	}
+	return 10
+}
+
+func (breaker *Breaker) failureRate() float64 {
+	if breaker.FailureRate > 0 {
+		return breaker.FailureRate
+	}
+	return 0.5
+}
+
+func (breaker *Breaker) openTimeout() time.Duration {
+	if breaker.OpenTimeout > 0 {
+		return breaker.OpenTimeout
+	}
+	return 30 * time.Second
+}
+
+func (breaker *Breaker) halfOpenRequests() int {
+	if breaker.HalfOpenRequests > 0 {
+		return breaker.HalfOpenRequests
+	}
+	return 1
+}
@@ -0,0 +1,182 @@
+package resilience
+
+import (
+	"context"
+
+	"github.com/qor/gomerchant"
+)
+
+// Guard guard requests to a gateway, Breaker and Limiter are guards
+type Guard interface {
+	Do(fn func() error) error
+}
+
+// ContextGuard guard that stops waiting when context of request is done, like Limiter
+type ContextGuard interface {
+	Guard
+	DoContext(ctx context.Context, fn func() error) error
+}
+
+// guard call fn with guards, the first guard is the outermost
+func guard(ctx context.Context, guards []Guard, fn func() error) error {
+	for idx := len(guards) - 1; idx >= 0; idx-- {
+		g, inner := guards[idx], fn
+		if contextGuard, ok := g.(ContextGuard); ok {
+			fn = func() error { return contextGuard.DoContext(ctx, inner) }
+		} else {
+			fn = func() error { return g.Do(inner) }
+		}
+	}
+	return fn()
+}
+
+// Gateway guard operations of wrapped gateway
+//
+//	breaker := resilience.NewBreaker()
+//	gateway := resilience.NewGateway(Paygent, resilience.NewLimiter(20, 5), breaker)
+type Gateway struct {
+	gomerchant.PaymentGateway
+	Guards []Guard
+
+	ctx context.Context
+}
+
+var _ gomerchant.PaymentGateway = &Gateway{}
+
+// NewGateway wrap gateway with guards, the first guard is the outermost
+func NewGateway(gateway gomerchant.PaymentGateway, guards ...Guard) *Gateway {
+	return &Gateway{PaymentGateway: gateway, Guards: guards}
+}
+
+// WithContext returns a Gateway that stops waiting for guards when ctx is done, like cancelled requests
+func (gateway *Gateway) WithContext(ctx context.Context) *Gateway {
+	copied := *gateway
+	copied.ctx = ctx
+	return &copied
+}
+
+func (gateway *Gateway) context() context.Context {
+	if gateway.ctx != nil {
+		return gateway.ctx
+	}
+	return context.Background()
+}
+
+// Authorize authorize
+func (gateway *Gateway) Authorize(amount uint64, params gomerchant.AuthorizeParams) (response gomerchant.AuthorizeResponse, err error) {
+	err = guard(gateway.context(), gateway.Guards, func() error {
+		response, err = gateway.PaymentGateway.Authorize(amount, params)
+		return err
+	})
+	return
+}
+
+// CompleteAuthorize complete authorize
+func (gateway *Gateway) CompleteAuthorize(paymentID string, params gomerchant.CompleteAuthorizeParams) (response gomerchant.CompleteAuthorizeResponse, err error) {
+	err = guard(gateway.context(), gateway.Guards, func() error {
+		response, err = gateway.PaymentGateway.CompleteAuthorize(paymentID, params)
+		return err
+	})
+	return
+}
+
+// Capture capture
+func (gateway *Gateway) Capture(transactionID string, params gomerchant.CaptureParams) (response gomerchant.CaptureResponse, err error) {
+	err = guard(gateway.context(), gateway.Guards, func() error {
+		response, err = gateway.PaymentGateway.Capture(transactionID, params)
+		return err
+	})
+	return
+}
+
+// Refund refund
+func (gateway *Gateway) Refund(transactionID string, amount uint, params gomerchant.RefundParams) (response gomerchant.RefundResponse, err error) {
+	err = guard(gateway.context(), gateway.Guards, func() error {
+		response, err = gateway.PaymentGateway.Refund(transactionID, amount, params)
+		return err
+	})
+	return
+}
+
+// Void void
+func (gateway *Gateway) Void(transactionID string, params gomerchant.VoidParams) (response gomerchant.VoidResponse, err error) {
+	err = guard(gateway.context(), gateway.Guards, func() error {
+		response, err = gateway.PaymentGateway.Void(transactionID, params)
+		return err
+	})
+	return
+}
+
+// Query query
+func (gateway *Gateway) Query(transactionID string) (transaction gomerchant.Transaction, err error) {
+	err = guard(gateway.context(), gateway.Guards, func() error {
+		transaction, err = gateway.PaymentGateway.Query(transactionID)
+		return err
+	})
+	return
+}
+
+// CreditCardManager guard operations of wrapped credit card manager
+type CreditCardManager struct {
+	gomerchant.CreditCardManager
+	Guards []Guard
+
+	ctx context.Context
+}
+
+var _ gomerchant.CreditCardManager = &CreditCardManager{}
+
+// NewCreditCardManager wrap credit card manager with guards, the first guard is the outermost
+func NewCreditCardManager(manager gomerchant.CreditCardManager, guards ...Guard) *CreditCardManager {
+	return &CreditCardManager{CreditCardManager: manager, Guards: guards}
+}
+
+// WithContext returns a CreditCardManager that stops waiting for guards when ctx is done
+func (manager *CreditCardManager) WithContext(ctx context.Context) *CreditCardManager {
+	copied := *manager
+	copied.ctx = ctx
+	return &copied
+}
+
+func (manager *CreditCardManager) context() context.Context {
+	if manager.ctx != nil {
+		return manager.ctx
+	}
+	return context.Background()
+}
+
+// CreateCreditCard create credit card
+func (manager *CreditCardManager) CreateCreditCard(params gomerchant.CreateCreditCardParams) (response gomerchant.CreditCardResponse, err error) {
+	err = guard(manager.context(), manager.Guards, func() error {
+		response, err = manager.CreditCardManager.CreateCreditCard(params)
+		return err
+	})
+	return
+}
+
+// GetCreditCard get credit card
+func (manager *CreditCardManager) GetCreditCard(params gomerchant.GetCreditCardParams) (response gomerchant.GetCreditCardResponse, err error) {
+	err = guard(manager.context(), manager.Guards, func() error {
+		response, err = manager.CreditCardManager.GetCreditCard(params)
+		return err
+	})
+	return
+}
+
+// ListCreditCards list credit cards
+func (manager *CreditCardManager) ListCreditCards(params gomerchant.ListCreditCardsParams) (response gomerchant.ListCreditCardsResponse, err error) {
+	err = guard(manager.context(), manager.Guards, func() error {
+		response, err = manager.CreditCardManager.ListCreditCards(params)
+		return err
+	})
+	return
+}
+
+// DeleteCreditCard delete credit card
+func (manager *CreditCardManager) DeleteCreditCard(params gomerchant.DeleteCreditCardParams) (response gomerchant.DeleteCreditCardResponse, err error) {
+	err = guard(manager.context(), manager.Guards, func() error {
+		response, err = manager.CreditCardManager.DeleteCreditCard(params)
+		return err
+	})
+	return
+}
@@ -0,0 +1,156 @@
+package resilience
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// ErrRateLimited request is rejected by rate limiter, use errors.As with *RateLimitedError to know when to retry
+var ErrRateLimited = errors.New("resilience: rate limited")
+
+// RateLimitedError error of requests rejected by rate limiter
+type RateLimitedError struct {
+	RetryAfter time.Duration
+}
+
+func (err *RateLimitedError) Error() string {
+	return fmt.Sprintf("%v, retry after %v", ErrRateLimited, err.RetryAfter)
+}
+
+// Is rate limited error is ErrRateLimited
+func (err *RateLimitedError) Is(target error) bool {
+	return target == ErrRateLimited
+}
+
+// Limiter token-bucket rate limiter, the bucket holds up to Burst tokens and is refilled with Rate tokens per second,
+// a request takes a token, it waits up to MaxWait for a token, otherwise fails fast with ErrRateLimited
+type Limiter struct {
+	Rate    float64 // tokens per second
+	Burst   int     // default 1
+	MaxWait time.Duration
+
+	// OnThrottle called with true when limiter starts rejecting requests, and with false when a request is allowed again
+	OnThrottle func(throttled bool)
+	Now        func() time.Time                     // default time.Now
+	After      func(time.Duration) <-chan time.Time // wait for a token, default a timer
+
+	mutex     sync.Mutex
+	tokens    float64
+	updatedAt time.Time
+	throttled bool
+}
+
+// NewLimiter initialize limiter, allows rate requests per second with burst
+func NewLimiter(rate float64, burst int) *Limiter {
+	return &Limiter{Rate: rate, Burst: burst}
+}
+
+// Do call fn if a token is taken in MaxWait, otherwise ErrRateLimited is returned without calling fn
+func (limiter *Limiter) Do(fn func() error) error {
+	return limiter.DoContext(context.Background(), fn)
+}
+
+// DoContext call fn if a token is taken in MaxWait, stop waiting when ctx is done
+func (limiter *Limiter) DoContext(ctx context.Context, fn func() error) error {
+	if err := limiter.Wait(ctx); err != nil {
+		return err
+	}
+	return fn()
+}
+
+// Allow take a token if it is available now
+func (limiter *Limiter) Allow() bool {
+	_, ok := limiter.reserve(0)
+	return ok
+}
+
+// Wait take a token, wait up to MaxWait for it, or returns error of ctx if it is done before the token is available
+func (limiter *Limiter) Wait(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	wait, ok := limiter.reserve(limiter.MaxWait)
+	if !ok {
+		return &RateLimitedError{RetryAfter: wait}
+	}
+
+	if wait > 0 {
+		var ready <-chan time.Time
+		if limiter.After != nil {
+			ready = limiter.After(wait)
+		} else {
+			timer := time.NewTimer(wait)
+			defer timer.Stop()
+			ready = timer.C
+		}
+
+		select {
+		case <-ready:
+		case <-ctx.Done():
+			limiter.cancel()
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
+// cancel give back token reserved by a request that stopped waiting
+func (limiter *Limiter) cancel() {
+	limiter.mutex.Lock()
+	defer limiter.mutex.Unlock()
+	limiter.tokens++
+}
+
+// reserve take a token if it is available in maxWait, tokens could be negative when they are reserved by waiting requests,
+// returns duration to wait for the token
+func (limiter *Limiter) reserve(maxWait time.Duration) (time.Duration, bool) {
+	limiter.mutex.Lock()
+
+	var (
+		now   = time.Now()
+		burst = float64(limiter.Burst)
+	)
+	if limiter.Now != nil {
+		now = limiter.Now()
+	}
+	if burst <= 0 {
+		burst = 1
+	}
+
+	if limiter.updatedAt.IsZero() {
+		limiter.tokens = burst
+	} else if elapsed := now.Sub(limiter.updatedAt); elapsed > 0 {
+		limiter.tokens += elapsed.Seconds() * limiter.Rate
+		if limiter.tokens > burst {
+			limiter.tokens = burst
+		}
+	}
+	limiter.updatedAt = now
+
+	var wait time.Duration
+	if limiter.tokens < 1 {
+		if limiter.Rate <= 0 {
+			wait = time.Duration(1<<63 - 1)
+		} else {
+			wait = time.Duration((1 - limiter.tokens) / limiter.Rate * float64(time.Second))
+		}
+	}
+
+	ok := wait <= maxWait
+	if ok {
+		limiter.tokens--
+	}
+
+	changed := limiter.throttled == ok
+	limiter.throttled = !ok
+	limiter.mutex.Unlock()
+
+	if changed && limiter.OnThrottle != nil {
+		limiter.OnThrottle(!ok)
+	}
+	return wait, ok
+}
@@ -0,0 +1,22 @@
+package resilience
+
+import (
+	"context"
+
+	"github.com/qor/gomerchant/gateways/paygent"
+)
+
+// PaygentInterceptor guard every telegram sent to Paygent, including telegrams sent with Request that Gateway doesn't guard,
+// the first guard is the outermost, guards stop waiting when context of Paygent.WithContext is done.
+// Don't use the same guards with Gateway wrapping the Paygent, or requests are counted twice
+//
+//	Paygent.Use(resilience.PaygentInterceptor(limiter, breaker))
+func PaygentInterceptor(guards ...Guard) paygent.Interceptor {
+	return func(ctx context.Context, telegramKind string, next func(context.Context) (paygent.Response, error)) (response paygent.Response, err error) {
+		err = guard(ctx, guards, func() error {
+			response, err = next(ctx)
+			return err
+		})
+		return
+	}
+}
@@ -0,0 +1,240 @@
+package resilience_test
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/qor/gomerchant"
+	"github.com/qor/gomerchant/gateways/paygent/paygenttest"
+	"github.com/qor/gomerchant/resilience"
+)
+
+type clock struct{ now time.Time }
+
+func (c *clock) Now() time.Time               { return c.now }
+func (c *clock) Sleep(duration time.Duration) { c.now = c.now.Add(duration) }
+
+// After advance clock and return a ready channel
+func (c *clock) After(duration time.Duration) <-chan time.Time {
+	c.Sleep(duration)
+	ready := make(chan time.Time, 1)
+	ready <- c.now
+	return ready
+}
+
+var errTimeout error = &net.OpError{Op: "dial", Err: errors.New("i/o timeout")}
+
+func TestBreaker(t *testing.T) {
+	var (
+		c       = &clock{now: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)}
+		changes []string
+		breaker = &resilience.Breaker{MinRequests: 4, FailureRate: 0.5, OpenTimeout: 10 * time.Second, Now: c.Now}
+	)
+	breaker.OnStateChange = func(from, to resilience.State) {
+		changes = append(changes, from.String()+"->"+to.String()+"("+breaker.State().String()+")")
+	}
+
+	// declines are not transient
+	for _, err := range []error{nil, gomerchant.ErrCardDeclined, errTimeout} {
+		breaker.Do(func() error { return err })
+	}
+	if breaker.State() != resilience.Closed {
+		t.Fatalf("breaker should be closed before min requests, got %v", breaker.State())
+	}
+
+	breaker.Do(func() error { return errTimeout })
+	if breaker.State() != resilience.Open {
+		t.Fatalf("breaker should be open when failure rate is reached, got %v", breaker.State())
+	}
+
+	var called bool
+	err := breaker.Do(func() error { called = true; return nil })
+	var openErr *resilience.OpenError
+	if called || !errors.Is(err, resilience.ErrOpen) || !errors.As(err, &openErr) || openErr.RetryAfter != 10*time.Second {
+		t.Fatalf("open breaker should fail fast, got %v, called %v", err, called)
+	}
+
+	c.Sleep(10 * time.Second)
+	done, err := breaker.Allow()
+	if err != nil {
+		t.Fatalf("half-open breaker should allow a probe, got %v", err)
+	}
+	if _, err := breaker.Allow(); !errors.Is(err, resilience.ErrOpen) {
+		t.Errorf("half-open breaker should only allow one probe, got %v", err)
+	}
+	done(errTimeout)
+	if breaker.State() != resilience.Open {
+		t.Fatalf("failed probe should open breaker again, got %v", breaker.State())
+	}
+
+	c.Sleep(10 * time.Second)
+	breaker.Do(func() error { return nil })
+	if breaker.State() != resilience.Closed {
+		t.Fatalf("succeeded probe should close breaker, got %v", breaker.State())
+	}
+
+	expected := []string{"closed->open(open)", "open->half-open(half-open)", "half-open->open(open)", "open->half-open(half-open)", "half-open->closed(closed)"}
+	if len(changes) != len(expected) {
+		t.Fatalf("state changes should be %v, but got %v", expected, changes)
+	}
+	for idx := range expected {
+		if changes[idx] != expected[idx] {
+			t.Errorf("state changes should be %v, but got %v", expected, changes)
+			break
+		}
+	}
+}
+
+func TestBreakerWindow(t *testing.T) {
+	c := &clock{now: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)}
+	breaker := &resilience.Breaker{MinRequests: 2, Window: time.Minute, Now: c.Now}
+
+	breaker.Do(func() error { return errTimeout })
+	c.Sleep(2 * time.Minute)
+	breaker.Do(func() error { return errTimeout })
+	if breaker.State() != resilience.Closed {
+		t.Errorf("failures out of window should not be counted, got %v", breaker.State())
+	}
+}
+
+func TestLimiter(t *testing.T) {
+	var (
+		c         = &clock{now: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)}
+		throttles []bool
+		limiter   = &resilience.Limiter{Rate: 2, Burst: 2, Now: c.Now, After: c.After}
+	)
+	limiter.OnThrottle = func(throttled bool) { throttles = append(throttles, throttled) }
+
+	if !limiter.Allow() || !limiter.Allow() {
+		t.Fatalf("limiter should allow burst")
+	}
+
+	var rateLimitedErr *resilience.RateLimitedError
+	if err := limiter.Do(func() error { return nil }); !errors.Is(err, resilience.ErrRateLimited) || !errors.As(err, &rateLimitedErr) || rateLimitedErr.RetryAfter != 500*time.Millisecond {
+		t.Fatalf("limiter should fail fast when bucket is empty, got %v", err)
+	}
+
+	limiter.MaxWait = time.Second
+	start := c.now
+	if err := limiter.Wait(context.Background()); err != nil || c.now.Sub(start) != 500*time.Millisecond {
+		t.Fatalf("limiter should wait for a token, got %v, waited %v", err, c.now.Sub(start))
+	}
+
+	if len(throttles) != 2 || !throttles[0] || throttles[1] {
+		t.Errorf("throttle changes are not correct, got %v", throttles)
+	}
+}
+
+type fakeGateway struct {
+	gomerchant.PaymentGateway
+	called *bool
+}
+
+func (gateway fakeGateway) Authorize(amount uint64, params gomerchant.AuthorizeParams) (gomerchant.AuthorizeResponse, error) {
+	*gateway.called = true
+	return gomerchant.AuthorizeResponse{}, nil
+}
+
+func TestLimiterWithCanceledContext(t *testing.T) {
+	var (
+		limiter = &resilience.Limiter{Rate: 0.1, Burst: 1, MaxWait: time.Minute}
+		called  bool
+	)
+	if !limiter.Allow() {
+		t.Fatalf("limiter should allow burst")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	gateway := resilience.NewGateway(fakeGateway{called: &called}, limiter).WithContext(ctx)
+	if _, err := gateway.Authorize(1000, gomerchant.AuthorizeParams{}); !errors.Is(err, context.DeadlineExceeded) || called {
+		t.Errorf("request should stop waiting when context is done, got %v, called %v", err, called)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("request should not wait for a token after context is done, waited %v", elapsed)
+	}
+
+	var rateLimitedErr *resilience.RateLimitedError
+	limiter.MaxWait = 0
+	if err := limiter.Do(func() error { return nil }); !errors.As(err, &rateLimitedErr) || rateLimitedErr.RetryAfter > 10*time.Second {
+		t.Errorf("token reserved by canceled request should be given back, got %v", err)
+	}
+}
+
+func TestGatewayWithPaygentTimeout(t *testing.T) {
+	server := paygenttest.NewServer()
+	defer server.Close()
+
+	client := server.Paygent()
+	client.Config.Timeout = 50 * time.Millisecond
+	server.InjectFailure("020", paygenttest.Failure{Delay: 500 * time.Millisecond})
+
+	var opened bool
+	breaker := &resilience.Breaker{MinRequests: 2, OnStateChange: func(from, to resilience.State) { opened = to == resilience.Open }}
+	gateway := resilience.NewGateway(client, resilience.NewLimiter(100, 10), breaker)
+
+	params := gomerchant.AuthorizeParams{
+		Currency: "JPY",
+		OrderID:  "order-1",
+		PaymentMethod: &gomerchant.PaymentMethod{
+			CreditCard: &gomerchant.CreditCard{Name: "VISA", Number: "4242424242424242", ExpMonth: 1, ExpYear: uint(time.Now().Year() + 1), CVC: "123"},
+		},
+	}
+
+	for i := 0; i < 2; i++ {
+		if _, err := gateway.Authorize(1000, params); err == nil || errors.Is(err, resilience.ErrOpen) {
+			t.Fatalf("authorize should time out, got %v", err)
+		}
+	}
+
+	start := time.Now()
+	if _, err := gateway.Authorize(1000, params); !errors.Is(err, resilience.ErrOpen) || !opened {
+		t.Fatalf("breaker should be open after timeouts, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 40*time.Millisecond {
+		t.Errorf("open breaker should fail fast, but took %v", elapsed)
+	}
+}
+
+func TestPaygentInterceptorWithServiceUnavailable(t *testing.T) {
+	server := paygenttest.NewServer()
+	defer server.Close()
+
+	client := server.Paygent()
+	breaker := &resilience.Breaker{MinRequests: 2}
+	client.Use(resilience.PaygentInterceptor(breaker))
+
+	server.InjectFailure("094", paygenttest.Failure{StatusCode: http.StatusServiceUnavailable})
+	for i := 0; i < 2; i++ {
+		if _, err := client.Request("094", gomerchant.Params{"payment_id": "10000001"}); !resilience.IsTransient(err) {
+			t.Fatalf("503 should be transient, got %v", err)
+		}
+	}
+
+	server.ClearFailures()
+	if _, err := client.Request("094", gomerchant.Params{"payment_id": "10000001"}); !errors.Is(err, resilience.ErrOpen) {
+		t.Errorf("breaker should be open after 503s, got %v", err)
+	}
+}
+
+func TestIsTransientPaygentErrors(t *testing.T) {
+	server := paygenttest.NewServer()
+	defer server.Close()
+	client := server.Paygent()
+
+	server.InjectFailure("094", paygenttest.Failure{ResponseCode: "E9999", Times: 1})
+	if _, err := client.Request("094", gomerchant.Params{"payment_id": "10000001"}); !resilience.IsTransient(err) {
+		t.Errorf("system error should be transient, got %v", err)
+	}
+
+	// payment is not found
+	if _, err := client.Request("094", gomerchant.Params{"payment_id": "10000001"}); err == nil || resilience.IsTransient(err) {
+		t.Errorf("failed telegram should not be transient, got %v", err)
+	}
+}
@@ -0,0 +1,66 @@
+package risk
+
+import (
+	"strings"
+
+	"github.com/qor/gomerchant"
+)
+
+const (
+	// DecisionParam key of decision in params of authorize response
+	DecisionParam = "risk_decision"
+	// ReasonsParam key of reasons in params of authorize response, reasons are joined with "; "
+	ReasonsParam = "risk_reasons"
+)
+
+// Gateway screens payments with engine before they are authorized by the wrapped gateway, denied payments are not sent,
+// reviewed payments are authorized with decision and reasons in response params, they should be reviewed before captured
+type Gateway struct {
+	gomerchant.PaymentGateway
+	Engine *Engine
+
+	// OnReview called before a reviewed payment is authorized, return an error to stop it
+	OnReview func(amount uint64, params gomerchant.AuthorizeParams, result Result) error
+}
+
+var _ gomerchant.PaymentGateway = &Gateway{}
+
+// NewGateway wrap gateway with engine
+func NewGateway(gateway gomerchant.PaymentGateway, engine *Engine) *Gateway {
+	return &Gateway{PaymentGateway: gateway, Engine: engine}
+}
+
+// Authorize evaluate payment, then authorize it with wrapped gateway if it isn't denied
+func (gateway *Gateway) Authorize(amount uint64, params gomerchant.AuthorizeParams) (gomerchant.AuthorizeResponse, error) {
+	result, err := gateway.Engine.Evaluate(amount, params)
+	if err != nil {
+		return gomerchant.AuthorizeResponse{}, err
+	}
+
+	if result.Decision == Deny {
+		return gomerchant.AuthorizeResponse{Params: resultParams(result)}, &DeniedError{Result: result}
+	}
+
+	if result.Decision == Review && gateway.OnReview != nil {
+		if err := gateway.OnReview(amount, params, result); err != nil {
+			return gomerchant.AuthorizeResponse{Params: resultParams(result)}, err
+		}
+	}
+
+	response, err := gateway.PaymentGateway.Authorize(amount, params)
+	if response.Params == nil {
+		response.Params = gomerchant.Params{}
+	}
+	for key, value := range resultParams(result) {
+		response.Params[key] = value
+	}
+	return response, err
+}
+
+func resultParams(result Result) gomerchant.Params {
+	var reasons []string
+	for _, reason := range result.Reasons {
+		reasons = append(reasons, reason.String())
+	}
+	return gomerchant.Params{DecisionParam: result.Decision.String(), ReasonsParam: strings.Join(reasons, "; ")}
+}
@@ -0,0 +1,197 @@
+// Package risk screens payments with rules before they are authorized, rules decide to allow, review or deny a payment with reasons.
+package risk
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/qor/gomerchant"
+)
+
+// Decision decision of rules, a greater decision overrides a smaller one
+type Decision int
+
+const (
+	Allow  Decision = iota
+	Review          // authorize, but the payment should be reviewed before it is captured
+	Deny
+)
+
+func (decision Decision) String() string {
+	switch decision {
+	case Allow:
+		return "allow"
+	case Review:
+		return "review"
+	case Deny:
+		return "deny"
+	}
+	return fmt.Sprintf("decision(%d)", int(decision))
+}
+
+// Reason reason of a review or deny decision
+type Reason struct {
+	Rule     string
+	Decision Decision
+	Message  string
+}
+
+func (reason Reason) String() string {
+	return fmt.Sprintf("%v: %v", reason.Rule, reason.Message)
+}
+
+// Result result of evaluation
+type Result struct {
+	Decision Decision
+	Reasons  []Reason
+}
+
+// Input payment to evaluate
+type Input struct {
+	Amount  uint64
+	Params  gomerchant.AuthorizeParams
+	Time    time.Time
+	Storage Storage
+
+	fingerprintKey []byte
+}
+
+// CustomerID customer of payment, customer of saved credit card is used if Params.Customer is blank
+func (input Input) CustomerID() string {
+	if input.Params.Customer != "" {
+		return input.Params.Customer
+	}
+	if method := input.Params.PaymentMethod; method != nil && method.SavedCreditCard != nil {
+		return method.SavedCreditCard.CustomerID
+	}
+	return ""
+}
+
+// CardNumber card number of payment, blank for saved credit cards
+func (input Input) CardNumber() string {
+	if method := input.Params.PaymentMethod; method != nil && method.CreditCard != nil {
+		return strings.Replace(method.CreditCard.Number, " ", "", -1)
+	}
+	return ""
+}
+
+// CardFingerprint identify card without its number, HMAC-SHA256 of card number with Engine.FingerprintKey or id of saved credit card,
+// it is blank for card numbers if the key is not set
+func (input Input) CardFingerprint() string {
+	if number := input.CardNumber(); number != "" {
+		if len(input.fingerprintKey) == 0 {
+			return ""
+		}
+		mac := hmac.New(sha256.New, input.fingerprintKey)
+		mac.Write([]byte(number))
+		return hex.EncodeToString(mac.Sum(nil))
+	}
+	if method := input.Params.PaymentMethod; method != nil && method.SavedCreditCard != nil && method.SavedCreditCard.CreditCardID != "" {
+		return "saved:" + method.SavedCreditCard.CustomerID + ":" + method.SavedCreditCard.CreditCardID
+	}
+	return ""
+}
+
+// Rule risk rule, returns reasons if payment should be reviewed or denied
+type Rule interface {
+	Check(input Input) ([]Reason, error)
+}
+
+// RuleFunc func as Rule
+type RuleFunc func(input Input) ([]Reason, error)
+
+// Check check payment with func
+func (fc RuleFunc) Check(input Input) ([]Reason, error) {
+	return fc(input)
+}
+
+// Recorder rules that keep state record evaluated payments after all rules checked it
+type Recorder interface {
+	Record(input Input) error
+}
+
+// Engine evaluate payments with rules
+type Engine struct {
+	Rules   []Rule
+	Storage Storage
+	Now     func() time.Time // default time.Now
+
+	// FingerprintKey secret key of card fingerprints saved in Storage, it is required if Storage is set,
+	// keep it secret as card numbers could be brute-forced from fingerprints with the key
+	FingerprintKey []byte
+}
+
+// ErrFingerprintKeyRequired engine with storage doesn't have FingerprintKey
+var ErrFingerprintKeyRequired = errors.New("risk: fingerprint key is required")
+
+// New initialize engine with rules, state of rules is saved in storage
+func New(storage Storage, rules ...Rule) *Engine {
+	return &Engine{Rules: rules, Storage: storage}
+}
+
+// Evaluate evaluate payment with all rules, then record it with Recorder rules, denied attempts count towards velocity limits too
+func (engine *Engine) Evaluate(amount uint64, params gomerchant.AuthorizeParams) (Result, error) {
+	var (
+		result Result
+		input  = Input{Amount: amount, Params: params, Time: time.Now(), Storage: engine.Storage, fingerprintKey: engine.FingerprintKey}
+	)
+
+	if engine.Storage != nil && len(engine.FingerprintKey) == 0 {
+		return result, ErrFingerprintKeyRequired
+	}
+
+	if engine.Now != nil {
+		input.Time = engine.Now()
+	}
+
+	for _, rule := range engine.Rules {
+		reasons, err := rule.Check(input)
+		if err != nil {
+			return result, err
+		}
+
+		for _, reason := range reasons {
+			if reason.Decision > result.Decision {
+				result.Decision = reason.Decision
+			}
+			result.Reasons = append(result.Reasons, reason)
+		}
+	}
+
+	for _, rule := range engine.Rules {
+		if recorder, ok := rule.(Recorder); ok {
+			if err := recorder.Record(input); err != nil {
+				return result, err
+			}
+		}
+	}
+	return result, nil
+}
+
+// ErrDenied payment is denied by rules, use errors.As with *DeniedError to get reasons
+var ErrDenied = errors.New("risk: payment denied")
+
+// DeniedError error of denied payment
+type DeniedError struct {
+	Result Result
+}
+
+func (err *DeniedError) Error() string {
+	var reasons []string
+	for _, reason := range err.Result.Reasons {
+		if reason.Decision == Deny {
+			reasons = append(reasons, reason.String())
+		}
+	}
+	return fmt.Sprintf("%v: %v", ErrDenied, strings.Join(reasons, "; "))
+}
+
+// Is denied error is ErrDenied
+func (err *DeniedError) Is(target error) bool {
+	return target == ErrDenied
+}
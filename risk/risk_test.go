@@ -0,0 +1,190 @@
+package risk_test
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/qor/gomerchant"
+	"github.com/qor/gomerchant/risk"
+)
+
+type fakeGateway struct {
+	gomerchant.PaymentGateway
+	authorized int
+}
+
+func (gateway *fakeGateway) Authorize(amount uint64, params gomerchant.AuthorizeParams) (gomerchant.AuthorizeResponse, error) {
+	gateway.authorized++
+	return gomerchant.AuthorizeResponse{TransactionID: "1"}, nil
+}
+
+func cardParams(number string) gomerchant.AuthorizeParams {
+	return gomerchant.AuthorizeParams{
+		Currency:      "JPY",
+		Customer:      "customer-1",
+		PaymentMethod: &gomerchant.PaymentMethod{CreditCard: &gomerchant.CreditCard{Number: number, ExpMonth: 1, ExpYear: 2099}},
+	}
+}
+
+func TestRules(t *testing.T) {
+	engine := risk.New(nil,
+		&risk.Blocklist{BINs: []string{"400000"}, Countries: []string{"XX"}},
+		&risk.CountryMismatch{},
+		&risk.AmountThreshold{Currency: "jpy", Review: 50000, Deny: 300000},
+	)
+
+	withAddresses := func(params gomerchant.AuthorizeParams, billing, shipping string) gomerchant.AuthorizeParams {
+		params.BillingAddress = &gomerchant.Address{Country: billing}
+		params.ShippingAddress = &gomerchant.Address{Country: shipping}
+		return params
+	}
+
+	cases := []struct {
+		amount   uint64
+		params   gomerchant.AuthorizeParams
+		decision risk.Decision
+		rules    []string
+	}{
+		{1000, withAddresses(cardParams("4242424242424242"), "JP", "jp"), risk.Allow, nil},
+		{1000, cardParams("4000 0000 0000 0002"), risk.Deny, []string{"bin_blocklist"}},
+		{1000, withAddresses(cardParams("4242424242424242"), "JP", "xx"), risk.Deny, []string{"country_blocklist", "country_mismatch"}},
+		{1000, withAddresses(cardParams("4242424242424242"), "JP", "US"), risk.Review, []string{"country_mismatch"}},
+		{60000, cardParams("4242424242424242"), risk.Review, []string{"amount_threshold"}},
+		{400000, cardParams("4242424242424242"), risk.Deny, []string{"amount_threshold"}},
+	}
+
+	for idx, c := range cases {
+		result, err := engine.Evaluate(c.amount, c.params)
+		if err != nil {
+			t.Fatalf("#%v: failed to evaluate, got %v", idx, err)
+		}
+
+		var rules []string
+		for _, reason := range result.Reasons {
+			rules = append(rules, reason.Rule)
+		}
+
+		if result.Decision != c.decision || strings.Join(rules, ",") != strings.Join(c.rules, ",") {
+			t.Errorf("#%v: should be %v with %v, but got %v with %v", idx, c.decision, c.rules, result.Decision, result.Reasons)
+		}
+	}
+}
+
+func TestVelocity(t *testing.T) {
+	var (
+		now     = time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+		storage = risk.NewMemoryStorage(time.Hour)
+		engine  = risk.New(storage, risk.CustomerVelocity(3, time.Hour), risk.CardVelocity(2, 10*time.Minute))
+	)
+	engine.Now = func() time.Time { return now }
+	engine.FingerprintKey = []byte("secret")
+
+	evaluate := func(params gomerchant.AuthorizeParams) risk.Result {
+		now = now.Add(time.Minute)
+		result, err := engine.Evaluate(1000, params)
+		if err != nil {
+			t.Fatalf("failed to evaluate, got %v", err)
+		}
+		return result
+	}
+
+	for _, number := range []string{"4242424242424242", "4242424242424242"} {
+		if result := evaluate(cardParams(number)); result.Decision != risk.Allow {
+			t.Errorf("should allow attempts under limit, got %+v", result)
+		}
+	}
+
+	if result := evaluate(cardParams("4242424242424242")); result.Decision != risk.Deny || result.Reasons[0].Rule != "card_velocity" {
+		t.Errorf("should deny attempts of card over limit, got %+v", result)
+	}
+
+	if result := evaluate(cardParams("5555555555554444")); result.Decision != risk.Deny || result.Reasons[0].Rule != "customer_velocity" {
+		t.Errorf("should deny attempts of customer over limit, got %+v", result)
+	}
+
+	now = now.Add(2 * time.Hour)
+	if result := evaluate(cardParams("4242424242424242")); result.Decision != risk.Allow {
+		t.Errorf("should allow attempts after period, got %+v", result)
+	}
+
+	if count, _ := storage.Count("card:4242424242424242", time.Time{}); count != 0 {
+		t.Errorf("card number should not be used as key")
+	}
+
+	mac := hmac.New(sha256.New, []byte("secret"))
+	mac.Write([]byte("4242424242424242"))
+	if count, _ := storage.Count("card:"+hex.EncodeToString(mac.Sum(nil)), time.Time{}); count != 1 {
+		t.Errorf("card should be identified by HMAC of card number, got %v attempts", count)
+	}
+}
+
+func TestFingerprintKeyRequired(t *testing.T) {
+	engine := risk.New(risk.NewMemoryStorage(time.Hour), risk.CardVelocity(2, time.Hour))
+	if _, err := engine.Evaluate(1000, cardParams("4242424242424242")); err != risk.ErrFingerprintKeyRequired {
+		t.Errorf("engine with storage should require fingerprint key, got %v", err)
+	}
+}
+
+func TestConcurrentVelocity(t *testing.T) {
+	var (
+		engine  = risk.New(risk.NewMemoryStorage(time.Hour), risk.CardVelocity(2, time.Hour))
+		mutex   sync.Mutex
+		allowed int
+		wg      sync.WaitGroup
+	)
+	engine.FingerprintKey = []byte("secret")
+
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if result, err := engine.Evaluate(1000, cardParams("4242424242424242")); err == nil && result.Decision == risk.Allow {
+				mutex.Lock()
+				allowed++
+				mutex.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if allowed != 2 {
+		t.Errorf("concurrent attempts should not pass the limit together, got %v allowed", allowed)
+	}
+}
+
+func TestGateway(t *testing.T) {
+	var (
+		reviewed int
+		wrapped  = &fakeGateway{}
+		gateway  = risk.NewGateway(wrapped, risk.New(nil, &risk.AmountThreshold{Review: 50000, Deny: 300000}))
+	)
+	gateway.OnReview = func(amount uint64, params gomerchant.AuthorizeParams, result risk.Result) error {
+		reviewed++
+		return nil
+	}
+
+	response, err := gateway.Authorize(400000, cardParams("4242424242424242"))
+	var denied *risk.DeniedError
+	if !errors.Is(err, risk.ErrDenied) || !errors.As(err, &denied) || denied.Result.Reasons[0].Rule != "amount_threshold" || wrapped.authorized != 0 {
+		t.Errorf("denied payment should not be authorized, got %v", err)
+	}
+
+	if response.Params[risk.DecisionParam] != "deny" {
+		t.Errorf("response should include decision, got %v", response.Params)
+	}
+
+	response, err = gateway.Authorize(60000, cardParams("4242424242424242"))
+	if err != nil || wrapped.authorized != 1 || reviewed != 1 || response.TransactionID != "1" || response.Params[risk.DecisionParam] != "review" {
+		t.Errorf("reviewed payment should be authorized, got %v, %+v", err, response)
+	}
+
+	if !strings.Contains(response.Params[risk.ReasonsParam].(string), "amount 60000 is greater than 50000") {
+		t.Errorf("response should include reasons, got %v", response.Params)
+	}
+}
@@ -0,0 +1,157 @@
+package risk
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/qor/gomerchant"
+)
+
+// Velocity limit payment attempts of a key (like customer or card) in a period
+type Velocity struct {
+	Name     string
+	Key      func(input Input) string // attempts without key are not limited
+	Limit    int                      // attempts allowed in Period
+	Period   time.Duration
+	Decision Decision // default Deny
+}
+
+// CustomerVelocity limit payment attempts of a customer
+func CustomerVelocity(limit int, period time.Duration) *Velocity {
+	return &Velocity{
+		Name:   "customer_velocity",
+		Key:    func(input Input) string { return prefixKey("customer", input.CustomerID()) },
+		Limit:  limit,
+		Period: period,
+	}
+}
+
+// CardVelocity limit payment attempts of a card, cards are identified with Input.CardFingerprint, so card numbers are not saved,
+// attempts are not limited if Engine.FingerprintKey is not set
+func CardVelocity(limit int, period time.Duration) *Velocity {
+	return &Velocity{
+		Name:   "card_velocity",
+		Key:    func(input Input) string { return prefixKey("card", input.CardFingerprint()) },
+		Limit:  limit,
+		Period: period,
+	}
+}
+
+func prefixKey(prefix, key string) string {
+	if key == "" {
+		return ""
+	}
+	return prefix + ":" + key
+}
+
+// Check record attempt and count attempts in period at once, so concurrent attempts can't pass the limit together
+func (velocity *Velocity) Check(input Input) ([]Reason, error) {
+	key := velocity.Key(input)
+	if key == "" || input.Storage == nil {
+		return nil, nil
+	}
+
+	count, err := input.Storage.AddAndCount(key, input.Time, input.Time.Add(-velocity.Period))
+	if err != nil || count <= velocity.Limit {
+		return nil, err
+	}
+
+	return []Reason{{
+		Rule:     velocity.Name,
+		Decision: decisionOr(velocity.Decision, Deny),
+		Message:  fmt.Sprintf("%v attempts in %v, limit is %v", count, velocity.Period, velocity.Limit),
+	}}, nil
+}
+
+// Blocklist deny cards of BINs (card number prefixes) and billing or shipping addresses in countries
+type Blocklist struct {
+	BINs      []string
+	Countries []string // compared case insensitively
+	Decision  Decision // default Deny
+}
+
+// Check check card number and countries of addresses
+func (blocklist *Blocklist) Check(input Input) ([]Reason, error) {
+	var (
+		reasons  []Reason
+		decision = decisionOr(blocklist.Decision, Deny)
+	)
+
+	if number := input.CardNumber(); number != "" {
+		for _, bin := range blocklist.BINs {
+			if bin != "" && strings.HasPrefix(number, bin) {
+				reasons = append(reasons, Reason{Rule: "bin_blocklist", Decision: decision, Message: fmt.Sprintf("card BIN %v is blocked", bin)})
+				break
+			}
+		}
+	}
+
+	for _, address := range []struct{ name, country string }{
+		{"billing", countryOf(input.Params.BillingAddress)},
+		{"shipping", countryOf(input.Params.ShippingAddress)},
+	} {
+		for _, country := range blocklist.Countries {
+			if address.country != "" && strings.EqualFold(address.country, country) {
+				reasons = append(reasons, Reason{Rule: "country_blocklist", Decision: decision, Message: fmt.Sprintf("%v country %v is blocked", address.name, address.country)})
+			}
+		}
+	}
+	return reasons, nil
+}
+
+// CountryMismatch review payments whose billing and shipping countries are different
+type CountryMismatch struct {
+	Decision Decision // default Review
+}
+
+// Check compare countries of billing and shipping address
+func (mismatch *CountryMismatch) Check(input Input) ([]Reason, error) {
+	billing, shipping := countryOf(input.Params.BillingAddress), countryOf(input.Params.ShippingAddress)
+	if billing == "" || shipping == "" || strings.EqualFold(billing, shipping) {
+		return nil, nil
+	}
+
+	return []Reason{{
+		Rule:     "country_mismatch",
+		Decision: decisionOr(mismatch.Decision, Review),
+		Message:  fmt.Sprintf("billing country %v is different from shipping country %v", billing, shipping),
+	}}, nil
+}
+
+// AmountThreshold review or deny payments greater than thresholds, thresholds of zero are disabled
+type AmountThreshold struct {
+	Currency string // only check payments of currency, compared case insensitively, all payments if it is blank
+	Review   uint64
+	Deny     uint64
+}
+
+// Check compare amount with thresholds
+func (threshold *AmountThreshold) Check(input Input) ([]Reason, error) {
+	if threshold.Currency != "" && !strings.EqualFold(threshold.Currency, input.Params.Currency) {
+		return nil, nil
+	}
+
+	if threshold.Deny > 0 && input.Amount > threshold.Deny {
+		return []Reason{{Rule: "amount_threshold", Decision: Deny, Message: fmt.Sprintf("amount %v is greater than %v", input.Amount, threshold.Deny)}}, nil
+	}
+
+	if threshold.Review > 0 && input.Amount > threshold.Review {
+		return []Reason{{Rule: "amount_threshold", Decision: Review, Message: fmt.Sprintf("amount %v is greater than %v", input.Amount, threshold.Review)}}, nil
+	}
+	return nil, nil
+}
+
+func countryOf(address *gomerchant.Address) string {
+	if address == nil {
+		return ""
+	}
+	return strings.TrimSpace(address.Country)
+}
+
+func decisionOr(decision, defaultDecision Decision) Decision {
+	if decision == Allow {
+		return defaultDecision
+	}
+	return decision
+}
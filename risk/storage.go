@@ -0,0 +1,104 @@
+package risk
+
+import (
+	"sync"
+	"time"
+)
+
+// Storage state of rules, like payment attempts of customers and cards for velocity limits
+type Storage interface {
+	Add(key string, at time.Time) error
+	Count(key string, since time.Time) (int, error)
+	// AddAndCount add event of key, then count events of key since time, including the added one, atomically
+	AddAndCount(key string, at time.Time, since time.Time) (int, error)
+}
+
+// MemoryStorage in-memory storage for a single process, events older than Retention are dropped
+type MemoryStorage struct {
+	Retention time.Duration // default 24 hours
+
+	mutex    sync.Mutex
+	events   map[string][]time.Time
+	prunedAt time.Time
+}
+
+// NewMemoryStorage initialize in-memory storage
+func NewMemoryStorage(retention time.Duration) *MemoryStorage {
+	return &MemoryStorage{Retention: retention}
+}
+
+// Add add event of key
+func (storage *MemoryStorage) Add(key string, at time.Time) error {
+	storage.mutex.Lock()
+	defer storage.mutex.Unlock()
+
+	storage.add(key, at)
+	return nil
+}
+
+// Count count events of key since time
+func (storage *MemoryStorage) Count(key string, since time.Time) (int, error) {
+	storage.mutex.Lock()
+	defer storage.mutex.Unlock()
+
+	return storage.count(key, since), nil
+}
+
+// AddAndCount add event of key, then count events of key since time
+func (storage *MemoryStorage) AddAndCount(key string, at time.Time, since time.Time) (int, error) {
+	storage.mutex.Lock()
+	defer storage.mutex.Unlock()
+
+	storage.add(key, at)
+	return storage.count(key, since), nil
+}
+
+func (storage *MemoryStorage) retention() time.Duration {
+	if storage.Retention <= 0 {
+		return 24 * time.Hour
+	}
+	return storage.Retention
+}
+
+func (storage *MemoryStorage) add(key string, at time.Time) {
+	if storage.events == nil {
+		storage.events = map[string][]time.Time{}
+	}
+
+	var (
+		expiredBefore = at.Add(-storage.retention())
+		events        []time.Time
+	)
+	for _, event := range storage.events[key] {
+		if !event.Before(expiredBefore) {
+			events = append(events, event)
+		}
+	}
+	storage.events[key] = append(events, at)
+	storage.prune(at)
+}
+
+// prune drop keys whose events are all expired, at most once per minute, so writes are not slowed down by many keys
+func (storage *MemoryStorage) prune(now time.Time) {
+	if now.Sub(storage.prunedAt) < time.Minute {
+		return
+	}
+	storage.prunedAt = now
+
+	expiredBefore := now.Add(-storage.retention())
+	for key, events := range storage.events {
+		if len(events) == 0 || events[len(events)-1].Before(expiredBefore) {
+			delete(storage.events, key)
+		}
+	}
+}
+
+func (storage *MemoryStorage) count(key string, since time.Time) int {
+	var count int
+	for _, event := range storage.events[key] {
+		if !event.Before(since) {
+			count++
+		}
+	}
+	return count
+}
@@ -0,0 +1,174 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/qor/gomerchant"
+	"github.com/qor/gomerchant/gateways/paygent"
+	"github.com/qor/gomerchant/ledger"
+	"github.com/qor/gomerchant/resilience"
+	"github.com/qor/gomerchant/risk"
+	stripe "github.com/stripe/stripe-go"
+)
+
+// Error types
+const (
+	TypeInvalidRequest = "invalid_request_error" // request is invalid, it should not be retried
+	TypeAuthentication = "authentication_error"
+	TypeCard           = "card_error"        // card is declined or invalid
+	TypeIdempotency    = "idempotency_error" // idempotency key is in use or reused with another request
+	TypeGateway        = "gateway_error"     // gateway failed or is unavailable, it could be retried
+)
+
+// Error structured error of API, responded as `{"error": {...}}`
+type Error struct {
+	Status       int           `json:"-"`
+	Type         string        `json:"type"`
+	Code         string        `json:"code"`
+	Message      string        `json:"message"`
+	DeclineCode  string        `json:"decline_code,omitempty"`  // decline code of issuer, like insufficient_funds
+	ResponseCode string        `json:"response_code,omitempty"` // response code of gateway, like Paygent's response_code
+	RetryAfter   time.Duration `json:"-"`
+}
+
+func (err *Error) Error() string {
+	return fmt.Sprintf("%v: %v", err.Code, err.Message)
+}
+
+type errorBody struct {
+	Error *Error `json:"error"`
+}
+
+// GatewayError error of a gateway that responded with a response code, like Paygent's response_code
+type GatewayError struct {
+	Err          error
+	ResponseCode string
+}
+
+func (err *GatewayError) Error() string {
+	return err.Err.Error()
+}
+
+func (err *GatewayError) Unwrap() error {
+	return err.Err
+}
+
+// withResponseCode wrap err with response code of gateway response params
+func withResponseCode(err error, params gomerchant.Params) error {
+	if err == nil {
+		return nil
+	}
+	if code, ok := params.Get("response_code"); ok && fmt.Sprint(code) != "" {
+		return &GatewayError{Err: err, ResponseCode: fmt.Sprint(code)}
+	}
+	return err
+}
+
+var cardErrors = []struct {
+	err  error
+	code string
+}{
+	{gomerchant.ErrInvalidNumber, "invalid_number"},
+	{gomerchant.ErrInvalidExpiryMonth, "invalid_expiry_month"},
+	{gomerchant.ErrInvalidExpiryYear, "invalid_expiry_year"},
+	{gomerchant.ErrInvalidCVC, "invalid_cvc"},
+	{gomerchant.ErrIncorrectNumber, "incorrect_number"},
+	{gomerchant.ErrExpiredCard, "expired_card"},
+	{gomerchant.ErrIncorrectCVC, "incorrect_cvc"},
+	{gomerchant.ErrIncorrectZip, "incorrect_zip"},
+	{gomerchant.ErrCardDeclined, "card_declined"},
+	{gomerchant.ErrMissing, "missing"},
+	{gomerchant.ErrProcessingError, "processing_error"},
+}
+
+// errorOf map gateway failures to API errors
+func errorOf(err error) *Error {
+	var (
+		apiErr        *Error
+		gatewayErr    *GatewayError
+		stripeErr     *stripe.Error
+		openErr       *resilience.OpenError
+		rateLimited   *resilience.RateLimitedError
+		netErr        net.Error
+		fieldErr      paygent.FieldError
+		checkedFailed = errors.Is(err, gomerchant.ErrCheckFailed)
+	)
+
+	if errors.As(err, &apiErr) {
+		return apiErr
+	}
+
+	for _, cardErr := range cardErrors {
+		if errors.Is(err, cardErr.err) {
+			return &Error{Status: http.StatusPaymentRequired, Type: TypeCard, Code: cardErr.code, Message: err.Error()}
+		}
+	}
+
+	switch {
+	case checkedFailed:
+		return &Error{Status: http.StatusPaymentRequired, Type: TypeCard, Code: "verification_failed", Message: err.Error()}
+	case errors.Is(err, risk.ErrDenied):
+		return &Error{Status: http.StatusPaymentRequired, Type: TypeCard, Code: "payment_denied", Message: err.Error()}
+	case errors.Is(err, gomerchant.ErrNotSupportedPaymentMethod):
+		return &Error{Status: http.StatusBadRequest, Type: TypeInvalidRequest, Code: "payment_method_not_supported", Message: err.Error()}
+	case errors.Is(err, gomerchant.ErrInvalidLineItems):
+		return &Error{Status: http.StatusBadRequest, Type: TypeInvalidRequest, Code: "invalid_line_items", Message: err.Error()}
+	case errors.Is(err, gomerchant.ErrTransactionNotFound), errors.Is(err, ledger.ErrNotFound):
+		return &Error{Status: http.StatusNotFound, Type: TypeInvalidRequest, Code: "not_found", Message: err.Error()}
+	case errors.As(err, &fieldErr):
+		return &Error{Status: http.StatusBadRequest, Type: TypeInvalidRequest, Code: "invalid_field", Message: err.Error()}
+	case errors.Is(err, ledger.ErrInsufficientBalance):
+		return &Error{Status: http.StatusConflict, Type: TypeInvalidRequest, Code: "insufficient_balance", Message: err.Error()}
+	case errors.As(err, &openErr):
+		return &Error{Status: http.StatusServiceUnavailable, Type: TypeGateway, Code: "gateway_unavailable", Message: err.Error(), RetryAfter: openErr.RetryAfter}
+	case errors.As(err, &rateLimited):
+		return &Error{Status: http.StatusTooManyRequests, Type: TypeGateway, Code: "rate_limited", Message: err.Error(), RetryAfter: rateLimited.RetryAfter}
+	case errors.As(err, &stripeErr):
+		e := &Error{Status: http.StatusBadGateway, Type: TypeGateway, Code: string(stripeErr.Code), Message: stripeErr.Msg, DeclineCode: string(stripeErr.DeclineCode)}
+		switch stripeErr.Type {
+		case stripe.ErrorTypeCard:
+			e.Status, e.Type = http.StatusPaymentRequired, TypeCard
+		case stripe.ErrorTypeInvalidRequest:
+			e.Status, e.Type = http.StatusBadRequest, TypeInvalidRequest
+		case stripe.ErrorTypeRateLimit:
+			e.Status = http.StatusTooManyRequests
+		}
+		if e.Code == "" {
+			e.Code = string(stripeErr.Type)
+		}
+		return e
+	case errors.Is(err, context.DeadlineExceeded), errors.As(err, &netErr) && netErr.Timeout():
+		return &Error{Status: http.StatusGatewayTimeout, Type: TypeGateway, Code: "gateway_timeout", Message: err.Error()}
+	case errors.As(err, &netErr):
+		return &Error{Status: http.StatusBadGateway, Type: TypeGateway, Code: "gateway_unreachable", Message: err.Error()}
+	case errors.As(err, &gatewayErr):
+		// gateway processed the request and rejected it
+		return &Error{Status: http.StatusPaymentRequired, Type: TypeCard, Code: "gateway_declined", Message: err.Error(), ResponseCode: gatewayErr.ResponseCode}
+	}
+
+	return &Error{Status: http.StatusBadGateway, Type: TypeGateway, Code: "gateway_error", Message: err.Error()}
+}
+
+// beforeGateway reports whether err happened before the gateway was called, like invalid requests, open circuit or rate limited,
+// other failures might have been processed by the gateway, like timeouts
+func beforeGateway(err error) bool {
+	var (
+		apiErr      *Error
+		openErr     *resilience.OpenError
+		rateLimited *resilience.RateLimitedError
+		fieldErr    paygent.FieldError
+	)
+
+	switch {
+	case errors.As(err, &openErr), errors.As(err, &rateLimited), errors.As(err, &fieldErr):
+		return true
+	case errors.As(err, &apiErr):
+		return apiErr.Type == TypeInvalidRequest
+	}
+	return false
+}
@@ -0,0 +1,364 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/qor/gomerchant"
+)
+
+// CreditCard credit card of request
+type CreditCard struct {
+	Name          string `json:"name,omitempty"`
+	Number        string `json:"number"`
+	ExpMonth      uint   `json:"exp_month"`
+	ExpYear       uint   `json:"exp_year"`
+	CVC           string `json:"cvc,omitempty"`
+	ThreeDSAuthID string `json:"three_ds_auth_id,omitempty"`
+}
+
+// SavedCreditCard saved credit card of request
+type SavedCreditCard struct {
+	CustomerID    string `json:"customer_id"`
+	CreditCardID  string `json:"credit_card_id"`
+	CVC           string `json:"cvc,omitempty"`
+	ThreeDSAuthID string `json:"three_ds_auth_id,omitempty"`
+}
+
+// PaymentMethod payment method of request, one of credit card and saved credit card
+type PaymentMethod struct {
+	CreditCard      *CreditCard      `json:"credit_card,omitempty"`
+	SavedCreditCard *SavedCreditCard `json:"saved_credit_card,omitempty"`
+}
+
+func (method PaymentMethod) paymentMethod() *gomerchant.PaymentMethod {
+	paymentMethod := &gomerchant.PaymentMethod{}
+	if card := method.CreditCard; card != nil {
+		paymentMethod.CreditCard = &gomerchant.CreditCard{Name: card.Name, Number: card.Number, ExpMonth: card.ExpMonth, ExpYear: card.ExpYear, CVC: card.CVC, ThreeDSAuthID: card.ThreeDSAuthID}
+	}
+	if card := method.SavedCreditCard; card != nil {
+		paymentMethod.SavedCreditCard = &gomerchant.SavedCreditCard{CustomerID: card.CustomerID, CreditCardID: card.CreditCardID, CVC: card.CVC, ThreeDSAuthID: card.ThreeDSAuthID}
+	}
+	return paymentMethod
+}
+
+// ThreeDSecure 3D Secure options of authorize request, customer's browser should be redirected to `redirect_url` of response,
+// after authenticated, it is redirected to ReturnURL with `transaction_id` and `status` (and `error_code` if failed) query
+type ThreeDSecure struct {
+	ReturnURL  string `json:"return_url,omitempty"` // the result is responded as JSON if it is blank
+	UserAgent  string `json:"user_agent,omitempty"` // user agent of customer's browser
+	HTTPAccept string `json:"http_accept,omitempty"`
+}
+
+// AuthorizeRequest authorize request
+type AuthorizeRequest struct {
+	Amount        uint64            `json:"amount"`
+	Currency      string            `json:"currency"`
+	Customer      string            `json:"customer,omitempty"`
+	Description   string            `json:"description,omitempty"`
+	OrderID       string            `json:"order_id,omitempty"`
+	PaymentMethod PaymentMethod     `json:"payment_method"`
+	ThreeDSecure  *ThreeDSecure     `json:"three_d_secure,omitempty"`
+	Params        map[string]string `json:"params,omitempty"` // gateway specific params
+}
+
+// AVS address verification results
+type AVS struct {
+	Address    gomerchant.CheckResult `json:"address,omitempty"`
+	PostalCode gomerchant.CheckResult `json:"postal_code,omitempty"`
+}
+
+// AuthorizeResponse authorize response
+type AuthorizeResponse struct {
+	TransactionID        string                 `json:"transaction_id"`
+	Status               string                 `json:"status"`                 // authorized or requires_action
+	RedirectURL          string                 `json:"redirect_url,omitempty"` // redirect customer's browser to it if status is requires_action
+	AVS                  AVS                    `json:"avs"`
+	CVCResult            gomerchant.CheckResult `json:"cvc_result,omitempty"`
+	NetworkTransactionID string                 `json:"network_transaction_id,omitempty"`
+	AuthorizationCode    string                 `json:"authorization_code,omitempty"`
+	Params               map[string]interface{} `json:"params,omitempty"`
+}
+
+// TransactionRequest capture, refund or void request
+type TransactionRequest struct {
+	Amount   uint `json:"amount,omitempty"` // refund amount
+	Captured bool `json:"captured,omitempty"`
+}
+
+// TransactionResponse capture, refund or void response
+type TransactionResponse struct {
+	TransactionID string                 `json:"transaction_id"` // might be a new id, like Paygent refunds
+	Params        map[string]interface{} `json:"params,omitempty"`
+}
+
+// Transaction queried transaction
+type Transaction struct {
+	ID                   string                 `json:"id"`
+	Amount               int                    `json:"amount"`
+	Currency             string                 `json:"currency"`
+	Captured             bool                   `json:"captured"`
+	Paid                 bool                   `json:"paid"`
+	Cancelled            bool                   `json:"cancelled"`
+	Disputed             bool                   `json:"disputed"`
+	Status               string                 `json:"status,omitempty"`
+	CreatedAt            *time.Time             `json:"created_at,omitempty"`
+	AVS                  AVS                    `json:"avs"`
+	CVCResult            gomerchant.CheckResult `json:"cvc_result,omitempty"`
+	NetworkTransactionID string                 `json:"network_transaction_id,omitempty"`
+	AuthorizationCode    string                 `json:"authorization_code,omitempty"`
+	Params               map[string]interface{} `json:"params,omitempty"`
+}
+
+// Card saved credit card
+type Card struct {
+	CustomerID   string `json:"customer_id"`
+	CreditCardID string `json:"credit_card_id"`
+	MaskedNumber string `json:"masked_number,omitempty"`
+	Brand        string `json:"brand,omitempty"`
+	ExpMonth     uint   `json:"exp_month,omitempty"`
+	ExpYear      uint   `json:"exp_year,omitempty"`
+}
+
+// CardList saved credit cards
+type CardList struct {
+	Data []Card `json:"data"`
+}
+
+// responseParams params of gateway response, without raw bodies
+func responseParams(params gomerchant.Params) map[string]interface{} {
+	result := map[string]interface{}{}
+	for key, value := range params {
+		if key == "RawBody" {
+			continue
+		}
+		if _, err := json.Marshal(value); err == nil {
+			result[key] = value
+		}
+	}
+	if len(result) == 0 {
+		return nil
+	}
+	return result
+}
+
+func decode(body []byte, value interface{}) error {
+	if len(bytes.TrimSpace(body)) == 0 {
+		return nil
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(value); err != nil {
+		return &Error{Status: http.StatusBadRequest, Type: TypeInvalidRequest, Code: "invalid_body", Message: err.Error()}
+	}
+	return nil
+}
+
+func invalid(code, message string) *Error {
+	return &Error{Status: http.StatusBadRequest, Type: TypeInvalidRequest, Code: code, Message: message}
+}
+
+func (server *Server) authorize(request *http.Request, body []byte) (int, interface{}, error) {
+	var input AuthorizeRequest
+	if err := decode(body, &input); err != nil {
+		return 0, nil, err
+	}
+
+	if input.Amount == 0 {
+		return 0, nil, invalid("invalid_amount", "amount is required")
+	}
+	if input.PaymentMethod.CreditCard == nil && input.PaymentMethod.SavedCreditCard == nil {
+		return 0, nil, invalid("invalid_payment_method", "credit_card or saved_credit_card is required")
+	}
+
+	params := gomerchant.AuthorizeParams{
+		Amount:        input.Amount,
+		Currency:      input.Currency,
+		Customer:      input.Customer,
+		Description:   input.Description,
+		OrderID:       input.OrderID,
+		PaymentMethod: input.PaymentMethod.paymentMethod(),
+		Params:        gomerchant.Params{},
+	}
+	for key, value := range input.Params {
+		params.Set(key, value)
+	}
+
+	var token string
+	if input.ThreeDSecure != nil {
+		token = newToken()
+		server.ThreeDSecureParams(&params, server.baseURL(request)+"/v1/3ds/"+token+"/return", *input.ThreeDSecure)
+	}
+
+	response, err := server.Gateway.Authorize(input.Amount, params)
+	if err != nil {
+		return 0, nil, withResponseCode(err, response.Params)
+	}
+
+	output := AuthorizeResponse{
+		TransactionID:        response.TransactionID,
+		Status:               "authorized",
+		AVS:                  AVS{Address: response.AVSResult.Address, PostalCode: response.AVSResult.PostalCode},
+		CVCResult:            response.CVCResult,
+		NetworkTransactionID: response.NetworkTransactionID,
+		AuthorizationCode:    response.AuthorizationCode,
+		Params:               responseParams(response.Params),
+	}
+
+	if response.HandleRequest && response.RequestHandler != nil {
+		if token == "" {
+			token = newToken()
+		}
+		server.pending.add(token, &pending{
+			transactionID: response.TransactionID,
+			handler:       response.RequestHandler,
+			returnURL:     input.ThreeDSecure.returnURL(),
+			expiresAt:     time.Now().Add(server.ThreeDSecureTTL),
+		})
+		output.Status, output.RedirectURL = "requires_action", server.baseURL(request)+"/v1/3ds/"+token
+	}
+	return http.StatusCreated, output, nil
+}
+
+func (server *Server) capture(request *http.Request, body []byte) (int, interface{}, error) {
+	if err := decode(body, &TransactionRequest{}); err != nil {
+		return 0, nil, err
+	}
+
+	response, err := server.Gateway.Capture(request.PathValue("id"), gomerchant.CaptureParams{})
+	if err != nil {
+		return 0, nil, withResponseCode(err, response.Params)
+	}
+	return http.StatusOK, TransactionResponse{TransactionID: response.TransactionID, Params: responseParams(response.Params)}, nil
+}
+
+func (server *Server) refund(request *http.Request, body []byte) (int, interface{}, error) {
+	var input TransactionRequest
+	if err := decode(body, &input); err != nil {
+		return 0, nil, err
+	}
+	if input.Amount == 0 {
+		return 0, nil, invalid("invalid_amount", "amount is required")
+	}
+
+	response, err := server.Gateway.Refund(request.PathValue("id"), input.Amount, gomerchant.RefundParams{Captured: input.Captured})
+	if err != nil {
+		return 0, nil, withResponseCode(err, response.Params)
+	}
+	return http.StatusOK, TransactionResponse{TransactionID: response.TransactionID, Params: responseParams(response.Params)}, nil
+}
+
+func (server *Server) void(request *http.Request, body []byte) (int, interface{}, error) {
+	var input TransactionRequest
+	if err := decode(body, &input); err != nil {
+		return 0, nil, err
+	}
+
+	response, err := server.Gateway.Void(request.PathValue("id"), gomerchant.VoidParams{Captured: input.Captured})
+	if err != nil {
+		return 0, nil, withResponseCode(err, response.Params)
+	}
+	return http.StatusOK, TransactionResponse{TransactionID: response.TransactionID, Params: responseParams(response.Params)}, nil
+}
+
+func (server *Server) query(request *http.Request, body []byte) (int, interface{}, error) {
+	transaction, err := server.Gateway.Query(request.PathValue("id"))
+	if err != nil {
+		return 0, nil, withResponseCode(err, transaction.Params)
+	}
+
+	return http.StatusOK, Transaction{
+		ID:                   transaction.ID,
+		Amount:               transaction.Amount,
+		Currency:             transaction.Currency,
+		Captured:             transaction.Captured,
+		Paid:                 transaction.Paid,
+		Cancelled:            transaction.Cancelled,
+		Disputed:             transaction.Disputed,
+		Status:               transaction.Status,
+		CreatedAt:            transaction.CreatedAt,
+		AVS:                  AVS{Address: transaction.AVSResult.Address, PostalCode: transaction.AVSResult.PostalCode},
+		CVCResult:            transaction.CVCResult,
+		NetworkTransactionID: transaction.NetworkTransactionID,
+		AuthorizationCode:    transaction.AuthorizationCode,
+		Params:               responseParams(transaction.Params),
+	}, nil
+}
+
+var errCardsNotSupported = &Error{Status: http.StatusNotImplemented, Type: TypeInvalidRequest, Code: "not_supported", Message: "saved cards are not supported by the gateway"}
+
+func cardOf(card *gomerchant.CustomerCreditCard) Card {
+	return Card{CustomerID: card.CustomerID, CreditCardID: card.CreditCardID, MaskedNumber: card.MaskedNumber, Brand: card.Brand, ExpMonth: card.ExpMonth, ExpYear: card.ExpYear}
+}
+
+func (server *Server) listCards(request *http.Request, body []byte) (int, interface{}, error) {
+	if server.Cards == nil {
+		return 0, nil, errCardsNotSupported
+	}
+
+	response, err := server.Cards.ListCreditCards(gomerchant.ListCreditCardsParams{CustomerID: request.PathValue("customer")})
+	if err != nil {
+		return 0, nil, withResponseCode(err, response.Params)
+	}
+
+	list := CardList{Data: []Card{}}
+	for _, card := range response.CreditCards {
+		list.Data = append(list.Data, cardOf(card))
+	}
+	return http.StatusOK, list, nil
+}
+
+func (server *Server) createCard(request *http.Request, body []byte) (int, interface{}, error) {
+	if server.Cards == nil {
+		return 0, nil, errCardsNotSupported
+	}
+
+	var input CreditCard
+	if err := decode(body, &input); err != nil {
+		return 0, nil, err
+	}
+	customerID := request.PathValue("customer")
+	response, err := server.Cards.CreateCreditCard(gomerchant.CreateCreditCardParams{
+		CustomerID: customerID,
+		CreditCard: &gomerchant.CreditCard{Name: input.Name, Number: input.Number, ExpMonth: input.ExpMonth, ExpYear: input.ExpYear, CVC: input.CVC},
+	})
+	if err != nil {
+		return 0, nil, withResponseCode(err, response.Params)
+	}
+
+	if response.CustomerID == "" {
+		response.CustomerID = customerID
+	}
+	return http.StatusCreated, Card{CustomerID: response.CustomerID, CreditCardID: response.CreditCardID}, nil
+}
+
+func (server *Server) getCard(request *http.Request, body []byte) (int, interface{}, error) {
+	if server.Cards == nil {
+		return 0, nil, errCardsNotSupported
+	}
+
+	response, err := server.Cards.GetCreditCard(gomerchant.GetCreditCardParams{CustomerID: request.PathValue("customer"), CreditCardID: request.PathValue("card")})
+	if err != nil {
+		return 0, nil, withResponseCode(err, response.Params)
+	}
+	if response.CreditCard == nil {
+		return 0, nil, &Error{Status: http.StatusNotFound, Type: TypeInvalidRequest, Code: "not_found", Message: "no such card"}
+	}
+	return http.StatusOK, cardOf(response.CreditCard), nil
+}
+
+func (server *Server) deleteCard(request *http.Request, body []byte) (int, interface{}, error) {
+	if server.Cards == nil {
+		return 0, nil, errCardsNotSupported
+	}
+
+	customerID, cardID := request.PathValue("customer"), request.PathValue("card")
+	response, err := server.Cards.DeleteCreditCard(gomerchant.DeleteCreditCardParams{CustomerID: customerID, CreditCardID: cardID})
+	if err != nil {
+		return 0, nil, withResponseCode(err, response.Params)
+	}
+	return http.StatusOK, map[string]interface{}{"customer_id": customerID, "credit_card_id": cardID, "deleted": true}, nil
+}
@@ -0,0 +1,118 @@
+package server
+
+import (
+	"net/http"
+	"sync"
+	"time"
+)
+
+// SavedResponse response saved for an idempotency key
+type SavedResponse struct {
+	Status int
+	Body   []byte
+}
+
+// IdempotencyStore store of idempotency keys, keys are scoped by API key
+type IdempotencyStore interface {
+	// Start reserve key for a request with fingerprint, returns saved response if the key is completed,
+	// returns an error if the key is in progress, or it was used with another request
+	Start(key, fingerprint string) (*SavedResponse, error)
+	// Save save response of the key
+	Save(key string, response SavedResponse) error
+	// Release release key of a request that could be retried
+	Release(key string) error
+}
+
+var (
+	// ErrIdempotencyKeyInUse request with the same key is in progress
+	ErrIdempotencyKeyInUse = &Error{Status: http.StatusConflict, Type: TypeIdempotency, Code: "idempotency_key_in_use", Message: "a request with the same idempotency key is in progress"}
+	// ErrIdempotencyKeyReused key was used with another request
+	ErrIdempotencyKeyReused = &Error{Status: http.StatusUnprocessableEntity, Type: TypeIdempotency, Code: "idempotency_key_reused", Message: "idempotency key was used with another request"}
+)
+
+// MemoryIdempotencyStore in-memory idempotency store
+type MemoryIdempotencyStore struct {
+	TTL time.Duration // keys expire after TTL
+	Now func() time.Time
+
+	mutex   sync.Mutex
+	records map[string]*idempotencyRecord
+	sweptAt time.Time
+}
+
+type idempotencyRecord struct {
+	fingerprint string
+	response    *SavedResponse
+	createdAt   time.Time
+}
+
+// NewMemoryIdempotencyStore initialize in-memory idempotency store
+func NewMemoryIdempotencyStore(ttl time.Duration) *MemoryIdempotencyStore {
+	return &MemoryIdempotencyStore{TTL: ttl, records: map[string]*idempotencyRecord{}}
+}
+
+func (store *MemoryIdempotencyStore) now() time.Time {
+	if store.Now != nil {
+		return store.Now()
+	}
+	return time.Now()
+}
+
+// Start reserve key
+func (store *MemoryIdempotencyStore) Start(key, fingerprint string) (*SavedResponse, error) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	now := store.now()
+	store.sweep(now)
+
+	if record, ok := store.records[key]; ok && !store.expired(record, now) {
+		switch {
+		case record.fingerprint != fingerprint:
+			return nil, ErrIdempotencyKeyReused
+		case record.response == nil:
+			return nil, ErrIdempotencyKeyInUse
+		}
+		return record.response, nil
+	}
+
+	store.records[key] = &idempotencyRecord{fingerprint: fingerprint, createdAt: now}
+	return nil, nil
+}
+
+func (store *MemoryIdempotencyStore) expired(record *idempotencyRecord, now time.Time) bool {
+	return store.TTL > 0 && now.Sub(record.createdAt) > store.TTL
+}
+
+// sweep drop expired keys, at most once per minute, so requests are not slowed down by many keys
+func (store *MemoryIdempotencyStore) sweep(now time.Time) {
+	if now.Sub(store.sweptAt) < time.Minute {
+		return
+	}
+	store.sweptAt = now
+
+	for key, record := range store.records {
+		if store.expired(record, now) {
+			delete(store.records, key)
+		}
+	}
+}
+
+// Save save response of key
+func (store *MemoryIdempotencyStore) Save(key string, response SavedResponse) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	if record, ok := store.records[key]; ok {
+		record.response = &response
+	}
+	return nil
+}
+
+// Release release key
+func (store *MemoryIdempotencyStore) Release(key string) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	delete(store.records, key)
+	return nil
+}
@@ -0,0 +1,16 @@
+package server
+
+import (
+	_ "embed"
+	"net/http"
+)
+
+// OpenAPI OpenAPI 3 document of the API
+//
+//go:embed openapi.json
+var OpenAPI []byte
+
+func serveOpenAPI(writer http.ResponseWriter, request *http.Request) {
+	writer.Header().Set("Content-Type", "application/json")
+	writer.Write(OpenAPI)
+}
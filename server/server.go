@@ -0,0 +1,241 @@
+// Package server puts a PaymentGateway and a CreditCardManager behind a JSON REST API, for services that are not written in Go.
+//
+// Requests are authenticated with API keys, POST and DELETE requests with an `Idempotency-Key` header are processed once,
+// failures are returned as structured errors, and the API is described by the OpenAPI document served at /openapi.json.
+package server
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/qor/gomerchant"
+)
+
+// Server REST API of gateway
+type Server struct {
+	Gateway gomerchant.PaymentGateway
+	Cards   gomerchant.CreditCardManager // saved card endpoints respond not_supported if it is nil
+
+	APIKeys     []string         // keys accepted in `Authorization: Bearer <key>` or `X-API-Key` header
+	Idempotency IdempotencyStore // default in-memory store, use a shared store if the server runs in multiple processes
+	BaseURL     string           // base URL of 3D Secure redirect and return endpoints, default scheme and host of request
+
+	// ThreeDSecureParams set gateway params of 3D Secure, default PaygentThreeDSecureParams
+	ThreeDSecureParams func(params *gomerchant.AuthorizeParams, termURL string, secure ThreeDSecure)
+	ThreeDSecureTTL    time.Duration // how long a 3D Secure redirect is valid, default 30 minutes
+
+	Logger *log.Logger // default log.Default(), request bodies are never logged
+
+	once    sync.Once
+	mux     *http.ServeMux
+	pending *pendingStore
+}
+
+// New initialize server
+func New(gateway gomerchant.PaymentGateway, cards gomerchant.CreditCardManager, apiKeys ...string) *Server {
+	return &Server{Gateway: gateway, Cards: cards, APIKeys: apiKeys}
+}
+
+func (server *Server) init() {
+	server.once.Do(func() {
+		if server.Idempotency == nil {
+			server.Idempotency = NewMemoryIdempotencyStore(24 * time.Hour)
+		}
+		if server.ThreeDSecureParams == nil {
+			server.ThreeDSecureParams = PaygentThreeDSecureParams
+		}
+		if server.ThreeDSecureTTL <= 0 {
+			server.ThreeDSecureTTL = 30 * time.Minute
+		}
+		if server.Logger == nil {
+			server.Logger = log.Default()
+		}
+		server.pending = &pendingStore{pending: map[string]*pending{}}
+
+		mux := http.NewServeMux()
+		mux.Handle("GET /openapi.json", http.HandlerFunc(serveOpenAPI))
+
+		mux.Handle("POST /v1/authorizations", server.api(server.authorize))
+		mux.Handle("GET /v1/transactions/{id}", server.api(server.query))
+		mux.Handle("POST /v1/transactions/{id}/capture", server.api(server.capture))
+		mux.Handle("POST /v1/transactions/{id}/refund", server.api(server.refund))
+		mux.Handle("POST /v1/transactions/{id}/void", server.api(server.void))
+
+		mux.Handle("GET /v1/customers/{customer}/cards", server.api(server.listCards))
+		mux.Handle("POST /v1/customers/{customer}/cards", server.api(server.createCard))
+		mux.Handle("GET /v1/customers/{customer}/cards/{card}", server.api(server.getCard))
+		mux.Handle("DELETE /v1/customers/{customer}/cards/{card}", server.api(server.deleteCard))
+
+		// browser endpoints of 3D Secure, they are protected by unguessable tokens instead of API keys
+		mux.HandleFunc("GET /v1/3ds/{token}", server.redirectThreeDSecure)
+		mux.HandleFunc("POST /v1/3ds/{token}/return", server.returnThreeDSecure)
+		mux.HandleFunc("GET /v1/3ds/{token}/return", server.returnThreeDSecure)
+
+		mux.HandleFunc("/", func(writer http.ResponseWriter, request *http.Request) {
+			writeError(writer, &Error{Status: http.StatusNotFound, Type: TypeInvalidRequest, Code: "not_found", Message: "no such endpoint"})
+		})
+		server.mux = mux
+	})
+}
+
+// ServeHTTP serve API
+func (server *Server) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
+	server.init()
+	server.mux.ServeHTTP(writer, request)
+}
+
+// handler API handler, returns status and body, or an error
+type handler func(request *http.Request, body []byte) (int, interface{}, error)
+
+// api authenticate request, and process it once if it has an idempotency key
+func (server *Server) api(h handler) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		apiKey, ok := server.authenticate(request)
+		if !ok {
+			writer.Header().Set("WWW-Authenticate", `Bearer realm="gomerchant"`)
+			writeError(writer, &Error{Status: http.StatusUnauthorized, Type: TypeAuthentication, Code: "invalid_api_key", Message: "a valid API key is required"})
+			return
+		}
+
+		body, err := io.ReadAll(io.LimitReader(request.Body, 1<<20))
+		if err != nil {
+			writeError(writer, &Error{Status: http.StatusBadRequest, Type: TypeInvalidRequest, Code: "invalid_body", Message: err.Error()})
+			return
+		}
+
+		respond := func() (int, []byte, bool) {
+			status, value, err := h(request, body)
+			release := false
+			if err != nil {
+				release = beforeGateway(err)
+				e := errorOf(err)
+				setRetryAfter(writer, e)
+				if e.Status >= 500 {
+					server.Logger.Printf("gomerchant server: %v %v: %v", request.Method, request.URL.Path, err)
+				}
+				status, value = e.Status, errorBody{e}
+			}
+			data, _ := json.Marshal(value)
+			return status, data, release
+		}
+
+		key := request.Header.Get("Idempotency-Key")
+		if key == "" || request.Method == http.MethodGet {
+			status, data, _ := respond()
+			writeRaw(writer, status, data)
+			return
+		}
+
+		var (
+			scoped      = hash(apiKey, key)
+			fingerprint = hash(request.Method, request.URL.Path, string(body))
+		)
+
+		saved, err := server.Idempotency.Start(scoped, fingerprint)
+		if err != nil {
+			writeError(writer, errorOf(err))
+			return
+		}
+		if saved != nil {
+			writer.Header().Set("Idempotent-Replayed", "true")
+			writeRaw(writer, saved.Status, saved.Body)
+			return
+		}
+
+		completed := false
+		defer func() {
+			if completed {
+				return
+			}
+			// handler panicked, release the key so it isn't left in progress until it expires
+			server.Idempotency.Release(scoped)
+			if r := recover(); r != nil {
+				server.Logger.Printf("gomerchant server: %v %v panicked: %v", request.Method, request.URL.Path, r)
+				writeError(writer, &Error{Status: http.StatusInternalServerError, Type: TypeGateway, Code: "internal_error", Message: "internal error, the request could be retried with the same idempotency key"})
+			}
+		}()
+
+		status, data, release := respond()
+		completed = true
+		if release {
+			// gateway was not called, let clients retry with the same key,
+			// other failures are saved, as the gateway might have processed the request
+			server.Idempotency.Release(scoped)
+		} else if err := server.Idempotency.Save(scoped, SavedResponse{Status: status, Body: data}); err != nil {
+			server.Logger.Printf("gomerchant server: failed to save idempotent response: %v", err)
+		}
+		writeRaw(writer, status, data)
+	})
+}
+
+// authenticate returns matched API key
+func (server *Server) authenticate(request *http.Request) (string, bool) {
+	key := request.Header.Get("X-API-Key")
+	if auth := request.Header.Get("Authorization"); key == "" && strings.HasPrefix(auth, "Bearer ") {
+		key = strings.TrimPrefix(auth, "Bearer ")
+	}
+
+	if key == "" {
+		return "", false
+	}
+	for _, apiKey := range server.APIKeys {
+		if subtle.ConstantTimeCompare([]byte(apiKey), []byte(key)) == 1 {
+			return apiKey, true
+		}
+	}
+	return "", false
+}
+
+func (server *Server) baseURL(request *http.Request) string {
+	if server.BaseURL != "" {
+		return strings.TrimSuffix(server.BaseURL, "/")
+	}
+
+	scheme := "http"
+	if request.TLS != nil {
+		scheme = "https"
+	}
+	return scheme + "://" + request.Host
+}
+
+func hash(values ...string) string {
+	h := sha256.New()
+	for _, value := range values {
+		h.Write([]byte(value))
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func writeRaw(writer http.ResponseWriter, status int, data []byte) {
+	writer.Header().Set("Content-Type", "application/json")
+	writer.WriteHeader(status)
+	writer.Write(data)
+	writer.Write([]byte("\n"))
+}
+
+func writeJSON(writer http.ResponseWriter, status int, value interface{}) {
+	data, _ := json.Marshal(value)
+	writeRaw(writer, status, data)
+}
+
+func writeError(writer http.ResponseWriter, err *Error) {
+	setRetryAfter(writer, err)
+	writeJSON(writer, err.Status, errorBody{err})
+}
+
+func setRetryAfter(writer http.ResponseWriter, err *Error) {
+	if err.RetryAfter > 0 {
+		writer.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(err.RetryAfter.Seconds()))))
+	}
+}
@@ -0,0 +1,403 @@
+package server_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"html"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/qor/gomerchant"
+	"github.com/qor/gomerchant/gateways/paygent"
+	"github.com/qor/gomerchant/gateways/paygent/paygenttest"
+	"github.com/qor/gomerchant/resilience"
+	"github.com/qor/gomerchant/server"
+)
+
+const apiKey = "sk_test_server"
+
+type testServer struct {
+	*httptest.Server
+	paygent *paygenttest.Server
+	client  *http.Client
+}
+
+func newTestServer(t *testing.T) *testServer {
+	simulator := paygenttest.NewServer()
+	t.Cleanup(simulator.Close)
+
+	client := simulator.Paygent()
+	api := httptest.NewServer(server.New(client, client, apiKey))
+	t.Cleanup(api.Close)
+
+	return &testServer{
+		Server:  api,
+		paygent: simulator,
+		client: &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		}},
+	}
+}
+
+func (ts *testServer) do(t *testing.T, method, path string, body interface{}, headers ...string) (int, map[string]interface{}, http.Header) {
+	t.Helper()
+
+	var reader io.Reader
+	if body != nil {
+		data, _ := json.Marshal(body)
+		reader = bytes.NewReader(data)
+	}
+
+	request, _ := http.NewRequest(method, ts.URL+path, reader)
+	request.Header.Set("Authorization", "Bearer "+apiKey)
+	for i := 0; i+1 < len(headers); i += 2 {
+		request.Header.Set(headers[i], headers[i+1])
+	}
+
+	response, err := ts.client.Do(request)
+	if err != nil {
+		t.Fatalf("failed to request %v %v, got %v", method, path, err)
+	}
+	defer response.Body.Close()
+
+	var result map[string]interface{}
+	json.NewDecoder(response.Body).Decode(&result)
+	return response.StatusCode, result, response.Header
+}
+
+func errorCode(result map[string]interface{}) string {
+	if e, ok := result["error"].(map[string]interface{}); ok {
+		code, _ := e["code"].(string)
+		return code
+	}
+	return ""
+}
+
+func card(number string) map[string]interface{} {
+	return map[string]interface{}{"number": number, "exp_month": 1, "exp_year": time.Now().Year() + 1, "cvc": "123"}
+}
+
+func TestAuthentication(t *testing.T) {
+	ts := newTestServer(t)
+
+	for _, headers := range [][]string{{"Authorization", ""}, {"Authorization", "Bearer wrong"}} {
+		status, result, header := ts.do(t, "GET", "/v1/transactions/1", nil, headers...)
+		if status != http.StatusUnauthorized || errorCode(result) != "invalid_api_key" || header.Get("WWW-Authenticate") == "" {
+			t.Errorf("request with %v should be unauthorized, got %v %v", headers, status, result)
+		}
+	}
+
+	if status, _, _ := ts.do(t, "GET", "/v1/transactions/1", nil, "Authorization", "", "X-API-Key", apiKey); status == http.StatusUnauthorized {
+		t.Errorf("X-API-Key header should be accepted")
+	}
+}
+
+func TestPaymentEndpoints(t *testing.T) {
+	ts := newTestServer(t)
+
+	body := map[string]interface{}{"amount": 1000, "currency": "JPY", "order_id": "order-1", "payment_method": map[string]interface{}{"credit_card": card("4242424242424242")}}
+	status, authorized, _ := ts.do(t, "POST", "/v1/authorizations", body, "Idempotency-Key", "key-1")
+	transactionID, _ := authorized["transaction_id"].(string)
+	if status != http.StatusCreated || transactionID == "" || authorized["status"] != "authorized" {
+		t.Fatalf("failed to authorize, got %v %v", status, authorized)
+	}
+	if params, _ := authorized["params"].(map[string]interface{}); params["RawBody"] != nil {
+		t.Errorf("raw body should not be responded, got %v", params)
+	}
+
+	// retry with the same key
+	status, replayed, header := ts.do(t, "POST", "/v1/authorizations", body, "Idempotency-Key", "key-1")
+	if status != http.StatusCreated || replayed["transaction_id"] != transactionID || header.Get("Idempotent-Replayed") != "true" {
+		t.Errorf("retry should replay saved response, got %v %v", status, replayed)
+	}
+	if _, ok := ts.paygent.Payment("2"); ok {
+		t.Errorf("retry should not authorize again")
+	}
+
+	body["amount"] = 2000
+	if status, result, _ := ts.do(t, "POST", "/v1/authorizations", body, "Idempotency-Key", "key-1"); status != http.StatusUnprocessableEntity || errorCode(result) != "idempotency_key_reused" {
+		t.Errorf("key reused with another request should be rejected, got %v %v", status, result)
+	}
+
+	status, refunded, _ := ts.do(t, "POST", "/v1/transactions/"+transactionID+"/refund", map[string]interface{}{"amount": 100})
+	refundedID, _ := refunded["transaction_id"].(string)
+	if status != http.StatusOK || refundedID == "" {
+		t.Fatalf("failed to refund, got %v %v", status, refunded)
+	}
+
+	if status, result, _ := ts.do(t, "POST", "/v1/transactions/"+refundedID+"/capture", nil); status != http.StatusOK {
+		t.Fatalf("failed to capture, got %v %v", status, result)
+	}
+
+	status, transaction, _ := ts.do(t, "GET", "/v1/transactions/"+refundedID, nil)
+	if status != http.StatusOK || transaction["amount"] != float64(900) || transaction["captured"] != true {
+		t.Errorf("failed to query, got %v %v", status, transaction)
+	}
+
+	if status, result, _ := ts.do(t, "POST", "/v1/transactions/"+refundedID+"/void", map[string]interface{}{"captured": true}); status != http.StatusOK {
+		t.Errorf("failed to void, got %v %v", status, result)
+	}
+}
+
+func TestPaymentErrors(t *testing.T) {
+	ts := newTestServer(t)
+
+	status, result, _ := ts.do(t, "POST", "/v1/authorizations", map[string]interface{}{"amount": 1000, "payment_method": map[string]interface{}{"credit_card": card("4000000000000002")}})
+	if e, _ := result["error"].(map[string]interface{}); status != http.StatusPaymentRequired || e["code"] != "gateway_declined" || e["response_code"] != "P012" || e["type"] != server.TypeCard {
+		t.Errorf("declined card should respond card error with response code, got %v %v", status, result)
+	}
+
+	if status, result, _ := ts.do(t, "POST", "/v1/authorizations", map[string]interface{}{"amount": 1000, "payment_method": map[string]interface{}{}}); status != http.StatusBadRequest || errorCode(result) != "invalid_payment_method" {
+		t.Errorf("payment method should be required, got %v %v", status, result)
+	}
+
+	if status, result, _ := ts.do(t, "GET", "/v1/transactions/unknown", nil); status != http.StatusBadRequest || errorCode(result) != "invalid_field" {
+		t.Errorf("invalid telegram field should be invalid request, got %v %v", status, result)
+	}
+
+	if status, result, _ := ts.do(t, "POST", "/v1/authorizations", map[string]interface{}{"amount": 1000, "unknown": true}); status != http.StatusBadRequest || errorCode(result) != "invalid_body" {
+		t.Errorf("unknown fields should be rejected, got %v %v", status, result)
+	}
+
+	// failures of gateway are saved, as the gateway might have processed the request
+	ts.paygent.InjectFailure("020", paygenttest.Failure{StatusCode: http.StatusServiceUnavailable, Times: 1})
+	body := map[string]interface{}{"amount": 1000, "payment_method": map[string]interface{}{"credit_card": card("4242424242424242")}}
+	if status, result, _ := ts.do(t, "POST", "/v1/authorizations", body, "Idempotency-Key", "key-2"); status != http.StatusBadGateway || errorCode(result) != "gateway_error" {
+		t.Errorf("gateway failure should respond gateway error, got %v %v", status, result)
+	}
+	if status, result, header := ts.do(t, "POST", "/v1/authorizations", body, "Idempotency-Key", "key-2"); status != http.StatusBadGateway || header.Get("Idempotent-Replayed") != "true" {
+		t.Errorf("gateway failure should be replayed, got %v %v", status, result)
+	}
+
+	// invalid requests are not saved, so they could be fixed and retried with the same key
+	if status, result, _ := ts.do(t, "POST", "/v1/authorizations", map[string]interface{}{"amount": 1000, "payment_method": map[string]interface{}{}}, "Idempotency-Key", "key-3"); status != http.StatusBadRequest {
+		t.Errorf("payment method should be required, got %v %v", status, result)
+	}
+	if status, result, _ := ts.do(t, "POST", "/v1/authorizations", body, "Idempotency-Key", "key-3"); status != http.StatusCreated {
+		t.Errorf("request failed with invalid request should be retried, got %v %v", status, result)
+	}
+}
+
+func TestAuthorizeTimeout(t *testing.T) {
+	simulator := paygenttest.NewServer()
+	defer simulator.Close()
+	client := paygent.New(simulator.Config())
+	client.Config.Timeout = 50 * time.Millisecond
+	api := httptest.NewServer(server.New(client, client, apiKey))
+	defer api.Close()
+	ts := &testServer{Server: api, paygent: simulator, client: http.DefaultClient}
+
+	simulator.InjectFailure("020", paygenttest.Failure{Delay: time.Second, Times: 1})
+	body := map[string]interface{}{"amount": 1000, "payment_method": map[string]interface{}{"credit_card": card("4242424242424242")}}
+	if status, result, _ := ts.do(t, "POST", "/v1/authorizations", body, "Idempotency-Key", "key-1"); status != http.StatusGatewayTimeout || errorCode(result) != "gateway_timeout" {
+		t.Errorf("slow gateway should respond gateway timeout, got %v %v", status, result)
+	}
+
+	// authorization might have been processed by gateway, so it is not sent again
+	if status, result, header := ts.do(t, "POST", "/v1/authorizations", body, "Idempotency-Key", "key-1"); status != http.StatusGatewayTimeout || header.Get("Idempotent-Replayed") != "true" {
+		t.Errorf("timed out authorization should be replayed, got %v %v", status, result)
+	}
+}
+
+type unavailableGateway struct {
+	gomerchant.PaymentGateway
+}
+
+func (unavailableGateway) Authorize(uint64, gomerchant.AuthorizeParams) (gomerchant.AuthorizeResponse, error) {
+	return gomerchant.AuthorizeResponse{}, gomerchant.ErrExpiredCard
+}
+
+func (unavailableGateway) Capture(string, gomerchant.CaptureParams) (gomerchant.CaptureResponse, error) {
+	return gomerchant.CaptureResponse{}, &resilience.OpenError{State: resilience.Open, RetryAfter: 1500 * time.Millisecond}
+}
+
+func TestGatewayUnavailable(t *testing.T) {
+	api := httptest.NewServer(server.New(unavailableGateway{}, nil, apiKey))
+	defer api.Close()
+	ts := &testServer{Server: api, client: http.DefaultClient}
+
+	status, result, header := ts.do(t, "POST", "/v1/transactions/1/capture", nil)
+	if status != http.StatusServiceUnavailable || errorCode(result) != "gateway_unavailable" || header.Get("Retry-After") != "2" {
+		t.Errorf("open circuit should respond unavailable with retry after, got %v %v %v", status, result, header.Get("Retry-After"))
+	}
+
+	if status, result, _ := ts.do(t, "POST", "/v1/authorizations", map[string]interface{}{"amount": 1000, "payment_method": map[string]interface{}{"credit_card": card("4242424242424242")}}); status != http.StatusPaymentRequired || errorCode(result) != "expired_card" {
+		t.Errorf("card errors should be mapped, got %v %v", status, result)
+	}
+
+	if status, result, _ := ts.do(t, "GET", "/v1/customers/c1/cards", nil); status != http.StatusNotImplemented || errorCode(result) != "not_supported" {
+		t.Errorf("cards should not be supported without manager, got %v %v", status, result)
+	}
+}
+
+type panicGateway struct {
+	gomerchant.PaymentGateway
+	panicked bool
+}
+
+func (gateway *panicGateway) Authorize(uint64, gomerchant.AuthorizeParams) (gomerchant.AuthorizeResponse, error) {
+	if !gateway.panicked {
+		gateway.panicked = true
+		panic("unexpected response")
+	}
+	return gomerchant.AuthorizeResponse{TransactionID: "1"}, nil
+}
+
+func TestHandlerPanic(t *testing.T) {
+	s := server.New(&panicGateway{}, nil, apiKey)
+	s.Logger = log.New(io.Discard, "", 0)
+	api := httptest.NewServer(s)
+	defer api.Close()
+	ts := &testServer{Server: api, client: http.DefaultClient}
+
+	body := map[string]interface{}{"amount": 1000, "payment_method": map[string]interface{}{"credit_card": card("4242424242424242")}}
+	if status, result, _ := ts.do(t, "POST", "/v1/authorizations", body, "Idempotency-Key", "key-1"); status != http.StatusInternalServerError || errorCode(result) != "internal_error" {
+		t.Errorf("panic should respond internal error, got %v %v", status, result)
+	}
+
+	// key is released, so it is not left in progress
+	if status, result, _ := ts.do(t, "POST", "/v1/authorizations", body, "Idempotency-Key", "key-1"); status != http.StatusCreated || result["transaction_id"] != "1" {
+		t.Errorf("key should be released after panic, got %v %v", status, result)
+	}
+}
+
+func TestIdempotencyKeyExpired(t *testing.T) {
+	now := time.Now()
+	store := server.NewMemoryIdempotencyStore(30 * time.Second)
+	store.Now = func() time.Time { return now }
+
+	store.Start("key-1", "a")
+	store.Save("key-1", server.SavedResponse{Status: http.StatusOK})
+	if saved, err := store.Start("key-1", "b"); saved != nil || err != server.ErrIdempotencyKeyReused {
+		t.Errorf("key should be reused with another request, got %v %v", saved, err)
+	}
+
+	// expired key is dropped even if keys were swept recently
+	now = now.Add(31 * time.Second)
+	if saved, err := store.Start("key-1", "b"); saved != nil || err != nil {
+		t.Errorf("expired key should be reserved again, got %v %v", saved, err)
+	}
+}
+
+var (
+	formAction = regexp.MustCompile(`action="([^"]*)"`)
+	formInput  = regexp.MustCompile(`name="([^"]*)" value="([^"]*)"`)
+)
+
+func TestThreeDSecure(t *testing.T) {
+	ts := newTestServer(t)
+
+	status, authorized, _ := ts.do(t, "POST", "/v1/authorizations", map[string]interface{}{
+		"amount":         1000,
+		"order_id":       "order-3ds",
+		"payment_method": map[string]interface{}{"credit_card": card("5123459358515820")},
+		"three_d_secure": map[string]interface{}{"return_url": "https://shop.example.com/return?order=order-3ds", "user_agent": "Mozilla/5.0", "http_accept": "text/html"},
+	})
+	redirectURL, _ := authorized["redirect_url"].(string)
+	if status != http.StatusCreated || authorized["status"] != "requires_action" || !strings.HasPrefix(redirectURL, ts.URL+"/v1/3ds/") {
+		t.Fatalf("3D Secure card should require action, got %v %v", status, authorized)
+	}
+
+	// browser opens redirect url without API key
+	response, err := http.Get(redirectURL)
+	if err != nil {
+		t.Fatalf("failed to open redirect url, got %v", err)
+	}
+	page, _ := io.ReadAll(response.Body)
+	response.Body.Close()
+
+	action := formAction.FindStringSubmatch(string(page))
+	if action == nil {
+		t.Fatalf("redirect page should post to ACS, got %s", page)
+	}
+
+	// ACS posts the result to term url
+	form := url.Values{}
+	for _, input := range formInput.FindAllStringSubmatch(string(page), -1) {
+		form.Set(html.UnescapeString(input[1]), html.UnescapeString(input[2]))
+	}
+	response, err = ts.client.PostForm(html.UnescapeString(action[1]), form)
+	if err != nil {
+		t.Fatalf("failed to return from ACS, got %v", err)
+	}
+	response.Body.Close()
+
+	location, _ := url.Parse(response.Header.Get("Location"))
+	if response.StatusCode != http.StatusSeeOther || location.Host != "shop.example.com" || location.Query().Get("status") != "authorized" ||
+		location.Query().Get("order") != "order-3ds" || location.Query().Get("transaction_id") != authorized["transaction_id"] {
+		t.Fatalf("should redirect to return url, got %v %v", response.StatusCode, location)
+	}
+
+	if payment, _ := ts.paygent.Payment(authorized["transaction_id"].(string)); payment.Status != "20" {
+		t.Errorf("payment should be authorized after 3D Secure, got %+v", payment)
+	}
+
+	if response, _ := ts.client.PostForm(html.UnescapeString(action[1]), form); response.StatusCode != http.StatusNotFound {
+		t.Errorf("term url should be used once, got %v", response.StatusCode)
+	}
+}
+
+func TestCardEndpoints(t *testing.T) {
+	ts := newTestServer(t)
+
+	status, created, _ := ts.do(t, "POST", "/v1/customers/c1/cards", card("4242424242424242"))
+	cardID, _ := created["credit_card_id"].(string)
+	if status != http.StatusCreated || cardID == "" {
+		t.Fatalf("failed to create card, got %v %v", status, created)
+	}
+
+	status, list, _ := ts.do(t, "GET", "/v1/customers/c1/cards", nil)
+	if data, _ := list["data"].([]interface{}); status != http.StatusOK || len(data) != 1 {
+		t.Fatalf("failed to list cards, got %v %v", status, list)
+	}
+
+	status, got, _ := ts.do(t, "GET", "/v1/customers/c1/cards/"+cardID, nil)
+	if status != http.StatusOK || got["credit_card_id"] != cardID || strings.Contains(got["masked_number"].(string), "42424242") {
+		t.Errorf("failed to get card, got %v %v", status, got)
+	}
+
+	if status, result, _ := ts.do(t, "DELETE", "/v1/customers/c1/cards/"+cardID, nil, "Idempotency-Key", "delete-1"); status != http.StatusOK || result["deleted"] != true {
+		t.Errorf("failed to delete card, got %v %v", status, result)
+	}
+	if status, _, _ := ts.do(t, "DELETE", "/v1/customers/c1/cards/"+cardID, nil, "Idempotency-Key", "delete-1"); status != http.StatusOK {
+		t.Errorf("retried delete should replay response, got %v", status)
+	}
+}
+
+func TestOpenAPI(t *testing.T) {
+	ts := newTestServer(t)
+
+	response, err := http.Get(ts.URL + "/openapi.json")
+	if err != nil {
+		t.Fatalf("failed to get openapi document, got %v", err)
+	}
+	defer response.Body.Close()
+
+	var doc struct {
+		OpenAPI string                            `json:"openapi"`
+		Paths   map[string]map[string]interface{} `json:"paths"`
+	}
+	if err := json.NewDecoder(response.Body).Decode(&doc); err != nil || doc.OpenAPI == "" {
+		t.Fatalf("openapi document should be valid JSON, got %v", err)
+	}
+
+	for _, route := range []string{
+		"POST /v1/authorizations", "GET /v1/transactions/{id}", "POST /v1/transactions/{id}/capture",
+		"POST /v1/transactions/{id}/refund", "POST /v1/transactions/{id}/void",
+		"GET /v1/customers/{customer}/cards", "POST /v1/customers/{customer}/cards",
+		"GET /v1/customers/{customer}/cards/{card}", "DELETE /v1/customers/{customer}/cards/{card}",
+		"GET /v1/3ds/{token}", "POST /v1/3ds/{token}/return",
+	} {
+		parts := strings.SplitN(route, " ", 2)
+		if _, ok := doc.Paths[parts[1]][strings.ToLower(parts[0])]; !ok {
+			t.Errorf("route %v is not documented", route)
+		}
+	}
+}
@@ -0,0 +1,155 @@
+package server
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/qor/gomerchant"
+	"github.com/qor/gomerchant/gateways/paygent"
+)
+
+// PaygentThreeDSecureParams set 3D Secure params of Paygent
+func PaygentThreeDSecureParams(params *gomerchant.AuthorizeParams, termURL string, secure ThreeDSecure) {
+	params.Set("Paygent3DMode", true)
+	params.Set("Paygent3DParams", paygent.SecureCodeParams{UserAgent: secure.UserAgent, TermURL: termURL, HttpAccept: secure.HTTPAccept})
+}
+
+func (secure *ThreeDSecure) returnURL() string {
+	if secure == nil {
+		return ""
+	}
+	return secure.ReturnURL
+}
+
+// pending authorization that waits for 3D Secure, it is kept in memory, so browsers should be redirected to the same process
+type pending struct {
+	transactionID string
+	handler       func(http.ResponseWriter, *http.Request, gomerchant.Params) error
+	returnURL     string
+	expiresAt     time.Time
+}
+
+type pendingStore struct {
+	mutex   sync.Mutex
+	pending map[string]*pending
+	sweptAt time.Time
+}
+
+func (store *pendingStore) add(token string, p *pending) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	store.sweep(time.Now())
+	store.pending[token] = p
+}
+
+// sweep drop expired authentications, at most once per minute, so adding is not slowed down by many pending ones
+func (store *pendingStore) sweep(now time.Time) {
+	if now.Sub(store.sweptAt) < time.Minute {
+		return
+	}
+	store.sweptAt = now
+
+	for token, p := range store.pending {
+		if now.After(p.expiresAt) {
+			delete(store.pending, token)
+		}
+	}
+}
+
+func (store *pendingStore) get(token string) (*pending, bool) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	p, ok := store.pending[token]
+	if ok && time.Now().After(p.expiresAt) {
+		delete(store.pending, token)
+		return nil, false
+	}
+	return p, ok
+}
+
+// take get pending authentication and remove it, so it could only be completed once
+func (store *pendingStore) take(token string) (*pending, bool) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	p, ok := store.pending[token]
+	if !ok {
+		return nil, false
+	}
+	delete(store.pending, token)
+	if time.Now().After(p.expiresAt) {
+		return nil, false
+	}
+	return p, true
+}
+
+func newToken() string {
+	token := make([]byte, 24)
+	rand.Read(token)
+	return hex.EncodeToString(token)
+}
+
+var errThreeDSecureNotFound = &Error{Status: http.StatusNotFound, Type: TypeInvalidRequest, Code: "not_found", Message: "3D Secure authentication is not found or expired"}
+
+// redirectThreeDSecure serve page of gateway that redirects customer's browser to ACS
+func (server *Server) redirectThreeDSecure(writer http.ResponseWriter, request *http.Request) {
+	p, ok := server.pending.get(request.PathValue("token"))
+	if !ok {
+		writeError(writer, errThreeDSecureNotFound)
+		return
+	}
+
+	writer.Header().Set("Cache-Control", "no-store")
+	if err := p.handler(writer, request, gomerchant.Params{}); err != nil {
+		server.Logger.Printf("gomerchant server: failed to redirect 3D Secure of %v: %v", p.transactionID, err)
+	}
+}
+
+// returnThreeDSecure complete authorization with result of ACS, then redirect to return URL
+func (server *Server) returnThreeDSecure(writer http.ResponseWriter, request *http.Request) {
+	p, ok := server.pending.take(request.PathValue("token"))
+	if !ok {
+		writeError(writer, errThreeDSecureNotFound)
+		return
+	}
+
+	response, err := server.Gateway.CompleteAuthorize(p.transactionID, gomerchant.CompleteAuthorizeParams{Params: gomerchant.Params{"request": request}})
+	var apiErr *Error
+	if err != nil {
+		apiErr = errorOf(withResponseCode(err, response.Params))
+		server.Logger.Printf("gomerchant server: failed to complete 3D Secure of %v: %v", p.transactionID, err)
+	}
+
+	writer.Header().Set("Cache-Control", "no-store")
+	if p.returnURL == "" {
+		if apiErr != nil {
+			writeError(writer, apiErr)
+			return
+		}
+		writeJSON(writer, http.StatusOK, AuthorizeResponse{TransactionID: p.transactionID, Status: "authorized", Params: responseParams(response.Params)})
+		return
+	}
+
+	returnURL, err := url.Parse(p.returnURL)
+	if err != nil {
+		writeError(writer, invalid("invalid_return_url", err.Error()))
+		return
+	}
+
+	query := returnURL.Query()
+	query.Set("transaction_id", p.transactionID)
+	if apiErr != nil {
+		query.Set("status", "failed")
+		query.Set("error_code", apiErr.Code)
+	} else {
+		query.Set("status", "authorized")
+	}
+	returnURL.RawQuery = query.Encode()
+	http.Redirect(writer, request, returnURL.String(), http.StatusSeeOther)
+}
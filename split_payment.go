@@ -0,0 +1,100 @@
+package gomerchant
+
+import (
+	"errors"
+	"fmt"
+)
+
+// SplitMode how funds of a split payment are moved to connected accounts
+type SplitMode string
+
+const (
+	// SplitDestination funds are moved to the only recipient when the payment is captured, platform keeps the application fee
+	SplitDestination SplitMode = "destination"
+	// SplitSeparate payment is charged by platform, funds are transferred to recipients separately after captured
+	SplitSeparate SplitMode = "separate"
+)
+
+// SplitPayment describes how a payment is split between the platform and connected accounts (sellers) of a marketplace
+type SplitPayment struct {
+	Mode           SplitMode
+	OnBehalfOf     string // account that settles the payment, it will be shown on customer's statement
+	ApplicationFee uint64 // amount kept by the platform, destination mode only
+	TransferGroup  string // group payment and transfers, default is order id
+	Recipients     []SplitRecipient
+}
+
+// SplitRecipient connected account that receives funds
+type SplitRecipient struct {
+	Account     string
+	Amount      uint64 // amount for destination mode is payment amount - application fee if it is zero
+	Description string
+}
+
+// ErrInvalidSplitPayment split payment can't be applied to the payment
+var ErrInvalidSplitPayment = errors.New("gomerchant: invalid split payment")
+
+// Validate validate split payment for amount
+func (split SplitPayment) Validate(amount uint64) error {
+	var total = split.ApplicationFee
+
+	for _, recipient := range split.Recipients {
+		if recipient.Account == "" {
+			return fmt.Errorf("%w: recipient account is required", ErrInvalidSplitPayment)
+		}
+		total += recipient.Amount
+	}
+
+	switch split.Mode {
+	case SplitDestination:
+		if len(split.Recipients) != 1 {
+			return fmt.Errorf("%w: destination payment should have only one recipient", ErrInvalidSplitPayment)
+		}
+	case SplitSeparate:
+		if len(split.Recipients) == 0 {
+			return fmt.Errorf("%w: no recipients", ErrInvalidSplitPayment)
+		}
+		if split.ApplicationFee > 0 {
+			return fmt.Errorf("%w: application fee is not supported for separate transfers, platform keeps what is not transferred", ErrInvalidSplitPayment)
+		}
+	default:
+		return fmt.Errorf("%w: unknown mode %q", ErrInvalidSplitPayment, split.Mode)
+	}
+
+	if total > amount {
+		return fmt.Errorf("%w: split amount %v is greater than payment amount %v", ErrInvalidSplitPayment, total, amount)
+	}
+	return nil
+}
+
+// Allocate allocate refunded amount of a payment of total to recipients in proportion to their amount, used to reverse transfers when refund,
+// rounding remainder goes to the first recipients
+func (split SplitPayment) Allocate(amount, total uint64) []uint64 {
+	var (
+		allocated = make([]uint64, len(split.Recipients))
+		sum       uint64
+		received  uint64
+	)
+
+	if total == 0 {
+		return allocated
+	}
+
+	if amount > total {
+		amount = total
+	}
+
+	for idx, recipient := range split.Recipients {
+		allocated[idx] = recipient.Amount * amount / total
+		sum += allocated[idx]
+		received += recipient.Amount
+	}
+
+	for idx, target := 0, received*amount/total; sum < target; idx = (idx + 1) % len(allocated) {
+		if allocated[idx] < split.Recipients[idx].Amount {
+			allocated[idx]++
+			sum++
+		}
+	}
+	return allocated
+}
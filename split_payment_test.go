@@ -0,0 +1,54 @@
+package gomerchant
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestSplitPaymentValidate(t *testing.T) {
+	cases := []struct {
+		split SplitPayment
+		valid bool
+	}{
+		{SplitPayment{Mode: SplitDestination, ApplicationFee: 100, Recipients: []SplitRecipient{{Account: "acct_1"}}}, true},
+		{SplitPayment{Mode: SplitDestination, Recipients: []SplitRecipient{{Account: "acct_1"}, {Account: "acct_2"}}}, false},
+		{SplitPayment{Mode: SplitDestination, ApplicationFee: 1001, Recipients: []SplitRecipient{{Account: "acct_1"}}}, false},
+		{SplitPayment{Mode: SplitSeparate, Recipients: []SplitRecipient{{Account: "acct_1", Amount: 500}, {Account: "acct_2", Amount: 500}}}, true},
+		{SplitPayment{Mode: SplitSeparate, Recipients: []SplitRecipient{{Account: "acct_1", Amount: 500}, {Account: "acct_2", Amount: 501}}}, false},
+		{SplitPayment{Mode: SplitSeparate, ApplicationFee: 100, Recipients: []SplitRecipient{{Account: "acct_1", Amount: 500}}}, false},
+		{SplitPayment{Mode: SplitSeparate, Recipients: []SplitRecipient{{Amount: 500}}}, false},
+		{SplitPayment{Mode: "unknown", Recipients: []SplitRecipient{{Account: "acct_1"}}}, false},
+	}
+
+	for idx, c := range cases {
+		err := c.split.Validate(1000)
+		if c.valid != (err == nil) {
+			t.Errorf("#%v: valid should be %v, but got %v", idx, c.valid, err)
+		}
+		if err != nil && !errors.Is(err, ErrInvalidSplitPayment) {
+			t.Errorf("#%v: error should be ErrInvalidSplitPayment, but got %v", idx, err)
+		}
+	}
+}
+
+func TestSplitPaymentAllocate(t *testing.T) {
+	split := SplitPayment{Recipients: []SplitRecipient{{Amount: 500}, {Amount: 200}, {Amount: 100}}}
+
+	cases := []struct {
+		amount   uint64
+		expected []uint64
+	}{
+		{300, []uint64{150, 60, 30}},
+		{1000, []uint64{500, 200, 100}},
+		{2000, []uint64{500, 200, 100}},
+		{333, []uint64{167, 66, 33}},
+		{0, []uint64{0, 0, 0}},
+	}
+
+	for _, c := range cases {
+		if allocated := split.Allocate(c.amount, 1000); !reflect.DeepEqual(allocated, c.expected) {
+			t.Errorf("allocate %v should be %v, but got %v", c.amount, c.expected, allocated)
+		}
+	}
+}
@@ -0,0 +1,194 @@
+package telemetry
+
+import (
+	"context"
+
+	"github.com/qor/gomerchant"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// ContextPaymentGateway gateway that sends requests with context, like Paygent, context of operation span is passed to it,
+// so spans of its requests (like RequestInterceptor's) nest under the operation span
+type ContextPaymentGateway interface {
+	PaymentGatewayWithContext(ctx context.Context) gomerchant.PaymentGateway
+}
+
+// ContextCreditCardManager credit card manager that sends requests with context, like Paygent
+type ContextCreditCardManager interface {
+	CreditCardManagerWithContext(ctx context.Context) gomerchant.CreditCardManager
+}
+
+// Gateway trace and measure operations of wrapped gateway
+type Gateway struct {
+	gomerchant.PaymentGateway
+	Name string
+
+	instruments *instruments
+	ctx         context.Context
+}
+
+var _ gomerchant.PaymentGateway = &Gateway{}
+
+// NewGateway wrap gateway, name is used as gomerchant.gateway attribute, like "stripe" or "paygent"
+func NewGateway(gateway gomerchant.PaymentGateway, name string, config Config) *Gateway {
+	return &Gateway{PaymentGateway: gateway, Name: name, instruments: newInstruments(config)}
+}
+
+func (gateway *Gateway) attributes(operation string) []attribute.KeyValue {
+	return []attribute.KeyValue{GatewayKey.String(gateway.Name), OperationKey.String(operation)}
+}
+
+// WithContext returns a Gateway whose spans are children of the span in ctx, like span of the incoming request,
+// spans are roots of new traces if context is not set
+func (gateway *Gateway) WithContext(ctx context.Context) *Gateway {
+	copied := *gateway
+	copied.ctx = ctx
+	return &copied
+}
+
+func (gateway *Gateway) context() context.Context {
+	if gateway.ctx != nil {
+		return gateway.ctx
+	}
+	return context.Background()
+}
+
+// withContext pass context of operation's span to wrapped gateway if it sends requests with context
+func (gateway *Gateway) withContext(ctx context.Context) gomerchant.PaymentGateway {
+	if wrapped, ok := gateway.PaymentGateway.(ContextPaymentGateway); ok {
+		return wrapped.PaymentGatewayWithContext(ctx)
+	}
+	return gateway.PaymentGateway
+}
+
+// Authorize authorize
+func (gateway *Gateway) Authorize(amount uint64, params gomerchant.AuthorizeParams) (response gomerchant.AuthorizeResponse, err error) {
+	err = gateway.instruments.observe(gateway.context(), gateway.attributes("authorize"), func(ctx context.Context) (string, error) {
+		response, err = gateway.withContext(ctx).Authorize(amount, params)
+		return responseCode(response.Params), err
+	})
+	return
+}
+
+// CompleteAuthorize complete authorize
+func (gateway *Gateway) CompleteAuthorize(paymentID string, params gomerchant.CompleteAuthorizeParams) (response gomerchant.CompleteAuthorizeResponse, err error) {
+	err = gateway.instruments.observe(gateway.context(), gateway.attributes("complete_authorize"), func(ctx context.Context) (string, error) {
+		response, err = gateway.withContext(ctx).CompleteAuthorize(paymentID, params)
+		return responseCode(response.Params), err
+	})
+	return
+}
+
+// Capture capture
+func (gateway *Gateway) Capture(transactionID string, params gomerchant.CaptureParams) (response gomerchant.CaptureResponse, err error) {
+	err = gateway.instruments.observe(gateway.context(), gateway.attributes("capture"), func(ctx context.Context) (string, error) {
+		response, err = gateway.withContext(ctx).Capture(transactionID, params)
+		return responseCode(response.Params), err
+	})
+	return
+}
+
+// Refund refund
+func (gateway *Gateway) Refund(transactionID string, amount uint, params gomerchant.RefundParams) (response gomerchant.RefundResponse, err error) {
+	err = gateway.instruments.observe(gateway.context(), gateway.attributes("refund"), func(ctx context.Context) (string, error) {
+		response, err = gateway.withContext(ctx).Refund(transactionID, amount, params)
+		return responseCode(response.Params), err
+	})
+	return
+}
+
+// Void void
+func (gateway *Gateway) Void(transactionID string, params gomerchant.VoidParams) (response gomerchant.VoidResponse, err error) {
+	err = gateway.instruments.observe(gateway.context(), gateway.attributes("void"), func(ctx context.Context) (string, error) {
+		response, err = gateway.withContext(ctx).Void(transactionID, params)
+		return responseCode(response.Params), err
+	})
+	return
+}
+
+// Query query
+func (gateway *Gateway) Query(transactionID string) (transaction gomerchant.Transaction, err error) {
+	err = gateway.instruments.observe(gateway.context(), gateway.attributes("query"), func(ctx context.Context) (string, error) {
+		transaction, err = gateway.withContext(ctx).Query(transactionID)
+		return responseCode(transaction.Params), err
+	})
+	return
+}
+
+// CreditCardManager trace and measure operations of wrapped credit card manager
+type CreditCardManager struct {
+	gomerchant.CreditCardManager
+	Name string
+
+	instruments *instruments
+	ctx         context.Context
+}
+
+var _ gomerchant.CreditCardManager = &CreditCardManager{}
+
+// NewCreditCardManager wrap credit card manager, name is used as gomerchant.gateway attribute
+func NewCreditCardManager(manager gomerchant.CreditCardManager, name string, config Config) *CreditCardManager {
+	return &CreditCardManager{CreditCardManager: manager, Name: name, instruments: newInstruments(config)}
+}
+
+func (manager *CreditCardManager) attributes(operation string) []attribute.KeyValue {
+	return []attribute.KeyValue{GatewayKey.String(manager.Name), OperationKey.String(operation)}
+}
+
+// WithContext returns a CreditCardManager whose spans are children of the span in ctx, like span of the incoming request
+func (manager *CreditCardManager) WithContext(ctx context.Context) *CreditCardManager {
+	copied := *manager
+	copied.ctx = ctx
+	return &copied
+}
+
+func (manager *CreditCardManager) context() context.Context {
+	if manager.ctx != nil {
+		return manager.ctx
+	}
+	return context.Background()
+}
+
+// withContext pass context of operation's span to wrapped manager if it sends requests with context
+func (manager *CreditCardManager) withContext(ctx context.Context) gomerchant.CreditCardManager {
+	if wrapped, ok := manager.CreditCardManager.(ContextCreditCardManager); ok {
+		return wrapped.CreditCardManagerWithContext(ctx)
+	}
+	return manager.CreditCardManager
+}
+
+// CreateCreditCard create credit card
+func (manager *CreditCardManager) CreateCreditCard(params gomerchant.CreateCreditCardParams) (response gomerchant.CreditCardResponse, err error) {
+	err = manager.instruments.observe(manager.context(), manager.attributes("create_credit_card"), func(ctx context.Context) (string, error) {
+		response, err = manager.withContext(ctx).CreateCreditCard(params)
+		return responseCode(response.Params), err
+	})
+	return
+}
+
+// GetCreditCard get credit card
+func (manager *CreditCardManager) GetCreditCard(params gomerchant.GetCreditCardParams) (response gomerchant.GetCreditCardResponse, err error) {
+	err = manager.instruments.observe(manager.context(), manager.attributes("get_credit_card"), func(ctx context.Context) (string, error) {
+		response, err = manager.withContext(ctx).GetCreditCard(params)
+		return responseCode(response.Params), err
+	})
+	return
+}
+
+// ListCreditCards list credit cards
+func (manager *CreditCardManager) ListCreditCards(params gomerchant.ListCreditCardsParams) (response gomerchant.ListCreditCardsResponse, err error) {
+	err = manager.instruments.observe(manager.context(), manager.attributes("list_credit_cards"), func(ctx context.Context) (string, error) {
+		response, err = manager.withContext(ctx).ListCreditCards(params)
+		return responseCode(response.Params), err
+	})
+	return
+}
+
+// DeleteCreditCard delete credit card
+func (manager *CreditCardManager) DeleteCreditCard(params gomerchant.DeleteCreditCardParams) (response gomerchant.DeleteCreditCardResponse, err error) {
+	err = manager.instruments.observe(manager.context(), manager.attributes("delete_credit_card"), func(ctx context.Context) (string, error) {
+		response, err = manager.withContext(ctx).DeleteCreditCard(params)
+		return responseCode(response.Params), err
+	})
+	return
+}
@@ -0,0 +1,24 @@
+package telemetry
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// RequestInterceptor trace and measure every request sent by a gateway client with interceptors, like telegrams of Paygent,
+// spans are children of the span in ctx, like spans of Gateway that wraps the client, responseCode returns response code of response
+//
+//	Paygent.Use(telemetry.RequestInterceptor(config, "paygent", func(response paygent.Response) string { return response.ResponseCode }))
+func RequestInterceptor[Response any](config Config, gateway string, responseCode func(Response) string) func(ctx context.Context, kind string, next func(context.Context) (Response, error)) (Response, error) {
+	instruments := newInstruments(config)
+
+	return func(ctx context.Context, kind string, next func(context.Context) (Response, error)) (response Response, err error) {
+		attrs := []attribute.KeyValue{GatewayKey.String(gateway), OperationKey.String("request"), RequestKindKey.String(kind)}
+		err = instruments.observe(ctx, attrs, func(ctx context.Context) (string, error) {
+			response, err = next(ctx)
+			return responseCode(response), err
+		})
+		return
+	}
+}
@@ -0,0 +1,190 @@
+// Package telemetry instruments payment gateways with OpenTelemetry traces and metrics, it is opt-in by wrapping gateways.
+//
+// Spans and metrics only carry operation, gateway, request kind, result, response code and decline category,
+// params, card data and customer data are never recorded.
+package telemetry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/qor/gomerchant"
+	stripe "github.com/stripe/stripe-go"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// ScopeName instrumentation scope name of tracer and meter
+const ScopeName = "github.com/qor/gomerchant/telemetry"
+
+// Attribute keys
+const (
+	OperationKey       = attribute.Key("gomerchant.operation")
+	GatewayKey         = attribute.Key("gomerchant.gateway")
+	ResultKey          = attribute.Key("gomerchant.result") // success or failure
+	ResponseCodeKey    = attribute.Key("gomerchant.response_code")
+	DeclineCategoryKey = attribute.Key("gomerchant.decline_category")
+	RequestKindKey     = attribute.Key("gomerchant.request_kind") // kind of request of RequestInterceptor, like telegram kind of Paygent
+)
+
+// Decline categories of failed operations
+const (
+	CategoryDeclined = "declined" // declined by issuer or gateway, like insufficient funds
+	CategoryInvalid  = "invalid"  // invalid request, like invalid card number or params
+	CategoryTimeout  = "timeout"
+	CategoryNetwork  = "network"
+	CategoryError    = "error"
+)
+
+// Config telemetry config
+type Config struct {
+	TracerProvider trace.TracerProvider // default otel.GetTracerProvider()
+	MeterProvider  metric.MeterProvider // default otel.GetMeterProvider()
+
+	// Categorize decline category of failed operations, default Categorize
+	Categorize func(err error, responseCode string) string
+}
+
+// Categorize decline category of error, response code is the code returned by gateway, like Paygent's response_code
+func Categorize(err error, responseCode string) string {
+	var (
+		stripeErr *stripe.Error
+		netErr    net.Error
+	)
+
+	switch {
+	case errors.Is(err, gomerchant.ErrCardDeclined), errors.Is(err, gomerchant.ErrExpiredCard),
+		errors.Is(err, gomerchant.ErrIncorrectCVC), errors.Is(err, gomerchant.ErrIncorrectZip):
+		return CategoryDeclined
+	case errors.Is(err, gomerchant.ErrInvalidNumber), errors.Is(err, gomerchant.ErrInvalidExpiryMonth),
+		errors.Is(err, gomerchant.ErrInvalidExpiryYear), errors.Is(err, gomerchant.ErrInvalidCVC),
+		errors.Is(err, gomerchant.ErrIncorrectNumber):
+		return CategoryInvalid
+	case errors.Is(err, context.DeadlineExceeded), errors.As(err, &netErr) && netErr.Timeout():
+		return CategoryTimeout
+	case errors.As(err, &stripeErr):
+		switch stripeErr.Type {
+		case stripe.ErrorTypeCard:
+			return CategoryDeclined
+		case stripe.ErrorTypeInvalidRequest:
+			return CategoryInvalid
+		case stripe.ErrorTypeAPIConnection:
+			return CategoryNetwork
+		}
+	case errors.As(err, &netErr):
+		return CategoryNetwork
+	case responseCode != "":
+		// gateway processed the request and rejected it
+		return CategoryDeclined
+	}
+	return CategoryError
+}
+
+// instruments tracer and metric instruments shared by wrappers
+type instruments struct {
+	config     Config
+	tracer     trace.Tracer
+	operations metric.Int64Counter
+	duration   metric.Float64Histogram
+}
+
+func newInstruments(config Config) *instruments {
+	if config.TracerProvider == nil {
+		config.TracerProvider = otel.GetTracerProvider()
+	}
+	if config.MeterProvider == nil {
+		config.MeterProvider = otel.GetMeterProvider()
+	}
+	if config.Categorize == nil {
+		config.Categorize = Categorize
+	}
+
+	meter := config.MeterProvider.Meter(ScopeName)
+	operations, err := meter.Int64Counter("gomerchant.operations", metric.WithDescription("Number of gateway operations"), metric.WithUnit("{operation}"))
+	if err != nil {
+		otel.Handle(err)
+	}
+	duration, err := meter.Float64Histogram("gomerchant.operation.duration", metric.WithDescription("Latency of gateway operations"), metric.WithUnit("s"))
+	if err != nil {
+		otel.Handle(err)
+	}
+
+	return &instruments{
+		config:     config,
+		tracer:     config.TracerProvider.Tracer(ScopeName),
+		operations: operations,
+		duration:   duration,
+	}
+}
+
+// observe run operation in a span of parent context, and record its result, fn is called with context of the span, returns response code of gateway if any
+func (instruments *instruments) observe(parent context.Context, attrs []attribute.KeyValue, fn func(context.Context) (string, error)) error {
+	var (
+		ctx, span = instruments.tracer.Start(parent, spanName(attrs), trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(attrs...))
+		start     = time.Now()
+	)
+	defer span.End()
+
+	responseCode, err := fn(ctx)
+	if responseCode == "" {
+		responseCode = errorCode(err)
+	}
+
+	if err == nil {
+		attrs = append(attrs, ResultKey.String("success"))
+	} else {
+		attrs = append(attrs, ResultKey.String("failure"), DeclineCategoryKey.String(instruments.config.Categorize(err, responseCode)))
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	if responseCode != "" {
+		attrs = append(attrs, ResponseCodeKey.String(responseCode))
+	}
+	span.SetAttributes(attrs...)
+
+	set := metric.WithAttributes(attrs...)
+	instruments.operations.Add(ctx, 1, set)
+	instruments.duration.Record(ctx, time.Since(start).Seconds(), set)
+	return err
+}
+
+func spanName(attrs []attribute.KeyValue) string {
+	var gateway, operation string
+	for _, attr := range attrs {
+		switch attr.Key {
+		case GatewayKey:
+			gateway = attr.Value.AsString()
+		case OperationKey:
+			operation = attr.Value.AsString()
+		case RequestKindKey:
+			operation = fmt.Sprintf("%v %v", operation, attr.Value.AsString())
+		}
+	}
+	return fmt.Sprintf("%v.%v", gateway, operation)
+}
+
+// errorCode decline code or error code of stripe errors
+func errorCode(err error) string {
+	var stripeErr *stripe.Error
+	if errors.As(err, &stripeErr) {
+		if stripeErr.DeclineCode != "" {
+			return string(stripeErr.DeclineCode)
+		}
+		return string(stripeErr.Code)
+	}
+	return ""
+}
+
+// responseCode response code from gateway's response params, like Paygent's response_code
+func responseCode(params gomerchant.Params) string {
+	if value, ok := params.Get("response_code"); ok {
+		return fmt.Sprint(value)
+	}
+	return ""
+}
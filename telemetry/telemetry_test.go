@@ -0,0 +1,249 @@
+package telemetry_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/qor/gomerchant"
+	"github.com/qor/gomerchant/gateways/paygent"
+	"github.com/qor/gomerchant/gateways/paygent/paygenttest"
+	"github.com/qor/gomerchant/telemetry"
+	stripe "github.com/stripe/stripe-go"
+	"go.opentelemetry.io/otel/attribute"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+const cardNumber = "4242424242424242"
+
+func newConfig() (telemetry.Config, *tracetest.InMemoryExporter, *sdkmetric.ManualReader) {
+	var (
+		exporter = tracetest.NewInMemoryExporter()
+		reader   = sdkmetric.NewManualReader()
+	)
+	return telemetry.Config{
+		TracerProvider: sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter)),
+		MeterProvider:  sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader)),
+	}, exporter, reader
+}
+
+func attributes(attrs []attribute.KeyValue) map[attribute.Key]string {
+	values := map[attribute.Key]string{}
+	for _, attr := range attrs {
+		values[attr.Key] = attr.Value.Emit()
+	}
+	return values
+}
+
+// counts sum of gomerchant.operations by operation and result
+func counts(t *testing.T, reader *sdkmetric.ManualReader) (map[string]int64, int) {
+	t.Helper()
+	var data metricdata.ResourceMetrics
+	if err := reader.Collect(context.Background(), &data); err != nil {
+		t.Fatalf("failed to collect metrics, got %v", err)
+	}
+
+	var (
+		results    = map[string]int64{}
+		histograms int
+	)
+	for _, scope := range data.ScopeMetrics {
+		for _, m := range scope.Metrics {
+			switch m.Name {
+			case "gomerchant.operations":
+				for _, point := range m.Data.(metricdata.Sum[int64]).DataPoints {
+					operation, _ := point.Attributes.Value(telemetry.OperationKey)
+					result, _ := point.Attributes.Value(telemetry.ResultKey)
+					category, _ := point.Attributes.Value(telemetry.DeclineCategoryKey)
+					key := operation.AsString() + " " + result.AsString()
+					if category.AsString() != "" {
+						key += " " + category.AsString()
+					}
+					results[key] += point.Value
+				}
+			case "gomerchant.operation.duration":
+				for _, point := range m.Data.(metricdata.Histogram[float64]).DataPoints {
+					histograms += int(point.Count)
+				}
+			}
+		}
+	}
+	return results, histograms
+}
+
+func paygentResponseCode(response paygent.Response) string {
+	return response.ResponseCode
+}
+
+func TestRequestInterceptor(t *testing.T) {
+	server := paygenttest.NewServer()
+	defer server.Close()
+
+	config, exporter, reader := newConfig()
+	client := server.Paygent()
+	client.Use(telemetry.RequestInterceptor(config, "paygent", paygentResponseCode))
+
+	response, err := client.Authorize(1000, gomerchant.AuthorizeParams{
+		Currency: "JPY",
+		OrderID:  "order-1",
+		PaymentMethod: &gomerchant.PaymentMethod{
+			CreditCard: &gomerchant.CreditCard{Name: "VISA", Number: cardNumber, ExpMonth: 1, ExpYear: uint(time.Now().Year() + 1), CVC: "123"},
+		},
+	})
+	if err != nil {
+		t.Fatalf("failed to authorize, got %v", err)
+	}
+
+	server.InjectFailure("022", paygenttest.Failure{ResponseCode: "P010"})
+	if _, err := client.Capture(response.TransactionID, gomerchant.CaptureParams{}); err == nil {
+		t.Fatalf("capture should fail with injected failure")
+	}
+
+	spans := exporter.GetSpans()
+	if len(spans) != 2 {
+		t.Fatalf("should record a span for each telegram, but got %v", len(spans))
+	}
+
+	authorizeAttrs, captureAttrs := attributes(spans[0].Attributes), attributes(spans[1].Attributes)
+	if spans[0].Name != "paygent.request 020" || authorizeAttrs[telemetry.RequestKindKey] != "020" || authorizeAttrs[telemetry.ResultKey] != "success" {
+		t.Errorf("authorize span is not correct, got %v %v", spans[0].Name, authorizeAttrs)
+	}
+	if captureAttrs[telemetry.ResultKey] != "failure" || captureAttrs[telemetry.ResponseCodeKey] != "P010" || captureAttrs[telemetry.DeclineCategoryKey] != telemetry.CategoryDeclined {
+		t.Errorf("capture span should record failure, got %v", captureAttrs)
+	}
+
+	for _, span := range spans {
+		for _, attr := range span.Attributes {
+			if strings.Contains(attr.Value.Emit(), cardNumber) {
+				t.Errorf("card data should not be recorded, got %v", attr)
+			}
+		}
+	}
+
+	results, histograms := counts(t, reader)
+	if results["request success"] != 1 || results["request failure declined"] != 1 || histograms != 2 {
+		t.Errorf("metrics are not correct, got %v, %v latencies", results, histograms)
+	}
+}
+
+func TestPaygentSpansNestUnderGateway(t *testing.T) {
+	server := paygenttest.NewServer()
+	defer server.Close()
+
+	config, exporter, _ := newConfig()
+	client := server.Paygent()
+	client.Use(telemetry.RequestInterceptor(config, "paygent", paygentResponseCode))
+	gateway := telemetry.NewGateway(client, "paygent", config)
+
+	if _, err := gateway.Authorize(1000, gomerchant.AuthorizeParams{
+		Currency: "JPY",
+		OrderID:  "order-1",
+		PaymentMethod: &gomerchant.PaymentMethod{
+			CreditCard: &gomerchant.CreditCard{Name: "VISA", Number: cardNumber, ExpMonth: 1, ExpYear: uint(time.Now().Year() + 1), CVC: "123"},
+		},
+	}); err != nil {
+		t.Fatalf("failed to authorize, got %v", err)
+	}
+
+	spans := exporter.GetSpans()
+	if len(spans) != 2 || spans[0].Name != "paygent.request 020" || spans[1].Name != "paygent.authorize" {
+		t.Fatalf("should record spans of telegram and operation, got %v", spans.Snapshots())
+	}
+
+	telegram, operation := spans[0], spans[1]
+	if telegram.Parent.SpanID() != operation.SpanContext.SpanID() || telegram.SpanContext.TraceID() != operation.SpanContext.TraceID() {
+		t.Errorf("telegram span should be a child of operation span, got parent %v", telegram.Parent.SpanID())
+	}
+}
+
+func TestGatewayWithContext(t *testing.T) {
+	config, exporter, _ := newConfig()
+	gateway := telemetry.NewGateway(fakeGateway{}, "stripe", config)
+
+	ctx, parent := config.TracerProvider.Tracer("test").Start(context.Background(), "POST /orders")
+	if _, err := gateway.WithContext(ctx).Authorize(1000, gomerchant.AuthorizeParams{}); err != nil {
+		t.Fatalf("failed to authorize, got %v", err)
+	}
+	parent.End()
+
+	if _, err := gateway.Authorize(1000, gomerchant.AuthorizeParams{}); err != nil {
+		t.Fatalf("failed to authorize, got %v", err)
+	}
+
+	spans := exporter.GetSpans()
+	if len(spans) != 3 || spans[0].Name != "stripe.authorize" || spans[0].Parent.SpanID() != parent.SpanContext().SpanID() || spans[0].SpanContext.TraceID() != parent.SpanContext().TraceID() {
+		t.Fatalf("operation span should join trace of caller, got %v", spans.Snapshots())
+	}
+	if spans[2].Parent.IsValid() {
+		t.Errorf("operation span should be a root span without context, got parent %v", spans[2].Parent)
+	}
+}
+
+type fakeGateway struct {
+	gomerchant.PaymentGateway
+	err error
+}
+
+func (gateway fakeGateway) Authorize(amount uint64, params gomerchant.AuthorizeParams) (gomerchant.AuthorizeResponse, error) {
+	return gomerchant.AuthorizeResponse{TransactionID: "ch_1"}, gateway.err
+}
+
+func (gateway fakeGateway) Refund(transactionID string, amount uint, params gomerchant.RefundParams) (gomerchant.RefundResponse, error) {
+	return gomerchant.RefundResponse{TransactionID: transactionID}, gateway.err
+}
+
+func TestGateway(t *testing.T) {
+	config, exporter, reader := newConfig()
+
+	gateway := telemetry.NewGateway(fakeGateway{}, "stripe", config)
+	if response, err := gateway.Authorize(1000, gomerchant.AuthorizeParams{}); err != nil || response.TransactionID != "ch_1" {
+		t.Fatalf("should return response of wrapped gateway, got %+v, %v", response, err)
+	}
+	if _, err := gateway.Refund("ch_1", 100, gomerchant.RefundParams{}); err != nil {
+		t.Fatalf("failed to refund, got %v", err)
+	}
+
+	declined := telemetry.NewGateway(fakeGateway{err: &stripe.Error{Type: stripe.ErrorTypeCard, Code: stripe.ErrorCodeCardDeclined, DeclineCode: "insufficient_funds"}}, "stripe", config)
+	if _, err := declined.Authorize(1000, gomerchant.AuthorizeParams{}); err == nil {
+		t.Fatalf("should return error of wrapped gateway")
+	}
+
+	spans := exporter.GetSpans()
+	if len(spans) != 3 || spans[0].Name != "stripe.authorize" || spans[1].Name != "stripe.refund" {
+		t.Fatalf("should record spans of operations, got %v", spans.Snapshots())
+	}
+	if attrs := attributes(spans[2].Attributes); attrs[telemetry.ResponseCodeKey] != "insufficient_funds" || attrs[telemetry.DeclineCategoryKey] != telemetry.CategoryDeclined {
+		t.Errorf("declined span should record decline code, got %v", attrs)
+	}
+
+	results, histograms := counts(t, reader)
+	if results["authorize success"] != 1 || results["refund success"] != 1 || results["authorize failure declined"] != 1 || histograms != 3 {
+		t.Errorf("metrics are not correct, got %v, %v latencies", results, histograms)
+	}
+}
+
+func TestCategorize(t *testing.T) {
+	tests := []struct {
+		err          error
+		responseCode string
+		category     string
+	}{
+		{gomerchant.ErrCardDeclined, "", telemetry.CategoryDeclined},
+		{gomerchant.ErrInvalidNumber, "", telemetry.CategoryInvalid},
+		{context.DeadlineExceeded, "", telemetry.CategoryTimeout},
+		{&stripe.Error{Type: stripe.ErrorTypeInvalidRequest}, "", telemetry.CategoryInvalid},
+		{&stripe.Error{Type: stripe.ErrorTypeAPIConnection}, "", telemetry.CategoryNetwork},
+		{context.Canceled, "P026", telemetry.CategoryDeclined},
+		{context.Canceled, "", telemetry.CategoryError},
+	}
+
+	for _, test := range tests {
+		if category := telemetry.Categorize(test.err, test.responseCode); category != test.category {
+			t.Errorf("category of %v should be %v, but got %v", test.err, test.category, category)
+		}
+	}
+}
@@ -9,7 +9,13 @@ type Transaction struct {
 	Captured  bool
 	Paid      bool // if authorized or captured
 	Cancelled bool
+	Disputed  bool // customer disputed the transaction, check disputes with DisputeManager
 	Status    string
 	CreatedAt *time.Time
+
+	AVSResult            AVSResult
+	CVCResult            CheckResult
+	NetworkTransactionID string // transaction id of card network, not filled by Paygent and Stripe yet
+	AuthorizationCode    string
 	Params
 }
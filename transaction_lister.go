@@ -0,0 +1,140 @@
+package gomerchant
+
+import (
+	"errors"
+	"time"
+)
+
+// TransactionLister interface, list transactions with filters
+type TransactionLister interface {
+	ListTransactions(params ListTransactionsParams) TransactionIterator
+}
+
+// TransactionStatus normalized transaction status, see StatusOf
+type TransactionStatus string
+
+const (
+	TransactionPending    TransactionStatus = "pending" // not authorized yet, like waiting for 3D Secure or redirect payments
+	TransactionAuthorized TransactionStatus = "authorized"
+	TransactionCaptured   TransactionStatus = "captured"
+	TransactionCancelled  TransactionStatus = "cancelled" // voided or refunded
+)
+
+// StatusOf normalized status of transaction
+func StatusOf(transaction Transaction) TransactionStatus {
+	switch {
+	case transaction.Cancelled:
+		return TransactionCancelled
+	case transaction.Captured:
+		return TransactionCaptured
+	case transaction.Paid:
+		return TransactionAuthorized
+	}
+	return TransactionPending
+}
+
+// ListTransactionsParams list transactions params, transactions match all filters
+type ListTransactionsParams struct {
+	OrderID       string
+	CustomerID    string
+	CreatedAfter  *time.Time // inclusive
+	CreatedBefore *time.Time // exclusive
+	Statuses      []TransactionStatus
+	PageSize      int    // transactions fetched per request, default value of gateway if it is zero
+	Cursor        string // continue from cursor of an iterator
+	Params
+}
+
+// Match check transaction matches date and status filters
+func (params ListTransactionsParams) Match(transaction Transaction) bool {
+	if transaction.CreatedAt != nil {
+		if params.CreatedAfter != nil && transaction.CreatedAt.Before(*params.CreatedAfter) {
+			return false
+		}
+		if params.CreatedBefore != nil && !transaction.CreatedAt.Before(*params.CreatedBefore) {
+			return false
+		}
+	}
+
+	if len(params.Statuses) > 0 {
+		status := StatusOf(transaction)
+		for _, s := range params.Statuses {
+			if s == status {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+// ErrUnsupportedFilter filters are not supported by gateway
+var ErrUnsupportedFilter = errors.New("gomerchant: transaction filter is not supported by gateway")
+
+// TransactionIterator iterate transactions page by page
+//
+//	iter := gateway.ListTransactions(params)
+//	for iter.Next() {
+//		transaction := iter.Transaction()
+//	}
+//	err := iter.Err()
+type TransactionIterator interface {
+	Next() bool
+	Transaction() Transaction
+	Err() error
+	Cursor() string // cursor of current transaction, pass it to ListTransactionsParams to continue
+}
+
+// TransactionPageFunc fetch a page of transactions after cursor, returns next cursor, empty cursor means no more pages
+type TransactionPageFunc func(cursor string) (transactions []Transaction, next string, err error)
+
+// NewTransactionIterator iterator that fetches pages with fetch, transactions that don't match filter are skipped
+func NewTransactionIterator(cursor string, fetch TransactionPageFunc, filter func(Transaction) bool) TransactionIterator {
+	return &pageIterator{next: cursor, fetch: fetch, filter: filter, more: true}
+}
+
+// ErrorIterator iterator that returns err
+func ErrorIterator(err error) TransactionIterator {
+	return &pageIterator{err: err}
+}
+
+type pageIterator struct {
+	fetch   TransactionPageFunc
+	filter  func(Transaction) bool
+	page    []Transaction
+	current Transaction
+	next    string
+	more    bool
+	err     error
+}
+
+func (iter *pageIterator) Next() bool {
+	for iter.err == nil {
+		for len(iter.page) > 0 {
+			iter.current, iter.page = iter.page[0], iter.page[1:]
+			if iter.filter == nil || iter.filter(iter.current) {
+				return true
+			}
+		}
+
+		if !iter.more {
+			return false
+		}
+
+		iter.page, iter.next, iter.err = iter.fetch(iter.next)
+		iter.more = iter.next != ""
+	}
+	return false
+}
+
+func (iter *pageIterator) Transaction() Transaction {
+	return iter.current
+}
+
+func (iter *pageIterator) Err() error {
+	return iter.err
+}
+
+func (iter *pageIterator) Cursor() string {
+	return iter.current.ID
+}
@@ -0,0 +1,83 @@
+package gomerchant
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestTransactionIterator(t *testing.T) {
+	pages := map[string][]Transaction{
+		"":   {{ID: "1", Paid: true}, {ID: "2", Paid: true, Captured: true}},
+		"2":  {{ID: "3", Cancelled: true}, {ID: "4"}},
+		"4":  {{ID: "5", Paid: true}},
+		"xx": {},
+	}
+	fetch := func(cursor string) ([]Transaction, string, error) {
+		page := pages[cursor]
+		if cursor == "4" {
+			return page, "", nil
+		}
+		return page, page[len(page)-1].ID, nil
+	}
+
+	var ids []string
+	iter := NewTransactionIterator("", fetch, ListTransactionsParams{Statuses: []TransactionStatus{TransactionAuthorized, TransactionCancelled}}.Match)
+	for iter.Next() {
+		ids = append(ids, iter.Transaction().ID)
+	}
+
+	if iter.Err() != nil || !reflect.DeepEqual(ids, []string{"1", "3", "5"}) {
+		t.Errorf("should iterate filtered transactions of all pages, got %v, %v", ids, iter.Err())
+	}
+
+	ids = nil
+	iter = NewTransactionIterator("2", fetch, nil)
+	for iter.Next() {
+		ids = append(ids, iter.Transaction().ID)
+	}
+	if !reflect.DeepEqual(ids, []string{"3", "4", "5"}) {
+		t.Errorf("should continue from cursor, got %v", ids)
+	}
+}
+
+func TestTransactionIteratorError(t *testing.T) {
+	failure := errors.New("failure")
+	iter := NewTransactionIterator("", func(cursor string) ([]Transaction, string, error) {
+		return nil, "", failure
+	}, nil)
+
+	if iter.Next() || iter.Err() != failure {
+		t.Errorf("should stop with error, got %v", iter.Err())
+	}
+
+	if iter := ErrorIterator(ErrUnsupportedFilter); iter.Next() || iter.Err() != ErrUnsupportedFilter {
+		t.Errorf("error iterator should return error")
+	}
+}
+
+func TestListTransactionsParamsMatch(t *testing.T) {
+	var (
+		now    = time.Now()
+		before = now.Add(-time.Hour)
+		after  = now.Add(time.Hour)
+	)
+
+	cases := []struct {
+		params ListTransactionsParams
+		match  bool
+	}{
+		{ListTransactionsParams{CreatedAfter: &before, CreatedBefore: &after}, true},
+		{ListTransactionsParams{CreatedAfter: &after}, false},
+		{ListTransactionsParams{CreatedBefore: &now}, false},
+		{ListTransactionsParams{Statuses: []TransactionStatus{TransactionCaptured}}, true},
+		{ListTransactionsParams{Statuses: []TransactionStatus{TransactionAuthorized, TransactionPending}}, false},
+	}
+
+	for idx, c := range cases {
+		if c.params.Match(Transaction{CreatedAt: &now, Paid: true, Captured: true}) != c.match {
+			t.Errorf("#%v: match should be %v", idx, c.match)
+		}
+	}
+}
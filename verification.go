@@ -0,0 +1,77 @@
+package gomerchant
+
+import (
+	"errors"
+	"fmt"
+)
+
+// CheckResult result of a card verification check
+type CheckResult string
+
+const (
+	CheckUnchecked   CheckResult = ""            // not checked or not reported by gateway
+	CheckPass        CheckResult = "pass"        // matched
+	CheckFail        CheckResult = "fail"        // didn't match
+	CheckUnavailable CheckResult = "unavailable" // checked, but issuer doesn't support it
+)
+
+// AVSResult result of address verification
+type AVSResult struct {
+	Address    CheckResult // street address, address line 1
+	PostalCode CheckResult
+}
+
+// Failed address or postal code didn't match
+func (result AVSResult) Failed() bool {
+	return result.Address == CheckFail || result.PostalCode == CheckFail
+}
+
+// CheckPolicy void authorizations whose checks failed, checks that are unchecked or unavailable don't fail
+type CheckPolicy struct {
+	VoidOnAddressFailure    bool
+	VoidOnPostalCodeFailure bool
+	VoidOnCVCFailure        bool
+}
+
+// ErrCheckFailed authorization is voided as its check failed
+var ErrCheckFailed = errors.New("gomerchant: card verification check failed")
+
+// Failed failed checks of response that should be voided
+func (policy CheckPolicy) Failed(response AuthorizeResponse) (checks []string) {
+	if policy.VoidOnAddressFailure && response.AVSResult.Address == CheckFail {
+		checks = append(checks, "address")
+	}
+	if policy.VoidOnPostalCodeFailure && response.AVSResult.PostalCode == CheckFail {
+		checks = append(checks, "postal code")
+	}
+	if policy.VoidOnCVCFailure && response.CVCResult == CheckFail {
+		checks = append(checks, "cvc")
+	}
+	return checks
+}
+
+// WithCheckPolicy wrap gateway, authorizations whose checks failed are voided and ErrCheckFailed is returned with the response,
+// so the results and voided transaction id are still available
+func WithCheckPolicy(gateway PaymentGateway, policy CheckPolicy) PaymentGateway {
+	return &checkPolicyGateway{PaymentGateway: gateway, policy: policy}
+}
+
+type checkPolicyGateway struct {
+	PaymentGateway
+	policy CheckPolicy
+}
+
+func (gateway *checkPolicyGateway) Authorize(amount uint64, params AuthorizeParams) (AuthorizeResponse, error) {
+	response, err := gateway.PaymentGateway.Authorize(amount, params)
+	if err != nil || response.TransactionID == "" {
+		return response, err
+	}
+
+	if checks := gateway.policy.Failed(response); len(checks) > 0 {
+		err = fmt.Errorf("%w: %v", ErrCheckFailed, checks)
+		if _, voidErr := gateway.PaymentGateway.Void(response.TransactionID, VoidParams{}); voidErr != nil {
+			err = fmt.Errorf("%w, but failed to void transaction %v: %v", err, response.TransactionID, voidErr)
+		}
+	}
+	return response, err
+}
@@ -0,0 +1,55 @@
+package gomerchant
+
+import (
+	"errors"
+	"testing"
+)
+
+type checkGateway struct {
+	PaymentGateway
+	response AuthorizeResponse
+	voided   []string
+	voidErr  error
+}
+
+func (gateway *checkGateway) Authorize(amount uint64, params AuthorizeParams) (AuthorizeResponse, error) {
+	return gateway.response, nil
+}
+
+func (gateway *checkGateway) Void(transactionID string, params VoidParams) (VoidResponse, error) {
+	gateway.voided = append(gateway.voided, transactionID)
+	return VoidResponse{TransactionID: transactionID}, gateway.voidErr
+}
+
+func TestCheckPolicy(t *testing.T) {
+	policy := CheckPolicy{VoidOnPostalCodeFailure: true, VoidOnCVCFailure: true}
+
+	cases := []struct {
+		response AuthorizeResponse
+		voided   bool
+	}{
+		{AuthorizeResponse{TransactionID: "1", AVSResult: AVSResult{Address: CheckPass, PostalCode: CheckPass}, CVCResult: CheckPass}, false},
+		{AuthorizeResponse{TransactionID: "1", AVSResult: AVSResult{Address: CheckFail, PostalCode: CheckPass}}, false},
+		{AuthorizeResponse{TransactionID: "1", AVSResult: AVSResult{PostalCode: CheckUnavailable}, CVCResult: CheckUnchecked}, false},
+		{AuthorizeResponse{TransactionID: "1", AVSResult: AVSResult{PostalCode: CheckFail}}, true},
+		{AuthorizeResponse{TransactionID: "1", CVCResult: CheckFail}, true},
+	}
+
+	for idx, c := range cases {
+		gateway := &checkGateway{response: c.response}
+		response, err := WithCheckPolicy(gateway, policy).Authorize(1000, AuthorizeParams{})
+
+		if c.voided != (len(gateway.voided) == 1) || c.voided != errors.Is(err, ErrCheckFailed) {
+			t.Errorf("#%v: voided should be %v, but got %v, %v", idx, c.voided, gateway.voided, err)
+		}
+
+		if response.TransactionID != "1" {
+			t.Errorf("#%v: response should be returned", idx)
+		}
+	}
+
+	gateway := &checkGateway{response: AuthorizeResponse{TransactionID: "1", CVCResult: CheckFail}, voidErr: errors.New("timeout")}
+	if _, err := WithCheckPolicy(gateway, policy).Authorize(1000, AuthorizeParams{}); !errors.Is(err, ErrCheckFailed) || err.Error() != "gomerchant: card verification check failed: [cvc], but failed to void transaction 1: timeout" {
+		t.Errorf("should report void failure, got %v", err)
+	}
+}
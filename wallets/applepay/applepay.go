@@ -0,0 +1,326 @@
+// Package applepay verifies and decrypts Apple Pay payment tokens of version EC_v1, for gateways without native Apple Pay support.
+//
+//	decrypter := applepay.New("merchant.com.example", appleRootCA, privateKey)
+//	data, err := decrypter.Decrypt(payment.Token.PaymentData)
+//	paymentMethod, err := data.PaymentMethod()
+//	gateway.Authorize(1000, gomerchant.AuthorizeParams{PaymentMethod: paymentMethod})
+//
+// Payment methods are device tokens authorized with cryptograms, built-in gateways (Paygent, Stripe) don't accept them yet
+// and return gomerchant.ErrNotSupportedPaymentMethod, so use a gateway that authorizes device tokens.
+//
+// https://developer.apple.com/documentation/passkit/payment-token-format-reference
+package applepay
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/qor/gomerchant"
+)
+
+// Version supported version of payment token
+const Version = "EC_v1"
+
+var (
+	// ErrInvalidToken token is malformed
+	ErrInvalidToken = errors.New("applepay: invalid token")
+	// ErrUnsupportedVersion token isn't EC_v1
+	ErrUnsupportedVersion = errors.New("applepay: unsupported version")
+	// ErrInvalidSignature signature doesn't match payment data, or it isn't signed by Apple's certificates
+	ErrInvalidSignature = errors.New("applepay: invalid signature")
+	// ErrExpiredSignature token was signed too long ago, it might be replayed
+	ErrExpiredSignature = errors.New("applepay: signature has expired")
+	// ErrUnknownMerchantKey token is encrypted for a public key that none of private keys match
+	ErrUnknownMerchantKey = errors.New("applepay: unknown merchant key")
+	// ErrDecrypt token couldn't be decrypted
+	ErrDecrypt = errors.New("applepay: failed to decrypt payment data")
+)
+
+// OIDs of Apple's certificates that sign payment tokens
+var (
+	OIDLeafCertificate         = asn1.ObjectIdentifier{1, 2, 840, 113635, 100, 6, 29}
+	OIDIntermediateCertificate = asn1.ObjectIdentifier{1, 2, 840, 113635, 100, 6, 2, 14}
+)
+
+// ParseCertificate parse certificate of PEM or DER, like Apple Root CA - G3 downloaded from https://www.apple.com/certificateauthority/
+func ParseCertificate(data []byte) (*x509.Certificate, error) {
+	if block, _ := pem.Decode(data); block != nil {
+		data = block.Bytes
+	}
+	return x509.ParseCertificate(data)
+}
+
+// ParsePrivateKey parse private key of merchant's payment processing certificate, PKCS #8 or SEC 1 in PEM or DER
+func ParsePrivateKey(data []byte) (*ecdh.PrivateKey, error) {
+	if block, _ := pem.Decode(data); block != nil {
+		data = block.Bytes
+	}
+
+	if key, err := x509.ParseECPrivateKey(data); err == nil {
+		return key.ECDH()
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(data)
+	if err != nil {
+		return nil, err
+	}
+	switch k := parsed.(type) {
+	case *ecdsa.PrivateKey:
+		return k.ECDH()
+	case *ecdh.PrivateKey:
+		return k, nil
+	}
+	return nil, fmt.Errorf("applepay: private key should be an EC key, got %T", parsed)
+}
+
+// Decrypter verifies and decrypts tokens of a merchant
+type Decrypter struct {
+	MerchantID      string             // merchant identifier, like merchant.com.example
+	RootCertificate *x509.Certificate  // Apple Root CA - G3
+	PrivateKeys     []*ecdh.PrivateKey // private keys of payment processing certificates, the one that matches publicKeyHash of token is used
+
+	// SigningTimeTolerance how long ago a token could be signed, default 5 minutes, negative to skip the check
+	SigningTimeTolerance time.Duration
+	Now                  func() time.Time
+}
+
+// New initialize decrypter of merchant
+func New(merchantID string, rootCertificate *x509.Certificate, privateKeys ...*ecdh.PrivateKey) *Decrypter {
+	return &Decrypter{MerchantID: merchantID, RootCertificate: rootCertificate, PrivateKeys: privateKeys}
+}
+
+func (decrypter *Decrypter) now() time.Time {
+	if decrypter.Now != nil {
+		return decrypter.Now()
+	}
+	return time.Now()
+}
+
+// Token payment token, `paymentData` of ApplePayPayment's token
+type Token struct {
+	Version   string `json:"version"`
+	Data      string `json:"data"`
+	Signature string `json:"signature"`
+	Header    struct {
+		EphemeralPublicKey string `json:"ephemeralPublicKey"`
+		PublicKeyHash      string `json:"publicKeyHash"`
+		TransactionID      string `json:"transactionId"`
+		ApplicationData    string `json:"applicationData,omitempty"`
+	} `json:"header"`
+}
+
+// PaymentData decrypted payment data
+type PaymentData struct {
+	ApplicationPrimaryAccountNumber string `json:"applicationPrimaryAccountNumber"` // device PAN
+	ApplicationExpirationDate       string `json:"applicationExpirationDate"`       // YYMMDD
+	CurrencyCode                    string `json:"currencyCode"`
+	TransactionAmount               uint64 `json:"transactionAmount"`
+	CardholderName                  string `json:"cardholderName,omitempty"`
+	DeviceManufacturerIdentifier    string `json:"deviceManufacturerIdentifier"`
+	PaymentDataType                 string `json:"paymentDataType"` // 3DSecure or EMV
+	PaymentData                     struct {
+		OnlinePaymentCryptogram string `json:"onlinePaymentCryptogram,omitempty"`
+		ECIIndicator            string `json:"eciIndicator,omitempty"`
+	} `json:"paymentData"`
+}
+
+// Decrypt verify and decrypt token
+func (decrypter *Decrypter) Decrypt(data []byte) (*PaymentData, error) {
+	var token Token
+	if err := json.Unmarshal(data, &token); err != nil {
+		return nil, ErrInvalidToken
+	}
+	if token.Version != Version {
+		return nil, ErrUnsupportedVersion
+	}
+
+	var (
+		ephemeralPublicKey, err1 = base64.StdEncoding.DecodeString(token.Header.EphemeralPublicKey)
+		ciphertext, err2         = base64.StdEncoding.DecodeString(token.Data)
+		transactionID, err3      = hex.DecodeString(token.Header.TransactionID)
+		applicationData, err4    = hex.DecodeString(token.Header.ApplicationData)
+		publicKeyHash, err5      = base64.StdEncoding.DecodeString(token.Header.PublicKeyHash)
+	)
+	if err := errors.Join(err1, err2, err3, err4, err5); err != nil {
+		return nil, ErrInvalidToken
+	}
+
+	signed := bytes.Join([][]byte{ephemeralPublicKey, ciphertext, transactionID, applicationData}, nil)
+	if err := decrypter.verify(token.Signature, signed); err != nil {
+		return nil, err
+	}
+
+	privateKey, err := decrypter.privateKey(publicKeyHash)
+	if err != nil {
+		return nil, err
+	}
+
+	plaintext, err := decrypter.decrypt(privateKey, ephemeralPublicKey, ciphertext)
+	if err != nil {
+		return nil, err
+	}
+
+	var paymentData PaymentData
+	if err := json.Unmarshal(plaintext, &paymentData); err != nil {
+		return nil, ErrInvalidToken
+	}
+	return &paymentData, nil
+}
+
+// verify verify signature is signed by Apple's leaf certificate that chains to root certificate, and it signs the payment data
+func (decrypter *Decrypter) verify(encoded string, signed []byte) error {
+	der, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return ErrInvalidToken
+	}
+	sig, err := parseSignature(der)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidSignature, err)
+	}
+
+	if decrypter.RootCertificate == nil {
+		return fmt.Errorf("%w: root certificate is not configured", ErrInvalidSignature)
+	}
+	roots, intermediates := x509.NewCertPool(), x509.NewCertPool()
+	roots.AddCert(decrypter.RootCertificate)
+	for _, certificate := range sig.certificates {
+		if certificate != sig.signer {
+			intermediates.AddCert(certificate)
+		}
+	}
+
+	currentTime := sig.signingTime
+	if currentTime.IsZero() {
+		currentTime = decrypter.now()
+	}
+	chains, err := sig.signer.Verify(x509.VerifyOptions{Roots: roots, Intermediates: intermediates, CurrentTime: currentTime, KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageAny}})
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidSignature, err)
+	}
+
+	var valid bool
+	for _, chain := range chains {
+		if len(chain) == 3 && hasExtension(chain[0], OIDLeafCertificate) && hasExtension(chain[1], OIDIntermediateCertificate) {
+			valid = true
+		}
+	}
+	if !valid {
+		return fmt.Errorf("%w: certificates are not Apple Pay's", ErrInvalidSignature)
+	}
+
+	if digest := sha256.Sum256(signed); !bytes.Equal(digest[:], sig.messageDigest) {
+		return fmt.Errorf("%w: message digest doesn't match", ErrInvalidSignature)
+	}
+	if err := sig.signer.CheckSignature(x509.ECDSAWithSHA256, sig.signedAttrs, sig.signature); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidSignature, err)
+	}
+
+	tolerance := decrypter.SigningTimeTolerance
+	if tolerance == 0 {
+		tolerance = 5 * time.Minute
+	}
+	if tolerance > 0 && (sig.signingTime.IsZero() || decrypter.now().Sub(sig.signingTime) > tolerance) {
+		return ErrExpiredSignature
+	}
+	return nil
+}
+
+func hasExtension(certificate *x509.Certificate, oid asn1.ObjectIdentifier) bool {
+	for _, extension := range certificate.Extensions {
+		if extension.Id.Equal(oid) {
+			return true
+		}
+	}
+	return false
+}
+
+// privateKey private key of public key hash, SHA-256 of X.509 SubjectPublicKeyInfo
+func (decrypter *Decrypter) privateKey(publicKeyHash []byte) (*ecdh.PrivateKey, error) {
+	for _, privateKey := range decrypter.PrivateKeys {
+		der, err := x509.MarshalPKIXPublicKey(privateKey.PublicKey())
+		if err != nil {
+			continue
+		}
+		if hash := sha256.Sum256(der); bytes.Equal(hash[:], publicKeyHash) {
+			return privateKey, nil
+		}
+	}
+	return nil, ErrUnknownMerchantKey
+}
+
+// decrypt derive key with ECDH and NIST SP 800-56A concatenation KDF, then decrypt with AES-256-GCM
+func (decrypter *Decrypter) decrypt(privateKey *ecdh.PrivateKey, ephemeralPublicKey, ciphertext []byte) ([]byte, error) {
+	parsed, err := x509.ParsePKIXPublicKey(ephemeralPublicKey)
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+	publicKey, ok := parsed.(*ecdsa.PublicKey)
+	if !ok {
+		return nil, ErrInvalidToken
+	}
+	ecdhPublicKey, err := publicKey.ECDH()
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+
+	sharedSecret, err := privateKey.ECDH(ecdhPublicKey)
+	if err != nil {
+		return nil, ErrDecrypt
+	}
+
+	merchantIDHash := sha256.Sum256([]byte(decrypter.MerchantID))
+	kdf := sha256.New()
+	kdf.Write([]byte{0, 0, 0, 1})
+	kdf.Write(sharedSecret)
+	kdf.Write([]byte("\x0did-aes256-GCM"))
+	kdf.Write([]byte("Apple"))
+	kdf.Write(merchantIDHash[:])
+
+	block, err := aes.NewCipher(kdf.Sum(nil))
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCMWithNonceSize(block, 16)
+	if err != nil {
+		return nil, err
+	}
+	plaintext, err := gcm.Open(nil, make([]byte, 16), ciphertext, nil)
+	if err != nil {
+		return nil, ErrDecrypt
+	}
+	return plaintext, nil
+}
+
+// PaymentMethod device token of decrypted payment data, EMV payment data isn't supported
+func (paymentData PaymentData) PaymentMethod() (*gomerchant.PaymentMethod, error) {
+	if paymentData.PaymentDataType != "3DSecure" {
+		return nil, gomerchant.ErrNotSupportedPaymentMethod
+	}
+
+	token := &gomerchant.DeviceToken{
+		Number:         paymentData.ApplicationPrimaryAccountNumber,
+		Cryptogram:     paymentData.PaymentData.OnlinePaymentCryptogram,
+		ECI:            paymentData.PaymentData.ECIIndicator,
+		CardholderName: paymentData.CardholderName,
+		Wallet:         "apple_pay",
+	}
+	if date := paymentData.ApplicationExpirationDate; len(date) == 6 {
+		year, _ := strconv.ParseUint(date[:2], 10, 16)
+		month, _ := strconv.ParseUint(date[2:4], 10, 8)
+		token.ExpYear, token.ExpMonth = uint(2000+year), uint(month)
+	}
+	return &gomerchant.PaymentMethod{DeviceToken: token}, nil
+}
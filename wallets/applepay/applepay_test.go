@@ -0,0 +1,291 @@
+package applepay_test
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/qor/gomerchant"
+	"github.com/qor/gomerchant/wallets/applepay"
+)
+
+const merchantID = "merchant.com.example"
+
+type certificate struct {
+	*x509.Certificate
+	key *ecdsa.PrivateKey
+}
+
+// newCertificate create certificate signed by parent, or a self-signed root if parent is nil
+func newCertificate(t *testing.T, name string, parent *certificate, oid asn1.ObjectIdentifier) *certificate {
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	serial, _ := rand.Int(rand.Reader, big.NewInt(1<<62))
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().AddDate(1, 0, 0),
+		BasicConstraintsValid: true,
+		IsCA:                  parent == nil || oid.Equal(applepay.OIDIntermediateCertificate),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+	}
+	if oid != nil {
+		template.ExtraExtensions = []pkix.Extension{{Id: oid, Value: []byte{0x05, 0x00}}}
+	}
+
+	issuer, signer := template, key
+	if parent != nil {
+		issuer, signer = parent.Certificate, parent.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, issuer, &key.PublicKey, signer)
+	if err != nil {
+		t.Fatalf("failed to create certificate, got %v", err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	return &certificate{Certificate: cert, key: key}
+}
+
+type attribute struct {
+	Type  asn1.ObjectIdentifier
+	Value asn1.RawValue
+}
+
+func set(values ...[]byte) asn1.RawValue {
+	var content []byte
+	for _, value := range values {
+		content = append(content, value...)
+	}
+	return asn1.RawValue{Class: asn1.ClassUniversal, Tag: asn1.TagSet, IsCompound: true, Bytes: content}
+}
+
+func marshal(value interface{}) []byte {
+	data, err := asn1.Marshal(value)
+	if err != nil {
+		panic(err)
+	}
+	return data
+}
+
+// sign sign content with leaf certificate as PKCS #7 detached signature
+func sign(leaf, intermediate *certificate, content []byte, signingTime time.Time) []byte {
+	digest := sha256.Sum256(content)
+	attributes := [][]byte{
+		marshal(attribute{Type: asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 3}, Value: set(marshal(asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 1}))}),
+		marshal(attribute{Type: asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 5}, Value: set(marshal(signingTime.UTC()))}),
+		marshal(attribute{Type: asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 4}, Value: set(marshal(digest[:]))}),
+	}
+	signedAttrs := set(attributes...)
+	hashed := sha256.Sum256(marshal(signedAttrs))
+	signature, _ := ecdsa.SignASN1(rand.Reader, leaf.key, hashed[:])
+
+	sha256Algorithm := pkix.AlgorithmIdentifier{Algorithm: asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 1}}
+	signedData := marshal(struct {
+		Version          int
+		DigestAlgorithms asn1.RawValue
+		ContentInfo      struct{ ContentType asn1.ObjectIdentifier }
+		Certificates     asn1.RawValue
+		SignerInfos      asn1.RawValue
+	}{
+		Version:          1,
+		DigestAlgorithms: set(marshal(sha256Algorithm)),
+		ContentInfo:      struct{ ContentType asn1.ObjectIdentifier }{asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 1}},
+		Certificates:     asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: append(append([]byte{}, leaf.Raw...), intermediate.Raw...)},
+		SignerInfos: set(marshal(struct {
+			Version               int
+			IssuerAndSerialNumber struct {
+				Issuer       asn1.RawValue
+				SerialNumber *big.Int
+			}
+			DigestAlgorithm           pkix.AlgorithmIdentifier
+			AuthenticatedAttributes   asn1.RawValue
+			DigestEncryptionAlgorithm pkix.AlgorithmIdentifier
+			EncryptedDigest           []byte
+		}{
+			Version: 1,
+			IssuerAndSerialNumber: struct {
+				Issuer       asn1.RawValue
+				SerialNumber *big.Int
+			}{asn1.RawValue{FullBytes: leaf.RawIssuer}, leaf.SerialNumber},
+			DigestAlgorithm:           sha256Algorithm,
+			AuthenticatedAttributes:   asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: signedAttrs.Bytes},
+			DigestEncryptionAlgorithm: pkix.AlgorithmIdentifier{Algorithm: asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 2}},
+			EncryptedDigest:           signature,
+		})),
+	})
+
+	return marshal(struct {
+		ContentType asn1.ObjectIdentifier
+		Content     asn1.RawValue
+	}{asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 2}, asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: signedData}})
+}
+
+type fixture struct {
+	root, intermediate, leaf *certificate
+	merchant                 *ecdh.PrivateKey
+}
+
+func newFixture(t *testing.T) fixture {
+	root := newCertificate(t, "Test Root CA", nil, nil)
+	intermediate := newCertificate(t, "Test Application Integration CA", root, applepay.OIDIntermediateCertificate)
+	leaf := newCertificate(t, "Test Payment Processing", intermediate, applepay.OIDLeafCertificate)
+
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	der, _ := x509.MarshalECPrivateKey(key)
+	merchant, err := applepay.ParsePrivateKey(pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der}))
+	if err != nil {
+		t.Fatalf("failed to parse private key, got %v", err)
+	}
+	return fixture{root: root, intermediate: intermediate, leaf: leaf, merchant: merchant}
+}
+
+type tokenOptions struct {
+	version     string
+	merchantID  string
+	signingTime time.Time
+	tamper      bool
+}
+
+// seal encrypt and sign payment data as Apple Pay does
+func (f fixture) seal(t *testing.T, paymentData map[string]interface{}, options tokenOptions) []byte {
+	if options.version == "" {
+		options.version = "EC_v1"
+	}
+	if options.merchantID == "" {
+		options.merchantID = merchantID
+	}
+	if options.signingTime.IsZero() {
+		options.signingTime = time.Now()
+	}
+
+	ephemeral, _ := ecdh.P256().GenerateKey(rand.Reader)
+	ephemeralPublicKey, _ := x509.MarshalPKIXPublicKey(ephemeral.PublicKey())
+	sharedSecret, _ := ephemeral.ECDH(f.merchant.PublicKey())
+
+	merchantIDHash := sha256.Sum256([]byte(options.merchantID))
+	kdf := sha256.New()
+	kdf.Write([]byte{0, 0, 0, 1})
+	kdf.Write(sharedSecret)
+	kdf.Write(append([]byte{13}, "id-aes256-GCM"...))
+	kdf.Write([]byte("Apple"))
+	kdf.Write(merchantIDHash[:])
+
+	block, _ := aes.NewCipher(kdf.Sum(nil))
+	gcm, _ := cipher.NewGCMWithNonceSize(block, 16)
+	plaintext, _ := json.Marshal(paymentData)
+	ciphertext := gcm.Seal(nil, make([]byte, 16), plaintext, nil)
+
+	transactionID := []byte("transaction-1")
+	signature := sign(f.leaf, f.intermediate, append(append(append([]byte{}, ephemeralPublicKey...), ciphertext...), transactionID...), options.signingTime)
+	if options.tamper {
+		ciphertext[0] ^= 1
+	}
+
+	merchantPublicKey, _ := x509.MarshalPKIXPublicKey(f.merchant.PublicKey())
+	publicKeyHash := sha256.Sum256(merchantPublicKey)
+
+	token, _ := json.Marshal(map[string]interface{}{
+		"version":   options.version,
+		"data":      base64.StdEncoding.EncodeToString(ciphertext),
+		"signature": base64.StdEncoding.EncodeToString(signature),
+		"header": map[string]string{
+			"ephemeralPublicKey": base64.StdEncoding.EncodeToString(ephemeralPublicKey),
+			"publicKeyHash":      base64.StdEncoding.EncodeToString(publicKeyHash[:]),
+			"transactionId":      hex.EncodeToString(transactionID),
+		},
+	})
+	return token
+}
+
+func paymentData(paymentDataType string) map[string]interface{} {
+	return map[string]interface{}{
+		"applicationPrimaryAccountNumber": "4111111111111111",
+		"applicationExpirationDate":       "301231",
+		"currencyCode":                    "392",
+		"transactionAmount":               1000,
+		"deviceManufacturerIdentifier":    "040010030273",
+		"paymentDataType":                 paymentDataType,
+		"paymentData":                     map[string]string{"onlinePaymentCryptogram": "AAAAAA==", "eciIndicator": "7"},
+	}
+}
+
+func TestDecrypt(t *testing.T) {
+	f := newFixture(t)
+	decrypter := applepay.New(merchantID, f.root.Certificate, f.merchant)
+
+	data, err := decrypter.Decrypt(f.seal(t, paymentData("3DSecure"), tokenOptions{}))
+	if err != nil {
+		t.Fatalf("failed to decrypt, got %v", err)
+	}
+	if data.TransactionAmount != 1000 || data.CurrencyCode != "392" {
+		t.Errorf("payment data should be decrypted, got %#v", data)
+	}
+
+	paymentMethod, err := data.PaymentMethod()
+	if err != nil || paymentMethod.DeviceToken == nil {
+		t.Fatalf("payment data should be a device token, got %#v %v", paymentMethod, err)
+	}
+	if token := paymentMethod.DeviceToken; token.Number != "4111111111111111" || token.Cryptogram != "AAAAAA==" || token.ECI != "7" || token.ExpYear != 2030 || token.ExpMonth != 12 || token.Wallet != "apple_pay" {
+		t.Errorf("device token should have device PAN and cryptogram, got %#v", token)
+	}
+
+	data, err = decrypter.Decrypt(f.seal(t, paymentData("EMV"), tokenOptions{}))
+	if err != nil {
+		t.Fatalf("failed to decrypt, got %v", err)
+	}
+	if _, err := data.PaymentMethod(); err != gomerchant.ErrNotSupportedPaymentMethod {
+		t.Errorf("EMV payment data isn't supported, got %v", err)
+	}
+}
+
+func TestInvalidTokens(t *testing.T) {
+	f := newFixture(t)
+	other := newFixture(t)
+
+	// leaf certificate without Apple Pay's OID
+	plain := f
+	plain.leaf = newCertificate(t, "Test Leaf", f.intermediate, nil)
+
+	cases := []struct {
+		name      string
+		decrypter *applepay.Decrypter
+		token     []byte
+		err       error
+	}{
+		{"unsupported version", applepay.New(merchantID, f.root.Certificate, f.merchant), f.seal(t, paymentData("3DSecure"), tokenOptions{version: "RSA_v1"}), applepay.ErrUnsupportedVersion},
+		{"another root", applepay.New(merchantID, other.root.Certificate, f.merchant), f.seal(t, paymentData("3DSecure"), tokenOptions{}), applepay.ErrInvalidSignature},
+		{"leaf without OID", applepay.New(merchantID, f.root.Certificate, f.merchant), plain.seal(t, paymentData("3DSecure"), tokenOptions{}), applepay.ErrInvalidSignature},
+		{"tampered data", applepay.New(merchantID, f.root.Certificate, f.merchant), f.seal(t, paymentData("3DSecure"), tokenOptions{tamper: true}), applepay.ErrInvalidSignature},
+		{"signed long ago", applepay.New(merchantID, f.root.Certificate, f.merchant), f.seal(t, paymentData("3DSecure"), tokenOptions{signingTime: time.Now().Add(-time.Hour)}), applepay.ErrExpiredSignature},
+		{"another merchant key", applepay.New(merchantID, f.root.Certificate, other.merchant), f.seal(t, paymentData("3DSecure"), tokenOptions{}), applepay.ErrUnknownMerchantKey},
+		{"another merchant id", applepay.New("merchant.com.another", f.root.Certificate, f.merchant), f.seal(t, paymentData("3DSecure"), tokenOptions{}), applepay.ErrDecrypt},
+		{"malformed", applepay.New(merchantID, f.root.Certificate, f.merchant), []byte("{"), applepay.ErrInvalidToken},
+	}
+
+	for _, c := range cases {
+		if data, err := c.decrypter.Decrypt(c.token); !errors.Is(err, c.err) {
+			t.Errorf("%v: should fail with %v, got %#v %v", c.name, c.err, data, err)
+		}
+	}
+
+	// signing time check could be skipped, like replaying saved tokens in tests
+	decrypter := applepay.New(merchantID, f.root.Certificate, f.merchant)
+	decrypter.SigningTimeTolerance = -1
+	if _, err := decrypter.Decrypt(f.seal(t, paymentData("3DSecure"), tokenOptions{signingTime: time.Now().Add(-time.Hour)})); err != nil {
+		t.Errorf("signing time should not be checked, got %v", err)
+	}
+}
@@ -0,0 +1,121 @@
+package applepay
+
+import (
+	"bytes"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"math/big"
+	"time"
+)
+
+// minimal PKCS #7 SignedData with detached content, as Apple Pay signs payment data with it
+// https://datatracker.ietf.org/doc/html/rfc2315#section-9.1
+
+var (
+	oidSignedData    = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 2}
+	oidMessageDigest = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 4}
+	oidSigningTime   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 5}
+)
+
+type contentInfo struct {
+	ContentType asn1.ObjectIdentifier
+	Content     asn1.RawValue `asn1:"optional,tag:0"` // [0] EXPLICIT, its bytes are the content
+}
+
+type signedData struct {
+	Version          int
+	DigestAlgorithms []pkix.AlgorithmIdentifier `asn1:"set"`
+	ContentInfo      contentInfo
+	Certificates     asn1.RawValue `asn1:"optional,tag:0"`
+	CRLs             asn1.RawValue `asn1:"optional,tag:1"`
+	SignerInfos      []signerInfo  `asn1:"set"`
+}
+
+type issuerAndSerialNumber struct {
+	Issuer       asn1.RawValue
+	SerialNumber *big.Int
+}
+
+type signerInfo struct {
+	Version                   int
+	IssuerAndSerialNumber     issuerAndSerialNumber
+	DigestAlgorithm           pkix.AlgorithmIdentifier
+	AuthenticatedAttributes   asn1.RawValue `asn1:"optional,tag:0"`
+	DigestEncryptionAlgorithm pkix.AlgorithmIdentifier
+	EncryptedDigest           []byte
+	UnauthenticatedAttributes asn1.RawValue `asn1:"optional,tag:1"`
+}
+
+type attribute struct {
+	Type  asn1.ObjectIdentifier
+	Value asn1.RawValue // SET of values
+}
+
+// signature parsed signature of payment data
+type signature struct {
+	certificates  []*x509.Certificate
+	signer        *x509.Certificate
+	messageDigest []byte
+	signingTime   time.Time
+	signedAttrs   []byte // DER of authenticated attributes, as a SET
+	signature     []byte
+}
+
+func parseSignature(der []byte) (*signature, error) {
+	var info contentInfo
+	if rest, err := asn1.Unmarshal(der, &info); err != nil || len(rest) > 0 || !info.ContentType.Equal(oidSignedData) {
+		return nil, errors.New("applepay: signature should be PKCS #7 signed data")
+	}
+
+	var signed signedData
+	if _, err := asn1.Unmarshal(info.Content.Bytes, &signed); err != nil {
+		return nil, err
+	}
+	if len(signed.SignerInfos) != 1 {
+		return nil, errors.New("applepay: signature should have one signer")
+	}
+
+	certificates, err := x509.ParseCertificates(signed.Certificates.Bytes)
+	if err != nil {
+		return nil, err
+	}
+
+	signer := signed.SignerInfos[0]
+	result := &signature{certificates: certificates, signature: signer.EncryptedDigest}
+	for _, certificate := range certificates {
+		if certificate.SerialNumber.Cmp(signer.IssuerAndSerialNumber.SerialNumber) == 0 && bytes.Equal(certificate.RawIssuer, signer.IssuerAndSerialNumber.Issuer.FullBytes) {
+			result.signer = certificate
+		}
+	}
+	if result.signer == nil {
+		return nil, errors.New("applepay: signer certificate is not found")
+	}
+
+	if len(signer.AuthenticatedAttributes.FullBytes) == 0 {
+		return nil, errors.New("applepay: signature should have signed attributes")
+	}
+	// attributes are signed as SET OF, not the implicit [0] tag
+	result.signedAttrs = append([]byte{0x31}, signer.AuthenticatedAttributes.FullBytes[1:]...)
+
+	for rest := signer.AuthenticatedAttributes.Bytes; len(rest) > 0; {
+		var attr attribute
+		if rest, err = asn1.Unmarshal(rest, &attr); err != nil {
+			return nil, err
+		}
+		switch {
+		case attr.Type.Equal(oidMessageDigest):
+			_, err = asn1.Unmarshal(attr.Value.Bytes, &result.messageDigest)
+		case attr.Type.Equal(oidSigningTime):
+			_, err = asn1.Unmarshal(attr.Value.Bytes, &result.signingTime)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	if result.messageDigest == nil {
+		return nil, errors.New("applepay: signature should have message digest")
+	}
+	return result, nil
+}
@@ -0,0 +1,349 @@
+// Package googlepay verifies and decrypts Google Pay payment method tokens of protocol ECv2, for gateways without native Google Pay support.
+//
+//	decrypter := googlepay.New("12345678901234567890", rootKeys, privateKey)
+//	message, err := decrypter.Decrypt(paymentData.PaymentMethodData.TokenizationData.Token)
+//	paymentMethod, err := message.PaymentMethod()
+//	gateway.Authorize(1000, gomerchant.AuthorizeParams{PaymentMethod: paymentMethod})
+//
+// PAN_ONLY cards are credit cards that could be authorized by any gateway. CRYPTOGRAM_3DS cards are network tokens,
+// built-in gateways (Paygent, Stripe) don't accept cryptograms and return gomerchant.ErrNotSupportedPaymentMethod for them,
+// so set allowedAuthMethods to PAN_ONLY in Google Pay requests unless your gateway authorizes network tokens.
+//
+// https://developers.google.com/pay/api/web/guides/resources/payment-data-cryptography
+package googlepay
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/hkdf"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/qor/gomerchant"
+)
+
+// ProtocolVersion supported protocol version
+const ProtocolVersion = "ECv2"
+
+// URLs of Google's root signing keys, they should be cached as Cache-Control of responses, and refreshed periodically
+const (
+	TestRootKeysURL       = "https://payments.developers.google.com/paymentmethodtoken/test/keys.json"
+	ProductionRootKeysURL = "https://payments.developers.google.com/paymentmethodtoken/keys.json"
+)
+
+const senderID = "Google"
+
+var (
+	// ErrInvalidToken token is malformed
+	ErrInvalidToken = errors.New("googlepay: invalid token")
+	// ErrUnsupportedProtocol token isn't ECv2
+	ErrUnsupportedProtocol = errors.New("googlepay: unsupported protocol version")
+	// ErrInvalidSignature signatures of intermediate signing key or message are invalid
+	ErrInvalidSignature = errors.New("googlepay: invalid signature")
+	// ErrExpiredKey intermediate signing key has expired
+	ErrExpiredKey = errors.New("googlepay: intermediate signing key has expired")
+	// ErrDecrypt message couldn't be decrypted with any private key
+	ErrDecrypt = errors.New("googlepay: failed to decrypt message")
+	// ErrExpiredMessage decrypted message has expired
+	ErrExpiredMessage = errors.New("googlepay: message has expired")
+)
+
+// RootKey Google's root signing key
+type RootKey struct {
+	KeyValue        string `json:"keyValue"` // base64 of X.509 SubjectPublicKeyInfo of ECDSA P-256 key
+	ProtocolVersion string `json:"protocolVersion"`
+	KeyExpiration   string `json:"keyExpiration,omitempty"` // milliseconds since epoch, blank if it doesn't expire
+}
+
+// ParseRootKeys parse keys.json of Google's root signing keys
+func ParseRootKeys(data []byte) ([]RootKey, error) {
+	var keys struct {
+		Keys []RootKey `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &keys); err != nil {
+		return nil, err
+	}
+	return keys.Keys, nil
+}
+
+// ParsePrivateKey parse merchant's private key, base64 of PKCS #8 like Google's guide generates, or its DER
+func ParsePrivateKey(key string) (*ecdh.PrivateKey, error) {
+	der, err := base64.StdEncoding.DecodeString(key)
+	if err != nil {
+		der = []byte(key)
+	}
+
+	parsed, err := x509.ParsePKCS8PrivateKey(der)
+	if err != nil {
+		return nil, err
+	}
+	switch k := parsed.(type) {
+	case *ecdsa.PrivateKey:
+		return k.ECDH()
+	case *ecdh.PrivateKey:
+		return k, nil
+	}
+	return nil, fmt.Errorf("googlepay: private key should be an EC key, got %T", parsed)
+}
+
+// Decrypter verifies and decrypts tokens of a merchant
+type Decrypter struct {
+	RecipientID string             // "merchant:<merchant id>" of Google Pay Business Console, or "gateway:<gateway id>"
+	RootKeys    []RootKey          // Google's root signing keys
+	PrivateKeys []*ecdh.PrivateKey // merchant's private keys, all of them are tried, so keys could be rotated
+	Now         func() time.Time
+}
+
+// New initialize decrypter of merchant
+func New(merchantID string, rootKeys []RootKey, privateKeys ...*ecdh.PrivateKey) *Decrypter {
+	return &Decrypter{RecipientID: "merchant:" + merchantID, RootKeys: rootKeys, PrivateKeys: privateKeys}
+}
+
+func (decrypter *Decrypter) now() time.Time {
+	if decrypter.Now != nil {
+		return decrypter.Now()
+	}
+	return time.Now()
+}
+
+// Token payment method token
+type Token struct {
+	ProtocolVersion        string `json:"protocolVersion"`
+	Signature              string `json:"signature"`
+	IntermediateSigningKey struct {
+		SignedKey  string   `json:"signedKey"`
+		Signatures []string `json:"signatures"`
+	} `json:"intermediateSigningKey"`
+	SignedMessage string `json:"signedMessage"`
+}
+
+type signedKey struct {
+	KeyValue      string `json:"keyValue"`
+	KeyExpiration string `json:"keyExpiration"`
+}
+
+type signedMessage struct {
+	EncryptedMessage   string `json:"encryptedMessage"`
+	EphemeralPublicKey string `json:"ephemeralPublicKey"`
+	Tag                string `json:"tag"`
+}
+
+// Message decrypted message
+type Message struct {
+	GatewayMerchantID    string               `json:"gatewayMerchantId"`
+	MessageExpiration    string               `json:"messageExpiration"`
+	MessageID            string               `json:"messageId"`
+	PaymentMethodType    string               `json:"paymentMethod"` // CARD
+	PaymentMethodDetails PaymentMethodDetails `json:"paymentMethodDetails"`
+}
+
+// PaymentMethodDetails card of decrypted message
+type PaymentMethodDetails struct {
+	AuthMethod      string `json:"authMethod"` // PAN_ONLY or CRYPTOGRAM_3DS
+	PAN             string `json:"pan"`        // card number, or network token if auth method is CRYPTOGRAM_3DS
+	ExpirationMonth uint   `json:"expirationMonth"`
+	ExpirationYear  uint   `json:"expirationYear"`
+	Cryptogram      string `json:"cryptogram,omitempty"`
+	ECIIndicator    string `json:"eciIndicator,omitempty"`
+	CardholderName  string `json:"cardholderName,omitempty"`
+}
+
+// Decrypt verify and decrypt token, it is `paymentMethodData.tokenizationData.token` of Google Pay's PaymentData
+func (decrypter *Decrypter) Decrypt(data []byte) (*Message, error) {
+	var token Token
+	if err := json.Unmarshal(data, &token); err != nil {
+		return nil, ErrInvalidToken
+	}
+	if token.ProtocolVersion != ProtocolVersion {
+		return nil, ErrUnsupportedProtocol
+	}
+
+	intermediateKey, err := decrypter.verifyIntermediateSigningKey(token)
+	if err != nil {
+		return nil, err
+	}
+
+	signature, err := base64.StdEncoding.DecodeString(token.Signature)
+	if err != nil || !ecdsa.VerifyASN1(intermediateKey, digest(senderID, decrypter.RecipientID, ProtocolVersion, token.SignedMessage), signature) {
+		return nil, ErrInvalidSignature
+	}
+
+	var signed signedMessage
+	if err := json.Unmarshal([]byte(token.SignedMessage), &signed); err != nil {
+		return nil, ErrInvalidToken
+	}
+
+	plaintext, err := decrypter.decrypt(signed)
+	if err != nil {
+		return nil, err
+	}
+
+	var message Message
+	if err := json.Unmarshal(plaintext, &message); err != nil {
+		return nil, ErrInvalidToken
+	}
+	if expired(message.MessageExpiration, decrypter.now()) {
+		return nil, ErrExpiredMessage
+	}
+	return &message, nil
+}
+
+// verifyIntermediateSigningKey verify intermediate signing key is signed by any root key, and it doesn't expire
+func (decrypter *Decrypter) verifyIntermediateSigningKey(token Token) (*ecdsa.PublicKey, error) {
+	var (
+		now      = decrypter.now()
+		hashed   = digest(senderID, ProtocolVersion, token.IntermediateSigningKey.SignedKey)
+		verified bool
+	)
+
+	for _, rootKey := range decrypter.RootKeys {
+		if rootKey.ProtocolVersion != ProtocolVersion || (rootKey.KeyExpiration != "" && expired(rootKey.KeyExpiration, now)) {
+			continue
+		}
+		publicKey, err := parsePublicKey(rootKey.KeyValue)
+		if err != nil {
+			continue
+		}
+		for _, s := range token.IntermediateSigningKey.Signatures {
+			if signature, err := base64.StdEncoding.DecodeString(s); err == nil && ecdsa.VerifyASN1(publicKey, hashed, signature) {
+				verified = true
+			}
+		}
+	}
+	if !verified {
+		return nil, ErrInvalidSignature
+	}
+
+	var key signedKey
+	if err := json.Unmarshal([]byte(token.IntermediateSigningKey.SignedKey), &key); err != nil {
+		return nil, ErrInvalidToken
+	}
+	if expired(key.KeyExpiration, now) {
+		return nil, ErrExpiredKey
+	}
+	publicKey, err := parsePublicKey(key.KeyValue)
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+	return publicKey, nil
+}
+
+// decrypt derive keys with ECDH and HKDF, verify tag with HMAC-SHA256, then decrypt with AES-256-CTR
+func (decrypter *Decrypter) decrypt(signed signedMessage) ([]byte, error) {
+	ephemeralPublicKey, err := base64.StdEncoding.DecodeString(signed.EphemeralPublicKey)
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+	ciphertext, err := base64.StdEncoding.DecodeString(signed.EncryptedMessage)
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+	tag, err := base64.StdEncoding.DecodeString(signed.Tag)
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+
+	publicKey, err := ecdh.P256().NewPublicKey(ephemeralPublicKey)
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+
+	for _, privateKey := range decrypter.PrivateKeys {
+		sharedSecret, err := privateKey.ECDH(publicKey)
+		if err != nil {
+			continue
+		}
+
+		keys, err := hkdf.Key(sha256.New, append(append([]byte{}, ephemeralPublicKey...), sharedSecret...), make([]byte, 32), senderID, 64)
+		if err != nil {
+			continue
+		}
+
+		mac := hmac.New(sha256.New, keys[32:])
+		mac.Write(ciphertext)
+		if hmac.Equal(mac.Sum(nil), tag) {
+			return aesCTR(keys[:32], ciphertext)
+		}
+	}
+	return nil, ErrDecrypt
+}
+
+// PaymentMethod payment method of decrypted card, a credit card for PAN_ONLY, a network token for CRYPTOGRAM_3DS
+func (message Message) PaymentMethod() (*gomerchant.PaymentMethod, error) {
+	details := message.PaymentMethodDetails
+	if message.PaymentMethodType != "CARD" {
+		return nil, gomerchant.ErrNotSupportedPaymentMethod
+	}
+
+	switch details.AuthMethod {
+	case "PAN_ONLY":
+		return &gomerchant.PaymentMethod{CreditCard: &gomerchant.CreditCard{
+			Name:     details.CardholderName,
+			Number:   details.PAN,
+			ExpMonth: details.ExpirationMonth,
+			ExpYear:  details.ExpirationYear,
+		}}, nil
+	case "CRYPTOGRAM_3DS":
+		return &gomerchant.PaymentMethod{NetworkToken: &gomerchant.NetworkToken{
+			Number:     details.PAN,
+			ExpMonth:   details.ExpirationMonth,
+			ExpYear:    details.ExpirationYear,
+			Cryptogram: details.Cryptogram,
+			ECI:        details.ECIIndicator,
+			Wallet:     "google_pay",
+		}}, nil
+	}
+	return nil, gomerchant.ErrNotSupportedPaymentMethod
+}
+
+// digest SHA-256 of length-prefixed values, lengths are 4 bytes little-endian
+func digest(values ...string) []byte {
+	h := sha256.New()
+	for _, value := range values {
+		binary.Write(h, binary.LittleEndian, uint32(len(value)))
+		h.Write([]byte(value))
+	}
+	return h.Sum(nil)
+}
+
+// aesCTR decrypt with zero IV, keys are only used once
+func aesCTR(key, ciphertext []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	plaintext := make([]byte, len(ciphertext))
+	cipher.NewCTR(block, make([]byte, aes.BlockSize)).XORKeyStream(plaintext, ciphertext)
+	return plaintext, nil
+}
+
+func parsePublicKey(value string) (*ecdsa.PublicKey, error) {
+	der, err := base64.StdEncoding.DecodeString(value)
+	if err != nil {
+		return nil, err
+	}
+	key, err := x509.ParsePKIXPublicKey(der)
+	if err != nil {
+		return nil, err
+	}
+	if publicKey, ok := key.(*ecdsa.PublicKey); ok {
+		return publicKey, nil
+	}
+	return nil, fmt.Errorf("googlepay: public key should be an ECDSA key, got %T", key)
+}
+
+// expired milliseconds since epoch is before now, invalid values are expired
+func expired(milliseconds string, now time.Time) bool {
+	ms, err := strconv.ParseInt(milliseconds, 10, 64)
+	return err != nil || now.After(time.UnixMilli(ms))
+}
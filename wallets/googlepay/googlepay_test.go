@@ -0,0 +1,207 @@
+package googlepay_test
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hkdf"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/qor/gomerchant/wallets/googlepay"
+)
+
+const merchantID = "12345678901234567890"
+
+// keys locally generated keys of Google and merchant
+type keys struct {
+	root         *ecdsa.PrivateKey
+	intermediate *ecdsa.PrivateKey
+	merchant     *ecdh.PrivateKey
+}
+
+func newKeys(t *testing.T) keys {
+	root, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	intermediate, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+
+	// merchant key is generated as PKCS #8 like Google's guide
+	merchant, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	der, _ := x509.MarshalPKCS8PrivateKey(merchant)
+	privateKey, err := googlepay.ParsePrivateKey(base64.StdEncoding.EncodeToString(der))
+	if err != nil {
+		t.Fatalf("failed to parse private key, got %v", err)
+	}
+	return keys{root: root, intermediate: intermediate, merchant: privateKey}
+}
+
+func (k keys) rootKeys() []googlepay.RootKey {
+	return []googlepay.RootKey{{KeyValue: publicKey(&k.root.PublicKey), ProtocolVersion: "ECv2", KeyExpiration: milliseconds(time.Now().AddDate(1, 0, 0))}}
+}
+
+func publicKey(key *ecdsa.PublicKey) string {
+	der, _ := x509.MarshalPKIXPublicKey(key)
+	return base64.StdEncoding.EncodeToString(der)
+}
+
+func milliseconds(t time.Time) string {
+	return fmt.Sprint(t.UnixMilli())
+}
+
+func signedString(values ...string) []byte {
+	var data []byte
+	for _, value := range values {
+		data = binary.LittleEndian.AppendUint32(data, uint32(len(value)))
+		data = append(data, value...)
+	}
+	hashed := sha256.Sum256(data)
+	return hashed[:]
+}
+
+func sign(key *ecdsa.PrivateKey, values ...string) string {
+	signature, _ := ecdsa.SignASN1(rand.Reader, key, signedString(values...))
+	return base64.StdEncoding.EncodeToString(signature)
+}
+
+type tokenOptions struct {
+	protocolVersion   string
+	recipientID       string
+	keyExpiration     time.Time
+	messageExpiration time.Time
+	tamperTag         bool
+}
+
+// seal encrypt and sign message as Google Pay does
+func (k keys) seal(t *testing.T, message map[string]interface{}, options tokenOptions) []byte {
+	if options.protocolVersion == "" {
+		options.protocolVersion = "ECv2"
+	}
+	if options.recipientID == "" {
+		options.recipientID = "merchant:" + merchantID
+	}
+	if options.keyExpiration.IsZero() {
+		options.keyExpiration = time.Now().Add(time.Hour)
+	}
+	if options.messageExpiration.IsZero() {
+		options.messageExpiration = time.Now().Add(time.Hour)
+	}
+	message["messageExpiration"] = milliseconds(options.messageExpiration)
+	plaintext, _ := json.Marshal(message)
+
+	ephemeral, _ := ecdh.P256().GenerateKey(rand.Reader)
+	sharedSecret, _ := ephemeral.ECDH(k.merchant.PublicKey())
+	ephemeralPublicKey := ephemeral.PublicKey().Bytes()
+	derived, err := hkdf.Key(sha256.New, append(append([]byte{}, ephemeralPublicKey...), sharedSecret...), make([]byte, 32), "Google", 64)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	block, _ := aes.NewCipher(derived[:32])
+	ciphertext := make([]byte, len(plaintext))
+	cipher.NewCTR(block, make([]byte, aes.BlockSize)).XORKeyStream(ciphertext, plaintext)
+	mac := hmac.New(sha256.New, derived[32:])
+	mac.Write(ciphertext)
+	tag := mac.Sum(nil)
+	if options.tamperTag {
+		tag[0] ^= 1
+	}
+
+	signedMessage, _ := json.Marshal(map[string]string{
+		"encryptedMessage":   base64.StdEncoding.EncodeToString(ciphertext),
+		"ephemeralPublicKey": base64.StdEncoding.EncodeToString(ephemeralPublicKey),
+		"tag":                base64.StdEncoding.EncodeToString(tag),
+	})
+	signedKey, _ := json.Marshal(map[string]string{"keyValue": publicKey(&k.intermediate.PublicKey), "keyExpiration": milliseconds(options.keyExpiration)})
+
+	token, _ := json.Marshal(map[string]interface{}{
+		"protocolVersion": options.protocolVersion,
+		"signature":       sign(k.intermediate, "Google", options.recipientID, options.protocolVersion, string(signedMessage)),
+		"intermediateSigningKey": map[string]interface{}{
+			"signedKey":  string(signedKey),
+			"signatures": []string{sign(k.root, "Google", options.protocolVersion, string(signedKey))},
+		},
+		"signedMessage": string(signedMessage),
+	})
+	return token
+}
+
+func card(authMethod string) map[string]interface{} {
+	details := map[string]interface{}{"authMethod": authMethod, "pan": "4111111111111111", "expirationMonth": 12, "expirationYear": 2030}
+	if authMethod == "CRYPTOGRAM_3DS" {
+		details["cryptogram"] = "AAAAAA=="
+		details["eciIndicator"] = "05"
+	}
+	return map[string]interface{}{"messageId": "message-1", "paymentMethod": "CARD", "paymentMethodDetails": details, "gatewayMerchantId": "gateway-1"}
+}
+
+func TestDecrypt(t *testing.T) {
+	k := newKeys(t)
+	decrypter := googlepay.New(merchantID, k.rootKeys(), k.merchant)
+
+	message, err := decrypter.Decrypt(k.seal(t, card("PAN_ONLY"), tokenOptions{}))
+	if err != nil {
+		t.Fatalf("failed to decrypt, got %v", err)
+	}
+	if message.MessageID != "message-1" || message.GatewayMerchantID != "gateway-1" {
+		t.Errorf("message should be decrypted, got %#v", message)
+	}
+	if paymentMethod, err := message.PaymentMethod(); err != nil || paymentMethod.CreditCard == nil || paymentMethod.CreditCard.Number != "4111111111111111" || paymentMethod.CreditCard.ExpYear != 2030 {
+		t.Errorf("PAN_ONLY should be a credit card, got %#v %v", paymentMethod, err)
+	}
+
+	message, err = decrypter.Decrypt(k.seal(t, card("CRYPTOGRAM_3DS"), tokenOptions{}))
+	if err != nil {
+		t.Fatalf("failed to decrypt, got %v", err)
+	}
+	paymentMethod, err := message.PaymentMethod()
+	if err != nil || paymentMethod.NetworkToken == nil {
+		t.Fatalf("CRYPTOGRAM_3DS should be a network token, got %#v %v", paymentMethod, err)
+	}
+	if token := paymentMethod.NetworkToken; token.Number != "4111111111111111" || token.Cryptogram != "AAAAAA==" || token.ECI != "05" || token.ExpMonth != 12 || token.Wallet != "google_pay" {
+		t.Errorf("network token should have cryptogram and ECI, got %#v", token)
+	}
+
+	// rotated keys
+	old, _ := ecdh.P256().GenerateKey(rand.Reader)
+	decrypter.PrivateKeys = []*ecdh.PrivateKey{old, k.merchant}
+	if _, err := decrypter.Decrypt(k.seal(t, card("PAN_ONLY"), tokenOptions{})); err != nil {
+		t.Errorf("all private keys should be tried, got %v", err)
+	}
+}
+
+func TestInvalidTokens(t *testing.T) {
+	k := newKeys(t)
+	other := newKeys(t)
+
+	cases := []struct {
+		name      string
+		decrypter *googlepay.Decrypter
+		token     []byte
+		err       error
+	}{
+		{"unsupported protocol", googlepay.New(merchantID, k.rootKeys(), k.merchant), k.seal(t, card("PAN_ONLY"), tokenOptions{protocolVersion: "ECv1"}), googlepay.ErrUnsupportedProtocol},
+		{"unknown root key", googlepay.New(merchantID, other.rootKeys(), k.merchant), k.seal(t, card("PAN_ONLY"), tokenOptions{}), googlepay.ErrInvalidSignature},
+		{"expired root key", googlepay.New(merchantID, []googlepay.RootKey{{KeyValue: publicKey(&k.root.PublicKey), ProtocolVersion: "ECv2", KeyExpiration: milliseconds(time.Now().Add(-time.Hour))}}, k.merchant), k.seal(t, card("PAN_ONLY"), tokenOptions{}), googlepay.ErrInvalidSignature},
+		{"another recipient", googlepay.New("another", k.rootKeys(), k.merchant), k.seal(t, card("PAN_ONLY"), tokenOptions{}), googlepay.ErrInvalidSignature},
+		{"expired intermediate key", googlepay.New(merchantID, k.rootKeys(), k.merchant), k.seal(t, card("PAN_ONLY"), tokenOptions{keyExpiration: time.Now().Add(-time.Minute)}), googlepay.ErrExpiredKey},
+		{"expired message", googlepay.New(merchantID, k.rootKeys(), k.merchant), k.seal(t, card("PAN_ONLY"), tokenOptions{messageExpiration: time.Now().Add(-time.Minute)}), googlepay.ErrExpiredMessage},
+		{"tampered tag", googlepay.New(merchantID, k.rootKeys(), k.merchant), k.seal(t, card("PAN_ONLY"), tokenOptions{tamperTag: true}), googlepay.ErrDecrypt},
+		{"another merchant key", googlepay.New(merchantID, k.rootKeys(), other.merchant), k.seal(t, card("PAN_ONLY"), tokenOptions{}), googlepay.ErrDecrypt},
+		{"malformed", googlepay.New(merchantID, k.rootKeys(), k.merchant), []byte("{"), googlepay.ErrInvalidToken},
+	}
+
+	for _, c := range cases {
+		if message, err := c.decrypter.Decrypt(c.token); err != c.err {
+			t.Errorf("%v: should fail with %v, got %#v %v", c.name, c.err, message, err)
+		}
+	}
+}